@@ -27,11 +27,13 @@ func main() {
 
 	command := cmd.NewDefaultImgpkgCmd(confUI)
 
-	err := command.Execute()
+	executedCommand, err := command.ExecuteC()
 	if err != nil {
 		confUI.ErrorLinef("Error: %v", err)
 		os.Exit(1)
 	}
 
-	confUI.PrintLinef("Succeeded")
+	if !cmd.PrintsOnlyResult(executedCommand) {
+		confUI.PrintLinef("Succeeded")
+	}
 }
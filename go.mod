@@ -3,13 +3,17 @@ module github.com/k14s/imgpkg
 go 1.13
 
 require (
+	github.com/blang/semver v3.5.1+incompatible
 	github.com/cppforlife/cobrautil v0.0.0-20180924214100-a39a1714c920
 	github.com/cppforlife/go-cli-ui v0.0.0-20200506005011-4268990983cc
+	github.com/docker/cli v0.0.0-20191017083524-a8ff7f821017
 	github.com/ghodss/yaml v1.0.0
 	github.com/google/go-containerregistry v0.1.4
 	github.com/k14s/difflib v0.0.0-20201103203400-90558b9d63e4
 	github.com/onsi/gomega v1.10.0 // indirect
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	golang.org/x/text v0.3.2
 	gopkg.in/yaml.v2 v2.3.0
 )
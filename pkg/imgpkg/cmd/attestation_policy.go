@@ -0,0 +1,113 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+const (
+	AttestationPolicyKind       string = "AttestationPolicy"
+	AttestationPolicyAPIVersion string = "imgpkg.carvel.dev/v1alpha1"
+)
+
+// AttestationPolicy lists requirements for predicate of in-toto attestation (YAML or JSON)
+type AttestationPolicy struct {
+	ApiVersion    string                       `yaml:"apiVersion"`
+	Kind          string                       `yaml:"kind"`
+	PredicateType string                       `yaml:"predicateType"`
+	Predicate     []AttestationPolicyPredicate `yaml:"predicate"`
+}
+
+type AttestationPolicyPredicate struct {
+	// Path is dot separated path of field within predicate (e.g. builder.id)
+	Path string `yaml:"path"`
+	// Value is expected value of field
+	Value *string `yaml:"value"`
+	// Pattern is regular expression matched against value of field
+	Pattern string `yaml:"pattern"`
+
+	patternRegexp *regexp.Regexp
+}
+
+func ReadAttestationPolicyFile(path string) (AttestationPolicy, error) {
+	var policy AttestationPolicy
+
+	err := readPathInto(path, &policy)
+	if err != nil {
+		return AttestationPolicy{}, fmt.Errorf("Reading attestation policy: %s", err)
+	}
+
+	if policy.ApiVersion != AttestationPolicyAPIVersion || policy.Kind != AttestationPolicyKind {
+		return AttestationPolicy{}, fmt.Errorf("Expected attestation policy to have apiVersion '%s' and kind '%s', got '%s' and '%s'",
+			AttestationPolicyAPIVersion, AttestationPolicyKind, policy.ApiVersion, policy.Kind)
+	}
+
+	for i, pred := range policy.Predicate {
+		if len(pred.Path) == 0 {
+			return AttestationPolicy{}, fmt.Errorf("Expected attestation policy predicate %d to specify path", i)
+		}
+		if (pred.Value == nil) == (pred.Pattern == "") {
+			return AttestationPolicy{}, fmt.Errorf("Expected attestation policy predicate '%s' to specify one of value or pattern", pred.Path)
+		}
+		if pred.Pattern != "" {
+			policy.Predicate[i].patternRegexp, err = regexp.Compile(pred.Pattern)
+			if err != nil {
+				return AttestationPolicy{}, fmt.Errorf("Expected attestation policy predicate '%s' to have valid pattern: %s", pred.Path, err)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Check returns error describing first unmet requirement
+func (p AttestationPolicy) Check(statement ctlimg.InTotoStatement) error {
+	if p.PredicateType != "" && statement.PredicateType != p.PredicateType {
+		return fmt.Errorf("Expected predicate type '%s', but was '%s'", p.PredicateType, statement.PredicateType)
+	}
+
+	for _, pred := range p.Predicate {
+		val, found := predicateField(statement.Predicate, pred.Path)
+		if !found {
+			return fmt.Errorf("Expected predicate to have field '%s'", pred.Path)
+		}
+
+		switch {
+		case pred.Value != nil && val != *pred.Value:
+			return fmt.Errorf("Expected predicate field '%s' to be '%s', but was '%s'", pred.Path, *pred.Value, val)
+		case pred.patternRegexp != nil && !pred.patternRegexp.MatchString(val):
+			return fmt.Errorf("Expected predicate field '%s' to match '%s', but was '%s'", pred.Path, pred.Pattern, val)
+		}
+	}
+
+	return nil
+}
+
+// predicateField returns scalar value of field at dot separated path
+func predicateField(predicate map[string]interface{}, path string) (string, bool) {
+	var val interface{} = predicate
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		val, ok = obj[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch typedVal := val.(type) {
+	case map[string]interface{}, []interface{}, nil:
+		return "", false
+	default:
+		return fmt.Sprintf("%v", typedVal), true
+	}
+}
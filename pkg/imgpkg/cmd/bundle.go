@@ -7,7 +7,6 @@ import (
 	"archive/tar"
 	"fmt"
 	"io"
-	"path/filepath"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -16,6 +15,8 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// isBundle checks presence of bundle label; its value is not checked
+// (imgpkg sets it to "true", other tools may write e.g. "True" or "1")
 func isBundle(img v1.Image) (bool, error) {
 	cfg, err := img.ConfigFile()
 	if err != nil {
@@ -26,7 +27,7 @@ func isBundle(img v1.Image) (bool, error) {
 	return present, nil
 }
 
-func GetReferencedImages(bundleRef name.Reference, regOpts image.RegistryOpts) ([]ImageDesc, error) {
+func GetReferencedImages(bundleRef name.Reference, lockLocation ImageLockLocation, regOpts image.RegistryOpts) ([]ImageDesc, error) {
 	reg, err := image.NewRegistry(regOpts)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to create a registry with the options %v: %v", regOpts, err)
@@ -53,12 +54,12 @@ func GetReferencedImages(bundleRef name.Reference, regOpts image.RegistryOpts) (
 		return nil, err
 	}
 
-	if mediaType != types.DockerLayer {
+	if mediaType != types.DockerLayer && mediaType != types.OCILayer && !image.IsUncompressedLayer(mediaType) {
 		return nil, fmt.Errorf("Expected layer to have docker layer media type, was %s", mediaType)
 	}
 
-	// here we know layer is .tgz so decompress and read tar headers
-	unzippedReader, err := layer.Uncompressed()
+	// here we know layer is .tgz (or plain .tar) so read tar headers
+	unzippedReader, err := image.UncompressedContents(layer)
 	if err != nil {
 		return nil, fmt.Errorf("Could not read bundle image layer contents: %v", err)
 	}
@@ -67,23 +68,21 @@ func GetReferencedImages(bundleRef name.Reference, regOpts image.RegistryOpts) (
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
-			return nil, fmt.Errorf("Expected to find .imgpkg/images.yml in bundle image")
+			return nil, fmt.Errorf("Expected to find %s/%s in bundle image", lockLocation.BundleDir, lockLocation.ImageLockFile)
 		}
 
 		if err != nil {
 			return nil, fmt.Errorf("reading tar: %v", err)
 		}
 
-		basename := filepath.Base(header.Name)
-		dirname := filepath.Dir(header.Name)
-		if dirname == BundleDir && basename == ImageLockFile {
+		if lockLocation.MatchesTarEntry(header.Name) {
 			break
 		}
 	}
 
 	imgLock := ImageLock{}
 	if err := yaml.NewDecoder(tarReader).Decode(&imgLock); err != nil {
-		return nil, fmt.Errorf("reading images.yml: %v", err)
+		return nil, fmt.Errorf("reading %s: %v", lockLocation.ImageLockFile, err)
 	}
 
 	return imgLock.Spec.Images, nil
@@ -8,13 +8,25 @@ import (
 )
 
 type BundleFlags struct {
-	Bundle string
+	Bundle        string
+	ImageLockPath string
 }
 
 func (s *BundleFlags) Set(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&s.Bundle, "bundle", "b", "", "Set bundle (example: docker.io/dkalinin/test-content)")
+	s.setImageLockPath(cmd)
 }
 
 func (s *BundleFlags) SetCopy(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&s.Bundle, "bundle", "b", "", "Bundle reference for copying (happens thickly, i.e. bundle image + all referenced images)")
+	s.setImageLockPath(cmd)
+}
+
+func (s *BundleFlags) setImageLockPath(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.ImageLockPath, "bundle-image-lock-path", BundleDir+"/"+ImageLockFile,
+		"Location of images lock file within bundle, useful for older bundle layouts (format: <dir>/<file>)")
+}
+
+func (s *BundleFlags) ImageLockLocation() (ImageLockLocation, error) {
+	return NewImageLockLocation(s.ImageLockPath)
 }
@@ -0,0 +1,48 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestIsBundleChecksLabelPresence(t *testing.T) {
+	testCases := []struct {
+		labelValue string
+		expected   bool
+	}{
+		{"true", true},
+		{"True", true},
+		{"TRUE", true},
+		{"1", true},
+		{"yes", true},
+	}
+
+	for _, tc := range testCases {
+		img := buildImage(t, map[string]string{"file.txt": "content"}, func(cfg *regv1.ConfigFile) {
+			cfg.Config.Labels = map[string]string{ctlimg.BundleConfigLabel: tc.labelValue}
+		})
+
+		isBundle, err := isBundle(img)
+		if err != nil {
+			t.Fatalf("Checking bundle: %s", err)
+		}
+		if isBundle != tc.expected {
+			t.Fatalf("Expected label value '%s' to be detected as bundle: %t, but was %t", tc.labelValue, tc.expected, isBundle)
+		}
+	}
+
+	img := buildImage(t, map[string]string{"file.txt": "content"}, nil)
+
+	isBundle, err := isBundle(img)
+	if err != nil {
+		t.Fatalf("Checking bundle: %s", err)
+	}
+	if isBundle {
+		t.Fatalf("Expected image without label to not be detected as bundle")
+	}
+}
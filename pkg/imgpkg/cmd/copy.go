@@ -11,6 +11,7 @@ import (
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	regname "github.com/google/go-containerregistry/pkg/name"
+	regremtran "github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/k14s/imgpkg/pkg/imgpkg/image"
 	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 	"gopkg.in/yaml.v2"
@@ -28,8 +29,22 @@ type CopyOptions struct {
 	TarFlags        TarFlags
 	RegistryFlags   RegistryFlags
 
-	RepoDst     string
-	Concurrency int
+	RepoDst         string
+	RepoDstTemplate string
+	Concurrency     int
+
+	DownloadConcurrency int
+	UploadConcurrency   int
+
+	AllTags   bool
+	TagFilter string
+
+	Since string
+
+	PruneExtraTags bool
+	DryRun         bool
+
+	CopySignatures bool
 }
 
 func NewCopyOptions(ui ui.UI) *CopyOptions {
@@ -46,7 +61,19 @@ func NewCopyCmd(o *CopyOptions) *cobra.Command {
     imgpkg copy -b dkalinin/app1-bundle --to-tar /Volumes/app1-bundle.tar
 
     # Copy image dkalinin/app1-image to another registry (or repository)
-    imgpkg copy -i dkalinin/app1-image --to-repo internal-registry/app1-image`,
+    imgpkg copy -i dkalinin/app1-image --to-repo internal-registry/app1-image
+
+    # Copy all 1.x tags of image repository dkalinin/app1-image preserving tags
+    imgpkg copy -i dkalinin/app1-image --all-tags --tag-filter 'semver:>=1.0.0 <2.0.0' --to-repo internal-registry/app1-image
+
+    # Copy each image of images lock into repository named after its source repository
+    imgpkg copy --lock images.yml --to-repo-template 'internal-registry/{repo}' --lock-output relocated.yml
+
+    # Copy bundle dkalinin/app1-bundle:v1.1.0 skipping images already copied with v1.0.0
+    imgpkg copy -b dkalinin/app1-bundle:v1.1.0 --since dkalinin/app1-bundle:v1.0.0 --to-repo internal-registry/app1-bundle
+
+    # Copy all repositories under team/ namespace (e.g. team/app1 to internal-registry/mirror/app1)
+    imgpkg copy -i registry.corp.com/team/* --all-tags --to-repo internal-registry/mirror`,
 	}
 
 	o.ImageFlags.SetCopy(cmd)
@@ -56,7 +83,16 @@ func NewCopyCmd(o *CopyOptions) *cobra.Command {
 	o.TarFlags.Set(cmd)
 	o.RegistryFlags.Set(cmd)
 	cmd.Flags().StringVar(&o.RepoDst, "to-repo", "", "Location to upload assets")
+	cmd.Flags().StringVar(&o.RepoDstTemplate, "to-repo-template", "", "Location to upload each image computed from template with {repo} (source repository path) and {name} (image name in images lock) (e.g. internal-registry/{repo})")
 	cmd.Flags().IntVar(&o.Concurrency, "concurrency", 5, "Concurrency")
+	cmd.Flags().IntVar(&o.DownloadConcurrency, "download-concurrency", 0, "Set number of layers downloaded in parallel; only used with --to-tar since copy to repository streams layers while uploading (defaults to --concurrency)")
+	cmd.Flags().IntVar(&o.UploadConcurrency, "upload-concurrency", 0, "Set number of concurrent uploads across images and layers (defaults to --concurrency)")
+	cmd.Flags().BoolVar(&o.AllTags, "all-tags", false, "Copy all tags of image repository preserving tag names (used with -i and --to-repo)")
+	cmd.Flags().StringVar(&o.Since, "since", "", "Skip images referenced by given older bundle that already exist in destination (used with -b and --to-repo) (example: dkalinin/app1-bundle:v1.0.0)")
+	cmd.Flags().BoolVar(&o.PruneExtraTags, "prune-extra-tags", false, "Remove destination tags that are not present in source repository after copying (used with --all-tags)")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Print tags that would be removed by --prune-extra-tags instead of removing them")
+	cmd.Flags().BoolVar(&o.CopySignatures, "copy-signatures", false, "Copy signatures, attestations and SBOMs (cosign sha256-<hex>.sig/.att/.sbom tags) and referrers (sha256-<hex> tag) of copied images")
+	cmd.Flags().StringVar(&o.TagFilter, "tag-filter", "", "Copy only tags matching filter (format: ^v1\\., semver:>=1.0.0) (used with --all-tags)")
 	return cmd
 }
 
@@ -69,17 +105,76 @@ func (o *CopyOptions) Run() error {
 		return fmt.Errorf("Expected either --to-tar or --to-repo")
 	}
 
+	var repoTemplate *RepoTemplate
+
+	if o.RepoDstTemplate != "" {
+		if o.RepoDst != "" {
+			return fmt.Errorf("Expected only one of --to-repo or --to-repo-template")
+		}
+		// Images referenced by bundle are expected to be collocated with bundle
+		if o.BundleFlags.Bundle != "" || IsImageGlob(o.ImageFlags.Image) {
+			return fmt.Errorf("Expected --to-repo-template to not be used with bundles or image patterns")
+		}
+
+		var err error
+
+		repoTemplate, err = NewRepoTemplate(o.RepoDstTemplate)
+		if err != nil {
+			return err
+		}
+	}
+
 	if o.isTarSrc() && o.isTarDst() {
 		return fmt.Errorf("Cannot use tar src with tar dst")
 	}
 
+	if o.AllTags && (o.ImageFlags.Image == "" || !o.isRepoDst()) {
+		return fmt.Errorf("Expected --all-tags to be used only with --image (-i) and --to-repo")
+	}
+
+	if o.TagFilter != "" && !o.AllTags {
+		return fmt.Errorf("Expected --tag-filter to be used with --all-tags")
+	}
+
+	if o.PruneExtraTags && (!o.AllTags || o.RepoDst == "" || IsImageGlob(o.ImageFlags.Image)) {
+		return fmt.Errorf("Expected --prune-extra-tags to be used only with --all-tags and --to-repo (without image patterns)")
+	}
+
+	if o.DryRun && !o.PruneExtraTags {
+		return fmt.Errorf("Expected --dry-run to be used with --prune-extra-tags")
+	}
+
+	if o.CopySignatures && o.isTarSrc() {
+		return fmt.Errorf("Expected --copy-signatures to be used with registry source (signature artifacts found in tar are always copied)")
+	}
+
+	if o.Since != "" && (o.BundleFlags.Bundle == "" || !o.isRepoDst()) {
+		return fmt.Errorf("Expected --since to be used only with --bundle (-b) and --to-repo")
+	}
+
+	if o.DownloadConcurrency < 0 || o.UploadConcurrency < 0 {
+		return fmt.Errorf("Expected --download-concurrency and --upload-concurrency to not be negative")
+	}
+
+	if o.DownloadConcurrency > 0 && !o.isTarDst() {
+		return fmt.Errorf("Expected --download-concurrency to be used only with --to-tar (use --upload-concurrency when copying to repository)")
+	}
+
 	logger := ctlimg.NewLogger(os.Stderr)
 	prefixedLogger := logger.NewPrefixedWriter("copy | ")
-	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts := o.RegistryFlags.AsRegistryOpts()
+	registryOpts.MaxConcurrentUploads = o.uploadConcurrency()
+
+	registry, err := ctlimg.NewRegistry(registryOpts)
 	if err != nil {
-		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+		return fmt.Errorf("Unable to create a registry with the options %v: %v", registryOpts, err)
+	}
+
+	if IsImageGlob(o.ImageFlags.Image) {
+		return o.runImageGlob(registry, prefixedLogger)
 	}
-	imageSet := ImageSet{o.Concurrency, prefixedLogger}
+
+	imageSet := ImageSet{o.uploadConcurrency(), prefixedLogger, o.AllTags, repoTemplate}
 
 	var importRepo regname.Repository
 	var unprocessedImageUrls *UnprocessedImageURLs
@@ -87,11 +182,13 @@ func (o *CopyOptions) Run() error {
 	var processedImages *ProcessedImages
 	switch {
 	case o.isTarSrc():
-		importRepo, err = regname.NewRepository(o.RepoDst)
-		if err != nil {
-			return fmt.Errorf("Building import repository ref: %s", err)
+		if repoTemplate == nil {
+			importRepo, err = regname.NewRepository(o.RepoDst)
+			if err != nil {
+				return fmt.Errorf("Building import repository ref: %s", err)
+			}
 		}
-		tarImageSet := TarImageSet{imageSet, o.Concurrency, prefixedLogger}
+		tarImageSet := TarImageSet{imageSet, o.downloadConcurrency(), prefixedLogger}
 		processedImages, bundleURL, err = tarImageSet.Import(o.TarFlags.TarSrc, importRepo, registry)
 	case o.isRepoSrc() && o.isTarDst():
 		if o.LockOutputFlags.LockFilePath != "" {
@@ -110,7 +207,14 @@ func (o *CopyOptions) Run() error {
 			}
 		}
 
-		tarImageSet := TarImageSet{imageSet, o.Concurrency, prefixedLogger}
+		if o.CopySignatures {
+			err = addSignatureArtifacts(unprocessedImageUrls, registry, prefixedLogger)
+			if err != nil {
+				return fmt.Errorf("Collecting signature artifacts: %s", err)
+			}
+		}
+
+		tarImageSet := TarImageSet{imageSet, o.downloadConcurrency(), prefixedLogger}
 		err = tarImageSet.Export(unprocessedImageUrls, o.TarFlags.TarDst, registry) // download to tar
 	case o.isRepoSrc() && o.isRepoDst():
 		unprocessedImageUrls, bundleURL, err = o.GetUnprocessedImageURLs()
@@ -125,11 +229,54 @@ func (o *CopyOptions) Run() error {
 			}
 		}
 
-		importRepo, err = regname.NewRepository(o.RepoDst)
+		if o.CopySignatures {
+			err = addSignatureArtifacts(unprocessedImageUrls, registry, prefixedLogger)
+			if err != nil {
+				return fmt.Errorf("Collecting signature artifacts: %s", err)
+			}
+		}
+
+		var importRepos []regname.Repository
+
+		if repoTemplate != nil {
+			if bundleURL != "" {
+				return fmt.Errorf("Expected --to-repo-template to not be used with bundles")
+			}
+
+			repoTemplate.names = unprocessedImageUrls
+
+			importRepos, err = templatedImportRepos(unprocessedImageUrls, repoTemplate)
+			if err != nil {
+				return err
+			}
+		} else {
+			importRepo, err = regname.NewRepository(o.RepoDst)
+			if err != nil {
+				return fmt.Errorf("Building import repository ref: %s", err)
+			}
+			importRepos = []regname.Repository{importRepo}
+		}
+
+		if o.Since != "" {
+			unprocessedImageUrls, err = o.skipUnchangedImages(unprocessedImageUrls, bundleURL, importRepo, registry, prefixedLogger)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Single token needs to cover source repositories
+		// for blobs to be mounted into import repository
+		relocateRegistryOpts := registryOpts
+		relocateRegistryOpts.ExtraScopes = append(relocateRegistryOpts.ExtraScopes, relocationScopes(unprocessedImageUrls, importRepos...)...)
+
+		var relocateRegistry ctlimg.Registry
+
+		relocateRegistry, err = ctlimg.NewRegistry(relocateRegistryOpts)
 		if err != nil {
-			return fmt.Errorf("Building import repository ref: %s", err)
+			return fmt.Errorf("Unable to create a registry with the options %v: %v", relocateRegistryOpts, err)
 		}
-		processedImages, err = imageSet.Relocate(unprocessedImageUrls, importRepo, registry)
+
+		processedImages, err = imageSet.Relocate(unprocessedImageUrls, importRepo, relocateRegistry)
 	}
 
 	if err != nil {
@@ -137,10 +284,126 @@ func (o *CopyOptions) Run() error {
 	}
 
 	if o.LockOutputFlags.LockFilePath != "" {
-		err = o.writeLockOutput(processedImages, bundleURL)
+		err = o.writeLockOutput(processedImages, bundleURL, unprocessedImageUrls)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.PruneExtraTags {
+		return o.pruneExtraTags(registry, prefixedLogger)
+	}
+
+	return nil
+}
+
+// runImageGlob copies each repository matching image pattern
+// into its own repository under destination repository
+func (o *CopyOptions) runImageGlob(registry ctlimg.Registry, logger *ctlimg.LoggerPrefixWriter) error {
+	if !o.isRepoDst() {
+		return fmt.Errorf("Expected image pattern to be used only with --to-repo")
+	}
+	if o.LockOutputFlags.LockFilePath != "" {
+		return fmt.Errorf("Lock output is not compatible with image pattern")
+	}
+
+	glob, err := NewImageGlob(o.ImageFlags.Image)
+	if err != nil {
+		return err
+	}
+
+	repos, err := registry.ListRepositories(glob.Registry)
+	if err != nil {
+		return fmt.Errorf("Listing repositories: %s", err)
+	}
+
+	matchedRepos := glob.Match(repos)
+	if len(matchedRepos) == 0 {
+		return fmt.Errorf("Expected to find at least one repository matching '%s', but found none", o.ImageFlags.Image)
+	}
+
+	for _, repo := range matchedRepos {
+		repoOpts := *o
+		repoOpts.ImageFlags.Image = glob.ImageRef(repo)
+		repoOpts.RepoDst = o.RepoDst + "/" + glob.RelativePath(repo)
+
+		logger.WriteStr("copying repository %s to %s\n", repoOpts.ImageFlags.Image, repoOpts.RepoDst)
+
+		err := repoOpts.Run()
+		if err != nil {
+			return fmt.Errorf("Copying repository '%s': %s", repo, err)
+		}
+	}
+
+	return nil
+}
+
+// relocationScopes returns push scopes for import repositories and pull scopes
+// for source repositories within the same registry (blobs can only be mounted within registry)
+func relocationScopes(images *UnprocessedImageURLs, importRepos ...regname.Repository) []string {
+	var scopes []string
+	seen := map[string]bool{}
+	importRegistries := map[string]bool{}
+	importRepoNames := map[string]bool{}
+
+	addScope := func(scope string) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	for _, importRepo := range importRepos {
+		addScope(importRepo.Scope(regremtran.PushScope))
+		importRegistries[importRepo.RegistryStr()] = true
+		importRepoNames[importRepo.Name()] = true
 	}
 
-	return err
+	for _, img := range images.All() {
+		ref, err := regname.ParseReference(img.URL)
+		if err != nil || !importRegistries[ref.Context().RegistryStr()] || importRepoNames[ref.Context().Name()] {
+			continue
+		}
+
+		addScope(ref.Context().Scope(regremtran.PullScope))
+	}
+
+	return scopes
+}
+
+// templatedImportRepos returns import repository of each image (used for token scopes)
+func templatedImportRepos(images *UnprocessedImageURLs, repoTemplate *RepoTemplate) ([]regname.Repository, error) {
+	var importRepos []regname.Repository
+
+	for _, img := range images.All() {
+		ref, err := regname.ParseReference(img.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		importRepo, err := repoTemplate.Repository(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		importRepos = append(importRepos, importRepo)
+	}
+
+	return importRepos, nil
+}
+
+func (o *CopyOptions) downloadConcurrency() int {
+	if o.DownloadConcurrency > 0 {
+		return o.DownloadConcurrency
+	}
+	return o.Concurrency
+}
+
+func (o *CopyOptions) uploadConcurrency() int {
+	if o.UploadConcurrency > 0 {
+		return o.UploadConcurrency
+	}
+	return o.Concurrency
 }
 
 func (o *CopyOptions) isTarSrc() bool {
@@ -156,7 +419,7 @@ func (o *CopyOptions) isTarDst() bool {
 }
 
 func (o *CopyOptions) isRepoDst() bool {
-	return o.RepoDst != ""
+	return o.RepoDst != "" || o.RepoDstTemplate != ""
 }
 
 func (o *CopyOptions) hasOneDest() bool {
@@ -185,6 +448,12 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 	if err != nil {
 		return nil, "", fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
 	}
+
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
+	if err != nil {
+		return nil, "", err
+	}
+
 	switch {
 
 	case o.LockInputFlags.LockFilePath != "":
@@ -219,7 +488,7 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 				return nil, "", fmt.Errorf("Expected image flag when given an image reference. Please run with -i instead of -b, or use -b with a bundle reference")
 			}
 
-			images, err := GetReferencedImages(parsedRef, o.RegistryFlags.AsRegistryOpts())
+			images, err := GetReferencedImages(parsedRef, lockLocation, o.RegistryFlags.AsRegistryOpts())
 			if err != nil {
 				return nil, "", err
 			}
@@ -230,7 +499,8 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 			unprocessedImageURLs.Add(UnprocessedImageURL{URL: bundleRef, Tag: bundleLock.Spec.Image.OriginalTag})
 
 		case lock.Kind == "ImagesLock":
-			imgLock, err := ReadImageLockFile(o.LockInputFlags.LockFilePath)
+			// Images referenced by tag are resolved so that relocated lock is immutable
+			imgLock, err := ReadImageLockFileResolvingTags(o.LockInputFlags.LockFilePath, reg)
 			if err != nil {
 				return nil, "", err
 			}
@@ -245,11 +515,23 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 
 			for _, img := range imgLock.Spec.Images {
 				unprocessedImageURLs.Add(UnprocessedImageURL{URL: img.Image})
+				if img.Name != "" {
+					unprocessedImageURLs.SetName(img.Image, img.Name)
+				}
+				if len(img.Annotations) > 0 {
+					unprocessedImageURLs.SetAnnotations(img.Image, img.Annotations)
+				}
 			}
 		default:
 			return nil, "", fmt.Errorf("Unexpected lock kind, expected bundleLock or imageLock, got: %v", lock.Kind)
 		}
 
+	case o.ImageFlags.Image != "" && o.AllTags:
+		err := o.addAllTagsImageURLs(unprocessedImageURLs, reg)
+		if err != nil {
+			return nil, "", err
+		}
+
 	case o.ImageFlags.Image != "":
 		parsedRef, err := regname.ParseReference(o.ImageFlags.Image)
 		if err != nil {
@@ -325,7 +607,7 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 			return nil, "", fmt.Errorf("Expected image flag when given an image reference. Please run with -i instead of -b, or use -b with a bundle reference")
 		}
 
-		images, err := GetReferencedImages(parsedRef, o.RegistryFlags.AsRegistryOpts())
+		images, err := GetReferencedImages(parsedRef, lockLocation, o.RegistryFlags.AsRegistryOpts())
 		if err != nil {
 			return nil, "", err
 		}
@@ -340,7 +622,53 @@ func (o *CopyOptions) GetUnprocessedImageURLs() (*UnprocessedImageURLs, string,
 	return unprocessedImageURLs, bundleRef, nil
 }
 
-func (o *CopyOptions) writeLockOutput(processedImages *ProcessedImages, bundleURL string) error {
+func (o *CopyOptions) addAllTagsImageURLs(unprocessedImageURLs *UnprocessedImageURLs, reg ctlimg.Registry) error {
+	repo, err := regname.NewRepository(o.ImageFlags.Image)
+	if err != nil {
+		return fmt.Errorf("Expected image to be a repository (without tag or digest) when copying all tags: %s", err)
+	}
+
+	var tagFilter *TagFilter
+	if o.TagFilter != "" {
+		filter, err := NewTagFilter(o.TagFilter)
+		if err != nil {
+			return err
+		}
+		tagFilter = &filter
+	}
+
+	tags, err := reg.ListTags(repo)
+	if err != nil {
+		return fmt.Errorf("Listing tags: %s", err)
+	}
+
+	var matchedTags int
+
+	for _, tag := range tags {
+		if tagFilter != nil && !tagFilter.Matches(tag) {
+			continue
+		}
+
+		desc, err := reg.Generic(repo.Tag(tag))
+		if err != nil {
+			return fmt.Errorf("Resolving tag '%s': %s", tag, err)
+		}
+
+		unprocessedImageURLs.Add(UnprocessedImageURL{URL: repo.Digest(desc.Digest.String()).Name(), Tag: tag})
+		matchedTags++
+	}
+
+	if matchedTags == 0 {
+		return fmt.Errorf("Expected to find at least one tag in repository '%s' matching filter, but found none", repo.Name())
+	}
+
+	return nil
+}
+
+// writeLockOutput writes lock referencing copied images by their destination
+// digest refs; each image of ImagesLock keeps name and annotations of source image
+// (when copied from ImagesLock) and is annotated with its source ref
+func (o *CopyOptions) writeLockOutput(processedImages *ProcessedImages, bundleURL string, unprocessedImageURLs *UnprocessedImageURLs) error {
 
 	var outBytes []byte
 	var err error
@@ -349,12 +677,24 @@ func (o *CopyOptions) writeLockOutput(processedImages *ProcessedImages, bundleUR
 	case "":
 		iLock := ImageLock{ApiVersion: ImageLockAPIVersion, Kind: ImageLockKind}
 		for _, img := range processedImages.All() {
-			iLock.Spec.Images = append(
-				iLock.Spec.Images,
-				ImageDesc{
-					Image: img.Image.URL,
-				},
-			)
+			// Signature artifacts are copied alongside images they refer to
+			if isSignatureArtifactTag(img.UnprocessedImageURL.Tag) {
+				continue
+			}
+
+			desc := ImageDesc{Image: img.Image.URL, Annotations: map[string]string{}}
+
+			// Images imported from tar are not listed as unprocessed
+			if unprocessedImageURLs != nil {
+				desc.Name = unprocessedImageURLs.Name(img.UnprocessedImageURL.URL)
+				for key, val := range unprocessedImageURLs.Annotations(img.UnprocessedImageURL.URL) {
+					desc.Annotations[key] = val
+				}
+			}
+
+			desc.Annotations[CopiedFromAnnotation] = img.UnprocessedImageURL.URL
+
+			iLock.Spec.Images = append(iLock.Spec.Images, desc)
 		}
 
 		outBytes, err = yaml.Marshal(iLock)
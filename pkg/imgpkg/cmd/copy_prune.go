@@ -0,0 +1,70 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// pruneExtraTags removes tags of destination repository that are not present
+// in source repository. Source tags not matched by tag filter are not pruned
+// since they still exist in source repository
+func (o *CopyOptions) pruneExtraTags(registry ctlimg.Registry, logger *ctlimg.LoggerPrefixWriter) error {
+	srcRepo, err := regname.NewRepository(o.ImageFlags.Image)
+	if err != nil {
+		return err
+	}
+
+	dstRepo, err := regname.NewRepository(o.RepoDst)
+	if err != nil {
+		return fmt.Errorf("Building import repository ref: %s", err)
+	}
+
+	srcTags, err := registry.ListTags(srcRepo)
+	if err != nil {
+		return fmt.Errorf("Listing tags of '%s': %s", srcRepo.Name(), err)
+	}
+
+	dstTags, err := registry.ListTags(dstRepo)
+	if err != nil {
+		return fmt.Errorf("Listing tags of '%s': %s", dstRepo.Name(), err)
+	}
+
+	srcTagsSet := map[string]bool{}
+	for _, tag := range srcTags {
+		srcTagsSet[tag] = true
+	}
+
+	var extraTags []string
+
+	for _, tag := range dstTags {
+		if !srcTagsSet[tag] {
+			extraTags = append(extraTags, tag)
+		}
+	}
+
+	sort.Strings(extraTags)
+
+	for _, tag := range extraTags {
+		if o.DryRun {
+			logger.WriteStr("would prune tag %s\n", dstRepo.Tag(tag).Name())
+			continue
+		}
+
+		logger.WriteStr("pruning tag %s\n", dstRepo.Tag(tag).Name())
+
+		err := registry.DeleteTag(dstRepo.Tag(tag))
+		if err != nil {
+			return fmt.Errorf("Pruning tag '%s': %s", dstRepo.Tag(tag).Name(), err)
+		}
+	}
+
+	logger.WriteStr("found %d extra tag(s) in %s\n", len(extraTags), dstRepo.Name())
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regremtran "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// signatureArtifactTagSuffixes are suffixes of tags used by cosign for artifacts
+// associated with an image (e.g. sha256-<hex>.sig); tag without suffix
+// is used by OCI referrers tag schema to list referrers of an image
+var signatureArtifactTagSuffixes = []string{".sig", ".att", ".sbom", ""}
+
+var signatureArtifactTagRegexp = regexp.MustCompile(`^sha(256|512)-[0-9a-f]+(\.sig|\.att|\.sbom)?$`)
+
+// isSignatureArtifactTag checks if tag refers to artifact associated with an image by digest,
+// such artifacts keep their tags when copied since they are discovered by tag
+func isSignatureArtifactTag(tag string) bool {
+	return signatureArtifactTagRegexp.MatchString(tag)
+}
+
+// addSignatureArtifacts adds signatures, attestations, SBOMs and referrers
+// of images found in image repositories, so that they are copied alongside images
+func addSignatureArtifacts(images *UnprocessedImageURLs, registry ctlimg.Registry, logger *ctlimg.LoggerPrefixWriter) error {
+	for _, img := range images.All() {
+		digestRef, err := resolveDigestRef(img.URL, registry)
+		if err != nil {
+			return fmt.Errorf("Resolving image '%s': %s", img.URL, err)
+		}
+
+		referrersTag, err := ctlimg.ReferrersTag(digestRef)
+		if err != nil {
+			return err
+		}
+
+		for _, suffix := range signatureArtifactTagSuffixes {
+			tag := referrersTag.Context().Tag(referrersTag.TagStr() + suffix)
+
+			desc, err := registry.Generic(tag)
+			if err != nil {
+				if isNotFoundErr(err) {
+					continue
+				}
+				return fmt.Errorf("Checking signature artifact '%s': %s", tag.Name(), err)
+			}
+
+			logger.WriteStr("found signature artifact %s\n", tag.Name())
+
+			images.Add(UnprocessedImageURL{URL: tag.Context().Digest(desc.Digest.String()).Name(), Tag: tag.TagStr()})
+		}
+	}
+
+	return nil
+}
+
+func resolveDigestRef(url string, registry ctlimg.Registry) (regname.Digest, error) {
+	ref, err := regname.ParseReference(url)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	if digestRef, ok := ref.(regname.Digest); ok {
+		return digestRef, nil
+	}
+
+	desc, err := registry.Generic(ref)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	return ref.Context().Digest(desc.Digest.String()), nil
+}
+
+func isNotFoundErr(err error) bool {
+	var tranErr *regremtran.Error
+	return errors.As(err, &tranErr) && tranErr.StatusCode == http.StatusNotFound
+}
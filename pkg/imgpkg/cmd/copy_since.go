@@ -0,0 +1,83 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// skipUnchangedImages removes images that are also referenced by older bundle
+// (given via --since) and already exist in import repository, so that only
+// images changed between bundles are copied. Images are matched by digest
+// since referenced images may have been relocated to bundle repository
+func (o *CopyOptions) skipUnchangedImages(images *UnprocessedImageURLs, bundleURL string,
+	importRepo regname.Repository, registry ctlimg.Registry, logger *ctlimg.LoggerPrefixWriter) (*UnprocessedImageURLs, error) {
+
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
+	if err != nil {
+		return nil, err
+	}
+
+	sinceRef, err := regname.ParseReference(o.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	sinceImg, err := registry.Image(sinceRef)
+	if err != nil {
+		return nil, fmt.Errorf("Fetching bundle '%s': %s", sinceRef.Name(), err)
+	}
+
+	isBundle, err := isBundle(sinceImg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isBundle {
+		return nil, fmt.Errorf("Expected --since '%s' to be a bundle", o.Since)
+	}
+
+	sinceImages, err := GetReferencedImages(sinceRef, lockLocation, o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return nil, fmt.Errorf("Reading images referenced by bundle '%s': %s", sinceRef.Name(), err)
+	}
+
+	sinceDigests := map[string]bool{}
+
+	for _, img := range sinceImages {
+		digestRef, err := regname.NewDigest(img.Image)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing image '%s' referenced by bundle '%s': %s", img.Image, sinceRef.Name(), err)
+		}
+		sinceDigests[digestRef.DigestStr()] = true
+	}
+
+	result := NewUnprocessedImageURLs()
+	var skipped int
+
+	for _, img := range images.All() {
+		digestRef, err := regname.NewDigest(img.URL)
+		if img.URL == bundleURL || err != nil || !sinceDigests[digestRef.DigestStr()] {
+			result.Add(img)
+			continue
+		}
+
+		// Unchanged images missing in destination (e.g. deleted) are copied again
+		_, err = registry.Generic(importRepo.Digest(digestRef.DigestStr()))
+		if err != nil {
+			result.Add(img)
+			continue
+		}
+
+		logger.WriteStr("skipping unchanged image %s\n", img.URL)
+		skipped++
+	}
+
+	logger.WriteStr("skipped %d unchanged images since bundle %s\n", skipped, sinceRef.Name())
+
+	return result, nil
+}
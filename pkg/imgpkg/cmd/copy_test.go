@@ -4,8 +4,25 @@
 package cmd
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 func TestMultiDest(t *testing.T) {
@@ -58,3 +75,936 @@ func TestNoSrc(t *testing.T) {
 func TestTarSrcWithTarDst(t *testing.T) {
 	t.Skip("implement the test")
 }
+
+func TestCopyAllTagsWithSemverFilter(t *testing.T) {
+	server := newListingRegistryServer()
+	defer server.Close()
+
+	srcRepo := registryHost(server) + "/src/app"
+	dstRepo := registryHost(server) + "/dst/app"
+
+	for _, tag := range []string{"0.9.0", "1.0.0", "1.2.0", "latest"} {
+		img := buildImage(t, map[string]string{"version": tag}, nil)
+
+		tagRef, err := regname.NewTag(srcRepo + ":" + tag)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tagRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRepo}, RepoDst: dstRepo,
+		Concurrency: 1, AllTags: true, TagFilter: "semver:>=1.0.0"}
+
+	err := copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	dstRef, err := regname.NewRepository(dstRepo)
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	tags, err := regremote.List(dstRef)
+	if err != nil {
+		t.Fatalf("Listing tags: %s", err)
+	}
+
+	sort.Strings(tags)
+
+	if strings.Join(tags, ",") != "1.0.0,1.2.0" {
+		t.Fatalf("Expected only matching tags to be copied, got: %v", tags)
+	}
+
+	for _, tag := range tags {
+		srcTag, err := regname.NewTag(srcRepo + ":" + tag)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		srcDesc, err := regremote.Head(srcTag)
+		if err != nil {
+			t.Fatalf("Getting source descriptor: %s", err)
+		}
+
+		dstDesc, err := regremote.Head(dstRef.Tag(tag))
+		if err != nil {
+			t.Fatalf("Getting destination descriptor: %s", err)
+		}
+
+		if srcDesc.Digest != dstDesc.Digest {
+			t.Fatalf("Expected tag '%s' to point to same digest, got %s and %s", tag, srcDesc.Digest, dstDesc.Digest)
+		}
+	}
+}
+
+func TestCopyAllTagsWithRegexFilter(t *testing.T) {
+	server := newListingRegistryServer()
+	defer server.Close()
+
+	srcRepo := registryHost(server) + "/src/app"
+	dstRepo := registryHost(server) + "/dst/app"
+
+	for _, tag := range []string{"main-1", "main-2", "feature-1"} {
+		tagRef, err := regname.NewTag(srcRepo + ":" + tag)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tagRef, buildImage(t, map[string]string{"tag": tag}, nil))
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRepo}, RepoDst: dstRepo,
+		Concurrency: 1, AllTags: true, TagFilter: "^main-"}
+
+	err := copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	dstRef, err := regname.NewRepository(dstRepo)
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	tags, err := regremote.List(dstRef)
+	if err != nil {
+		t.Fatalf("Listing tags: %s", err)
+	}
+
+	sort.Strings(tags)
+
+	if strings.Join(tags, ",") != "main-1,main-2" {
+		t.Fatalf("Expected only matching tags to be copied, got: %v", tags)
+	}
+}
+
+func TestCopyTagFilterWithoutAllTagsError(t *testing.T) {
+	err := (&CopyOptions{ImageFlags: ImageFlags{Image: "foo"}, RepoDst: "bar", TagFilter: "^v1"}).Run()
+	if err == nil {
+		t.Fatalf("Expected Run() to err")
+	}
+
+	if !strings.Contains(err.Error(), "Expected --tag-filter to be used with --all-tags") {
+		t.Fatalf("Expected error message related to tag filter, got: %s", err)
+	}
+}
+
+func TestCopyPruneExtraTagsRemovesOnlyExtraDestinationTags(t *testing.T) {
+	server := newListingRegistryServer()
+	defer server.Close()
+
+	srcRepo := registryHost(server) + "/src/app"
+	dstRepo := registryHost(server) + "/dst/app"
+
+	for _, tagRef := range []string{srcRepo + ":1.0.0", srcRepo + ":1.1.0", srcRepo + ":dev", dstRepo + ":0.9.0", dstRepo + ":dev", dstRepo + ":stale"} {
+		tag, err := regname.NewTag(tagRef)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, buildImage(t, map[string]string{"tag": tagRef}, nil))
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	dstRef, err := regname.NewRepository(dstRepo)
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	dstTags := func() string {
+		tags, err := regremote.List(dstRef)
+		if err != nil {
+			t.Fatalf("Listing tags: %s", err)
+		}
+		sort.Strings(tags)
+		return strings.Join(tags, ",")
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRepo}, RepoDst: dstRepo,
+		Concurrency: 1, AllTags: true, TagFilter: "semver:>=1.0.0"}
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	if dstTags() != "0.9.0,1.0.0,1.1.0,dev,stale" {
+		t.Fatalf("Expected extra tags to be kept without --prune-extra-tags, got: %s", dstTags())
+	}
+
+	copyOpts.PruneExtraTags = true
+	copyOpts.DryRun = true
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected dry run copy to succeed: %s", err)
+	}
+
+	if dstTags() != "0.9.0,1.0.0,1.1.0,dev,stale" {
+		t.Fatalf("Expected extra tags to be kept with --dry-run, got: %s", dstTags())
+	}
+
+	copyOpts.DryRun = false
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	// dev tag is present in source (only filtered out), hence not pruned
+	if dstTags() != "1.0.0,1.1.0,dev" {
+		t.Fatalf("Expected only tags present in source to be kept, got: %s", dstTags())
+	}
+}
+
+func TestCopyPruneExtraTagsRequiresAllTags(t *testing.T) {
+	err := (&CopyOptions{ImageFlags: ImageFlags{Image: "foo"}, RepoDst: "bar", PruneExtraTags: true}).Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --prune-extra-tags to be used only with --all-tags and --to-repo") {
+		t.Fatalf("Expected error related to prune extra tags, got: %v", err)
+	}
+
+	err = (&CopyOptions{ImageFlags: ImageFlags{Image: "foo"}, RepoDst: "bar", AllTags: true, DryRun: true}).Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --dry-run to be used with --prune-extra-tags") {
+		t.Fatalf("Expected error related to dry run, got: %v", err)
+	}
+}
+
+func TestCopyImageGlobCopiesMatchingRepositories(t *testing.T) {
+	server := newListingRegistryServer()
+	defer server.Close()
+
+	host := registryHost(server)
+	srcDigests := map[string]regv1.Hash{}
+
+	for _, repo := range []string{"team/app1", "team/app2", "other/app3"} {
+		img := buildImage(t, map[string]string{"repo": repo}, nil)
+
+		tagRef, err := regname.NewTag(host + "/" + repo + ":latest")
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tagRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		srcDigests[repo], err = img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: host + "/team/*"},
+		RepoDst: host + "/mirror", Concurrency: 1}
+
+	err := copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	for _, name := range []string{"app1", "app2", "app3"} {
+		srcRepo := "team/" + name
+		if name == "app3" {
+			srcRepo = "other/" + name
+		}
+
+		dstRef, err := regname.NewDigest(host + "/mirror/" + name + "@" + srcDigests[srcRepo].String())
+		if err != nil {
+			t.Fatalf("Building digest ref: %s", err)
+		}
+
+		_, err = regremote.Head(dstRef)
+		if name == "app3" {
+			if err == nil {
+				t.Fatalf("Expected non-matching repository '%s' to not be copied", srcRepo)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected repository '%s' to be copied: %s", srcRepo, err)
+		}
+	}
+}
+
+func TestCopyImageGlobWithoutCatalogSupportError(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: registryHost(server) + "/team/*"},
+		RepoDst: registryHost(server) + "/mirror", Concurrency: 1}
+
+	err := copyOpts.Run()
+	if err == nil || !strings.Contains(err.Error(), "does not support listing repositories") {
+		t.Fatalf("Expected copy to fail due to missing catalog support, but was: %v", err)
+	}
+}
+
+func TestRelocationScopesIncludeSourceRepositoriesOfSameRegistry(t *testing.T) {
+	images := NewUnprocessedImageURLs()
+	images.Add(UnprocessedImageURL{URL: "registry.io/src/app1@sha256:0000000000000000000000000000000000000000000000000000000000000000"})
+	images.Add(UnprocessedImageURL{URL: "registry.io/src/app2@sha256:1111111111111111111111111111111111111111111111111111111111111111"})
+	images.Add(UnprocessedImageURL{URL: "registry.io/src/app1@sha256:2222222222222222222222222222222222222222222222222222222222222222"})
+	images.Add(UnprocessedImageURL{URL: "other.io/src/app3@sha256:3333333333333333333333333333333333333333333333333333333333333333"})
+
+	importRepo, err := regname.NewRepository("registry.io/dst/app")
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	scopes := relocationScopes(images, importRepo)
+	sort.Strings(scopes[1:])
+
+	expectedScopes := "repository:dst/app:push,pull repository:src/app1:pull repository:src/app2:pull"
+	if strings.Join(scopes, " ") != expectedScopes {
+		t.Fatalf("Expected scopes '%s', but was '%s'", expectedScopes, strings.Join(scopes, " "))
+	}
+}
+
+func TestCopyUploadConcurrencyIsCapped(t *testing.T) {
+	srcServer := newTestRegistryServer()
+	defer srcServer.Close()
+
+	regHandler := registry.New()
+
+	var uploadsLock sync.Mutex
+	var inFlight, maxInFlight, total int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isUpload := r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch
+		if isUpload {
+			uploadsLock.Lock()
+			inFlight++
+			total++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			uploadsLock.Unlock()
+
+			// Give other uploads a chance to overlap
+			time.Sleep(10 * time.Millisecond)
+
+			defer func() {
+				uploadsLock.Lock()
+				inFlight--
+				uploadsLock.Unlock()
+			}()
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	srcRef, err := regname.NewTag(registryHost(srcServer) + "/src/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	img, err := random.Image(1024, 6)
+	if err != nil {
+		t.Fatalf("Building image: %s", err)
+	}
+
+	err = regremote.Write(srcRef, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRef.Name()}, RepoDst: registryHost(server) + "/dst/app",
+		Concurrency: 5, UploadConcurrency: 1}
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	if total == 0 {
+		t.Fatalf("Expected copy to upload blobs")
+	}
+	if maxInFlight > 1 {
+		t.Fatalf("Expected at most 1 upload in flight, but was %d", maxInFlight)
+	}
+}
+
+func TestCopyLockResolvesTagReferencedImages(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	srcRef, err := regname.NewTag(registryHost(server) + "/src/app:v1")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	img := buildImage(t, map[string]string{"app": "v1"}, nil)
+
+	err = regremote.Write(srcRef, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-copy-lock-tags")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lockPath := filepath.Join(tmpDir, "images.yml")
+	lockOutputPath := filepath.Join(tmpDir, "relocated.yml")
+
+	err = ioutil.WriteFile(lockPath, []byte(`apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+srcRef.Name()+`
+`), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	dstRepo := registryHost(server) + "/dst/app"
+
+	copyOpts := CopyOptions{LockInputFlags: LockInputFlags{LockFilePath: lockPath}, RepoDst: dstRepo,
+		LockOutputFlags: LockOutputFlags{LockFilePath: lockOutputPath}, Concurrency: 1}
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	relocatedLock, err := ReadImageLockFile(lockOutputPath)
+	if err != nil {
+		t.Fatalf("Reading relocated lock: %s", err)
+	}
+
+	expectedImage := dstRepo + "@" + digest.String()
+
+	if len(relocatedLock.Spec.Images) != 1 || relocatedLock.Spec.Images[0].Image != expectedImage {
+		t.Fatalf("Expected relocated lock to reference '%s', but was: %v", expectedImage, relocatedLock.Spec.Images)
+	}
+}
+
+func TestCopyResumesInterruptedUploadWithoutReuploadingBlobs(t *testing.T) {
+	srcServer := newTestRegistryServer()
+	defer srcServer.Close()
+
+	srcRef, err := regname.NewTag(registryHost(srcServer) + "/src/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	img, err := random.Image(4096, 3)
+	if err != nil {
+		t.Fatalf("Building image: %s", err)
+	}
+
+	err = regremote.Write(srcRef, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	// Registry may have kept only first byte (reported as range '0-0')
+	for _, keptBytes := range []int{512, 1} {
+		keptBytes := keptBytes // copy
+
+		t.Run(fmt.Sprintf("kept %d bytes", keptBytes), func(t *testing.T) {
+			regHandler := registry.New()
+
+			var uploadsLock sync.Mutex
+			var interrupted bool
+			var resumedRanges []string
+			received := map[string]int{}
+			blobChecks := map[string]int{}
+			completed := map[string]int{}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				uploadsLock.Lock()
+				interrupt := r.Method == http.MethodPatch && !interrupted
+				if interrupt {
+					interrupted = true
+				}
+				if r.Method == http.MethodPatch && r.Header.Get("Content-Range") != "" {
+					resumedRanges = append(resumedRanges, r.Header.Get("Content-Range"))
+				}
+				if r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/blobs/") {
+					blobChecks[r.URL.Path]++
+				}
+				if r.Method == http.MethodPut && r.URL.Query().Get("digest") != "" {
+					completed[r.URL.Query().Get("digest")]++
+				}
+				uploadsLock.Unlock()
+
+				switch {
+				case interrupt:
+					// Registry keeps first few bytes before connection drops
+					// in the middle of receiving blob
+					chunk := make([]byte, keptBytes)
+					_, err := io.ReadFull(r.Body, chunk)
+					if err != nil {
+						t.Errorf("Reading interrupted upload: %s", err)
+					}
+
+					partialReq := httptest.NewRequest(http.MethodPatch, r.URL.String(), bytes.NewReader(chunk))
+					partialReq.Header.Set("Content-Range", fmt.Sprintf("0-%d", keptBytes-1))
+					regHandler.ServeHTTP(httptest.NewRecorder(), partialReq)
+
+					uploadsLock.Lock()
+					received[r.URL.Path] = len(chunk)
+					uploadsLock.Unlock()
+
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err == nil {
+						conn.Close()
+					}
+
+				case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+					// Upload status is not supported by test registry
+					uploadsLock.Lock()
+					size := received[r.URL.Path]
+					uploadsLock.Unlock()
+
+					w.Header().Set("Location", r.URL.Path)
+					w.Header().Set("Range", fmt.Sprintf("0-%d", size-1))
+					w.WriteHeader(http.StatusNoContent)
+
+				default:
+					regHandler.ServeHTTP(w, r)
+				}
+			}))
+			defer server.Close()
+
+			copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRef.Name()}, RepoDst: registryHost(server) + "/dst/app",
+				Concurrency: 1, UploadConcurrency: 1}
+
+			err := copyOpts.Run()
+			if err != nil {
+				t.Fatalf("Expected copy to succeed after interruption: %s", err)
+			}
+
+			if !interrupted {
+				t.Fatalf("Expected upload to be interrupted")
+			}
+
+			if len(resumedRanges) != 1 || !strings.HasPrefix(resumedRanges[0], fmt.Sprintf("%d-", keptBytes)) {
+				t.Fatalf("Expected interrupted upload to be resumed from %d bytes, but ranges were: %v", keptBytes, resumedRanges)
+			}
+
+			// 3 layers and config blob
+			if len(completed) != 4 {
+				t.Fatalf("Expected 4 blobs to be uploaded, but was %d", len(completed))
+			}
+			for digest, count := range completed {
+				if count != 1 {
+					t.Fatalf("Expected blob '%s' to be uploaded once, but was %d times", digest, count)
+				}
+			}
+			for path, count := range blobChecks {
+				if count != 1 {
+					t.Fatalf("Expected blob '%s' to be checked for existence once, but was %d times", path, count)
+				}
+			}
+		})
+	}
+}
+
+func TestCopyRepoTemplateRelocatesEachImageToItsDestination(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-copy-repo-template")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imagesYaml := "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n"
+	digests := map[string]regv1.Hash{}
+
+	for _, srcRepo := range []string{"src/frontend", "team/backend"} {
+		img := buildImage(t, map[string]string{"app": srcRepo}, nil)
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		srcRef, err := regname.NewDigest(registryHost(server) + "/" + srcRepo + "@" + digest.String())
+		if err != nil {
+			t.Fatalf("Building digest ref: %s", err)
+		}
+
+		err = regremote.Write(srcRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digests[srcRepo] = digest
+		imagesYaml += "  - name: " + filepath.Base(srcRepo) + "\n    image: " + srcRef.Name() + "\n"
+	}
+
+	lockPath := filepath.Join(tmpDir, "images.yml")
+
+	err = ioutil.WriteFile(lockPath, []byte(imagesYaml), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	templates := map[string]map[string]string{
+		registryHost(server) + "/mirror/{repo}": {
+			"src/frontend": "mirror/src/frontend",
+			"team/backend": "mirror/team/backend",
+		},
+		registryHost(server) + "/apps/{name}": {
+			"src/frontend": "apps/frontend",
+			"team/backend": "apps/backend",
+		},
+	}
+
+	for template, expectedRepos := range templates {
+		lockOutputPath := filepath.Join(tmpDir, "relocated.yml")
+
+		copyOpts := CopyOptions{LockInputFlags: LockInputFlags{LockFilePath: lockPath}, RepoDstTemplate: template,
+			LockOutputFlags: LockOutputFlags{LockFilePath: lockOutputPath}, Concurrency: 1}
+
+		err = copyOpts.Run()
+		if err != nil {
+			t.Fatalf("Expected copy with template '%s' to succeed: %s", template, err)
+		}
+
+		relocatedLock, err := ReadImageLockFile(lockOutputPath)
+		if err != nil {
+			t.Fatalf("Reading relocated lock: %s", err)
+		}
+
+		var relocatedImages []string
+		for _, img := range relocatedLock.Spec.Images {
+			relocatedImages = append(relocatedImages, img.Image)
+		}
+
+		for srcRepo, expectedRepo := range expectedRepos {
+			expectedRef := registryHost(server) + "/" + expectedRepo + "@" + digests[srcRepo].String()
+
+			copiedRef, err := regname.NewDigest(expectedRef)
+			if err != nil {
+				t.Fatalf("Building digest ref: %s", err)
+			}
+
+			_, err = regremote.Get(copiedRef)
+			if err != nil {
+				t.Fatalf("Expected image '%s' to be copied to '%s': %s", srcRepo, expectedRef, err)
+			}
+
+			if !strings.Contains(strings.Join(relocatedImages, " "), expectedRef) {
+				t.Fatalf("Expected relocated lock to reference '%s', but was: %v", expectedRef, relocatedImages)
+			}
+		}
+	}
+
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: registryHost(server) + "/src/frontend@" + digests["src/frontend"].String()},
+		RepoDstTemplate: registryHost(server) + "/apps/{name}", Concurrency: 1}
+
+	err = copyOpts.Run()
+	if err == nil || !strings.Contains(err.Error(), "to have name (e.g. in ImagesLock)") {
+		t.Fatalf("Expected copy of unnamed image with {name} template to fail, but was: %v", err)
+	}
+}
+
+func TestCopySinceCopiesOnlyChangedImages(t *testing.T) {
+	regHandler := registry.New()
+
+	var manifestPutsLock sync.Mutex
+	var manifestPuts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+			manifestPutsLock.Lock()
+			manifestPuts = append(manifestPuts, r.URL.Path)
+			manifestPutsLock.Unlock()
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	digests := map[string]regv1.Hash{}
+	imageRefs := map[string]string{}
+
+	for _, version := range []string{"unchanged", "v1", "v2"} {
+		img := buildImage(t, map[string]string{"app": version}, nil)
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		srcRef, err := regname.NewDigest(registryHost(server) + "/src/app@" + digest.String())
+		if err != nil {
+			t.Fatalf("Building digest ref: %s", err)
+		}
+
+		err = regremote.Write(srcRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digests[version] = digest
+		imageRefs[version] = srcRef.Name()
+	}
+
+	imagesYaml := func(versions ...string) string {
+		result := "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n"
+		for _, version := range versions {
+			result += "  - image: " + imageRefs[version] + "\n"
+		}
+		return result
+	}
+
+	oldBundleRef := writeBundle(t, server, "src/bundle-v1", imagesYaml("unchanged", "v1"))
+	newBundleRef := writeBundle(t, server, "src/bundle-v2", imagesYaml("unchanged", "v2"))
+
+	dstRepo := registryHost(server) + "/dst/bundle"
+
+	copyOpts := CopyOptions{BundleFlags: BundleFlags{Bundle: oldBundleRef}, RepoDst: dstRepo, Concurrency: 1}
+
+	err := copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy of old bundle to succeed: %s", err)
+	}
+
+	manifestPuts = nil
+
+	copyOpts = CopyOptions{BundleFlags: BundleFlags{Bundle: newBundleRef}, RepoDst: dstRepo, Since: oldBundleRef, Concurrency: 1}
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy of new bundle to succeed: %s", err)
+	}
+
+	puts := strings.Join(manifestPuts, " ")
+
+	if strings.Contains(puts, digests["unchanged"].Hex) {
+		t.Fatalf("Expected unchanged image to not be copied again, but manifests written: %s", puts)
+	}
+	if !strings.Contains(puts, digests["v2"].Hex) {
+		t.Fatalf("Expected changed image to be copied, but manifests written: %s", puts)
+	}
+
+	unchangedDstRef, err := regname.NewDigest(dstRepo + "@" + digests["unchanged"].String())
+	if err != nil {
+		t.Fatalf("Building digest ref: %s", err)
+	}
+
+	_, err = regremote.Get(unchangedDstRef)
+	if err != nil {
+		t.Fatalf("Expected unchanged image to remain in destination: %s", err)
+	}
+}
+
+func TestCopySinceRequiresBundleAndRepoDestination(t *testing.T) {
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: "registry.example.com/app"}, RepoDst: "registry.example.com/dst",
+		Since: "registry.example.com/bundle:v1"}
+
+	err := copyOpts.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --since to be used only with --bundle (-b) and --to-repo") {
+		t.Fatalf("Expected --since with image to fail, but was: %v", err)
+	}
+}
+
+func TestCopyDownloadConcurrencyRequiresTarDestination(t *testing.T) {
+	copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: "registry.example.com/app"}, RepoDst: "registry.example.com/dst",
+		DownloadConcurrency: 2}
+
+	err := copyOpts.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --download-concurrency to be used only with --to-tar") {
+		t.Fatalf("Expected --download-concurrency with repository destination to fail, but was: %v", err)
+	}
+}
+
+func TestCopyLockOutputReferencesDestinationDigests(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-copy-lock-output")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imagesYaml := "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n"
+	srcRefs := map[string]string{}
+	digests := map[string]regv1.Hash{}
+
+	for _, name := range []string{"frontend", "backend"} {
+		img := buildImage(t, map[string]string{"app": name}, nil)
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		srcRef, err := regname.NewDigest(registryHost(server) + "/src/" + name + "@" + digest.String())
+		if err != nil {
+			t.Fatalf("Building digest ref: %s", err)
+		}
+
+		err = regremote.Write(srcRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		srcRefs[name] = srcRef.Name()
+		digests[name] = digest
+		imagesYaml += "  - name: " + name + "\n    image: " + srcRef.Name() + "\n    annotations:\n      kbld.carvel.dev/id: " + name + "\n"
+	}
+
+	lockPath := filepath.Join(tmpDir, "images.yml")
+	lockOutputPath := filepath.Join(tmpDir, "relocated.yml")
+
+	err = ioutil.WriteFile(lockPath, []byte(imagesYaml), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	dstRepo := registryHost(server) + "/dst/apps"
+
+	copyOpts := CopyOptions{LockInputFlags: LockInputFlags{LockFilePath: lockPath}, RepoDst: dstRepo,
+		LockOutputFlags: LockOutputFlags{LockFilePath: lockOutputPath}, Concurrency: 1}
+
+	err = copyOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	relocatedLock, err := ReadImageLockFile(lockOutputPath)
+	if err != nil {
+		t.Fatalf("Expected output to be valid ImagesLock: %s", err)
+	}
+
+	if len(relocatedLock.Spec.Images) != 2 {
+		t.Fatalf("Expected relocated lock to contain 2 images, but was: %#v", relocatedLock.Spec.Images)
+	}
+
+	for _, img := range relocatedLock.Spec.Images {
+		expectedImage := dstRepo + "@" + digests[img.Name].String()
+		if img.Image != expectedImage {
+			t.Fatalf("Expected image '%s' to reference '%s', but was '%s'", img.Name, expectedImage, img.Image)
+		}
+
+		dstRef, err := regname.NewDigest(img.Image)
+		if err != nil {
+			t.Fatalf("Parsing relocated image: %s", err)
+		}
+
+		_, err = regremote.Get(dstRef)
+		if err != nil {
+			t.Fatalf("Expected '%s' to exist in destination: %s", img.Image, err)
+		}
+
+		if img.Annotations[CopiedFromAnnotation] != srcRefs[img.Name] {
+			t.Fatalf("Expected image '%s' to be annotated with source '%s', but was: %#v", img.Name, srcRefs[img.Name], img.Annotations)
+		}
+		if img.Annotations["kbld.carvel.dev/id"] != img.Name {
+			t.Fatalf("Expected image '%s' to keep source annotations, but was: %#v", img.Name, img.Annotations)
+		}
+	}
+}
+
+func TestCopySignaturesCopiesSignatureArtifacts(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-copy-signatures")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeImage := func(ref string, img regv1.Image) {
+		tag, err := regname.NewTag(ref)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	img := buildImage(t, map[string]string{"app": "app"}, nil)
+	sig := buildImage(t, map[string]string{"signature": "sig"}, nil)
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	sigDigest, err := sig.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	sigTag := digest.Algorithm + "-" + digest.Hex + ".sig"
+
+	srcRepo := registryHost(server) + "/src/app"
+	writeImage(srcRepo+":v1", img)
+	writeImage(srcRepo+":"+sigTag, sig)
+
+	for _, copySignatures := range []bool{false, true} {
+		dstRepo := registryHost(server) + "/dst/app"
+		if copySignatures {
+			dstRepo += "-signed"
+		}
+
+		lockOutputPath := filepath.Join(tmpDir, "relocated.yml")
+
+		copyOpts := CopyOptions{ImageFlags: ImageFlags{Image: srcRepo + ":v1"}, RepoDst: dstRepo, CopySignatures: copySignatures,
+			LockOutputFlags: LockOutputFlags{LockFilePath: lockOutputPath}, Concurrency: 1}
+
+		err = copyOpts.Run()
+		if err != nil {
+			t.Fatalf("Expected copy to succeed: %s", err)
+		}
+
+		dstSigTag, err := regname.NewTag(dstRepo + ":" + sigTag)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		desc, err := regremote.Get(dstSigTag)
+		if !copySignatures {
+			if err == nil {
+				t.Fatalf("Expected signature to not be copied without --copy-signatures")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected signature to be copied under its tag: %s", err)
+		}
+		if desc.Digest != sigDigest {
+			t.Fatalf("Expected copied signature to have digest '%s', but was '%s'", sigDigest, desc.Digest)
+		}
+
+		relocatedLock, err := ReadImageLockFile(lockOutputPath)
+		if err != nil {
+			t.Fatalf("Expected output to be valid ImagesLock: %s", err)
+		}
+
+		if len(relocatedLock.Spec.Images) != 1 || relocatedLock.Spec.Images[0].Image != dstRepo+"@"+digest.String() {
+			t.Fatalf("Expected relocated lock to only contain copied image, but was: %#v", relocatedLock.Spec.Images)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/spf13/cobra"
+)
+
+type ExtractFlags struct {
+	DirMode     string
+	FileMode    string
+	ChangedOnly bool
+	Concurrency int
+	NewerThan   string
+	Chown       string
+
+	RenameTemplate string
+}
+
+func (s *ExtractFlags) Set(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.DirMode, "dir-mode", "", "Set mode for extracted directories (format: 0750)")
+	cmd.Flags().StringVar(&s.FileMode, "file-mode", "", "Set mode for extracted files (format: 0640)")
+	cmd.Flags().BoolVar(&s.ChangedOnly, "changed-only", false, "Extract into existing output directory, skipping files with unchanged contents")
+	cmd.Flags().IntVar(&s.Concurrency, "extract-concurrency", 1, "Set number of small files written in parallel within each layer")
+	cmd.Flags().StringVar(&s.NewerThan, "newer-than", "", "Extract into existing output directory only files modified after given time (format: 2006-01-02T15:04:05Z)")
+	cmd.Flags().StringVar(&s.Chown, "chown", "", "Set owner of extracted files when running as root (format: uid:gid)")
+	cmd.Flags().StringVar(&s.RenameTemplate, "rename-template", "", "Set output path of each extracted entry via Go template with .Name, .Dir, .Base, .Ext and .LayerDigest (e.g. '{{.LayerDigest.Hex}}/{{.Name}}')")
+}
+
+func (s *ExtractFlags) AsDirImageOpts() (ctlimg.DirImageOpts, error) {
+	dirMode, err := s.parseMode("dir-mode", s.DirMode)
+	if err != nil {
+		return ctlimg.DirImageOpts{}, err
+	}
+
+	fileMode, err := s.parseMode("file-mode", s.FileMode)
+	if err != nil {
+		return ctlimg.DirImageOpts{}, err
+	}
+
+	if s.Concurrency < 0 {
+		return ctlimg.DirImageOpts{}, fmt.Errorf("Expected --extract-concurrency to not be negative, got %d", s.Concurrency)
+	}
+
+	var newerThan time.Time
+
+	if len(s.NewerThan) > 0 {
+		newerThan, err = time.Parse(time.RFC3339, s.NewerThan)
+		if err != nil {
+			return ctlimg.DirImageOpts{}, fmt.Errorf("Expected --newer-than to be an RFC3339 time (e.g. 2006-01-02T15:04:05Z), got '%s'", s.NewerThan)
+		}
+	}
+
+	owner, err := s.parseOwner()
+	if err != nil {
+		return ctlimg.DirImageOpts{}, err
+	}
+
+	var renameTpl *ctlimg.RenameTemplate
+
+	if len(s.RenameTemplate) > 0 {
+		renameTpl, err = ctlimg.NewRenameTemplate(s.RenameTemplate)
+		if err != nil {
+			return ctlimg.DirImageOpts{}, fmt.Errorf("Expected --rename-template to be valid: %s", err)
+		}
+	}
+
+	return ctlimg.DirImageOpts{DirMode: dirMode, FileMode: fileMode, SkipUnchanged: s.ChangedOnly,
+		Concurrency: s.Concurrency, NewerThan: newerThan, Owner: owner, RenameTemplate: renameTpl}, nil
+}
+
+func (s *ExtractFlags) parseOwner() (*ctlimg.Owner, error) {
+	if len(s.Chown) == 0 {
+		return nil, nil
+	}
+
+	pieces := strings.Split(s.Chown, ":")
+	if len(pieces) != 2 {
+		return nil, fmt.Errorf("Expected --chown to be in format uid:gid (e.g. 1000:1000), got '%s'", s.Chown)
+	}
+
+	var ids []int
+
+	for _, piece := range pieces {
+		id, err := strconv.ParseUint(piece, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("Expected --chown to be in format uid:gid (e.g. 1000:1000), got '%s'", s.Chown)
+		}
+		ids = append(ids, int(id))
+	}
+
+	return &ctlimg.Owner{UID: ids[0], GID: ids[1]}, nil
+}
+
+func (s *ExtractFlags) parseMode(flagName, val string) (os.FileMode, error) {
+	if len(val) == 0 {
+		return 0, nil
+	}
+
+	mode, err := strconv.ParseUint(val, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Expected --%s to be an octal mode (e.g. 0750), got '%s'", flagName, val)
+	}
+
+	if mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("Expected --%s to be within 0001-0777, got '%s'", flagName, val)
+	}
+
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractFlagsInvalidMode(t *testing.T) {
+	for _, mode := range []string{"rwx", "0789", "01777"} {
+		_, err := (&ExtractFlags{DirMode: mode}).AsDirImageOpts()
+		if err == nil {
+			t.Fatalf("Expected mode '%s' to err", mode)
+		}
+
+		if !strings.Contains(err.Error(), "--dir-mode") {
+			t.Fatalf("Expected error to mention --dir-mode, got: %s", err)
+		}
+	}
+}
+
+func TestExtractFlagsOctalMode(t *testing.T) {
+	opts, err := (&ExtractFlags{DirMode: "0750", FileMode: "640"}).AsDirImageOpts()
+	if err != nil {
+		t.Fatalf("Expected modes to parse: %s", err)
+	}
+
+	if opts.DirMode != 0750 || opts.FileMode != 0640 {
+		t.Fatalf("Expected modes 0750/0640, got %o/%o", opts.DirMode, opts.FileMode)
+	}
+}
+
+func TestExtractFlagsChangedOnly(t *testing.T) {
+	opts, err := (&ExtractFlags{ChangedOnly: true}).AsDirImageOpts()
+	if err != nil {
+		t.Fatalf("Expected flags to succeed: %s", err)
+	}
+
+	if !opts.SkipUnchanged {
+		t.Fatalf("Expected changed only to skip unchanged files")
+	}
+}
+
+func TestExtractFlagsChown(t *testing.T) {
+	opts, err := (&ExtractFlags{Chown: "1000:2000"}).AsDirImageOpts()
+	if err != nil {
+		t.Fatalf("Expected chown to parse: %s", err)
+	}
+
+	if opts.Owner == nil || opts.Owner.UID != 1000 || opts.Owner.GID != 2000 {
+		t.Fatalf("Expected owner 1000:2000, got %#v", opts.Owner)
+	}
+
+	for _, val := range []string{"1000", "1000:", "user:group", "-1:0", "1:2:3"} {
+		_, err := (&ExtractFlags{Chown: val}).AsDirImageOpts()
+		if err == nil || !strings.Contains(err.Error(), "--chown") {
+			t.Fatalf("Expected chown '%s' to err mentioning --chown, got: %v", val, err)
+		}
+	}
+}
+
+func TestExtractFlagsRenameTemplate(t *testing.T) {
+	opts, err := (&ExtractFlags{RenameTemplate: "renamed/{{.Name}}"}).AsDirImageOpts()
+	if err != nil {
+		t.Fatalf("Expected rename template to parse: %s", err)
+	}
+
+	if opts.RenameTemplate == nil {
+		t.Fatalf("Expected rename template to be set")
+	}
+
+	_, err = (&ExtractFlags{RenameTemplate: "../{{.Name}}"}).AsDirImageOpts()
+	if err == nil || !strings.Contains(err.Error(), "--rename-template") {
+		t.Fatalf("Expected rename template escaping output directory to err mentioning --rename-template, got: %v", err)
+	}
+}
@@ -4,19 +4,230 @@
 package cmd
 
 import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	regtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 	"github.com/spf13/cobra"
 )
 
 type FileFlags struct {
-	Files      []string
-	RawTarFile string
+	Files        []string
+	FileManifest string
+	RawTarFile   string
+
+	ArtifactFiles []string
 
 	FileExcludeDefaults []string
+	FileMaxSize         int64
+	TarPrefix           string
+	RelativeTo          string
+	PreserveMtime       bool
+	Mtime               string
+	TarCopyBufferSize   int
+	TarReadAhead        int
+	NormalizeUnicode    bool
+	TarFormat           string
+	SkipEmptyDirs       bool
+	NoCompressLayers    bool
+	LayerMediaType      string
 }
 
 func (s *FileFlags) Set(cmd *cobra.Command) {
 	cmd.Flags().StringSliceVarP(&s.Files, "file", "f", nil, "Set file (format: /tmp/foo, -) (can be specified multiple times)")
-	cmd.Flags().StringVar(&s.RawTarFile, "file-raw-tar", "", "Set raw tar file (format: /tmp/foo.tgz, -)")
+	cmd.Flags().StringVar(&s.FileManifest, "file-manifest", "", "Set PushManifest file listing files with their names and excludes (format: /tmp/manifest.yml)")
+	cmd.Flags().StringVar(&s.RawTarFile, "file-raw-tar", "", "Set raw tar file, optionally gzip compressed (format: /tmp/foo.tar, /tmp/foo.tgz, -)")
+	cmd.Flags().StringSliceVar(&s.ArtifactFiles, "artifact-file", nil, "Set file stored as its own layer with title annotation (format: /tmp/foo, title=/tmp/foo) (can be specified multiple times)")
 
 	cmd.Flags().StringSliceVar(&s.FileExcludeDefaults, "file-exclude-defaults", []string{".git"}, "Excluded file paths by default (can be specified multiple times)")
+	cmd.Flags().Int64Var(&s.FileMaxSize, "file-max-size", 0, "Skip files larger than given size in bytes (0 means no limit)")
+	cmd.Flags().StringVar(&s.TarPrefix, "tar-prefix", "", "Nest all files under given relative directory within image (example: app)")
+	cmd.Flags().StringVar(&s.RelativeTo, "relative-to", "", "Store files under their paths relative to given directory instead of at image root (example: /project for /project/src)")
+	cmd.Flags().BoolVar(&s.PreserveMtime, "preserve-mtime", false, "Record modification time of files instead of static time (image digest depends on it)")
+	cmd.Flags().StringVar(&s.Mtime, "mtime", "", "Record given static modification time for all files and directories instead of zero time, e.g. for extractors rejecting zero time (format: RFC3339, e.g. 2020-01-01T00:00:00Z)")
+	cmd.Flags().IntVar(&s.TarCopyBufferSize, "tar-copy-buffer-size", ctlimg.DefaultTarCopyBufferSize, "Set buffer size in bytes used to copy file contents into image (larger values speed up packaging of large files)")
+	cmd.Flags().IntVar(&s.TarReadAhead, "tar-read-ahead", 8, "Set number of small files read in parallel ahead of being written into image (speeds up packaging of many files; 1 reads serially)")
+	cmd.Flags().BoolVar(&s.SkipEmptyDirs, "skip-empty-dirs", false, "Omit directories that do not contain any included files (e.g. all of their files are excluded)")
+	cmd.Flags().StringVar(&s.TarFormat, "tar-format", "", "Force tar header format of files within image (gnu, ustar, pax) (defaults to ustar when names fit, pax otherwise)")
+	cmd.Flags().BoolVar(&s.NoCompressLayers, "no-compress-layers", false, "Store files as uncompressed tar layer (e.g. when files are already compressed)")
+	cmd.Flags().StringVar(&s.LayerMediaType, "layer-media-type", "", "Override media type of layer with files, e.g. for registries rejecting OCI media types (docker, oci; with --no-compress-layers: docker-uncompressed, oci-uncompressed) (defaults to docker)")
+	cmd.Flags().BoolVar(&s.NormalizeUnicode, "normalize-unicode", false, "Normalize file names to Unicode NFC form so that names decomposed by filesystem (e.g. on macOS) result in the same image")
+}
+
+func (s *FileFlags) AsTarImageOpts() (ctlimg.TarImageOpts, error) {
+	format, err := s.tarFormat()
+	if err != nil {
+		return ctlimg.TarImageOpts{}, err
+	}
+
+	layerMediaType, err := s.layerMediaType()
+	if err != nil {
+		return ctlimg.TarImageOpts{}, err
+	}
+
+	mtime, err := s.mtime()
+	if err != nil {
+		return ctlimg.TarImageOpts{}, err
+	}
+
+	return ctlimg.TarImageOpts{
+		MaxFileSize:      s.FileMaxSize,
+		Prefix:           s.TarPrefix,
+		PreserveMtime:    s.PreserveMtime,
+		Mtime:            mtime,
+		CopyBufferSize:   s.TarCopyBufferSize,
+		ReadAhead:        s.TarReadAhead,
+		NormalizeUnicode: s.NormalizeUnicode,
+		SkipEmptyDirs:    s.SkipEmptyDirs,
+		NoCompression:    s.NoCompressLayers,
+		LayerMediaType:   layerMediaType,
+		Format:           format,
+	}, nil
+}
+
+func (s *FileFlags) tarFormat() (tar.Format, error) {
+	switch s.TarFormat {
+	case "":
+		return tar.FormatUnknown, nil
+	case "gnu":
+		return tar.FormatGNU, nil
+	case "ustar":
+		return tar.FormatUSTAR, nil
+	case "pax":
+		return tar.FormatPAX, nil
+	default:
+		return tar.FormatUnknown, fmt.Errorf("Expected --tar-format to be one of gnu, ustar, pax, got '%s'", s.TarFormat)
+	}
+}
+
+func (s *FileFlags) mtime() (time.Time, error) {
+	if len(s.Mtime) == 0 {
+		return time.Time{}, nil
+	}
+
+	if s.PreserveMtime {
+		return time.Time{}, fmt.Errorf("Expected --mtime to not be combined with --preserve-mtime")
+	}
+
+	mtime, err := time.Parse(time.RFC3339, s.Mtime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Expected --mtime to be in RFC3339 format (e.g. 2020-01-01T00:00:00Z), got '%s'", s.Mtime)
+	}
+
+	return mtime, nil
+}
+
+// layerMediaTypes lists accepted values of --layer-media-type
+var layerMediaTypes = map[string]regtypes.MediaType{
+	"docker":              regtypes.DockerLayer,
+	"oci":                 regtypes.OCILayer,
+	"docker-uncompressed": regtypes.DockerUncompressedLayer,
+	"oci-uncompressed":    regtypes.OCIUncompressedLayer,
+}
+
+func (s *FileFlags) layerMediaType() (regtypes.MediaType, error) {
+	if len(s.LayerMediaType) == 0 {
+		return "", nil
+	}
+
+	mediaType, found := layerMediaTypes[s.LayerMediaType]
+	if !found {
+		// Full media types are accepted as well
+		for _, knownMediaType := range layerMediaTypes {
+			if string(knownMediaType) == s.LayerMediaType {
+				mediaType, found = knownMediaType, true
+			}
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("Expected --layer-media-type to be one of docker, oci, docker-uncompressed, oci-uncompressed (or their full media types), got '%s'", s.LayerMediaType)
+	}
+
+	if ctlimg.IsUncompressedLayer(mediaType) != s.NoCompressLayers {
+		return "", fmt.Errorf("Expected --layer-media-type '%s' to match layer compression "+
+			"(uncompressed media types are used only with --no-compress-layers)", s.LayerMediaType)
+	}
+
+	return mediaType, nil
+}
+
+// AsTarImageSources returns files either from file flags or push manifest
+func (s *FileFlags) AsTarImageSources() ([]ctlimg.TarImageSource, error) {
+	if len(s.FileManifest) == 0 {
+		var sources []ctlimg.TarImageSource
+		for _, file := range s.Files {
+			sources = append(sources, ctlimg.TarImageSource{Path: file})
+		}
+		return s.namedRelativeTo(sources)
+	}
+
+	if len(s.Files) > 0 {
+		return nil, fmt.Errorf("Expected only one of files or file manifest")
+	}
+
+	manifest, err := ReadPushManifestFile(s.FileManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.namedRelativeTo(manifest.AsTarImageSources())
+}
+
+// namedRelativeTo names sources without explicit name by their path
+// relative to relative to directory (e.g. /project/src is stored as src/)
+func (s *FileFlags) namedRelativeTo(sources []ctlimg.TarImageSource) ([]ctlimg.TarImageSource, error) {
+	if len(s.RelativeTo) == 0 {
+		return sources, nil
+	}
+
+	absRelativeTo, err := filepath.Abs(s.RelativeTo)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, source := range sources {
+		if len(source.Name) > 0 {
+			continue
+		}
+
+		absPath, err := filepath.Abs(source.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		relPath, err := filepath.Rel(absRelativeTo, absPath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("Expected file '%s' to be within relative to directory '%s'", source.Path, s.RelativeTo)
+		}
+
+		sources[i].Name = relPath
+	}
+
+	return sources, nil
+}
+
+func (s *FileFlags) AsArtifactFiles() []ctlimg.ArtifactFile {
+	var files []ctlimg.ArtifactFile
+
+	for _, val := range s.ArtifactFiles {
+		pieces := strings.SplitN(val, "=", 2)
+		// Existing path containing '=' is not split into title and path
+		if len(pieces) == 2 && !pathExists(val) {
+			files = append(files, ctlimg.ArtifactFile{Title: pieces[0], Path: pieces[1]})
+		} else {
+			files = append(files, ctlimg.ArtifactFile{Title: filepath.Base(val), Path: val})
+		}
+	}
+
+	return files
+}
+
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
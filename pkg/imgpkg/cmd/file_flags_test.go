@@ -0,0 +1,46 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestFileFlagsArtifactFilesWithEqualsInPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgpkg-artifact-files")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	equalsPath := filepath.Join(dir, "key=value.yml")
+
+	err = ioutil.WriteFile(equalsPath, []byte("contents"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	flags := FileFlags{ArtifactFiles: []string{
+		equalsPath,
+		"config/values.yml=" + equalsPath,
+		"values.yml=/missing/values.yml",
+	}}
+
+	expectedFiles := []ctlimg.ArtifactFile{
+		{Title: "key=value.yml", Path: equalsPath},
+		{Title: "config/values.yml", Path: equalsPath},
+		{Title: "values.yml", Path: "/missing/values.yml"},
+	}
+
+	files := flags.AsArtifactFiles()
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected artifact files %#v, but was %#v", expectedFiles, files)
+	}
+}
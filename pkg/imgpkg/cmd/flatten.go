@@ -0,0 +1,98 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/spf13/cobra"
+)
+
+type FlattenOptions struct {
+	ui ui.UI
+
+	RegistryFlags RegistryFlags
+	From          string
+	ToTar         string
+}
+
+func NewFlattenOptions(ui ui.UI) *FlattenOptions {
+	return &FlattenOptions{ui: ui}
+}
+
+func NewFlattenCmd(o *FlattenOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "flatten",
+		Short: "Merge all layers of image or bundle into single tar file",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		Example: `
+  # Merge layers of image dkalinin/app1-image into /tmp/app1-image.tar
+  imgpkg flatten --from dkalinin/app1-image --to-tar /tmp/app1-image.tar
+
+  # Push flattened image as single layer image
+  imgpkg push -i dkalinin/app1-image-flat --file-raw-tar /tmp/app1-image.tar`,
+	}
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().StringVar(&o.From, "from", "", "Image or bundle reference to flatten")
+	cmd.Flags().StringVar(&o.ToTar, "to-tar", "", "Location to write uncompressed tar file with merged contents")
+	return cmd
+}
+
+func (o *FlattenOptions) Run() error {
+	if o.From == "" {
+		return fmt.Errorf("Expected --from flag")
+	}
+	if o.ToTar == "" {
+		return fmt.Errorf("Expected --to-tar flag")
+	}
+
+	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+	}
+
+	ref, err := parseImageRef(o.From)
+	if err != nil {
+		return err
+	}
+
+	img, err := registry.Image(ref)
+	if err != nil {
+		return err
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("Getting image digest: %s", err)
+	}
+
+	o.ui.BeginLinef("Flattening image '%s@%s'\n", ref.Context(), digest)
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-flatten")
+	if err != nil {
+		return fmt.Errorf("Creating temporary directory: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	// Extraction merges layers (applying whiteouts) and
+	// tar image writes entries in deterministic order with static metadata
+	err = ctlimg.NewDirImage(tmpDir, img, ctlimg.DirImageOpts{Warnf: warnfFunc(o.ui)}, o.ui).AsDirectory()
+	if err != nil {
+		return fmt.Errorf("Extracting image into directory: %s", err)
+	}
+
+	err = ctlimg.NewTarImage([]string{tmpDir}, nil, ctlimg.TarImageOpts{}, InfoLog{o.ui}).AsTarFile(o.ToTar)
+	if err != nil {
+		return fmt.Errorf("Writing tar file: %s", err)
+	}
+
+	o.ui.BeginLinef("Wrote merged contents to '%s'\n", o.ToTar)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestFlattenWritesMergedLayers(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	img, err := mutate.AppendLayers(empty.Image,
+		buildLayer(t, map[string]string{"a.txt": "a1", "b.txt": "b", "dir/c.txt": "c"}),
+		buildLayer(t, map[string]string{"a.txt": "a2", ".wh.b.txt": "", "dir/d.txt": "d"}),
+	)
+	if err != nil {
+		t.Fatalf("Appending layers: %s", err)
+	}
+
+	tag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-flatten-test")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var tars [][]byte
+
+	for _, name := range []string{"first.tar", "second.tar"} {
+		flatten := FlattenOptions{ui: ui.NewNoopUI(), From: tag.Name(), ToTar: filepath.Join(tmpDir, name)}
+
+		err = flatten.Run()
+		if err != nil {
+			t.Fatalf("Expected flatten to succeed: %s", err)
+		}
+
+		contents, err := ioutil.ReadFile(flatten.ToTar)
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		tars = append(tars, contents)
+	}
+
+	if !bytes.Equal(tars[0], tars[1]) {
+		t.Fatalf("Expected flattened tar to be reproducible")
+	}
+
+	files := map[string]string{}
+	tarReader := tar.NewReader(bytes.NewReader(tars[0]))
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		contents, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("Reading tar entry: %s", err)
+		}
+
+		files[header.Name] = string(contents)
+	}
+
+	expectedFiles := map[string]string{"a.txt": "a2", "dir/c.txt": "c", "dir/d.txt": "d"}
+
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected flattened files %v, got %v", expectedFiles, files)
+	}
+}
+
+func TestFlattenWithoutToTarError(t *testing.T) {
+	err := (&FlattenOptions{ui: ui.NewNoopUI(), From: "repo/app"}).Run()
+	if err == nil || err.Error() != "Expected --to-tar flag" {
+		t.Fatalf("Expected error about --to-tar, got: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func newTestRegistryServer() *httptest.Server {
+	return httptest.NewServer(registry.New())
+}
+
+// newListingRegistryServer additionally serves tags list and catalog APIs
+// and deleting tags (not supported by test registry) based on pushed manifest tags
+func newListingRegistryServer() *httptest.Server {
+	regHandler := registry.New()
+	tags := map[string][]string{}
+	var tagsLock sync.Mutex
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v2/_catalog" {
+			tagsLock.Lock()
+			defer tagsLock.Unlock()
+
+			var repos []string
+			for repo := range tags {
+				repos = append(repos, repo)
+			}
+			sort.Strings(repos)
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"repositories": repos})
+			return
+		}
+
+		pieces := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")
+		if len(pieces) < 3 {
+			regHandler.ServeHTTP(w, r)
+			return
+		}
+
+		repo := strings.Join(pieces[:len(pieces)-2], "/")
+		kind, ref := pieces[len(pieces)-2], pieces[len(pieces)-1]
+
+		switch {
+		case r.Method == http.MethodGet && kind == "tags" && ref == "list":
+			tagsLock.Lock()
+			defer tagsLock.Unlock()
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": tags[repo]})
+			return
+
+		case r.Method == http.MethodPut && kind == "manifests" && !strings.Contains(ref, ":"):
+			tagsLock.Lock()
+			tags[repo] = append(removeString(tags[repo], ref), ref)
+			tagsLock.Unlock()
+
+		case r.Method == http.MethodDelete && kind == "manifests" && !strings.Contains(ref, ":"):
+			tagsLock.Lock()
+			tags[repo] = removeString(tags[repo], ref)
+			tagsLock.Unlock()
+
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		regHandler.ServeHTTP(w, r)
+	}))
+}
+
+func removeString(vals []string, val string) []string {
+	var result []string
+	for _, v := range vals {
+		if v != val {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// newStrictUI returns UI that treats warnings as errors (--strict)
+func newStrictUI() *WarningsUI {
+	strictUI := NewWarningsUI(ui.NewNoopUI())
+	strictUI.EnableStrict()
+	return strictUI
+}
+
+// runImgpkg runs imgpkg command the same way as main (including printing
+// "Succeeded") and returns what was written to stdout and stderr
+func runImgpkg(t *testing.T, args ...string) (string, string, error) {
+	origStdout, origStderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = origStdout, origStderr }()
+
+	readPipe := func() (*os.File, <-chan string) {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Creating pipe: %s", err)
+		}
+		output := make(chan string, 1)
+		go func() {
+			bs, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			output <- string(bs)
+		}()
+		return writer, output
+	}
+
+	stdoutWriter, stdout := readPipe()
+	stderrWriter, stderr := readPipe()
+
+	// Console UI writes to os.Stdout and os.Stderr set at creation time
+	os.Stdout, os.Stderr = stdoutWriter, stderrWriter
+
+	confUI := ui.NewConfUI(ui.NewNoopLogger())
+
+	imgpkgCmd := NewDefaultImgpkgCmd(confUI)
+	imgpkgCmd.SetArgs(args)
+
+	executedCmd, err := imgpkgCmd.ExecuteC()
+	if err == nil && !PrintsOnlyResult(executedCmd) {
+		confUI.PrintLinef("Succeeded")
+	}
+
+	confUI.Flush()
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	return <-stdout, <-stderr, err
+}
+
+func registryHost(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// buildImage returns single layer image with given files (path -> contents)
+func buildImage(t *testing.T, files map[string]string, mutateCfg func(*regv1.ConfigFile)) regv1.Image {
+	layer := buildLayer(t, files)
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatalf("Appending layer: %s", err)
+	}
+
+	if mutateCfg != nil {
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("Getting config: %s", err)
+		}
+
+		mutateCfg(cfg)
+
+		img, err = mutate.ConfigFile(img, cfg)
+		if err != nil {
+			t.Fatalf("Setting config: %s", err)
+		}
+	}
+
+	return img
+}
+
+// writeBundle pushes bundle with given ImagesLock contents and returns its tag
+func writeBundle(t *testing.T, server *httptest.Server, repo, imagesYaml string) string {
+	bundleImg := buildImage(t, map[string]string{
+		"config.yml":                    "key: value",
+		BundleDir + "/" + ImageLockFile: imagesYaml,
+	}, func(cfg *regv1.ConfigFile) {
+		cfg.Config.Labels = map[string]string{ctlimg.BundleConfigLabel: "true"}
+	})
+
+	bundleRef := registryHost(server) + "/" + repo + ":latest"
+
+	tag, err := regname.NewTag(bundleRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, bundleImg)
+	if err != nil {
+		t.Fatalf("Writing bundle: %s", err)
+	}
+
+	return bundleRef
+}
+
+func buildLayer(t *testing.T, files map[string]string) regv1.Layer {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+
+	for _, path := range paths {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     path,
+			Mode:     0600,
+			Size:     int64(len(files[path])),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			t.Fatalf("Writing tar header: %s", err)
+		}
+
+		_, err = tarWriter.Write([]byte(files[path]))
+		if err != nil {
+			t.Fatalf("Writing tar content: %s", err)
+		}
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		t.Fatalf("Closing tar: %s", err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("Building layer: %s", err)
+	}
+
+	return layer
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+const imageGlobChars = "*?["
+
+// ImageGlob matches repositories within a registry
+// (e.g. registry.io/team/* matches registry.io/team/app1)
+type ImageGlob struct {
+	Registry regname.Registry
+
+	pattern string
+	prefix  string
+	tag     string
+}
+
+func IsImageGlob(ref string) bool {
+	return strings.ContainsAny(ref, imageGlobChars)
+}
+
+func NewImageGlob(ref string) (ImageGlob, error) {
+	if strings.Contains(ref, "@") {
+		return ImageGlob{}, fmt.Errorf("Expected image pattern '%s' to not include digest", ref)
+	}
+
+	regStr := regname.DefaultRegistry
+	repoPattern := ref
+
+	pieces := strings.SplitN(ref, "/", 2)
+	if len(pieces) == 2 && (strings.ContainsAny(pieces[0], ".:") || pieces[0] == "localhost") {
+		regStr, repoPattern = pieces[0], pieces[1]
+	}
+
+	var tag string
+	if idx := strings.LastIndex(repoPattern, ":"); idx > strings.LastIndex(repoPattern, "/") {
+		repoPattern, tag = repoPattern[:idx], repoPattern[idx+1:]
+	}
+
+	if _, err := path.Match(repoPattern, ""); err != nil {
+		return ImageGlob{}, fmt.Errorf("Parsing image pattern '%s': %s", ref, err)
+	}
+
+	reg, err := regname.NewRegistry(regStr, regname.WeakValidation)
+	if err != nil {
+		return ImageGlob{}, fmt.Errorf("Parsing image pattern '%s' registry: %s", ref, err)
+	}
+
+	// Prefix includes all directories before first pattern segment
+	var prefixSegments []string
+	for _, segment := range strings.Split(repoPattern, "/") {
+		if IsImageGlob(segment) {
+			break
+		}
+		prefixSegments = append(prefixSegments, segment)
+	}
+
+	var prefix string
+	if len(prefixSegments) > 0 {
+		prefix = strings.Join(prefixSegments, "/") + "/"
+	}
+
+	return ImageGlob{Registry: reg, pattern: repoPattern, prefix: prefix, tag: tag}, nil
+}
+
+// Match returns sorted repository names that match pattern
+func (g ImageGlob) Match(repos []string) []string {
+	var result []string
+	for _, repo := range repos {
+		if matched, _ := path.Match(g.pattern, repo); matched {
+			result = append(result, repo)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ImageRef returns image reference for matched repository (including pattern's tag, if any)
+func (g ImageGlob) ImageRef(repo string) string {
+	ref := g.Registry.Name() + "/" + repo
+	if len(g.tag) > 0 {
+		ref += ":" + g.tag
+	}
+	return ref
+}
+
+// RelativePath returns part of matched repository name that follows pattern's directory prefix
+func (g ImageGlob) RelativePath(repo string) string {
+	return strings.TrimPrefix(repo, g.prefix)
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImageGlobMatch(t *testing.T) {
+	glob, err := NewImageGlob("registry.io:5000/team/app-*:v1")
+	if err != nil {
+		t.Fatalf("Expected parsing to succeed: %s", err)
+	}
+
+	if glob.Registry.Name() != "registry.io:5000" {
+		t.Fatalf("Expected registry to be parsed, but was '%s'", glob.Registry.Name())
+	}
+
+	matched := glob.Match([]string{"team/app-b", "team/app-a", "team/other", "team/app-a/nested", "app-c"})
+	if !reflect.DeepEqual(matched, []string{"team/app-a", "team/app-b"}) {
+		t.Fatalf("Expected matched repositories, but was: %v", matched)
+	}
+
+	if ref := glob.ImageRef("team/app-a"); ref != "registry.io:5000/team/app-a:v1" {
+		t.Fatalf("Expected image ref to include tag, but was '%s'", ref)
+	}
+
+	if path := glob.RelativePath("team/app-a"); path != "app-a" {
+		t.Fatalf("Expected relative path to exclude prefix, but was '%s'", path)
+	}
+}
+
+func TestImageGlobInvalid(t *testing.T) {
+	for _, ref := range []string{"registry.io/team/*@sha256:abc", "registry.io/team/[app"} {
+		_, err := NewImageGlob(ref)
+		if err == nil {
+			t.Fatalf("Expected parsing '%s' to fail", ref)
+		}
+	}
+}
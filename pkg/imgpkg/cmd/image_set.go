@@ -15,6 +15,13 @@ import (
 type ImageSet struct {
 	concurrency int
 	logger      *ctlimg.LoggerPrefixWriter
+
+	// preserveTags uploads images under their source tags
+	// instead of generated imgpkg-sha256-... tags
+	preserveTags bool
+
+	// repoTemplate computes import repository per image when set
+	repoTemplate *RepoTemplate
 }
 
 func (o ImageSet) Relocate(foundImages *UnprocessedImageURLs,
@@ -80,7 +87,17 @@ func (o *ImageSet) Import(imgOrIndexes []imagedesc.ImageOrIndex,
 				return
 			}
 
-			importDigestRef, err := o.importImage(item, existingRef, importRepo, registry)
+			itemImportRepo := importRepo
+
+			if o.repoTemplate != nil {
+				itemImportRepo, err = o.repoTemplate.Repository(existingRef)
+				if err != nil {
+					errCh <- err
+					return
+				}
+			}
+
+			importDigestRef, err := o.importImage(item, existingRef, itemImportRepo, registry)
 			if err != nil {
 				errCh <- fmt.Errorf("Importing image %s: %s", existingRef.Name(), err)
 				return
@@ -127,6 +144,11 @@ func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
 		}
 	}
 
+	// Signature artifacts are discovered by their tags
+	if (o.preserveTags || isSignatureArtifactTag(item.Tag())) && item.Tag() != "" {
+		tag = item.Tag()
+	}
+
 	// Seems like AWS ECR doesnt like using digests for manifest uploads
 	uploadTagRef, err := regname.NewTag(fmt.Sprintf("%s:%s", importRepo.Name(), tag))
 	if err != nil {
@@ -135,15 +157,20 @@ func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
 
 	o.logger.Write([]byte(fmt.Sprintf("importing %s -> %s...\n", existingRef.Name(), importDigestRef.Name())))
 
+	reportProgress := func(progress ctlimg.LayerProgress) {
+		o.logger.WriteStr("transferred %d/%d bytes of layer %s (%s)\n",
+			progress.Transferred, progress.Total, progress.Digest, existingRef.Name())
+	}
+
 	switch {
 	case item.Image != nil:
-		err = registry.WriteImage(uploadTagRef, *item.Image)
+		err = registry.WriteImage(uploadTagRef, ctlimg.NewProgressImage(*item.Image, reportProgress))
 		if err != nil {
 			return regname.Digest{}, fmt.Errorf("Importing image as %s: %s", importDigestRef.Name(), err)
 		}
 
 	case item.Index != nil:
-		err = registry.WriteIndex(uploadTagRef, *item.Index)
+		err = registry.WriteIndex(uploadTagRef, ctlimg.NewProgressIndex(*item.Index, reportProgress))
 		if err != nil {
 			return regname.Digest{}, fmt.Errorf("Importing image index as %s: %s", importDigestRef.Name(), err)
 		}
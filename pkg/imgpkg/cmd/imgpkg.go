@@ -14,7 +14,8 @@ import (
 type ImgpkgOptions struct {
 	ui *ui.ConfUI
 
-	UIFlags UIFlags
+	UIFlags      UIFlags
+	WarningFlags WarningFlags
 }
 
 func NewImgpkgOptions(ui *ui.ConfUI) *ImgpkgOptions {
@@ -39,22 +40,42 @@ func NewImgpkgCmd(o *ImgpkgOptions) *cobra.Command {
 	cmd.SetOutput(uiBlockWriter{o.ui}) // setting output for cmd.Help()
 
 	o.UIFlags.Set(cmd)
-
-	cmd.AddCommand(NewPushCmd(NewPushOptions(o.ui)))
-	cmd.AddCommand(NewPullCmd(NewPullOptions(o.ui)))
-	cmd.AddCommand(NewVersionCmd(NewVersionOptions(o.ui)))
-	cmd.AddCommand(NewCopyCmd(NewCopyOptions(o.ui)))
+	o.WarningFlags.Set(cmd)
+
+	// All commands print warnings via shared UI so that they are
+	// included in JSON output as a table and fail with --strict
+	warningsUI := NewWarningsUI(o.ui)
+
+	cmd.AddCommand(NewPushCmd(NewPushOptions(warningsUI)))
+	cmd.AddCommand(NewPullCmd(NewPullOptions(warningsUI)))
+	cmd.AddCommand(NewVersionCmd(NewVersionOptions(warningsUI)))
+	cmd.AddCommand(NewCopyCmd(NewCopyOptions(warningsUI)))
+	cmd.AddCommand(NewLockCmd(NewLockOptions(warningsUI)))
+	cmd.AddCommand(NewResolveCmd(NewResolveOptions(warningsUI)))
+	cmd.AddCommand(NewLayersCmd(NewLayersOptions(warningsUI)))
+	cmd.AddCommand(NewListImagesCmd(NewListImagesOptions(warningsUI)))
+	cmd.AddCommand(NewLockDiffCmd(NewLockDiffOptions(warningsUI)))
+	cmd.AddCommand(NewLockVerifyCmd(NewLockVerifyOptions(warningsUI)))
+	cmd.AddCommand(NewFlattenCmd(NewFlattenOptions(warningsUI)))
 
 	tagCmd := NewTagCmd()
-	tagCmd.AddCommand(NewTagListCmd(NewTagListOptions(o.ui)))
+	tagCmd.AddCommand(NewTagListCmd(NewTagListOptions(warningsUI)))
 	cmd.AddCommand(tagCmd)
 
 	// Last one runs first
 	cobrautil.VisitCommands(cmd, cobrautil.ReconfigureCmdWithSubcmd)
 	cobrautil.VisitCommands(cmd, cobrautil.ReconfigureLeafCmd)
 
+	cobrautil.VisitCommands(cmd, printWarningsAfterRunE(warningsUI))
+
 	cobrautil.VisitCommands(cmd, cobrautil.WrapRunEForCmd(func(*cobra.Command, []string) error {
 		o.UIFlags.ConfigureUI(o.ui)
+		if o.UIFlags.JSON {
+			warningsUI.EnableJSON()
+		}
+		if o.WarningFlags.Strict {
+			warningsUI.EnableStrict()
+		}
 		return nil
 	}))
 
@@ -63,6 +84,32 @@ func NewImgpkgCmd(o *ImgpkgOptions) *cobra.Command {
 	return cmd
 }
 
+// printWarningsAfterRunE prints collected warnings even if command failed
+func printWarningsAfterRunE(warningsUI *WarningsUI) func(*cobra.Command) {
+	return func(cmd *cobra.Command) {
+		origRunE := cmd.RunE
+		cmd.RunE = func(cmd2 *cobra.Command, args []string) error {
+			defer warningsUI.PrintWarnings()
+			return origRunE(cmd2, args)
+		}
+	}
+}
+
+// PrintsOnlyResult returns true when executed command was asked to print only
+// its result (e.g. push with --quiet or --silent, or pull with --to-stdout
+// or --output-tar), hence nothing else should be printed
+func PrintsOnlyResult(cmd *cobra.Command) bool {
+	for _, name := range []string{"quiet", "silent", "to-stdout"} {
+		flag := cmd.Flags().Lookup(name)
+		if flag != nil && flag.Value.String() == "true" {
+			return true
+		}
+	}
+	// Output tar may be /dev/stdout
+	flag := cmd.Flags().Lookup("output-tar")
+	return flag != nil && flag.Value.String() != ""
+}
+
 type uiBlockWriter struct {
 	ui ui.UI
 }
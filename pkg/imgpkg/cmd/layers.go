@@ -0,0 +1,115 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/spf13/cobra"
+)
+
+type LayersOptions struct {
+	ui ui.UI
+
+	ImageFlags    ImageFlags
+	RegistryFlags RegistryFlags
+}
+
+func NewLayersOptions(ui ui.UI) *LayersOptions {
+	return &LayersOptions{ui: ui}
+}
+
+func NewLayersCmd(o *LayersOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "layers",
+		Short: "List image layers",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		Example: `
+  # List layers of image dkalinin/app1-image
+  imgpkg layers -i dkalinin/app1-image
+
+  # List layers as JSON
+  imgpkg layers -i dkalinin/app1-image --json`,
+	}
+	o.ImageFlags.Set(cmd)
+	o.RegistryFlags.Set(cmd)
+	return cmd
+}
+
+func (o *LayersOptions) Run() error {
+	if o.ImageFlags.Image == "" {
+		return fmt.Errorf("Expected image flag")
+	}
+
+	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+	}
+
+	ref, err := regname.ParseReference(o.ImageFlags.Image, regname.WeakValidation)
+	if err != nil {
+		return err
+	}
+
+	img, err := registry.Image(ref)
+	if err != nil {
+		return err
+	}
+
+	// Layer details come from manifest and config,
+	// hence no layer blobs are fetched
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	table := uitable.Table{
+		Title:   "Layers",
+		Content: "layers",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Digest"),
+			uitable.NewHeader("DiffID"),
+			uitable.NewHeader("Size"),
+			uitable.NewHeader("Media type"),
+		},
+	}
+
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return fmt.Errorf("Getting diff ID of layer '%s': %s", digest, err)
+		}
+
+		size, err := layer.Size()
+		if err != nil {
+			return err
+		}
+
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return err
+		}
+
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(digest.String()),
+			uitable.NewValueString(diffID.String()),
+			uitable.NewValueInt(int(size)),
+			uitable.NewValueString(string(mediaType)),
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestLayersListsImageLayers(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/image:latest"
+
+	tag, err := regname.NewTag(imageRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	out := &bytes.Buffer{}
+	jsonUI := ui.NewJSONUI(ui.NewWriterUI(out, &bytes.Buffer{}, nil), ui.NewNoopLogger())
+
+	layersOpts := LayersOptions{ui: jsonUI, ImageFlags: ImageFlags{Image: imageRef}}
+
+	err = layersOpts.Run()
+	if err != nil {
+		t.Fatalf("Expected layers to succeed: %s", err)
+	}
+
+	jsonUI.Flush()
+
+	var output struct {
+		Tables []struct {
+			Rows []map[string]string
+		}
+	}
+
+	err = json.Unmarshal(out.Bytes(), &output)
+	if err != nil {
+		t.Fatalf("Unmarshaling output: %s (output: %s)", err, out)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	if len(output.Tables) != 1 || len(output.Tables[0].Rows) != len(layers) {
+		t.Fatalf("Expected one row per layer, got: %s", out)
+	}
+
+	for i, layer := range layers {
+		digest, _ := layer.Digest()
+		diffID, _ := layer.DiffID()
+		size, _ := layer.Size()
+		mediaType, _ := layer.MediaType()
+
+		expectedRow := map[string]string{
+			"digest":     digest.String(),
+			"diffid":     diffID.String(),
+			"size":       fmt.Sprintf("%d", size),
+			"media_type": string(mediaType),
+		}
+
+		for key, val := range expectedRow {
+			if output.Tables[0].Rows[i][key] != val {
+				t.Fatalf("Expected layer %d '%s' to be '%s', got: %s", i, key, val, out)
+			}
+		}
+	}
+}
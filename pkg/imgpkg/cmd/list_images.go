@@ -0,0 +1,131 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+const (
+	listImagesSortByName   = "name"
+	listImagesSortByDigest = "digest"
+)
+
+type ListImagesOptions struct {
+	ui ui.UI
+
+	BundleFlags   BundleFlags
+	RegistryFlags RegistryFlags
+	SortBy        string
+}
+
+func NewListImagesOptions(ui ui.UI) *ListImagesOptions {
+	return &ListImagesOptions{ui: ui}
+}
+
+func NewListImagesCmd(o *ListImagesOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-images",
+		Short: "List images referenced by bundle",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		Example: `
+  # List images referenced by bundle dkalinin/app1-bundle
+  imgpkg list-images -b dkalinin/app1-bundle
+
+  # List images ordered by digest
+  imgpkg list-images -b dkalinin/app1-bundle --sort-by digest`,
+	}
+	o.BundleFlags.Set(cmd)
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().StringVar(&o.SortBy, "sort-by", listImagesSortByName, "Sort images by 'name' or 'digest'")
+	return cmd
+}
+
+type listedImage struct {
+	Name   string
+	Digest string
+}
+
+func (o *ListImagesOptions) Run() error {
+	if o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected bundle flag")
+	}
+
+	sortBy := o.SortBy
+	if sortBy == "" {
+		sortBy = listImagesSortByName
+	}
+	if sortBy != listImagesSortByName && sortBy != listImagesSortByDigest {
+		return fmt.Errorf("Unsupported sort by '%s' (supported: %s, %s)", o.SortBy, listImagesSortByName, listImagesSortByDigest)
+	}
+
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
+	if err != nil {
+		return err
+	}
+
+	ref, err := regname.ParseReference(o.BundleFlags.Bundle, regname.WeakValidation)
+	if err != nil {
+		return err
+	}
+
+	images, err := GetReferencedImages(ref, lockLocation, o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Reading bundle image lock: %s", err)
+	}
+
+	var listedImages []listedImage
+
+	for _, img := range images {
+		digestRef, err := regname.NewDigest(img.Image)
+		if err != nil {
+			return fmt.Errorf("Parsing image '%s': %s", img.Image, err)
+		}
+		listedImages = append(listedImages, listedImage{digestRef.Context().Name(), digestRef.DigestStr()})
+	}
+
+	// Secondary key keeps order stable when primary key is the same
+	sortKeys := func(img listedImage) (string, string) {
+		if sortBy == listImagesSortByDigest {
+			return img.Digest, img.Name
+		}
+		return img.Name, img.Digest
+	}
+
+	sort.SliceStable(listedImages, func(i, j int) bool {
+		iPrimary, iSecondary := sortKeys(listedImages[i])
+		jPrimary, jSecondary := sortKeys(listedImages[j])
+		if iPrimary != jPrimary {
+			return iPrimary < jPrimary
+		}
+		return iSecondary < jSecondary
+	})
+
+	table := uitable.Table{
+		Title:   "Images",
+		Content: "images",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Name"),
+			uitable.NewHeader("Digest"),
+		},
+	}
+
+	for _, img := range listedImages {
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(img.Name),
+			uitable.NewValueString(img.Digest),
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+func TestListImagesSortBy(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	host := registryHost(server)
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+host+`/repo/b@sha256:1111111111111111111111111111111111111111111111111111111111111111
+  - image: `+host+`/repo/c@sha256:0000000000000000000000000000000000000000000000000000000000000000
+  - image: `+host+`/repo/a@sha256:2222222222222222222222222222222222222222222222222222222222222222
+`)
+
+	listImages := func(sortBy string) []string {
+		out := &bytes.Buffer{}
+		jsonUI := ui.NewJSONUI(ui.NewWriterUI(out, &bytes.Buffer{}, nil), ui.NewNoopLogger())
+
+		opts := ListImagesOptions{ui: jsonUI, BundleFlags: BundleFlags{Bundle: bundleRef}, SortBy: sortBy}
+
+		err := opts.Run()
+		if err != nil {
+			t.Fatalf("Expected list images to succeed: %s", err)
+		}
+
+		jsonUI.Flush()
+
+		var output struct {
+			Tables []struct {
+				Rows []map[string]string
+			}
+		}
+
+		err = json.Unmarshal(out.Bytes(), &output)
+		if err != nil {
+			t.Fatalf("Unmarshaling output: %s (output: %s)", err, out)
+		}
+
+		var names []string
+		for _, row := range output.Tables[0].Rows {
+			names = append(names, row["name"])
+		}
+		return names
+	}
+
+	// name is default
+	expectedByName := []string{host + "/repo/a", host + "/repo/b", host + "/repo/c"}
+	if names := listImages(""); !reflect.DeepEqual(names, expectedByName) {
+		t.Fatalf("Expected images sorted by name, got: %v", names)
+	}
+
+	expectedByDigest := []string{host + "/repo/c", host + "/repo/b", host + "/repo/a"}
+	if names := listImages("digest"); !reflect.DeepEqual(names, expectedByDigest) {
+		t.Fatalf("Expected images sorted by digest, got: %v", names)
+	}
+}
+
+func TestListImagesUnsupportedSortByError(t *testing.T) {
+	opts := ListImagesOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: "repo/bundle"}, SortBy: "size"}
+
+	err := opts.Run()
+	if err == nil {
+		t.Fatalf("Expected unsupported sort by to fail")
+	}
+}
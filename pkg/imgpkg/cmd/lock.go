@@ -0,0 +1,87 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type LockOptions struct {
+	ui ui.UI
+
+	BundleFlags   BundleFlags
+	RegistryFlags RegistryFlags
+	OutputPath    string
+}
+
+func NewLockOptions(ui ui.UI) *LockOptions {
+	return &LockOptions{ui: ui}
+}
+
+func NewLockCmd(o *LockOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Write ImagesLock of bundle without pulling its contents",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		Example: `
+  # Write images referenced by bundle dkalinin/app1-bundle into images.yml
+  imgpkg lock -b dkalinin/app1-bundle -o images.yml`,
+	}
+	o.BundleFlags.Set(cmd)
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().StringVarP(&o.OutputPath, "output", "o", "", "Output ImagesLock file path")
+	cmd.MarkFlagRequired("output")
+	return cmd
+}
+
+func (o *LockOptions) Run() error {
+	if o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected bundle flag")
+	}
+
+	if o.OutputPath == "" {
+		return fmt.Errorf("Expected output flag")
+	}
+
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
+	if err != nil {
+		return err
+	}
+
+	ref, err := regname.ParseReference(o.BundleFlags.Bundle, regname.WeakValidation)
+	if err != nil {
+		return err
+	}
+
+	images, err := GetReferencedImages(ref, lockLocation, o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Reading bundle image lock: %s", err)
+	}
+
+	imgLock := ImageLock{
+		ApiVersion: ImageLockAPIVersion,
+		Kind:       ImageLockKind,
+		Spec:       ImageSpec{Images: images},
+	}
+
+	imgLockBytes, err := yaml.Marshal(imgLock)
+	if err != nil {
+		return fmt.Errorf("Marshalling image lock file: %s", err)
+	}
+
+	err = ioutil.WriteFile(o.OutputPath, append([]byte("---\n"), imgLockBytes...), 0600)
+	if err != nil {
+		return fmt.Errorf("Writing image lock file: %s", err)
+	}
+
+	o.ui.BeginLinef("Wrote %d image(s) referenced by bundle '%s' to '%s'\n", len(images), ref.Name(), o.OutputPath)
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+type LockDiffOptions struct {
+	ui ui.UI
+
+	OldPath string
+	NewPath string
+}
+
+// LockDiff describes image changes between two lock files
+// (images are matched by repository)
+type LockDiff struct {
+	Added   []LockDiffImage  `json:"added"`
+	Removed []LockDiffImage  `json:"removed"`
+	Changed []LockDiffChange `json:"changed"`
+}
+
+type LockDiffImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+type LockDiffChange struct {
+	Image     string `json:"image"`
+	OldDigest string `json:"oldDigest"`
+	NewDigest string `json:"newDigest"`
+}
+
+func NewLockDiffOptions(ui ui.UI) *LockDiffOptions {
+	return &LockDiffOptions{ui: ui}
+}
+
+func NewLockDiffCmd(o *LockDiffOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock-diff OLD-LOCK NEW-LOCK",
+		Short: "Compare images in two ImagesLock or BundleLock files (prints JSON)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			o.OldPath, o.NewPath = args[0], args[1]
+			return o.Run()
+		},
+		Example: `
+  # Compare images locked in images.yml before and after update
+  imgpkg lock-diff old/images.yml new/images.yml`,
+	}
+	return cmd
+}
+
+func (o *LockDiffOptions) Run() error {
+	oldImages, err := readLockDiffImages(o.OldPath)
+	if err != nil {
+		return err
+	}
+
+	newImages, err := readLockDiffImages(o.NewPath)
+	if err != nil {
+		return err
+	}
+
+	diffBytes, err := json.MarshalIndent(NewLockDiff(oldImages, newImages), "", "  ")
+	if err != nil {
+		return fmt.Errorf("Marshaling lock diff: %s", err)
+	}
+
+	o.ui.PrintBlock(append(diffBytes, '\n'))
+
+	return nil
+}
+
+// NewLockDiff compares digest refs; repository with a single digest on each side
+// is reported as changed, otherwise differing digests are reported as added or removed
+func NewLockDiff(oldImages, newImages []regname.Digest) LockDiff {
+	diff := LockDiff{Added: []LockDiffImage{}, Removed: []LockDiffImage{}, Changed: []LockDiffChange{}}
+
+	oldDigests := lockDiffDigestsByRepo(oldImages)
+	newDigests := lockDiffDigestsByRepo(newImages)
+
+	var repos []string
+	for repo := range oldDigests {
+		repos = append(repos, repo)
+	}
+	for repo := range newDigests {
+		if _, found := oldDigests[repo]; !found {
+			repos = append(repos, repo)
+		}
+	}
+	sort.Strings(repos)
+
+	for _, repo := range repos {
+		removed := lockDiffSubtract(oldDigests[repo], newDigests[repo])
+		added := lockDiffSubtract(newDigests[repo], oldDigests[repo])
+
+		if len(removed) == 1 && len(added) == 1 {
+			diff.Changed = append(diff.Changed, LockDiffChange{Image: repo, OldDigest: removed[0], NewDigest: added[0]})
+			continue
+		}
+
+		for _, digest := range removed {
+			diff.Removed = append(diff.Removed, LockDiffImage{Image: repo, Digest: digest})
+		}
+		for _, digest := range added {
+			diff.Added = append(diff.Added, LockDiffImage{Image: repo, Digest: digest})
+		}
+	}
+
+	return diff
+}
+
+func readLockDiffImages(path string) ([]regname.Digest, error) {
+	lock, err := ReadLockFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading lock file '%s': %s", path, err)
+	}
+
+	var refs []string
+
+	switch lock.Kind {
+	case BundleLockKind:
+		bundleLock, err := ReadBundleLockFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Reading bundle lock file '%s': %s", path, err)
+		}
+		refs = append(refs, bundleLock.Spec.Image.DigestRef)
+
+	case ImageLockKind, "ImagesLock":
+		imgLock, err := ReadImageLockFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Reading image lock file '%s': %s", path, err)
+		}
+		for _, img := range imgLock.Spec.Images {
+			refs = append(refs, img.Image)
+		}
+
+	default:
+		return nil, fmt.Errorf("Unexpected lock kind in '%s', expected BundleLock or ImagesLock, got: %v", path, lock.Kind)
+	}
+
+	var digests []regname.Digest
+
+	for _, ref := range refs {
+		digest, err := regname.NewDigest(ref)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing image '%s' in '%s': %s", ref, path, err)
+		}
+		digests = append(digests, digest)
+	}
+
+	return digests, nil
+}
+
+func lockDiffDigestsByRepo(images []regname.Digest) map[string][]string {
+	result := map[string][]string{}
+	for _, img := range images {
+		repo := img.Context().Name()
+		result[repo] = append(result[repo], img.DigestStr())
+	}
+	return result
+}
+
+// lockDiffSubtract returns sorted unique digests found in a but not in b
+func lockDiffSubtract(a, b []string) []string {
+	excluded := map[string]bool{}
+	for _, digest := range b {
+		excluded[digest] = true
+	}
+
+	var result []string
+	for _, digest := range a {
+		if !excluded[digest] {
+			excluded[digest] = true
+			result = append(result, digest)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
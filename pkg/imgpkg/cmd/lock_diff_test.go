@@ -0,0 +1,163 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+const (
+	lockDiffDigest1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	lockDiffDigest2 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	lockDiffDigest3 = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func TestLockDiffImagesLocks(t *testing.T) {
+	oldLock := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: registry.io/app@` + lockDiffDigest1 + `
+  - image: registry.io/removed@` + lockDiffDigest1 + `
+  - image: registry.io/same@` + lockDiffDigest3 + `
+`
+	newLock := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: registry.io/same@` + lockDiffDigest3 + `
+  - image: registry.io/app@` + lockDiffDigest2 + `
+  - image: registry.io/added@` + lockDiffDigest2 + `
+`
+
+	diff := runLockDiff(t, oldLock, newLock)
+
+	expectedDiff := LockDiff{
+		Added:   []LockDiffImage{{Image: "registry.io/added", Digest: lockDiffDigest2}},
+		Removed: []LockDiffImage{{Image: "registry.io/removed", Digest: lockDiffDigest1}},
+		Changed: []LockDiffChange{{Image: "registry.io/app", OldDigest: lockDiffDigest1, NewDigest: lockDiffDigest2}},
+	}
+
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Fatalf("Expected diff %#v, but was %#v", expectedDiff, diff)
+	}
+}
+
+func TestLockDiffRepositoryWithMultipleDigests(t *testing.T) {
+	oldLock := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: registry.io/app@` + lockDiffDigest1 + `
+  - image: registry.io/app@` + lockDiffDigest2 + `
+`
+	newLock := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: registry.io/app@` + lockDiffDigest3 + `
+`
+
+	diff := runLockDiff(t, oldLock, newLock)
+
+	expectedDiff := LockDiff{
+		Added: []LockDiffImage{{Image: "registry.io/app", Digest: lockDiffDigest3}},
+		Removed: []LockDiffImage{
+			{Image: "registry.io/app", Digest: lockDiffDigest1},
+			{Image: "registry.io/app", Digest: lockDiffDigest2},
+		},
+		Changed: []LockDiffChange{},
+	}
+
+	if !reflect.DeepEqual(diff, expectedDiff) {
+		t.Fatalf("Expected diff %#v, but was %#v", expectedDiff, diff)
+	}
+}
+
+func TestLockDiffBundleLocks(t *testing.T) {
+	bundleLock := func(digest string) string {
+		return `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: BundleLock
+spec:
+  image:
+    url: registry.io/bundle@` + digest + `
+    tag: v1
+`
+	}
+
+	diff := runLockDiff(t, bundleLock(lockDiffDigest1), bundleLock(lockDiffDigest1))
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Fatalf("Expected no differences, but was %#v", diff)
+	}
+
+	diff = runLockDiff(t, bundleLock(lockDiffDigest1), bundleLock(lockDiffDigest2))
+	if len(diff.Changed) != 1 || diff.Changed[0].NewDigest != lockDiffDigest2 {
+		t.Fatalf("Expected bundle digest change, but was %#v", diff)
+	}
+}
+
+func TestLockDiffUnknownKindError(t *testing.T) {
+	oldLock := "apiVersion: v1\nkind: ConfigMap\n"
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-lock-diff")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "lock.yml")
+
+	err = ioutil.WriteFile(path, []byte(oldLock), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	err = (&LockDiffOptions{ui: ui.NewNoopUI(), OldPath: path, NewPath: path}).Run()
+	if err == nil || !strings.Contains(err.Error(), "Unexpected lock kind") {
+		t.Fatalf("Expected unknown lock kind to fail, but was: %v", err)
+	}
+}
+
+func runLockDiff(t *testing.T, oldLock, newLock string) LockDiff {
+	tmpDir, err := ioutil.TempDir("", "imgpkg-lock-diff")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	oldPath := filepath.Join(tmpDir, "old.yml")
+	newPath := filepath.Join(tmpDir, "new.yml")
+
+	for path, contents := range map[string]string{oldPath: oldLock, newPath: newLock} {
+		err := ioutil.WriteFile(path, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing lock file: %s", err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+
+	err = (&LockDiffOptions{ui: ui.NewWriterUI(out, &bytes.Buffer{}, nil), OldPath: oldPath, NewPath: newPath}).Run()
+	if err != nil {
+		t.Fatalf("Expected lock diff to succeed: %s", err)
+	}
+
+	var diff LockDiff
+
+	err = json.Unmarshal(out.Bytes(), &diff)
+	if err != nil {
+		t.Fatalf("Unmarshaling output: %s (output: %s)", err, out)
+	}
+
+	return diff
+}
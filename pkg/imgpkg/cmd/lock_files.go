@@ -6,6 +6,8 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 
 	regname "github.com/google/go-containerregistry/pkg/name"
 	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
@@ -20,8 +22,43 @@ const (
 
 	ImageLockAPIVersion  string = "imgpkg.carvel.dev/v1alpha1"
 	BundleLockAPIVersion string = "imgpkg.carvel.dev/v1alpha1"
+
+	// CopiedFromAnnotation records source ref of image in ImagesLock written by copy
+	CopiedFromAnnotation string = "imgpkg.carvel.dev/copied-from"
 )
 
+// ImageLockLocation describes where ImageLock is located within a bundle
+type ImageLockLocation struct {
+	BundleDir     string
+	ImageLockFile string
+}
+
+var DefaultImageLockLocation = ImageLockLocation{BundleDir, ImageLockFile}
+
+// NewImageLockLocation parses path in the form of '<dir>/<file>' (e.g. .imgpkg/images.yml)
+func NewImageLockLocation(path string) (ImageLockLocation, error) {
+	if len(path) == 0 {
+		return DefaultImageLockLocation, nil
+	}
+
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	if filepath.IsAbs(path) || len(parts) != 2 || parts[0] == ".." || parts[0] == "." {
+		return ImageLockLocation{}, fmt.Errorf("Expected image lock path to be in the form of '<dir>/<file>' (e.g. %s/%s), got '%s'", BundleDir, ImageLockFile, path)
+	}
+
+	return ImageLockLocation{BundleDir: parts[0], ImageLockFile: parts[1]}, nil
+}
+
+// Path returns image lock location within given bundle root directory
+func (l ImageLockLocation) Path(bundleRoot string) string {
+	return filepath.Join(bundleRoot, l.BundleDir, l.ImageLockFile)
+}
+
+// MatchesTarEntry checks if tar entry name (relative to bundle root) is an image lock
+func (l ImageLockLocation) MatchesTarEntry(name string) bool {
+	return filepath.Dir(name) == l.BundleDir && filepath.Base(name) == l.ImageLockFile
+}
+
 type BundleLock struct {
 	ApiVersion string `yaml:"apiVersion"`
 	Kind       string `yaml:"kind"`
@@ -48,11 +85,10 @@ func (il *ImageLock) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 
-	for _, image := range alias.Spec.Images {
+	for i, image := range alias.Spec.Images {
 		if _, err := name.NewDigest(image.Image); err != nil {
-			return fmt.Errorf("Expected ref to be in digest form, got %s", image.Image)
+			return fmt.Errorf("Expected ref to be in digest form, got %s (field 'spec.images[%d].image')", image.Image, i)
 		}
-
 	}
 
 	*il = ImageLock(alias)
@@ -65,6 +101,8 @@ type ImageSpec struct {
 }
 
 type ImageDesc struct {
+	// Name optionally identifies image within lock (e.g. frontend)
+	Name        string `yaml:"name,omitempty"`
 	Image       string
 	Annotations map[string]string
 }
@@ -89,15 +127,75 @@ func ReadLockFile(path string) (Lock, error) {
 func ReadBundleLockFile(path string) (BundleLock, error) {
 	var bundleLock BundleLock
 	err := readPathInto(path, &bundleLock)
+	if err != nil {
+		return bundleLock, err
+	}
+
+	err = bundleLock.Validate()
+	if err != nil {
+		return BundleLock{}, fmt.Errorf("Validating bundle lock '%s': %s", path, err)
+	}
 
-	return bundleLock, err
+	return bundleLock, nil
 }
 
 func ReadImageLockFile(path string) (ImageLock, error) {
 	var imgLock ImageLock
 	err := readPathInto(path, &imgLock)
+	if err != nil {
+		return imgLock, err
+	}
 
-	return imgLock, err
+	err = imgLock.Validate()
+	if err != nil {
+		return ImageLock{}, fmt.Errorf("Validating image lock '%s': %s", path, err)
+	}
+
+	return imgLock, nil
+}
+
+// ReadImageLockFileResolvingTags reads image lock that may reference images
+// by tag, and resolves such references to digests (e.g. for relocation)
+func ReadImageLockFileResolvingTags(path string, reg ctlimg.Registry) (ImageLock, error) {
+	// Avoids ImageLock's unmarshaling which rejects tag references
+	type unresolvedImageLock ImageLock
+
+	var lock unresolvedImageLock
+	err := readPathInto(path, &lock)
+	if err != nil {
+		return ImageLock{}, err
+	}
+
+	for i, img := range lock.Spec.Images {
+		if _, err := regname.NewDigest(img.Image); err == nil {
+			continue
+		}
+
+		ref, err := regname.ParseReference(img.Image, regname.WeakValidation)
+		if err != nil {
+			return ImageLock{}, fmt.Errorf("Parsing image '%s' (field 'spec.images[%d].image'): %s", img.Image, i, err)
+		}
+
+		desc, err := reg.Generic(ref)
+		if err != nil {
+			return ImageLock{}, fmt.Errorf("Resolving image '%s' to digest: %s", img.Image, err)
+		}
+
+		lock.Spec.Images[i].Image = ref.Context().Digest(desc.Digest.String()).Name()
+	}
+
+	imgLock := ImageLock(lock)
+
+	err = imgLock.Validate()
+	if err != nil {
+		return ImageLock{}, fmt.Errorf("Validating image lock '%s': %s", path, err)
+	}
+
+	return imgLock, nil
+}
+
+func ReadBundleImageLockFile(bundleRoot string, location ImageLockLocation) (ImageLock, error) {
+	return ReadImageLockFile(location.Path(bundleRoot))
 }
 
 func readPathInto(path string, obj interface{}) error {
@@ -109,6 +207,88 @@ func readPathInto(path string, obj interface{}) error {
 	return yaml.Unmarshal(bs, obj)
 }
 
+// Validate checks required fields and their formats
+func (bl BundleLock) Validate() error {
+	err := validateLockHeader(bl.ApiVersion, bl.Kind, BundleLockAPIVersion, []string{BundleLockKind})
+	if err != nil {
+		return err
+	}
+
+	if len(bl.Spec.Image.DigestRef) == 0 {
+		return fmt.Errorf("Expected field 'spec.image.url' to be set")
+	}
+
+	if _, err := regname.NewDigest(bl.Spec.Image.DigestRef); err != nil {
+		return fmt.Errorf("Expected field 'spec.image.url' to be in digest form (e.g. registry.io/repo@sha256:...), got '%s'", bl.Spec.Image.DigestRef)
+	}
+
+	return nil
+}
+
+// Validate checks required fields and their formats
+func (il ImageLock) Validate() error {
+	// ImageLock kind is produced by older imgpkg versions
+	err := validateLockHeader(il.ApiVersion, il.Kind, ImageLockAPIVersion, []string{"ImagesLock", ImageLockKind})
+	if err != nil {
+		return err
+	}
+
+	for i, img := range il.Spec.Images {
+		if len(img.Image) == 0 {
+			return fmt.Errorf("Expected field 'spec.images[%d].image' to be set", i)
+		}
+
+		if _, err := regname.NewDigest(img.Image); err != nil {
+			return fmt.Errorf("Expected field 'spec.images[%d].image' to be in digest form (e.g. registry.io/repo@sha256:...), got '%s'", i, img.Image)
+		}
+	}
+
+	return nil
+}
+
+func validateLockHeader(apiVersion, kind, expectedAPIVersion string, expectedKinds []string) error {
+	if apiVersion != expectedAPIVersion {
+		return fmt.Errorf("Expected field 'apiVersion' to be '%s', got '%s'", expectedAPIVersion, apiVersion)
+	}
+
+	for _, expectedKind := range expectedKinds {
+		if kind == expectedKind {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Expected field 'kind' to be one of '%s', got '%s'", strings.Join(expectedKinds, "', '"), kind)
+}
+
+// RelocatedImageLock returns copy of given lock with all images pointing
+// to destination repository (no registry requests are made)
+func RelocatedImageLock(lock ImageLock, destRepo string) (ImageLock, error) {
+	repo, err := regname.NewRepository(destRepo)
+	if err != nil {
+		return ImageLock{}, fmt.Errorf("Parsing destination repository '%s': %s", destRepo, err)
+	}
+
+	var imgDescs []ImageDesc
+
+	for _, img := range lock.Spec.Images {
+		relocatedImg, err := ImageWithRepository(img.Image, repo.Name())
+		if err != nil {
+			return ImageLock{}, err
+		}
+
+		_, err = regname.NewDigest(relocatedImg)
+		if err != nil {
+			return ImageLock{}, fmt.Errorf("Relocating image '%s': %s", img.Image, err)
+		}
+
+		imgDescs = append(imgDescs, ImageDesc{Name: img.Name, Image: relocatedImg, Annotations: img.Annotations})
+	}
+
+	lock.Spec.Images = imgDescs
+
+	return lock, nil
+}
+
 func (il *ImageLock) CheckForBundles(reg ctlimg.Registry) ([]string, error) {
 	var bundles []string
 	for _, img := range il.Spec.Images {
@@ -4,6 +4,9 @@
 package cmd_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -29,3 +32,187 @@ spec:
 		t.Fatalf("Expected unmarshal to fail due to tag ref in lock file")
 	}
 }
+
+func TestNewImageLockLocation(t *testing.T) {
+	loc, err := cmd.NewImageLockLocation("")
+	if err != nil {
+		t.Fatalf("Expected empty path to succeed: %s", err)
+	}
+	if loc != cmd.DefaultImageLockLocation {
+		t.Fatalf("Expected empty path to use default location, got: %#v", loc)
+	}
+
+	loc, err = cmd.NewImageLockLocation("./.bundle/lock.yml")
+	if err != nil {
+		t.Fatalf("Expected path to succeed: %s", err)
+	}
+	if loc.BundleDir != ".bundle" || loc.ImageLockFile != "lock.yml" {
+		t.Fatalf("Expected location to be parsed, got: %#v", loc)
+	}
+
+	for _, path := range []string{"images.yml", "a/b/images.yml", "../images.yml", "/images.yml"} {
+		_, err := cmd.NewImageLockLocation(path)
+		if err == nil {
+			t.Fatalf("Expected path '%s' to be rejected", path)
+		}
+	}
+}
+
+func TestReadBundleImageLockFileFromCustomLocation(t *testing.T) {
+	bundleRoot, err := ioutil.TempDir("", "imgpkg-image-lock-location")
+	if err != nil {
+		t.Fatalf("Creating bundle dir: %s", err)
+	}
+	defer os.RemoveAll(bundleRoot)
+
+	loc, err := cmd.NewImageLockLocation(".bundle/lock.yml")
+	if err != nil {
+		t.Fatalf("Parsing location: %s", err)
+	}
+
+	err = os.Mkdir(filepath.Join(bundleRoot, ".bundle"), 0700)
+	if err != nil {
+		t.Fatalf("Creating lock dir: %s", err)
+	}
+
+	imageLockYaml := []byte(`apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: index.docker.io/library/nginx@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2`)
+
+	err = ioutil.WriteFile(loc.Path(bundleRoot), imageLockYaml, 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	imageLock, err := cmd.ReadBundleImageLockFile(bundleRoot, loc)
+	if err != nil {
+		t.Fatalf("Expected reading lock file to succeed: %s", err)
+	}
+
+	if len(imageLock.Spec.Images) != 1 {
+		t.Fatalf("Expected one image, got: %#v", imageLock.Spec.Images)
+	}
+
+	if !loc.MatchesTarEntry(".bundle/lock.yml") || loc.MatchesTarEntry(".imgpkg/images.yml") {
+		t.Fatalf("Expected only custom location to match tar entries")
+	}
+}
+
+func TestRelocatedImageLockRewritesRepositories(t *testing.T) {
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	lock := cmd.ImageLock{
+		ApiVersion: "imgpkg.carvel.dev/v1alpha1",
+		Kind:       "ImagesLock",
+		Spec: cmd.ImageSpec{Images: []cmd.ImageDesc{
+			{Image: "registry.io:5000/team/app@" + digest, Annotations: map[string]string{"key": "val"}},
+			{Image: "other.io/deeply/nested/path/app@" + digest},
+		}},
+	}
+
+	for _, destRepo := range []string{"localhost:5000/dst/bundle", "registry.io/org/team/nested/bundle"} {
+		relocated, err := cmd.RelocatedImageLock(lock, destRepo)
+		if err != nil {
+			t.Fatalf("Expected relocation to succeed: %s", err)
+		}
+
+		if len(relocated.Spec.Images) != 2 {
+			t.Fatalf("Expected two images, but was: %v", relocated.Spec.Images)
+		}
+
+		for _, img := range relocated.Spec.Images {
+			if img.Image != destRepo+"@"+digest {
+				t.Fatalf("Expected image to be relocated to '%s', but was '%s'", destRepo, img.Image)
+			}
+		}
+
+		if relocated.Spec.Images[0].Annotations["key"] != "val" {
+			t.Fatalf("Expected annotations to be kept, but was: %v", relocated.Spec.Images[0].Annotations)
+		}
+		if relocated.Kind != "ImagesLock" {
+			t.Fatalf("Expected kind to be kept, but was '%s'", relocated.Kind)
+		}
+	}
+
+	if lock.Spec.Images[0].Image != "registry.io:5000/team/app@"+digest {
+		t.Fatalf("Expected original lock to be unchanged, but was '%s'", lock.Spec.Images[0].Image)
+	}
+}
+
+func TestRelocatedImageLockInvalidDestinationError(t *testing.T) {
+	_, err := cmd.RelocatedImageLock(cmd.ImageLock{}, "Invalid Repo")
+	if err == nil || !strings.Contains(err.Error(), "Parsing destination repository") {
+		t.Fatalf("Expected destination parsing error, but was: %v", err)
+	}
+}
+
+func TestReadLockFilesValidationErrors(t *testing.T) {
+	digestRef := "registry.io/repo/app@sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	cases := []struct {
+		Desc        string
+		Contents    string
+		BundleLock  bool
+		ExpectedErr string
+	}{
+		{
+			Desc:        "image lock with wrong apiVersion",
+			Contents:    "apiVersion: v1\nkind: ImagesLock\nspec:\n  images: []",
+			ExpectedErr: "Expected field 'apiVersion' to be 'imgpkg.carvel.dev/v1alpha1', got 'v1'",
+		},
+		{
+			Desc:        "image lock without kind",
+			Contents:    "apiVersion: imgpkg.carvel.dev/v1alpha1\nspec:\n  images: []",
+			ExpectedErr: "Expected field 'kind' to be one of 'ImagesLock', 'ImageLock', got ''",
+		},
+		{
+			Desc:        "image lock with tag ref",
+			Contents:    "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n  - image: " + digestRef + "\n  - image: nginx:v1",
+			ExpectedErr: "Expected ref to be in digest form, got nginx:v1 (field 'spec.images[1].image')",
+		},
+		{
+			Desc:        "bundle lock with image lock kind",
+			Contents:    "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  image:\n    url: " + digestRef,
+			BundleLock:  true,
+			ExpectedErr: "Expected field 'kind' to be one of 'BundleLock', got 'ImagesLock'",
+		},
+		{
+			Desc:        "bundle lock without url",
+			Contents:    "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: BundleLock\nspec:\n  image:\n    tag: v1",
+			BundleLock:  true,
+			ExpectedErr: "Expected field 'spec.image.url' to be set",
+		},
+		{
+			Desc:        "bundle lock with tag url",
+			Contents:    "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: BundleLock\nspec:\n  image:\n    url: registry.io/repo/bundle:v1",
+			BundleLock:  true,
+			ExpectedErr: "Expected field 'spec.image.url' to be in digest form (e.g. registry.io/repo@sha256:...), got 'registry.io/repo/bundle:v1'",
+		},
+	}
+
+	for _, tc := range cases {
+		lockFile, err := ioutil.TempFile("", "imgpkg-lock-validation")
+		if err != nil {
+			t.Fatalf("Creating lock file: %s", err)
+		}
+		defer os.Remove(lockFile.Name())
+
+		_, err = lockFile.Write([]byte(tc.Contents))
+		lockFile.Close()
+		if err != nil {
+			t.Fatalf("Writing lock file: %s", err)
+		}
+
+		if tc.BundleLock {
+			_, err = cmd.ReadBundleLockFile(lockFile.Name())
+		} else {
+			_, err = cmd.ReadImageLockFile(lockFile.Name())
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectedErr) {
+			t.Fatalf("Expected %s to fail with '%s', but was: %v", tc.Desc, tc.ExpectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+func TestLockWritesBundleImageLock(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	imageRef := "index.docker.io/library/nginx@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2"
+	imagesYaml := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: ` + imageRef + `
+    annotations:
+      kbld.carvel.dev/id: nginx
+`
+
+	bundleRef := writeBundle(t, server, "repo/bundle", imagesYaml)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-lock")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	outputPath := filepath.Join(outputDir, "images.yml")
+
+	lock := LockOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputPath}
+
+	err = lock.Run()
+	if err != nil {
+		t.Fatalf("Expected lock to succeed: %s", err)
+	}
+
+	imgLock, err := ReadImageLockFile(outputPath)
+	if err != nil {
+		t.Fatalf("Expected output to be parseable ImagesLock: %s", err)
+	}
+
+	if imgLock.ApiVersion != ImageLockAPIVersion || imgLock.Kind != ImageLockKind {
+		t.Fatalf("Expected ImagesLock kind and api version, got: %s %s", imgLock.ApiVersion, imgLock.Kind)
+	}
+
+	if len(imgLock.Spec.Images) != 1 || imgLock.Spec.Images[0].Image != imageRef {
+		t.Fatalf("Expected lock to contain '%s', got: %#v", imageRef, imgLock.Spec.Images)
+	}
+
+	if imgLock.Spec.Images[0].Annotations["kbld.carvel.dev/id"] != "nginx" {
+		t.Fatalf("Expected annotations to be preserved, got: %#v", imgLock.Spec.Images[0].Annotations)
+	}
+}
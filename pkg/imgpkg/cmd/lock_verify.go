@@ -0,0 +1,157 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/k14s/imgpkg/pkg/imgpkg/util"
+	"github.com/spf13/cobra"
+)
+
+const (
+	lockVerifyStatusOK      = "ok"
+	lockVerifyStatusMissing = "missing"
+)
+
+type LockVerifyOptions struct {
+	ui ui.UI
+
+	RegistryFlags RegistryFlags
+
+	LockPath    string
+	Concurrency int
+}
+
+type lockVerifyResult struct {
+	Image  regname.Digest
+	Status string
+}
+
+func NewLockVerifyOptions(ui ui.UI) *LockVerifyOptions {
+	return &LockVerifyOptions{ui: ui}
+}
+
+func NewLockVerifyCmd(o *LockVerifyOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock-verify LOCK",
+		Short: "Verify that images in ImagesLock or BundleLock file exist in registry",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			o.LockPath = args[0]
+			return o.Run()
+		},
+		Example: `
+  # Check that all images locked in images.yml are still present
+  imgpkg lock-verify .imgpkg/images.yml`,
+	}
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().IntVar(&o.Concurrency, "concurrency", 5, "Set number of images checked in parallel")
+	return cmd
+}
+
+func (o *LockVerifyOptions) Run() error {
+	if o.Concurrency < 1 {
+		return fmt.Errorf("Expected --concurrency to be greater than 0")
+	}
+
+	images, err := readLockDiffImages(o.LockPath)
+	if err != nil {
+		return err
+	}
+
+	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+	}
+
+	results, err := o.verifyImages(images, registry)
+	if err != nil {
+		return err
+	}
+
+	table := uitable.Table{
+		Title:   "Images",
+		Content: "images",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Image"),
+			uitable.NewHeader("Digest"),
+			uitable.NewHeader("Status"),
+		},
+	}
+
+	var failed int
+
+	for _, result := range results {
+		if result.Status != lockVerifyStatusOK {
+			failed++
+		}
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(result.Image.Context().Name()),
+			uitable.NewValueString(result.Image.DigestStr()),
+			uitable.ValueFmt{V: uitable.NewValueString(result.Status), Error: result.Status != lockVerifyStatusOK},
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	if failed > 0 {
+		return fmt.Errorf("Expected all %d image(s) in '%s' to resolve to locked digests, but %d did not", len(results), o.LockPath, failed)
+	}
+
+	return nil
+}
+
+// verifyImages checks images in parallel; results keep order of lock file
+func (o *LockVerifyOptions) verifyImages(images []regname.Digest, registry ctlimg.Registry) ([]lockVerifyResult, error) {
+	results := make([]lockVerifyResult, len(images))
+	errCh := make(chan error, len(images))
+	verifyThrottle := util.NewThrottle(o.Concurrency)
+
+	for i, img := range images {
+		i, img := i, img // copy
+
+		go func() {
+			verifyThrottle.Take()
+			defer verifyThrottle.Done()
+
+			result, err := verifyLockedImage(img, registry)
+			if err != nil {
+				errCh <- fmt.Errorf("Checking image '%s': %s", img.Name(), err)
+				return
+			}
+
+			results[i] = result
+			errCh <- nil
+		}()
+	}
+
+	for i := 0; i < len(images); i++ {
+		err := <-errCh
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// verifyLockedImage checks that image exists; since it is fetched by digest
+// (content addressed), found image always matches locked digest
+func verifyLockedImage(img regname.Digest, registry ctlimg.Registry) (lockVerifyResult, error) {
+	_, err := registry.Generic(img)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return lockVerifyResult{Image: img, Status: lockVerifyStatusMissing}, nil
+		}
+		return lockVerifyResult{}, err
+	}
+
+	return lockVerifyResult{Image: img, Status: lockVerifyStatusOK}, nil
+}
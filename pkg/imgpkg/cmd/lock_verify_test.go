@@ -0,0 +1,118 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestLockVerifyReportsMissingDigests(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	host := registryHost(server)
+
+	img := buildImage(t, map[string]string{"file.txt": "contents"}, nil)
+
+	tag, err := regname.NewTag(host + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	missingDigest := "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	presentLock := `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: ` + host + `/repo/app@` + digest.String() + `
+`
+	mixedLock := presentLock + `  - image: ` + host + `/repo/app@` + missingDigest + `
+  - image: ` + host + `/repo/gone@` + digest.String() + `
+`
+
+	statuses, err := runLockVerify(t, presentLock)
+	if err != nil {
+		t.Fatalf("Expected lock verify to succeed: %s", err)
+	}
+	if !reflect.DeepEqual(statuses, []string{"ok"}) {
+		t.Fatalf("Expected present image to be reported as ok, but was: %v", statuses)
+	}
+
+	statuses, err = runLockVerify(t, mixedLock)
+	if err == nil || !strings.Contains(err.Error(), "Expected all 3 image(s)") || !strings.Contains(err.Error(), "but 2 did not") {
+		t.Fatalf("Expected lock verify to fail for missing images, but was: %v", err)
+	}
+	if !reflect.DeepEqual(statuses, []string{"ok", "missing", "missing"}) {
+		t.Fatalf("Expected missing images to be reported in lock order, but was: %v", statuses)
+	}
+}
+
+func TestLockVerifyRequiresPositiveConcurrency(t *testing.T) {
+	err := (&LockVerifyOptions{ui: ui.NewNoopUI(), LockPath: "images.yml"}).Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --concurrency to be greater than 0") {
+		t.Fatalf("Expected concurrency validation error, but was: %v", err)
+	}
+}
+
+func runLockVerify(t *testing.T, lock string) ([]string, error) {
+	tmpDir, err := ioutil.TempDir("", "imgpkg-lock-verify")
+	if err != nil {
+		t.Fatalf("Creating tmp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	lockPath := filepath.Join(tmpDir, "images.yml")
+
+	err = ioutil.WriteFile(lockPath, []byte(lock), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	out := &bytes.Buffer{}
+	jsonUI := ui.NewJSONUI(ui.NewWriterUI(out, &bytes.Buffer{}, nil), ui.NewNoopLogger())
+
+	runErr := (&LockVerifyOptions{ui: jsonUI, LockPath: lockPath, Concurrency: 2}).Run()
+
+	jsonUI.Flush()
+
+	var output struct {
+		Tables []struct {
+			Rows []map[string]string
+		}
+	}
+
+	err = json.Unmarshal(out.Bytes(), &output)
+	if err != nil {
+		t.Fatalf("Unmarshaling output: %s (output: %s)", err, out)
+	}
+
+	var statuses []string
+	for _, row := range output.Tables[0].Rows {
+		statuses = append(statuses, row["status"])
+	}
+
+	return statuses, runErr
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// newSiblingTempDir creates temporary directory next to given path
+// (so that it can be renamed into place), or in system temp directory
+// if it cannot be created there
+func newSiblingTempDir(path string, parentDirMode os.FileMode) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	parentPath := filepath.Dir(path)
+
+	err = os.MkdirAll(parentPath, parentDirMode)
+	if err == nil {
+		tmpPath, err := ioutil.TempDir(parentPath, "."+filepath.Base(path)+"-imgpkg-")
+		if err == nil {
+			return tmpPath, nil
+		}
+	}
+
+	return ioutil.TempDir("", "imgpkg-pull-")
+}
+
+// replaceDir moves srcPath into dstPath keeping existing dstPath
+// until srcPath is in place; contents are copied when rename
+// is not possible (e.g. paths are on different filesystems)
+func replaceDir(srcPath, dstPath string) error {
+	dstPath, err := filepath.Abs(dstPath)
+	if err != nil {
+		return err
+	}
+
+	backupPath := filepath.Join(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+"-imgpkg-old")
+
+	_, err = os.Lstat(dstPath)
+	switch {
+	case err == nil:
+		// Left over from previously interrupted pull
+		err = os.RemoveAll(backupPath)
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(dstPath, backupPath)
+		if err != nil {
+			return err
+		}
+
+	case os.IsNotExist(err):
+		backupPath = ""
+
+	default:
+		return err
+	}
+
+	err = os.Rename(srcPath, dstPath)
+	if err != nil {
+		err = copyDir(srcPath, dstPath)
+		if err != nil {
+			if backupPath != "" {
+				_ = os.RemoveAll(dstPath)
+				_ = os.Rename(backupPath, dstPath)
+			}
+			return err
+		}
+	}
+
+	if backupPath != "" {
+		return os.RemoveAll(backupPath)
+	}
+
+	return nil
+}
+
+func copyDir(srcPath, dstPath string) error {
+	var dirs []string
+
+	err := filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(dstPath, relPath)
+
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, relPath)
+			return os.MkdirAll(targetPath, 0700)
+
+		case info.Mode()&os.ModeSymlink != 0:
+			linkDest, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkDest, targetPath)
+
+		default:
+			return copyFile(path, targetPath, info)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Directory modes and times are set after their contents were written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Stat(filepath.Join(srcPath, dirs[i]))
+		if err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(dstPath, dirs[i])
+
+		err = os.Chmod(targetPath, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		err = os.Chtimes(targetPath, info.ModTime(), info.ModTime())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(srcPath, dstPath string, info os.FileInfo) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		return err
+	}
+
+	// OpenFile is subject to umask
+	err = os.Chmod(dstPath, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+}
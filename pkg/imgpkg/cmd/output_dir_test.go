@@ -0,0 +1,58 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyDirPreservesContentsAndModes(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "imgpkg-copy-dir")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcDir := filepath.Join(tmpDir, "src")
+
+	err = os.MkdirAll(filepath.Join(srcDir, "nested"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(srcDir, "nested", "file.sh"), []byte("contents"), 0755)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	err = os.Chmod(filepath.Join(srcDir, "nested"), 0750)
+	if err != nil {
+		t.Fatalf("Changing mode: %s", err)
+	}
+
+	dstDir := filepath.Join(tmpDir, "dst")
+
+	err = copyDir(srcDir, dstDir)
+	if err != nil {
+		t.Fatalf("Expected copy to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dstDir, "nested", "file.sh"))
+	if err != nil || string(contents) != "contents" {
+		t.Fatalf("Expected file to be copied: %v", err)
+	}
+
+	for path, expectedMode := range map[string]os.FileMode{"nested": 0750, "nested/file.sh": 0755} {
+		info, err := os.Stat(filepath.Join(dstDir, path))
+		if err != nil {
+			t.Fatalf("Stating copied path: %s", err)
+		}
+		if info.Mode().Perm() != expectedMode {
+			t.Fatalf("Expected '%s' mode to be %o, got %o", path, expectedMode, info.Mode().Perm())
+		}
+	}
+}
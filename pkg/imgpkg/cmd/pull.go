@@ -5,25 +5,72 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	regtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	lockUpdatePolicyAll     = "all"
+	lockUpdatePolicyPartial = "partial"
+	lockUpdatePolicyNone    = "none"
+)
+
 type PullOptions struct {
 	ui ui.UI
 
-	ImageFlags     ImageFlags
-	RegistryFlags  RegistryFlags
-	BundleFlags    BundleFlags
-	LockInputFlags LockInputFlags
-	OutputPath     string
+	// stdout receives file contents with --to-stdout (defaults to os.Stdout)
+	stdout io.Writer
+
+	ImageFlags       ImageFlags
+	RegistryFlags    RegistryFlags
+	BundleFlags      BundleFlags
+	LockInputFlags   LockInputFlags
+	ExtractFlags     ExtractFlags
+	OutputPath       string
+	Estimate         bool
+	Platform         string
+	CheckImages      bool
+	RequireRelocated bool
+	MetadataOnly     bool
+	Artifact         bool
+	ExpectedDigest   string
+	ExpectedImages   string
+	SkipSpaceCheck   bool
+	RekorURL         string
+	Layer            string
+
+	// AttestationPolicy is a path to AttestationPolicy file
+	AttestationPolicy string
+	// AttestationKey is a path to PEM encoded public key
+	// attestations are required to be signed with
+	AttestationKey string
+
+	// ExpectedFileCount is checked against number of extracted files when set
+	ExpectedFileCount int
+
+	ExcludeImgpkgDir bool
+	WriteLock        string
+	LockUpdatePolicy string
+	Recursive        bool
+	LayersToDir      string
+	OutputTar        string
+	ToStdout         bool
+	KeepOnError      bool
+	PostPullExec     string
+	TreeDigestOutput string
+	ImageName        string
 }
 
 var _ ctlimg.ImagesMetadata = ctlimg.Registry{}
@@ -42,19 +89,56 @@ func NewPullCmd(o *PullOptions) *cobra.Command {
   imgpkg pull -b dkalinin/app1-bundle -o /tmp/app1-bundle
 
   # Pull image dkalinin/app1-image and extract into /tmp/app1-image
-  imgpkg pull -i dkalinin/app1-image -o /tmp/app1-image`,
+  imgpkg pull -i dkalinin/app1-image -o /tmp/app1-image
+
+  # Write each layer of image dkalinin/app1-image as a tar file into /tmp/app1-layers
+  imgpkg pull -i dkalinin/app1-image --layers-to-dir /tmp/app1-layers`,
 	}
 	o.ImageFlags.Set(cmd)
 	o.RegistryFlags.Set(cmd)
 	o.BundleFlags.Set(cmd)
 	o.LockInputFlags.Set(cmd)
+	o.ExtractFlags.Set(cmd)
 	cmd.Flags().StringVarP(&o.OutputPath, "output", "o", "", "Output directory path")
-	cmd.MarkFlagRequired("output")
+	cmd.Flags().StringVar(&o.LayersToDir, "layers-to-dir", "", "Write each uncompressed layer as a separate tar file into directory instead of extracting (used instead of --output)")
+	cmd.Flags().StringVar(&o.OutputTar, "output-tar", "", "Stream contents of single layer image or bundle as uncompressed tar into file, named pipe or /dev/stdout (used instead of --output)")
+	cmd.Flags().BoolVar(&o.ToStdout, "to-stdout", false, "Write contents of the only file in image (or artifact image with --artifact) to stdout (used instead of --output)")
+	cmd.Flags().BoolVar(&o.Estimate, "estimate", false, "Print estimated download and extracted sizes without extracting")
+	cmd.Flags().StringVar(&o.Platform, "platform", "", "Set to 'all' to extract every image of an index into '<os>-<arch>' subdirectories, or to platform to extract its image (format: os/arch[/variant], e.g. linux/arm64 or linux/arm/v7)")
+	cmd.Flags().BoolVar(&o.MetadataOnly, "metadata-only", false, "Extract only bundle directory (e.g. .imgpkg/) skipping bundle contents")
+	cmd.Flags().BoolVar(&o.SkipSpaceCheck, "skip-space-check", false, "Skip checking that output filesystem has enough free space for estimated extracted size")
+	cmd.Flags().StringVar(&o.ExpectedDigest, "expected-digest", "", "Fail before extraction if pulled image digest does not match (format: sha256:..., sha512:...)")
+	cmd.Flags().IntVar(&o.ExpectedFileCount, "expected-file-count", 0, "Fail if number of extracted files does not match, e.g. to detect truncated bundles (0 skips check)")
+	cmd.Flags().StringVar(&o.RekorURL, "rekor-url", "", "Fail before extraction if pulled image digest is not recorded in Rekor transparency log at given URL (e.g. https://rekor.sigstore.dev)")
+	cmd.Flags().StringVar(&o.AttestationPolicy, "attestation-policy", "", "Fail before extraction if pulled image has no in-toto attestation about its digest satisfying given AttestationPolicy file (e.g. pushed with --attest-provenance or cosign attest); signatures are only verified with --attestation-key (warns otherwise)")
+	cmd.Flags().StringVar(&o.AttestationKey, "attestation-key", "", "Accept only attestations in DSSE envelope signed with given PEM encoded public key (e.g. cosign.pub) for --attestation-policy")
+	cmd.Flags().StringVar(&o.ExpectedImages, "expected-images", "", "Fail before extraction if bundle does not reference exactly images listed in given ImagesLock file (matched by digest, and by name when set)")
+	cmd.Flags().StringVar(&o.Layer, "layer", "", "Extract only image layer with given digest without merging other layers, e.g. for debugging (format: sha256:...)")
+	cmd.Flags().BoolVar(&o.Artifact, "artifact", false, "Write each image layer as a file named by its title annotation (e.g. image pushed with --artifact-file)")
+	cmd.Flags().BoolVar(&o.ExcludeImgpkgDir, "exclude-imgpkg-dir", false, "Do not keep bundle directory (e.g. .imgpkg/) in output directory")
+	cmd.Flags().StringVar(&o.WriteLock, "write-lock", "", "Keep image lock file (e.g. .imgpkg/images.yml) in output directory even with --exclude-imgpkg-dir, or remove it with --write-lock=false (by default kept unless --exclude-imgpkg-dir)")
+	cmd.Flags().Lookup("write-lock").NoOptDefVal = "true"
+	cmd.Flags().StringVar(&o.LockUpdatePolicy, "lock-update-policy", lockUpdatePolicyAll, "Point image lock file to images found in bundle repo: 'all' (only if every image is found), 'partial' (found images, keeping original locations of others) or 'none'")
+	cmd.Flags().BoolVar(&o.Recursive, "recursive", false, "Pull bundles referenced by bundle into '<bundle dir>/bundles/sha256-<digest>' directories")
+	cmd.Flags().StringVar(&o.TreeDigestOutput, "tree-digest-output", "", "Write digest computed over extracted files (sorted paths and contents digests) to given file, e.g. to detect later changes")
+	cmd.Flags().StringVar(&o.PostPullExec, "post-pull-exec", "", "Run command (via shell) after successful extraction with $"+PostPullExecOutputPathEnv+" set to output directory")
+	cmd.Flags().StringVar(&o.ImageName, "image-name", "", "Pull image with given name from ImagesLock file (used with --lock)")
+	cmd.Flags().BoolVar(&o.KeepOnError, "keep-on-error", false, "Keep partially extracted files in temporary directory (next to output directory) if pull fails")
+	cmd.Flags().BoolVar(&o.CheckImages, "check-images", false, "Check that images referenced by bundle exist after extraction")
+	cmd.Flags().BoolVar(&o.RequireRelocated, "require-relocated", false, "Fail if any image referenced by bundle is not located in bundle repository")
 
 	return cmd
 }
 
 func (o *PullOptions) Run() error {
+	// Streamed contents must not be mixed with other output
+	// (--output-tar may be /dev/stdout)
+	if o.ToStdout || o.OutputTar != "" {
+		origUI := o.ui
+		o.ui = newStderrUI(o.ui)
+		defer func() { o.ui = origUI }()
+	}
+
 	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
 	if err != nil {
 		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
@@ -65,22 +149,165 @@ func (o *PullOptions) Run() error {
 		return err
 	}
 
-	ref, err := regname.ParseReference(inputRef, regname.WeakValidation)
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
 	if err != nil {
 		return err
 	}
 
-	imgs, err := ctlimg.NewImages(ref, registry).Images()
+	if o.CheckImages && o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected --check-images to be used only with bundle flag")
+	}
+
+	if o.WriteLock != "" {
+		if _, err := strconv.ParseBool(o.WriteLock); err != nil {
+			return fmt.Errorf("Expected --write-lock to be 'true' or 'false', got '%s'", o.WriteLock)
+		}
+		if o.OutputPath == "" || o.Artifact {
+			return fmt.Errorf("Expected --write-lock to be used with --output (-o) and without --artifact")
+		}
+	}
+
+	switch o.LockUpdatePolicy {
+	case "", lockUpdatePolicyAll, lockUpdatePolicyPartial, lockUpdatePolicyNone:
+	default:
+		return fmt.Errorf("Expected --lock-update-policy to be one of %s, %s, %s, got '%s'",
+			lockUpdatePolicyAll, lockUpdatePolicyPartial, lockUpdatePolicyNone, o.LockUpdatePolicy)
+	}
+
+	if o.RequireRelocated && (o.BundleFlags.Bundle == "" || !o.writesLock()) {
+		return fmt.Errorf("Expected --require-relocated to be used only with bundle flag and with lock file written (without --exclude-imgpkg-dir or with --write-lock)")
+	}
+
+	if o.ExpectedImages != "" && o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected --expected-images to be used only with bundle flag")
+	}
+
+	if o.MetadataOnly && o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected --metadata-only to be used only with bundle flag")
+	}
+
+	if o.Artifact && o.ImageFlags.Image == "" {
+		return fmt.Errorf("Expected --artifact to be used only with image flag")
+	}
+
+	if o.ExcludeImgpkgDir && (o.BundleFlags.Bundle == "" || o.MetadataOnly) {
+		return fmt.Errorf("Expected --exclude-imgpkg-dir to be used only with bundle flag and without --metadata-only")
+	}
+
+	if o.Recursive && (o.BundleFlags.Bundle == "" || o.ExcludeImgpkgDir || !o.writesLock()) {
+		return fmt.Errorf("Expected --recursive to be used only with bundle flag and without --exclude-imgpkg-dir or --write-lock=false")
+	}
+
+	if o.RekorURL != "" {
+		err = o.validateRekorURL()
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.AttestationKey != "" && o.AttestationPolicy == "" {
+		return fmt.Errorf("Expected --attestation-key to be used only with --attestation-policy")
+	}
+
+	if o.Layer != "" && (o.BundleFlags.Bundle != "" || o.OutputPath == "" || o.Platform == pullPlatformAll || o.Artifact) {
+		return fmt.Errorf("Expected --layer to be used only with image flag and --output (-o), and without --platform all or --artifact")
+	}
+
+	var layerDigest regv1.Hash
+
+	if o.Layer != "" {
+		layerDigest, err = ctlimg.ParseDigest(o.Layer)
+		if err != nil {
+			return fmt.Errorf("Parsing layer digest: %s", err)
+		}
+	}
+
+	var expectedDigest regv1.Hash
+
+	if o.ExpectedDigest != "" {
+		expectedDigest, err = ctlimg.ParseDigest(o.ExpectedDigest)
+		if err != nil {
+			return fmt.Errorf("Parsing expected digest: %s", err)
+		}
+	}
+
+	switch {
+	case o.OutputPath == "" && o.LayersToDir == "" && o.OutputTar == "" && !o.ToStdout && !o.Estimate:
+		return fmt.Errorf("Expected output flag")
+	case o.ToStdout && (o.OutputPath != "" || o.LayersToDir != "" || o.OutputTar != ""):
+		return fmt.Errorf("Expected --to-stdout to not be combined with --output (-o), --layers-to-dir or --output-tar")
+	case o.ToStdout && (o.BundleFlags.Bundle != "" || o.Platform == pullPlatformAll || o.PostPullExec != ""):
+		return fmt.Errorf("Expected --to-stdout to be used only with images and without --platform all or --post-pull-exec")
+	case o.OutputPath != "" && o.LayersToDir != "":
+		return fmt.Errorf("Expected only one of --output (-o) or --layers-to-dir")
+	case o.OutputTar != "" && (o.OutputPath != "" || o.LayersToDir != ""):
+		return fmt.Errorf("Expected --output-tar to not be combined with --output (-o) or --layers-to-dir")
+	case o.OutputTar != "" && (o.Platform == pullPlatformAll || o.Artifact || o.MetadataOnly || o.CheckImages || o.ExcludeImgpkgDir || o.Recursive || o.RequireRelocated || o.PostPullExec != ""):
+		return fmt.Errorf("Expected --output-tar to not be combined with --platform all, --artifact, --metadata-only, --check-images, --exclude-imgpkg-dir, --recursive, --require-relocated or --post-pull-exec")
+	case o.LayersToDir != "" && (o.Platform != "" || o.Artifact || o.MetadataOnly || o.CheckImages || o.ExcludeImgpkgDir || o.Recursive):
+		return fmt.Errorf("Expected --layers-to-dir to not be combined with --platform, --artifact, --metadata-only, --check-images, --exclude-imgpkg-dir or --recursive")
+	case o.LayersToDir != "" && o.PostPullExec != "":
+		return fmt.Errorf("Expected --post-pull-exec to be used with --output (-o)")
+	case o.TreeDigestOutput != "" && o.OutputPath == "":
+		return fmt.Errorf("Expected --tree-digest-output to be used with --output (-o)")
+	case o.ExpectedFileCount < 0:
+		return fmt.Errorf("Expected --expected-file-count to not be negative, got %d", o.ExpectedFileCount)
+	case o.ExpectedFileCount > 0 && (o.OutputPath == "" || o.Artifact || o.ExtractFlags.ChangedOnly || o.ExtractFlags.NewerThan != ""):
+		// Files skipped as unchanged or older are not extracted, hence not counted
+		return fmt.Errorf("Expected --expected-file-count to be used with --output (-o) and without --artifact, --changed-only or --newer-than")
+	}
+
+	ref, err := parseImageRef(inputRef)
+	if err != nil {
+		return err
+	}
+
+	platformImgs, err := ctlimg.NewImages(ref, registry).PlatformImages()
 	if err != nil {
 		return fmt.Errorf("Collecting images: %s", err)
 	}
 
+	var imgs []regv1.Image
+	for _, img := range platformImgs {
+		imgs = append(imgs, img.Image)
+	}
+
 	if len(imgs) == 0 {
 		return fmt.Errorf("Expected to find at least one image, but found none")
 	}
 
-	if len(imgs) > 1 {
-		o.ui.BeginLinef("Found multiple images, extracting first\n")
+	var platformDirs []string
+
+	switch o.Platform {
+	case "":
+		if len(imgs) > 1 {
+			err = warnf(o.ui, "Found multiple images, extracting first")
+			if err != nil {
+				return err
+			}
+		}
+		imgs = imgs[:1]
+
+	case pullPlatformAll:
+		if o.ImageFlags.Image == "" {
+			return fmt.Errorf("Expected --platform to be used only with image flag")
+		}
+
+		platformDirs, err = o.platformDirs(imgs)
+		if err != nil {
+			return err
+		}
+
+	default:
+		platform, err := parsePlatform(o.Platform)
+		if err != nil {
+			return fmt.Errorf("Unsupported platform '%s' (supported: %s, os/arch[/variant]): %s", o.Platform, pullPlatformAll, err)
+		}
+
+		imgs, err = o.platformImages(platformImgs, platform)
+		if err != nil {
+			return err
+		}
 	}
 
 	img := imgs[0]
@@ -89,7 +316,7 @@ func (o *PullOptions) Run() error {
 		return fmt.Errorf("checking if image is bunlde: %v", err)
 	}
 
-	if o.ImageFlags.Image != "" {
+	if o.ImageFlags.Image != "" || o.ImageName != "" {
 		if isBundle {
 			return fmt.Errorf("Expected bundle flag when pulling a bundle, please use -b instead of --image")
 		}
@@ -98,42 +325,400 @@ func (o *PullOptions) Run() error {
 		return fmt.Errorf("Expected image flag when pulling an image or index, please use --image instead of -b")
 	}
 
+	if o.Layer != "" && isBundle {
+		return fmt.Errorf("Expected --layer to be used only with images")
+	}
+
 	digest, err := img.Digest()
 	if err != nil {
 		return fmt.Errorf("Getting image digest: %s", err)
 	}
 
-	o.ui.BeginLinef("Pulling image '%s@%s'\n", ref.Context(), digest)
+	if o.ExpectedDigest != "" {
+		actualDigest, err := ctlimg.ManifestDigest(img, ctlimg.DigestAlgorithm(expectedDigest.Algorithm))
+		if err != nil {
+			return fmt.Errorf("Getting image digest: %s", err)
+		}
+		if actualDigest != expectedDigest {
+			return fmt.Errorf("Expected image '%s' to have digest '%s', but was '%s'", ref.Context(), expectedDigest, actualDigest)
+		}
+	}
+
+	if o.RekorURL != "" {
+		err = o.checkRekorEntry(ref, digest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.AttestationPolicy != "" {
+		err = o.verifyAttestation(ref, digest, registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.ExpectedImages != "" {
+		err = o.checkExpectedImages(ref.Context().Digest(digest.String()), lockLocation)
+		if err != nil {
+			return err
+		}
+	}
+
+	total, err := o.estimateSize(imgs)
+	if err != nil {
+		return err
+	}
+
+	if o.Estimate {
+		o.ui.BeginLinef("Image '%s@%s'\n", ref.Context(), digest)
+		o.ui.BeginLinef("Download size: %d bytes\n", total.DownloadSize)
+		o.ui.BeginLinef("Estimated extracted size: %d bytes\n", total.ExtractedSize)
+		return nil
+	}
+
+	if o.LayersToDir != "" {
+		return o.writeLayersToDir(ref, img, total)
+	}
+
+	if o.OutputTar != "" {
+		return o.writeOutputTar(img)
+	}
+
+	if o.ToStdout {
+		return o.writeToStdout(img)
+	}
+
+	if platformDirs == nil {
+		o.ui.BeginLinef("Pulling image '%s@%s'\n", ref.Context(), digest)
+	}
 
 	if o.OutputPath == "/" || o.OutputPath == "." || o.OutputPath == ".." {
 		return fmt.Errorf("Disallowed output directory (trying to avoid accidental deletion)")
 	}
 
-	// TODO protection for destination
-	err = os.RemoveAll(o.OutputPath)
+	dirImageOpts, err := o.ExtractFlags.AsDirImageOpts()
 	if err != nil {
-		return fmt.Errorf("Removing output directory: %s", err)
+		return err
+	}
+
+	// Metadata is expected to be small, so do not block on (data based) estimate
+	if !o.SkipSpaceCheck && !o.MetadataOnly {
+		err = ctlimg.CheckFreeSpace(o.OutputPath, total.ExtractedSize)
+		if err != nil {
+			return fmt.Errorf("%s (use --skip-space-check to skip)", err)
+		}
+	}
+
+	dirImageOpts.Warnf = warnfFunc(o.ui)
+
+	// Files overwritten by later layers are only counted once
+	extractedFiles := map[string]struct{}{}
+
+	if o.ExpectedFileCount > 0 {
+		dirImageOpts.FileWritten = func(file ctlimg.ExtractedFile) { extractedFiles[file.FullPath] = struct{}{} }
+	}
+
+	outputDirMode := os.FileMode(0700)
+	if dirImageOpts.DirMode != 0 {
+		outputDirMode = dirImageOpts.DirMode
+	}
+
+	// Extract into temporary directory and swap it with output directory
+	// only on success, so that existing output is kept if pull fails
+	// (changed only and newer than extraction update existing output directory in place)
+	extractPath := o.OutputPath
+	succeeded := false
+
+	if !dirImageOpts.SkipUnchanged && dirImageOpts.NewerThan.IsZero() {
+		extractPath, err = newSiblingTempDir(o.OutputPath, outputDirMode)
+		if err != nil {
+			return fmt.Errorf("Creating temporary output directory: %s", err)
+		}
+
+		defer func() {
+			if o.KeepOnError && !succeeded {
+				o.ui.BeginLinef("Kept partially extracted files in '%s'\n", extractPath)
+				return
+			}
+			os.RemoveAll(extractPath)
+		}()
 	}
 
-	err = os.MkdirAll(o.OutputPath, 0700)
+	err = os.MkdirAll(extractPath, outputDirMode)
 	if err != nil {
 		return fmt.Errorf("Creating output directory: %s", err)
 	}
 
-	err = ctlimg.NewDirImage(o.OutputPath, img, o.ui).AsDirectory()
+	// MkdirAll is subject to umask
+	err = os.Chmod(extractPath, outputDirMode)
+	if err != nil {
+		return fmt.Errorf("Setting output directory mode: %s", err)
+	}
+
+	switch {
+	case platformDirs != nil:
+		err = o.extractPlatforms(ref, imgs, extractPath, platformDirs, dirImageOpts)
+
+	case o.Artifact:
+		err = ctlimg.NewArtifactDir(extractPath, img, o.ui).Write()
+		if err != nil {
+			err = fmt.Errorf("Writing artifact files into directory: %s", err)
+		}
+
+	case o.Layer != "":
+		err = ctlimg.NewDirImage(extractPath, img, dirImageOpts, o.ui).AsLayerDirectory(layerDigest)
+		if err != nil {
+			err = fmt.Errorf("Extracting layer into directory: %s", err)
+		}
+
+	default:
+		err = o.extractImage(ref, img, extractPath, dirImageOpts, lockLocation, registry)
+		if err == nil && o.Recursive {
+			err = o.extractNestedBundles(ref, extractPath, dirImageOpts, lockLocation, registry, []string{digest.String()})
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if o.ExpectedFileCount > 0 {
+		extractedCount, err := countExistingFiles(extractedFiles)
+		if err != nil {
+			return fmt.Errorf("Counting extracted files: %s", err)
+		}
+		if extractedCount != o.ExpectedFileCount {
+			return fmt.Errorf("Expected to extract %d file(s), but extracted %d", o.ExpectedFileCount, extractedCount)
+		}
+	}
+
+	if extractPath != o.OutputPath {
+		err = replaceDir(extractPath, o.OutputPath)
+		if err != nil {
+			return fmt.Errorf("Moving extracted files into output directory: %s", err)
+		}
+	}
+
+	succeeded = true
+
+	if o.TreeDigestOutput != "" {
+		err = o.writeTreeDigest()
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.PostPullExec != "" {
+		return o.runPostPullExec()
+	}
+
+	return nil
+}
+
+func (o *PullOptions) extractImage(ref regname.Reference, img regv1.Image, outputPath string,
+	dirImageOpts ctlimg.DirImageOpts, lockLocation ImageLockLocation, registry ctlimg.Registry) error {
+
+	dirImage := ctlimg.NewDirImage(outputPath, img, dirImageOpts, o.ui)
+
+	var err error
+
+	if o.MetadataOnly {
+		err = dirImage.AsMetadataDirectory(lockLocation.BundleDir)
+	} else {
+		err = dirImage.AsDirectory()
+	}
 	if err != nil {
 		return fmt.Errorf("Extracting image into directory: %s", err)
 	}
 
-	if o.BundleFlags.Bundle != "" {
-		err = o.rewriteImageLock(ref, registry)
+	// Image may carry lock file as well, though it's not rewritten
+	if o.BundleFlags.Bundle == "" {
+		if !o.writesLock() {
+			return removeImageLock(outputPath, lockLocation)
+		}
+		return nil
+	}
+
+	skipLockUpdate := false
+
+	if o.CheckImages {
+		missingImages, err := o.checkImages(ref, outputPath, lockLocation, registry)
+		if err != nil {
+			return fmt.Errorf("Checking referenced images: %s", err)
+		}
+
+		if len(missingImages) > 0 {
+			err = warnf(o.ui, "Expected all referenced images to exist, but %d were not found: %s",
+				len(missingImages), strings.Join(missingImages, ", "))
+			if err != nil {
+				return err
+			}
+			if o.writesLock() {
+				err = warnf(o.ui, "One or more images not found; skipping lock file update")
+				if err != nil {
+					return err
+				}
+				skipLockUpdate = true
+			}
+		}
+	}
+
+	// Bundle directory is read (e.g. for checking images)
+	// before it's removed; no need to rewrite lock that is removed
+	if o.ExcludeImgpkgDir {
+		err = removeBundleDir(outputPath, lockLocation, o.writesLock())
 		if err != nil {
-			return fmt.Errorf("Rewriting image lock file: %s", err)
+			return fmt.Errorf("Removing bundle directory: %s", err)
+		}
+	}
+
+	if !o.writesLock() {
+		return removeImageLock(outputPath, lockLocation)
+	}
+
+	if skipLockUpdate || o.LockUpdatePolicy == lockUpdatePolicyNone {
+		return nil
+	}
+
+	err = o.rewriteImageLock(ref, outputPath, lockLocation, registry)
+	if err != nil {
+		return fmt.Errorf("Rewriting image lock file: %s", err)
+	}
+
+	if o.RequireRelocated {
+		err = o.checkRelocated(ref, outputPath, lockLocation)
+		if err != nil {
+			return err
 		}
 	}
+
 	return nil
 }
 
+// extractNestedBundles extracts each bundle referenced by already extracted bundle
+// into bundles/ subdirectory of its bundle directory. ancestors includes digests
+// of bundles that lead to current bundle and is used to detect cycles.
+func (o *PullOptions) extractNestedBundles(ref regname.Reference, outputPath string,
+	dirImageOpts ctlimg.DirImageOpts, lockLocation ImageLockLocation, registry ctlimg.Registry, ancestors []string) error {
+
+	lockFile, err := ReadBundleImageLockFile(outputPath, lockLocation)
+	if err != nil {
+		return fmt.Errorf("Reading image lock file: %s", err)
+	}
+
+	for _, imgDesc := range lockFile.Spec.Images {
+		bundleRepoImgRef, err := ImageWithRepository(imgDesc.Image, ref.Context().Name())
+		if err != nil {
+			return err
+		}
+
+		foundImg, err := checkImageExists([]string{bundleRepoImgRef, imgDesc.Image}, registry)
+		if err != nil {
+			return fmt.Errorf("Locating referenced image '%s': %s", imgDesc.Image, err)
+		}
+
+		nestedRef, err := regname.NewDigest(foundImg)
+		if err != nil {
+			return err
+		}
+
+		desc, err := registry.Generic(nestedRef)
+		if err != nil {
+			return fmt.Errorf("Getting referenced image '%s': %s", foundImg, err)
+		}
+
+		if desc.MediaType == regtypes.OCIImageIndex || desc.MediaType == regtypes.DockerManifestList {
+			continue
+		}
+
+		nestedImg, err := registry.Image(nestedRef)
+		if err != nil {
+			return fmt.Errorf("Getting referenced image '%s': %s", foundImg, err)
+		}
+
+		isBundle, err := isBundle(nestedImg)
+		if err != nil {
+			return fmt.Errorf("Checking if referenced image '%s' is a bundle: %s", foundImg, err)
+		}
+		if !isBundle {
+			continue
+		}
+
+		for _, ancestor := range ancestors {
+			if ancestor == nestedRef.DigestStr() {
+				return fmt.Errorf("Expected bundles to not reference each other, but found cycle: %s -> %s",
+					strings.Join(ancestors, " -> "), nestedRef.DigestStr())
+			}
+		}
+
+		nestedPath := filepath.Join(outputPath, lockLocation.BundleDir, "bundles", strings.Replace(nestedRef.DigestStr(), ":", "-", 1))
+
+		o.ui.BeginLinef("Pulling nested bundle '%s'\n", foundImg)
+
+		err = os.MkdirAll(nestedPath, 0700)
+		if err != nil {
+			return fmt.Errorf("Creating nested bundle directory: %s", err)
+		}
+
+		err = o.extractImage(nestedRef, nestedImg, nestedPath, dirImageOpts, lockLocation, registry)
+		if err != nil {
+			return fmt.Errorf("Pulling nested bundle '%s': %s", foundImg, err)
+		}
+
+		err = o.extractNestedBundles(nestedRef, nestedPath, dirImageOpts, lockLocation, registry, append(ancestors, nestedRef.DigestStr()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *PullOptions) writeLayersToDir(ref regname.Reference, img regv1.Image, total ctlimg.SizeEstimate) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return fmt.Errorf("Getting image digest: %s", err)
+	}
+
+	o.ui.BeginLinef("Writing layers of image '%s@%s' into '%s'\n", ref.Context(), digest, o.LayersToDir)
+
+	if !o.SkipSpaceCheck {
+		err = ctlimg.CheckFreeSpace(o.LayersToDir, total.ExtractedSize)
+		if err != nil {
+			return fmt.Errorf("%s (use --skip-space-check to skip)", err)
+		}
+	}
+
+	err = os.MkdirAll(o.LayersToDir, 0700)
+	if err != nil {
+		return fmt.Errorf("Creating layers directory: %s", err)
+	}
+
+	err = ctlimg.NewLayersDir(o.LayersToDir, img, o.ui).Write()
+	if err != nil {
+		return fmt.Errorf("Writing layers into directory: %s", err)
+	}
+
+	return nil
+}
+
+func (o *PullOptions) estimateSize(imgs []regv1.Image) (ctlimg.SizeEstimate, error) {
+	var total ctlimg.SizeEstimate
+
+	for _, img := range imgs {
+		estimate, err := ctlimg.EstimateSize(img)
+		if err != nil {
+			return ctlimg.SizeEstimate{}, fmt.Errorf("Estimating image size: %s", err)
+		}
+
+		total.DownloadSize += estimate.DownloadSize
+		total.ExtractedSize += estimate.ExtractedSize
+	}
+
+	return total, nil
+}
+
 func (o *PullOptions) getRefFromFlags() (string, error) {
 	var ref string
 	for _, s := range []string{o.LockInputFlags.LockFilePath, o.ImageFlags.Image, o.BundleFlags.Bundle} {
@@ -150,8 +735,14 @@ func (o *PullOptions) getRefFromFlags() (string, error) {
 	}
 	//ref is not empty
 	if o.LockInputFlags.LockFilePath == "" {
+		if o.ImageName != "" {
+			return "", fmt.Errorf("Expected --image-name to be used only with --lock")
+		}
 		return ref, nil
 	}
+	if o.ImageName != "" {
+		return o.namedImageLockRef()
+	}
 	lockBytes, err := ioutil.ReadFile(ref)
 	if err != nil {
 		return "", err
@@ -164,9 +755,47 @@ func (o *PullOptions) getRefFromFlags() (string, error) {
 	return bundleLock.Spec.Image.DigestRef, nil
 }
 
-func (o *PullOptions) rewriteImageLock(ref regname.Reference, registry ctlimg.Registry) error {
-	imageLockDir := filepath.Join(o.OutputPath, BundleDir, ImageLockFile)
-	lockFile, err := ReadImageLockFile(imageLockDir)
+// parseImageRef parses tag or digest reference. Digest references (host/repo@sha256:...),
+// e.g. for content stores without tags, are parsed on their own to report digest problems
+func parseImageRef(val string) (regname.Reference, error) {
+	val = strings.TrimSpace(val)
+
+	if strings.Contains(val, "@") {
+		ref, err := regname.NewDigest(val, regname.WeakValidation)
+		if err != nil {
+			return nil, fmt.Errorf("Expected digest reference '%s' to be in format host/repo@sha256:<hex>: %s", val, err)
+		}
+		return ref, nil
+	}
+
+	return regname.ParseReference(val, regname.WeakValidation)
+}
+
+// namedImageLockRef returns reference of image with given name in ImagesLock file
+func (o *PullOptions) namedImageLockRef() (string, error) {
+	imgLock, err := ReadImageLockFile(o.LockInputFlags.LockFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+
+	for _, img := range imgLock.Spec.Images {
+		if img.Name == o.ImageName {
+			return img.Image, nil
+		}
+		if img.Name != "" {
+			names = append(names, img.Name)
+		}
+	}
+
+	return "", fmt.Errorf("Expected to find image named '%s' in lock file '%s' (available names: %s)",
+		o.ImageName, o.LockInputFlags.LockFilePath, strings.Join(names, ", "))
+}
+
+func (o *PullOptions) rewriteImageLock(ref regname.Reference, outputPath string, lockLocation ImageLockLocation, registry ctlimg.Registry) error {
+	imageLockDir := lockLocation.Path(outputPath)
+	lockFile, err := ReadBundleImageLockFile(outputPath, lockLocation)
 	if err != nil {
 		return fmt.Errorf("Reading image lock file: %s", err)
 	}
@@ -177,6 +806,7 @@ func (o *PullOptions) rewriteImageLock(ref regname.Reference, registry ctlimg.Re
 
 	bundleRepo := ref.Context().Name()
 	inBundleRepo := 0
+	notInBundleRepo := 0
 	var newImgDescs []ImageDesc
 	for _, img := range lockFile.Spec.Images {
 		bundleRepoImgRef, err := ImageWithRepository(img.Image, bundleRepo)
@@ -186,15 +816,28 @@ func (o *PullOptions) rewriteImageLock(ref regname.Reference, registry ctlimg.Re
 		if img.Image == bundleRepoImgRef {
 			inBundleRepo = inBundleRepo + 1
 		}
-		foundImg, err := checkImageExists([]string{bundleRepoImgRef, img.Image}, registry)
-		if err != nil {
-			return err
-		}
-		if foundImg != bundleRepoImgRef {
-			o.ui.BeginLinef("One or more images not found in bundle repo; skipping lock file update\n")
-			return nil
+		var foundImg string
+		if o.LockUpdatePolicy == lockUpdatePolicyPartial {
+			// Images not (yet) relocated to bundle repo keep original location
+			foundImg, err = checkImageInBundleRepo(bundleRepoImgRef, registry)
+			if err != nil {
+				return err
+			}
+			if foundImg == "" {
+				foundImg = img.Image
+				notInBundleRepo++
+			}
+		} else {
+			foundImg, err = checkImageExists([]string{bundleRepoImgRef, img.Image}, registry)
+			if err != nil {
+				return err
+			}
+			if foundImg != bundleRepoImgRef {
+				return warnf(o.ui, "One or more images not found in bundle repo; skipping lock file update")
+			}
 		}
 		newImgDescs = append(newImgDescs, ImageDesc{
+			Name:        img.Name,
 			Image:       foundImg,
 			Annotations: img.Annotations,
 		})
@@ -202,15 +845,183 @@ func (o *PullOptions) rewriteImageLock(ref regname.Reference, registry ctlimg.Re
 	if inBundleRepo == len(lockFile.Spec.Images) {
 		return nil
 	}
+	if notInBundleRepo == len(lockFile.Spec.Images) {
+		o.ui.BeginLinef("No images found in bundle repo; skipping lock file update\n")
+		return nil
+	}
 	lockFile.Spec.Images = newImgDescs
 	imgLockBytes, err := yaml.Marshal(lockFile)
 	if err != nil {
 		return fmt.Errorf("Marshalling image lock file: %s", err)
 	}
-	o.ui.BeginLinef("All images found in bundle repo; updating lock file: %s\n", imageLockDir)
+	if notInBundleRepo > 0 {
+		o.ui.BeginLinef("%d of %d images found in bundle repo; updating lock file for found images: %s\n",
+			len(lockFile.Spec.Images)-notInBundleRepo, len(lockFile.Spec.Images), lockLocation.Path(o.OutputPath))
+	} else {
+		o.ui.BeginLinef("All images found in bundle repo; updating lock file: %s\n", lockLocation.Path(o.OutputPath))
+	}
 	return ioutil.WriteFile(imageLockDir, imgLockBytes, 600)
 }
 
+// writeTreeDigest records digest of output directory (before post pull command runs)
+func (o *PullOptions) writeTreeDigest() error {
+	digest, err := ctlimg.DefaultDigestAlgorithm.TreeDigest(o.OutputPath)
+	if err != nil {
+		return fmt.Errorf("Computing tree digest of '%s': %s", o.OutputPath, err)
+	}
+
+	o.ui.BeginLinef("Tree digest: %s\n", digest)
+
+	err = ioutil.WriteFile(o.TreeDigestOutput, []byte(digest.String()+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("Writing tree digest: %s", err)
+	}
+
+	return nil
+}
+
+// writesLock returns whether image lock file is kept in output directory
+// countExistingFiles counts extracted files that remain after extraction
+// (files removed by whiteouts of later layers are not counted)
+func countExistingFiles(paths map[string]struct{}) (int, error) {
+	count := 0
+
+	for path := range paths {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return 0, err
+		}
+		if fi.Mode().IsRegular() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (o *PullOptions) writesLock() bool {
+	if o.WriteLock == "" {
+		return !o.ExcludeImgpkgDir
+	}
+	writeLock, _ := strconv.ParseBool(o.WriteLock) // validated in Run
+	return writeLock
+}
+
+// removeBundleDir removes bundle directory optionally keeping image lock file in it
+func removeBundleDir(outputPath string, lockLocation ImageLockLocation, keepLock bool) error {
+	bundleDirPath := filepath.Join(outputPath, lockLocation.BundleDir)
+
+	if !keepLock {
+		return os.RemoveAll(bundleDirPath)
+	}
+
+	entries, err := ioutil.ReadDir(bundleDirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == lockLocation.ImageLockFile {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(bundleDirPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeImageLock(outputPath string, lockLocation ImageLockLocation) error {
+	err := os.Remove(lockLocation.Path(outputPath))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Removing image lock file: %s", err)
+	}
+	return nil
+}
+
+// checkImages looks for each referenced image in bundle repo and its original location
+func (o *PullOptions) checkImages(ref regname.Reference, outputPath string, lockLocation ImageLockLocation, registry ctlimg.Registry) ([]string, error) {
+	lockFile, err := ReadBundleImageLockFile(outputPath, lockLocation)
+	if err != nil {
+		return nil, fmt.Errorf("Reading image lock file: %s", err)
+	}
+
+	o.ui.BeginLinef("Checking %d referenced image(s)...\n", len(lockFile.Spec.Images))
+
+	var missingImages []string
+
+	for _, img := range lockFile.Spec.Images {
+		bundleRepoImgRef, err := ImageWithRepository(img.Image, ref.Context().Name())
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = checkImageExists([]string{bundleRepoImgRef, img.Image}, registry)
+		if err != nil {
+			o.ui.BeginLinef("Image '%s' not found: %s\n", img.Image, err)
+			missingImages = append(missingImages, img.Image)
+		}
+	}
+
+	return missingImages, nil
+}
+
+// checkRelocated makes sure that each image in (possibly rewritten) lock file
+// is referenced from bundle repo instead of its original location
+func (o *PullOptions) checkRelocated(ref regname.Reference, outputPath string, lockLocation ImageLockLocation) error {
+	lockFile, err := ReadBundleImageLockFile(outputPath, lockLocation)
+	if err != nil {
+		return fmt.Errorf("Reading image lock file: %s", err)
+	}
+
+	bundleRepo := ref.Context().Name()
+
+	var externalImages []string
+
+	for _, img := range lockFile.Spec.Images {
+		bundleRepoImgRef, err := ImageWithRepository(img.Image, bundleRepo)
+		if err != nil {
+			return err
+		}
+		if img.Image != bundleRepoImgRef {
+			externalImages = append(externalImages, img.Image)
+		}
+	}
+
+	if len(externalImages) > 0 {
+		return fmt.Errorf("Expected all referenced images to be relocated to bundle repo '%s', but %d were not: %s",
+			bundleRepo, len(externalImages), strings.Join(externalImages, ", "))
+	}
+
+	return nil
+}
+
+// checkImageInBundleRepo returns empty string if image is not found in bundle repo;
+// other errors (e.g. denied access) are returned instead of treating image as missing
+func checkImageInBundleRepo(url string, registry ctlimg.Registry) (string, error) {
+	ref, err := regname.NewDigest(url)
+	if err != nil {
+		return "", err
+	}
+	_, err = registry.Generic(ref)
+	switch {
+	case err == nil:
+		return url, nil
+	case isNotFoundErr(err):
+		return "", nil
+	default:
+		return "", fmt.Errorf("Checking image '%s' in bundle repo: %s", url, err)
+	}
+}
+
 func checkImageExists(urls []string, registry ctlimg.Registry) (string, error) {
 	var err error
 	for _, img := range urls {
@@ -0,0 +1,95 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// verifyAttestation makes sure that pulled image (e.g. bundle) has in-toto attestation
+// about its digest satisfying policy (and signed with key if given) before anything is extracted;
+// accepting attestation without key is a warning (hence fails with --strict)
+func (o *PullOptions) verifyAttestation(ref regname.Reference, digest regv1.Hash, registry ctlimg.Registry) error {
+	policy, err := ReadAttestationPolicyFile(o.AttestationPolicy)
+	if err != nil {
+		return err
+	}
+
+	var key crypto.PublicKey
+
+	if o.AttestationKey != "" {
+		keyBytes, err := ioutil.ReadFile(o.AttestationKey)
+		if err != nil {
+			return fmt.Errorf("Reading attestation key: %s", err)
+		}
+
+		key, err = ctlimg.ParsePublicKey(keyBytes)
+		if err != nil {
+			return fmt.Errorf("Reading attestation key '%s': %s", o.AttestationKey, err)
+		}
+	}
+
+	attestations, err := registry.Attestations(ref.Context().Digest(digest.String()))
+	if err != nil {
+		return fmt.Errorf("Fetching attestations: %s", err)
+	}
+
+	if len(attestations) == 0 {
+		return fmt.Errorf("Expected image '%s@%s' to have in-toto attestation, but found none", ref.Context(), digest)
+	}
+
+	var rejections []string
+
+	for _, attestation := range attestations {
+		if key != nil {
+			if attestation.Envelope == nil {
+				rejections = append(rejections, fmt.Sprintf("%s: Expected attestation to be signed (DSSE envelope)", attestation.Ref.DigestStr()))
+				continue
+			}
+
+			err := attestation.Envelope.Verify(key)
+			if err != nil {
+				rejections = append(rejections, fmt.Sprintf("%s: %s", attestation.Ref.DigestStr(), err))
+				continue
+			}
+		}
+
+		err := attestation.Statement.CheckType()
+		if err != nil {
+			rejections = append(rejections, fmt.Sprintf("%s: %s", attestation.Ref.DigestStr(), err))
+			continue
+		}
+
+		if !attestation.Statement.HasSubject(digest) {
+			rejections = append(rejections, fmt.Sprintf("%s: Expected subject to have digest '%s'", attestation.Ref.DigestStr(), digest))
+			continue
+		}
+
+		err = policy.Check(attestation.Statement)
+		if err != nil {
+			rejections = append(rejections, fmt.Sprintf("%s: %s", attestation.Ref.DigestStr(), err))
+			continue
+		}
+
+		if key == nil {
+			err := warnf(o.ui, "Warning: Signature of attestation '%s' was not verified (use --attestation-key to verify it)", attestation.Ref.Name())
+			if err != nil {
+				return err
+			}
+		}
+
+		o.ui.BeginLinef("Verified attestation '%s' against policy '%s'\n", attestation.Ref.Name(), o.AttestationPolicy)
+		return nil
+	}
+
+	return fmt.Errorf("Expected image '%s@%s' to have in-toto attestation about its digest satisfying policy '%s', "+
+		"but none of %d attestation(s) did:\n- %s", ref.Context(), digest, o.AttestationPolicy, len(attestations), strings.Join(rejections, "\n- "))
+}
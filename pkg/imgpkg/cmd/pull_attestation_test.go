@@ -0,0 +1,305 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestPullAttestationKeyVerifiesSignedCosignAttestation(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-pull-attestation-key")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte("config"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	// Unsigned provenance is attached by push
+	provenanceRef := registryHost(server) + "/repo/app:provenance"
+
+	push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: provenanceRef}, FileFlags: FileFlags{Files: []string{dir}}, AttestProvenance: true}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	// Signed attestation is attached by cosign via 'sha256-<hex>.att' tag
+	signedRef := registryHost(server) + "/repo/app:signed"
+	img := buildImage(t, map[string]string{"signed.yml": "signed"}, nil)
+
+	tag, err := regname.NewTag(signedRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating key: %s", err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Generating key: %s", err)
+	}
+
+	statement := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2",`+
+		`"subject":[{"name":"app","digest":{"sha256":"%s"}}],"predicate":{"builder":{"id":"https://ci.example.com"}}}`, digest.Hex)
+
+	writeCosignAttestation(t, server, digest, signDSSEEnvelope(t, key, statement))
+
+	// Other document with matching fields is not an in-toto statement
+	otherRef := registryHost(server) + "/repo/app:other"
+	otherImg := buildImage(t, map[string]string{"other.yml": "other"}, nil)
+
+	otherTag, err := regname.NewTag(otherRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(otherTag, otherImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	otherDigest, err := otherImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	otherStatement := fmt.Sprintf(`{"_type":"https://example.com/Document/v1","predicateType":"https://slsa.dev/provenance/v0.2",`+
+		`"subject":[{"name":"app","digest":{"sha256":"%s"}}],"predicate":{"builder":{"id":"https://ci.example.com"}}}`, otherDigest.Hex)
+
+	writeCosignAttestation(t, server, otherDigest, signDSSEEnvelope(t, key, otherStatement))
+
+	policyPath := filepath.Join(dir, "policy.yml")
+
+	err = ioutil.WriteFile(policyPath, []byte(`apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: AttestationPolicy
+predicateType: https://slsa.dev/provenance/v0.2
+predicate:
+- path: builder.id
+  pattern: ^(https://ci.example.com|imgpkg@)
+`), 0600)
+	if err != nil {
+		t.Fatalf("Writing policy: %s", err)
+	}
+
+	keyPath := writePublicKey(t, dir, "key.pub", key)
+	otherKeyPath := writePublicKey(t, dir, "other.pub", otherKey)
+
+	testCases := []struct {
+		name        string
+		image       string
+		key         string
+		strict      bool
+		expectedErr string
+	}{
+		{
+			name:  "cosign attestation without key",
+			image: signedRef,
+		},
+		{
+			name:        "cosign attestation without key with strict",
+			image:       signedRef,
+			strict:      true,
+			expectedErr: "Warning: Signature of attestation '" + registryHost(server) + "/repo/app@sha256:",
+		},
+		{
+			name:   "cosign attestation signed with key with strict",
+			image:  signedRef,
+			key:    keyPath,
+			strict: true,
+		},
+		{
+			name:        "statement of other type",
+			image:       otherRef,
+			key:         keyPath,
+			expectedErr: "Expected statement type to be 'https://in-toto.io/Statement/v0.1' or 'https://in-toto.io/Statement/v1', but was 'https://example.com/Document/v1'",
+		},
+		{
+			name:  "cosign attestation signed with key",
+			image: signedRef,
+			key:   keyPath,
+		},
+		{
+			name:        "cosign attestation signed with other key",
+			image:       signedRef,
+			key:         otherKeyPath,
+			expectedErr: "Expected envelope to be signed with given key, but none of 1 signature(s) was",
+		},
+		{
+			name:        "unsigned provenance with key",
+			image:       provenanceRef,
+			key:         keyPath,
+			expectedErr: "Expected attestation to be signed (DSSE envelope)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputDir := filepath.Join(dir, "output")
+			defer os.RemoveAll(outputDir)
+
+			var pullUI ui.UI = ui.NewNoopUI()
+			if tc.strict {
+				pullUI = newStrictUI()
+			}
+
+			pull := PullOptions{ui: pullUI, ImageFlags: ImageFlags{Image: tc.image}, OutputPath: outputDir,
+				AttestationPolicy: policyPath, AttestationKey: tc.key}
+
+			err := pull.Run()
+
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Expected pull to succeed: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("Expected pull to fail with '%s', but was: %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	t.Run("key without policy", func(t *testing.T) {
+		pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: signedRef}, OutputPath: filepath.Join(dir, "output"), AttestationKey: keyPath}
+
+		err := pull.Run()
+		if err == nil || !strings.Contains(err.Error(), "Expected --attestation-key to be used only with --attestation-policy") {
+			t.Fatalf("Expected pull to fail due to missing policy, but was: %v", err)
+		}
+	})
+}
+
+// writeCosignAttestation attaches envelope to subject the way cosign attest does ('sha256-<hex>.att' tag)
+func writeCosignAttestation(t *testing.T, server *httptest.Server, subject regv1.Hash, envelope []byte) {
+	attImg, err := mutate.Append(empty.Image, mutate.Addendum{Layer: attestationTestLayer{envelope}})
+	if err != nil {
+		t.Fatalf("Building attestation: %s", err)
+	}
+
+	attTag, err := regname.NewTag(registryHost(server) + "/repo/app:" + subject.Algorithm + "-" + subject.Hex + ".att")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(attTag, attImg)
+	if err != nil {
+		t.Fatalf("Writing attestation: %s", err)
+	}
+}
+
+// signDSSEEnvelope signs statement the way cosign attest does
+func signDSSEEnvelope(t *testing.T, key *ecdsa.PrivateKey, statement string) []byte {
+	payloadType := "application/vnd.in-toto+json"
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(statement), statement)
+	digest := sha256.Sum256([]byte(pae))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Signing: %s", err)
+	}
+
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatalf("Encoding signature: %s", err)
+	}
+
+	envelope, err := json.Marshal(ctlimg.DSSEEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString([]byte(statement)),
+		Signatures:  []ctlimg.DSSESignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+	if err != nil {
+		t.Fatalf("Encoding envelope: %s", err)
+	}
+
+	return envelope
+}
+
+func writePublicKey(t *testing.T, dir, name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("Encoding public key: %s", err)
+	}
+
+	path := filepath.Join(dir, name)
+
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("Writing public key: %s", err)
+	}
+
+	return path
+}
+
+// attestationTestLayer stores DSSE envelope as is (as cosign does)
+type attestationTestLayer struct {
+	contents []byte
+}
+
+var _ regv1.Layer = attestationTestLayer{}
+
+func (l attestationTestLayer) Digest() (regv1.Hash, error) {
+	digest, _, err := regv1.SHA256(bytes.NewReader(l.contents))
+	return digest, err
+}
+
+func (l attestationTestLayer) DiffID() (regv1.Hash, error) { return l.Digest() }
+func (l attestationTestLayer) Size() (int64, error)        { return int64(len(l.contents)), nil }
+func (l attestationTestLayer) MediaType() (types.MediaType, error) {
+	return ctlimg.DSSEEnvelopeMediaType, nil
+}
+
+func (l attestationTestLayer) Compressed() (io.ReadCloser, error) { return l.Uncompressed() }
+func (l attestationTestLayer) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.contents)), nil
+}
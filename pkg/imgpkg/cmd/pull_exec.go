@@ -0,0 +1,43 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// PostPullExecOutputPathEnv is set to absolute output directory path for post pull command
+const PostPullExecOutputPathEnv = "IMGPKG_OUTPUT_PATH"
+
+func (o *PullOptions) runPostPullExec() error {
+	outputPath, err := filepath.Abs(o.OutputPath)
+	if err != nil {
+		return err
+	}
+
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", o.PostPullExec)
+	} else {
+		cmd = exec.Command("sh", "-c", o.PostPullExec)
+	}
+
+	cmd.Env = append(os.Environ(), PostPullExecOutputPathEnv+"="+outputPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	o.ui.BeginLinef("Running post pull command '%s'\n", o.PostPullExec)
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Running post pull command '%s': %s", o.PostPullExec, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// checkExpectedImages makes sure that bundle references exactly images listed in
+// expected images lock. Images are matched by digest (so that relocated bundles match too)
+// and additionally by name when expected image has a name
+func (o *PullOptions) checkExpectedImages(bundleRef regname.Reference, lockLocation ImageLockLocation) error {
+	expectedLock, err := ReadImageLockFile(o.ExpectedImages)
+	if err != nil {
+		return fmt.Errorf("Reading expected images: %s", err)
+	}
+
+	images, err := GetReferencedImages(bundleRef, lockLocation, o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Reading bundle image lock: %s", err)
+	}
+
+	matched := map[int]bool{}
+	var unexpectedImages, missingImages []string
+
+	for _, img := range images {
+		found := false
+
+		for i, expectedImg := range expectedLock.Spec.Images {
+			if !matched[i] && expectedImageMatches(expectedImg, img) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			unexpectedImages = append(unexpectedImages, describeImageDesc(img))
+		}
+	}
+
+	for i, expectedImg := range expectedLock.Spec.Images {
+		if !matched[i] {
+			missingImages = append(missingImages, describeImageDesc(expectedImg))
+		}
+	}
+
+	if len(unexpectedImages) > 0 || len(missingImages) > 0 {
+		return fmt.Errorf("Expected bundle to reference exactly images listed in '%s', but found %d unexpected (%s) and %d missing (%s)",
+			o.ExpectedImages, len(unexpectedImages), strings.Join(unexpectedImages, ", "), len(missingImages), strings.Join(missingImages, ", "))
+	}
+
+	return nil
+}
+
+func expectedImageMatches(expectedImg, img ImageDesc) bool {
+	if expectedImg.Name != "" && expectedImg.Name != img.Name {
+		return false
+	}
+
+	expectedRef, err := regname.NewDigest(expectedImg.Image)
+	if err != nil {
+		return false
+	}
+
+	ref, err := regname.NewDigest(img.Image)
+	if err != nil {
+		return false
+	}
+
+	return expectedRef.DigestStr() == ref.DigestStr()
+}
+
+func describeImageDesc(img ImageDesc) string {
+	if img.Name != "" {
+		return fmt.Sprintf("%s (%s)", img.Name, img.Image)
+	}
+	return img.Image
+}
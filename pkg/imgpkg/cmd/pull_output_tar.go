@@ -0,0 +1,95 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// writeOutputTar streams image contents into --output-tar path, which may
+// be a named pipe or /dev/stdout. Other output is printed to stderr
+// instead, since stdout may be the same destination (see newStderrUI)
+func (o *PullOptions) writeOutputTar(img regv1.Image) error {
+	file, err := os.OpenFile(o.OutputTar, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Opening output tar: %s", err)
+	}
+
+	err = ctlimg.NewLayerTar(img).Write(file)
+	closeErr := file.Close()
+
+	switch {
+	case isClosedPipeErr(err):
+		// Consumer stopped reading (e.g. 'head'); not a failure
+		return nil
+	case err != nil:
+		return fmt.Errorf("Writing output tar: %s", err)
+	case closeErr != nil && !isClosedPipeErr(closeErr):
+		return fmt.Errorf("Closing output tar: %s", closeErr)
+	}
+
+	return nil
+}
+
+// writeToStdout streams contents of the only file in image to stdout.
+// Other output is printed to stderr instead (see newStderrUI)
+func (o *PullOptions) writeToStdout(img regv1.Image) error {
+	var stdout io.Writer = os.Stdout
+	if o.stdout != nil {
+		stdout = o.stdout
+	}
+
+	err := ctlimg.NewSingleFile(img, o.Artifact).Write(stdout)
+
+	switch {
+	case isClosedPipeErr(err):
+		return nil
+	case err != nil:
+		return fmt.Errorf("Writing file to stdout: %s", err)
+	}
+
+	return nil
+}
+
+func isClosedPipeErr(err error) bool {
+	return err != nil && errors.Is(err, syscall.EPIPE)
+}
+
+// newStderrUI returns UI printing lines (e.g. warnings, verified
+// signatures) to stderr so that they do not mix with contents
+// streamed to stdout; warnings still fail with --strict
+func newStderrUI(parent ui.UI) ui.UI {
+	printUI := parent
+	if warningsUI, ok := parent.(*WarningsUI); ok {
+		printUI = warningsUI.UI
+	}
+	return withWarnings(parent, stderrUI{printUI})
+}
+
+type stderrUI struct {
+	ui.UI
+}
+
+var _ ui.UI = stderrUI{}
+
+func (u stderrUI) PrintLinef(pattern string, args ...interface{}) {
+	u.UI.ErrorLinef(pattern, args...)
+}
+
+func (u stderrUI) BeginLinef(pattern string, args ...interface{}) {
+	u.UI.ErrorLinef(strings.TrimSuffix(pattern, "\n"), args...)
+}
+
+func (u stderrUI) EndLinef(pattern string, args ...interface{}) {
+	u.UI.ErrorLinef(strings.TrimSuffix(pattern, "\n"), args...)
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !windows
+
+package cmd
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestPullOutputTarStreamsIntoPipe(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	// Larger than pipe buffer so that writer blocks on reader
+	largeContents := strings.Repeat("0123456789abcdef", 64*1024)
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	imageTag, err := regname.NewTag(imageRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(imageTag, buildImage(t, map[string]string{"large.txt": largeContents, "small.txt": "small"}, nil))
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-pull-output-tar")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	pipePath := filepath.Join(tmpDir, "pipe")
+
+	err = syscall.Mkfifo(pipePath, 0600)
+	if err != nil {
+		t.Fatalf("Creating fifo: %s", err)
+	}
+
+	readEntries := func(readAll bool) <-chan []string {
+		result := make(chan []string, 1)
+
+		go func() {
+			var names []string
+			defer func() { result <- names }()
+
+			pipe, err := os.Open(pipePath)
+			if err != nil {
+				return
+			}
+			defer pipe.Close()
+
+			if !readAll {
+				// Stop reading after first bytes (e.g. like 'head')
+				pipe.Read(make([]byte, 10))
+				return
+			}
+
+			tarReader := tar.NewReader(pipe)
+			for {
+				header, err := tarReader.Next()
+				if err != nil {
+					return
+				}
+				io.Copy(ioutil.Discard, tarReader)
+				names = append(names, header.Name)
+			}
+		}()
+
+		return result
+	}
+
+	// Output tar may be /dev/stdout, hence nothing else is printed there
+	// (lines are printed to non-TTY stdout only with --tty)
+	expectNoStdout := func(t *testing.T, stdout string) {
+		if stdout != "" {
+			t.Fatalf("Expected nothing to be printed to stdout, but was '%s'", stdout)
+		}
+	}
+
+	t.Run("bundle", func(t *testing.T) {
+		entries := readEntries(true)
+
+		stdout, _, err := runImgpkg(t, "pull", "-b", bundleRef, "--output-tar", pipePath, "--tty")
+		if err != nil {
+			t.Fatalf("Expected pull to succeed: %s", err)
+		}
+
+		expectNoStdout(t, stdout)
+
+		names := <-entries
+		if strings.Join(names, ",") != ".imgpkg/images.yml,config.yml" {
+			t.Fatalf("Expected bundle entries to be streamed, got: %v", names)
+		}
+	})
+
+	t.Run("image", func(t *testing.T) {
+		entries := readEntries(true)
+
+		stdout, _, err := runImgpkg(t, "pull", "-i", imageRef, "--output-tar", pipePath, "--tty")
+		if err != nil {
+			t.Fatalf("Expected pull to succeed: %s", err)
+		}
+
+		expectNoStdout(t, stdout)
+
+		names := <-entries
+		if strings.Join(names, ",") != "large.txt,small.txt" {
+			t.Fatalf("Expected image entries to be streamed, got: %v", names)
+		}
+	})
+
+	t.Run("reader closes early", func(t *testing.T) {
+		entries := readEntries(false)
+
+		stdout, _, err := runImgpkg(t, "pull", "-i", imageRef, "--output-tar", pipePath, "--tty")
+		if err != nil {
+			t.Fatalf("Expected pull to stop without error when reader goes away: %s", err)
+		}
+
+		expectNoStdout(t, stdout)
+
+		<-entries
+	})
+
+	t.Run("combined with output", func(t *testing.T) {
+		_, _, err := runImgpkg(t, "pull", "-i", imageRef, "--output-tar", pipePath, "-o", tmpDir)
+		if err == nil || !strings.Contains(err.Error(), "Expected --output-tar to not be combined with --output (-o)") {
+			t.Fatalf("Expected error about combined output flags, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+const pullPlatformAll = "all"
+
+// platformDirs returns output subdirectory name for each image (in the same order)
+func (o *PullOptions) platformDirs(imgs []regv1.Image) ([]string, error) {
+	var result []string
+	seen := map[string]regv1.Hash{}
+
+	for _, img := range imgs {
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("Getting image config: %s", err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			return nil, fmt.Errorf("Getting image digest: %s", err)
+		}
+
+		if len(cfg.OS) == 0 || len(cfg.Architecture) == 0 {
+			return nil, fmt.Errorf("Expected image '%s' to specify os and architecture", digest)
+		}
+
+		dirName := cfg.OS + "-" + cfg.Architecture
+
+		if prevDigest, found := seen[dirName]; found {
+			return nil, fmt.Errorf("Expected images to have unique platforms, but images '%s' and '%s' both are '%s'", prevDigest, digest, dirName)
+		}
+		seen[dirName] = digest
+
+		result = append(result, dirName)
+	}
+
+	return result, nil
+}
+
+// platformImages returns image matching os and architecture of given platform,
+// and its variant when given (e.g. linux/arm/v7); variant is recorded in index descriptor
+func (o *PullOptions) platformImages(imgs []ctlimg.PlatformImage, platform regv1.Platform) ([]regv1.Image, error) {
+	var matched []regv1.Image
+	var matchedPlatforms, available []string
+
+	for _, img := range imgs {
+		imgPlatform := regv1.Platform{}
+		if img.Platform != nil {
+			imgPlatform = *img.Platform
+		}
+
+		// Image config is authoritative for os and architecture
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("Getting image config: %s", err)
+		}
+
+		imgPlatform.OS = cfg.OS
+		imgPlatform.Architecture = cfg.Architecture
+
+		available = append(available, platformString(imgPlatform))
+
+		if imgPlatform.OS != platform.OS || imgPlatform.Architecture != platform.Architecture {
+			continue
+		}
+		if len(platform.Variant) > 0 && imgPlatform.Variant != platform.Variant {
+			continue
+		}
+
+		matched = append(matched, img.Image)
+		matchedPlatforms = append(matchedPlatforms, platformString(imgPlatform))
+	}
+
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("Expected to find image for platform '%s', but found none (available: %s)",
+			platformString(platform), strings.Join(available, ", "))
+	case 1:
+		return matched, nil
+	default:
+		return nil, fmt.Errorf("Expected to find one image for platform '%s', but found %d (%s); specify variant to select one",
+			platformString(platform), len(matched), strings.Join(matchedPlatforms, ", "))
+	}
+}
+
+// platformString formats platform as os/arch[/variant]
+func platformString(platform regv1.Platform) string {
+	result := platform.OS + "/" + platform.Architecture
+	if len(platform.Variant) > 0 {
+		result += "/" + platform.Variant
+	}
+	return result
+}
+
+func (o *PullOptions) extractPlatforms(ref regname.Reference, imgs []regv1.Image,
+	outputPath string, platformDirs []string, dirImageOpts ctlimg.DirImageOpts) error {
+
+	for i, img := range imgs {
+		digest, err := img.Digest()
+		if err != nil {
+			return fmt.Errorf("Getting image digest: %s", err)
+		}
+
+		o.ui.BeginLinef("Pulling image '%s@%s' into '%s'\n", ref.Context(), digest, filepath.Join(o.OutputPath, platformDirs[i]))
+
+		platformDir := filepath.Join(outputPath, platformDirs[i])
+
+		dirMode := os.FileMode(0700)
+		if dirImageOpts.DirMode != 0 {
+			dirMode = dirImageOpts.DirMode
+		}
+
+		// Platform directory already exists when pulling into
+		// existing output directory (e.g. --changed-only)
+		err = os.MkdirAll(platformDir, dirMode)
+		if err != nil {
+			return fmt.Errorf("Creating platform directory: %s", err)
+		}
+
+		// MkdirAll is subject to umask
+		err = os.Chmod(platformDir, dirMode)
+		if err != nil {
+			return fmt.Errorf("Setting platform directory mode: %s", err)
+		}
+
+		err = ctlimg.NewDirImage(platformDir, img, dirImageOpts, o.ui).AsDirectory()
+		if err != nil {
+			return fmt.Errorf("Extracting image into directory: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestPullPlatformAllExtractsEachPlatform(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	imgRef := writePlatformIndex(t, server)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-platform-all")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imgRef}, OutputPath: outputDir, Platform: "all"}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	for _, platform := range []string{"linux-amd64", "linux-arm64"} {
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, platform, "platform.txt"))
+		if err != nil {
+			t.Fatalf("Expected platform '%s' to be extracted: %s", platform, err)
+		}
+
+		if string(contents) != strings.Replace(platform, "-", "/", 1) {
+			t.Fatalf("Expected platform '%s' to contain its own files, got: %s", platform, contents)
+		}
+	}
+}
+
+func TestPullPlatformAllRepeatedIntoExistingOutput(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	imgRef := writePlatformIndex(t, server)
+
+	testCases := map[string]ExtractFlags{
+		"changed only": {ChangedOnly: true},
+		"newer than":   {NewerThan: "2000-01-01T00:00:00Z"},
+	}
+
+	for name, extractFlags := range testCases {
+		t.Run(name, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "imgpkg-pull-platform-all-repeated")
+			if err != nil {
+				t.Fatalf("Creating output dir: %s", err)
+			}
+			defer os.RemoveAll(outputDir)
+
+			// Second pull updates platform directories created by first one
+			for _, flags := range []ExtractFlags{{}, extractFlags} {
+				pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imgRef}, OutputPath: outputDir,
+					Platform: "all", ExtractFlags: flags}
+
+				err := pull.Run()
+				if err != nil {
+					t.Fatalf("Expected pull to succeed: %s", err)
+				}
+			}
+
+			for _, platform := range []string{"linux-amd64", "linux-arm64"} {
+				_, err := os.Stat(filepath.Join(outputDir, platform, "platform.txt"))
+				if err != nil {
+					t.Fatalf("Expected platform '%s' to be extracted: %s", platform, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPullPlatformMatchesVariant(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	var addenda []mutate.IndexAddendum
+
+	for _, platform := range []regv1.Platform{{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm", Variant: "v6"}, {OS: "linux", Architecture: "arm", Variant: "v7"}} {
+
+		platform := platform // copy
+
+		img := buildImage(t, map[string]string{"platform.txt": platformString(platform)}, func(cfg *regv1.ConfigFile) {
+			cfg.OS = platform.OS
+			cfg.Architecture = platform.Architecture
+		})
+
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: regv1.Descriptor{Platform: &platform}})
+	}
+
+	imgRef := registryHost(server) + "/repo/multi-variant:latest"
+
+	tag, err := regname.NewTag(imgRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.WriteIndex(tag, mutate.AppendManifests(empty.Index, addenda...))
+	if err != nil {
+		t.Fatalf("Writing index: %s", err)
+	}
+
+	testCases := []struct {
+		platform    string
+		expectedErr string
+	}{
+		{platform: "linux/amd64"},
+		{platform: "linux/arm/v7"},
+		{platform: "linux/arm/v6"},
+		{platform: "linux/arm", expectedErr: "Expected to find one image for platform 'linux/arm', but found 2 (linux/arm/v6, linux/arm/v7)"},
+		{platform: "linux/arm/v8", expectedErr: "Expected to find image for platform 'linux/arm/v8', but found none"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.platform, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "imgpkg-pull-platform-variant")
+			if err != nil {
+				t.Fatalf("Creating output dir: %s", err)
+			}
+			defer os.RemoveAll(outputDir)
+
+			pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imgRef}, OutputPath: outputDir, Platform: tc.platform}
+
+			err = pull.Run()
+
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("Expected pull to fail with '%s', but was: %v", tc.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected pull to succeed: %s", err)
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join(outputDir, "platform.txt"))
+			if err != nil {
+				t.Fatalf("Reading extracted file: %s", err)
+			}
+
+			if string(contents) != tc.platform {
+				t.Fatalf("Expected image for platform '%s' to be extracted, but was '%s'", tc.platform, contents)
+			}
+		})
+	}
+}
+
+func TestPullPlatformAllCollision(t *testing.T) {
+	pull := PullOptions{OutputPath: "out"}
+
+	_, err := pull.platformDirs([]regv1.Image{buildPlatformImage(t, "linux", "amd64"), buildPlatformImage(t, "linux", "amd64")})
+	if err == nil {
+		t.Fatalf("Expected platform collision to err")
+	}
+
+	if !strings.Contains(err.Error(), "both are 'linux-amd64'") {
+		t.Fatalf("Expected error to mention colliding platform, got: %s", err)
+	}
+}
+
+// writePlatformIndex pushes index with linux/amd64 and linux/arm64 images and returns its tag
+func writePlatformIndex(t *testing.T, server *httptest.Server) string {
+	amd64Img := buildPlatformImage(t, "linux", "amd64")
+	arm64Img := buildPlatformImage(t, "linux", "arm64")
+
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64Img, Descriptor: regv1.Descriptor{Platform: &regv1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: arm64Img, Descriptor: regv1.Descriptor{Platform: &regv1.Platform{OS: "linux", Architecture: "arm64"}}},
+	)
+
+	imgRef := registryHost(server) + "/repo/multi-arch:latest"
+
+	tag, err := regname.NewTag(imgRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.WriteIndex(tag, idx)
+	if err != nil {
+		t.Fatalf("Writing index: %s", err)
+	}
+
+	return imgRef
+}
+
+func buildPlatformImage(t *testing.T, os, arch string) regv1.Image {
+	return buildImage(t, map[string]string{"platform.txt": os + "/" + arch}, func(cfg *regv1.ConfigFile) {
+		cfg.OS = os
+		cfg.Architecture = arch
+	})
+}
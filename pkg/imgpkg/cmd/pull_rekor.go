@@ -0,0 +1,48 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func (o *PullOptions) validateRekorURL() error {
+	rekorURL, err := url.Parse(o.RekorURL)
+	if err != nil || (rekorURL.Scheme != "http" && rekorURL.Scheme != "https") || rekorURL.Host == "" {
+		return fmt.Errorf("Expected --rekor-url to be http(s) URL (e.g. https://rekor.sigstore.dev), got '%s'", o.RekorURL)
+	}
+	if o.RegistryFlags.AsRegistryOpts().Offline {
+		return fmt.Errorf("Expected no network access in offline mode, but --rekor-url requires reaching '%s'", rekorURL.Host)
+	}
+	return nil
+}
+
+// checkRekorEntry makes sure that pulled image (e.g. bundle) digest
+// is recorded in Rekor transparency log before anything is extracted
+func (o *PullOptions) checkRekorEntry(ref regname.Reference, digest regv1.Hash) error {
+	// Rekor is reached with the same TLS and proxy settings as registries
+	tran, err := ctlimg.NewBaseTransport(o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return err
+	}
+
+	uuids, err := ctlimg.NewRekorIndex(o.RekorURL, tran).EntryUUIDs(digest)
+	if err != nil {
+		return err
+	}
+
+	if len(uuids) == 0 {
+		return fmt.Errorf("Expected image '%s@%s' to be recorded in Rekor transparency log '%s', but found no entries",
+			ref.Context(), digest, o.RekorURL)
+	}
+
+	o.ui.BeginLinef("Found %d Rekor transparency log entry(ies) for '%s@%s'\n", len(uuids), ref.Context(), digest)
+
+	return nil
+}
@@ -4,8 +4,30 @@
 package cmd
 
 import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 )
 
 func TestNoImageOrBundleOrLockError(t *testing.T) {
@@ -21,7 +43,7 @@ func TestNoImageOrBundleOrLockError(t *testing.T) {
 }
 
 func TestImageAndBundleAndLockError(t *testing.T) {
-	pull := PullOptions{ImageFlags: ImageFlags{"image@123456"}, BundleFlags: BundleFlags{"my-bundle"}, LockInputFlags: LockInputFlags{LockFilePath: "lockpath"}}
+	pull := PullOptions{ImageFlags: ImageFlags{"image@123456"}, BundleFlags: BundleFlags{Bundle: "my-bundle"}, LockInputFlags: LockInputFlags{LockFilePath: "lockpath"}}
 	err := pull.Run()
 	if err == nil {
 		t.Fatalf("Expected validations to err, but did not")
@@ -31,3 +53,2144 @@ func TestImageAndBundleAndLockError(t *testing.T) {
 		t.Fatalf("Expected error to contain message about invalid flags, got: %s", err)
 	}
 }
+
+func TestPullCheckImagesReportsMissingImages(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	existingImg := buildImage(t, map[string]string{"file.txt": "content"}, nil)
+
+	existingTag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(existingTag, existingImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	existingDigest, err := existingImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	existingRef := registryHost(server) + "/repo/app@" + existingDigest.String()
+	missingRef := registryHost(server) + "/repo/app@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2"
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+existingRef+`
+  - image: `+missingRef+`
+`)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-check-images")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, CheckImages: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull without strict to succeed: %s", err)
+	}
+
+	pull.ui = newStrictUI()
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected strict pull to fail due to missing image")
+	}
+
+	if !strings.Contains(err.Error(), "1 were not found: "+missingRef) {
+		t.Fatalf("Expected error to mention missing image, got: %s", err)
+	}
+}
+
+func TestPullStrictWithoutCheckImages(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-strict")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	// --strict is global and no longer requires --check-images
+	pull := PullOptions{ui: newStrictUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected strict pull without warnings to succeed: %s", err)
+	}
+}
+
+func TestPullMetadataOnlySkipsDataLayers(t *testing.T) {
+	var fetchedBlobs []string
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			fetchedBlobs = append(fetchedBlobs, path.Base(r.URL.Path))
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// Random contents do not compress, keeping data layer larger than metadata layer
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	dataLayer := buildLayer(t, map[string]string{"data.bin": string(data)})
+	metadataLayer := buildLayer(t, map[string]string{BundleDir + "/" + ImageLockFile: emptyImagesYaml})
+
+	bundleImg := buildImage(t, map[string]string{"config.yml": "key: value"}, func(cfg *regv1.ConfigFile) {
+		cfg.Config.Labels = map[string]string{ctlimg.BundleConfigLabel: "true"}
+	})
+
+	bundleImg, err := mutate.AppendLayers(bundleImg, dataLayer, metadataLayer)
+	if err != nil {
+		t.Fatalf("Appending layers: %s", err)
+	}
+
+	bundleRef := registryHost(server) + "/repo/bundle:latest"
+
+	tag, err := regname.NewTag(bundleRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, bundleImg)
+	if err != nil {
+		t.Fatalf("Writing bundle: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-metadata-only")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	fetchedBlobs = nil
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, MetadataOnly: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, BundleDir, ImageLockFile))
+	if err != nil {
+		t.Fatalf("Expected image lock to be extracted: %s", err)
+	}
+
+	for _, name := range []string{"config.yml", "data.bin"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("Expected '%s' to not be extracted", name)
+		}
+	}
+
+	dataDigest, err := dataLayer.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	for _, blob := range fetchedBlobs {
+		if blob == dataDigest.String() {
+			t.Fatalf("Expected data layer to not be fetched, fetched: %v", fetchedBlobs)
+		}
+	}
+}
+
+func TestPullStrictTreatsWarningsAsErrors(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	// Multiple images found when pulling index without platform
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "amd64")},
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "arm64")},
+	)
+
+	idxRef := registryHost(server) + "/repo/multi-arch:latest"
+
+	idxTag, err := regname.NewTag(idxRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.WriteIndex(idxTag, idx)
+	if err != nil {
+		t.Fatalf("Writing index: %s", err)
+	}
+
+	// Lock file update skipped since image is not in bundle repo
+	otherImg := buildImage(t, map[string]string{"file.txt": "content"}, nil)
+
+	otherTag, err := regname.NewTag(registryHost(server) + "/other/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(otherTag, otherImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	otherDigest, err := otherImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+otherTag.Context().Digest(otherDigest.String()).Name()+`
+`)
+
+	testCases := []struct {
+		name        string
+		pull        PullOptions
+		expectedErr string
+	}{
+		{
+			name:        "multiple images",
+			pull:        PullOptions{ImageFlags: ImageFlags{Image: idxRef}},
+			expectedErr: "Found multiple images, extracting first",
+		},
+		{
+			name:        "images not found in bundle repo",
+			pull:        PullOptions{BundleFlags: BundleFlags{Bundle: bundleRef}},
+			expectedErr: "One or more images not found in bundle repo; skipping lock file update",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "imgpkg-pull-strict")
+			if err != nil {
+				t.Fatalf("Creating output dir: %s", err)
+			}
+			defer os.RemoveAll(outputDir)
+
+			pull := tc.pull
+			pull.ui = ui.NewNoopUI()
+			pull.OutputPath = outputDir
+
+			err = pull.Run()
+			if err != nil {
+				t.Fatalf("Expected pull without strict to succeed: %s", err)
+			}
+
+			pull.ui = newStrictUI()
+
+			err = pull.Run()
+			if err == nil {
+				t.Fatalf("Expected strict pull to fail")
+			}
+			if !strings.Contains(err.Error(), tc.expectedErr) || !strings.Contains(err.Error(), "with --strict") {
+				t.Fatalf("Expected error to contain warning '%s', got: %s", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestStrictIsGlobalFlag(t *testing.T) {
+	cmd := NewImgpkgCmd(NewImgpkgOptions(ui.NewConfUI(ui.NewNoopLogger())))
+
+	if cmd.PersistentFlags().Lookup("strict") == nil {
+		t.Fatalf("Expected --strict to be defined for all commands")
+	}
+
+	for _, subCmd := range cmd.Commands() {
+		if subCmd.LocalNonPersistentFlags().Lookup("strict") != nil {
+			t.Fatalf("Expected '%s' to not define its own --strict", subCmd.Name())
+		}
+	}
+}
+
+func TestPullJSONIncludesWarnings(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "amd64")},
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "arm64")},
+	)
+
+	idxRef := registryHost(server) + "/repo/multi-arch:latest"
+
+	idxTag, err := regname.NewTag(idxRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.WriteIndex(idxTag, idx)
+	if err != nil {
+		t.Fatalf("Writing index: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-json")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	var out bytes.Buffer
+
+	jsonUI := ui.NewJSONUI(ui.NewWriterUI(&out, ioutil.Discard, nil), ui.NewNoopLogger())
+
+	warningsUI := NewWarningsUI(jsonUI)
+	warningsUI.EnableJSON()
+
+	pull := PullOptions{ui: warningsUI, ImageFlags: ImageFlags{Image: idxRef}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	warningsUI.PrintWarnings()
+	jsonUI.Flush()
+
+	var resp ui.JSONUIResp
+
+	err = json.Unmarshal(out.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("Expected output to be JSON: %s (output: %s)", err, out.String())
+	}
+
+	var warnings []string
+
+	for _, table := range resp.Tables {
+		if table.Content == "warnings" {
+			for _, row := range table.Rows {
+				warnings = append(warnings, row["warning"])
+			}
+		}
+	}
+
+	if len(warnings) != 1 || warnings[0] != "Found multiple images, extracting first" {
+		t.Fatalf("Expected JSON output to include warning, got: %#v", warnings)
+	}
+
+	for _, line := range resp.Lines {
+		if strings.Contains(line, "Found multiple images") {
+			t.Fatalf("Expected warning to not be mixed with lines, got: %#v", resp.Lines)
+		}
+	}
+}
+
+func TestPullExtractionWarningsGoThroughWarningsUI(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	// Entries differing only by case are a warning on case-sensitive filesystems
+	img := buildImage(t, map[string]string{"README": "upper", "readme": "lower"}, nil)
+
+	imgTag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(imgTag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-extraction-warnings")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	caseInsensitive, err := isCaseInsensitiveDir(outputDir)
+	if err != nil {
+		t.Fatalf("Checking case sensitivity: %s", err)
+	}
+	if caseInsensitive {
+		t.Skip("Case collisions are errors on case-insensitive filesystems")
+	}
+
+	warningsUI := NewWarningsUI(ui.NewNoopUI())
+	warningsUI.EnableJSON()
+
+	pull := PullOptions{ui: warningsUI, ImageFlags: ImageFlags{Image: imgTag.Name()}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	if len(warningsUI.warnings) != 1 || !strings.Contains(warningsUI.warnings[0], "Tar entries 'README' and 'readme' differ only by case") {
+		t.Fatalf("Expected extraction warning to be collected, got: %#v", warningsUI.warnings)
+	}
+
+	pull.ui = newStrictUI()
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "differ only by case (they collide on case-insensitive filesystems) (warnings are treated as errors with --strict)") {
+		t.Fatalf("Expected strict pull to fail due to extraction warning, got: %v", err)
+	}
+}
+
+func isCaseInsensitiveDir(dir string) (bool, error) {
+	err := ioutil.WriteFile(filepath.Join(dir, "probe"), nil, 0600)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(filepath.Join(dir, "probe"))
+
+	_, err = os.Stat(filepath.Join(dir, "PROBE"))
+	return err == nil, nil
+}
+
+func TestPullArtifactWritesFilesByTitle(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	inputDir, err := ioutil.TempDir("", "imgpkg-push-artifact")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	files := map[string]string{"chart.tgz": "chart-contents", "values.yml": "key: value"}
+
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(inputDir, name), []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing input file: %s", err)
+		}
+	}
+
+	imageRef := registryHost(server) + "/repo/artifact:latest"
+
+	push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: imageRef}, FileFlags: FileFlags{
+		ArtifactFiles: []string{filepath.Join(inputDir, "chart.tgz"), "config/values.yml=" + filepath.Join(inputDir, "values.yml")},
+	}}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Fetching image: %s", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("Getting manifest: %s", err)
+	}
+
+	// Files are not tar archives, hence not labelled as filesystem layers
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != "application/octet-stream" {
+			t.Fatalf("Expected artifact file layer to have media type 'application/octet-stream', but was '%s'", layer.MediaType)
+		}
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-artifact")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: imageRef}, OutputPath: outputDir, Artifact: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	expectedFiles := map[string]string{"chart.tgz": files["chart.tgz"], "config/values.yml": files["values.yml"]}
+
+	for name, expectedContents := range expectedFiles {
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("Reading pulled file: %s", err)
+		}
+		if string(contents) != expectedContents {
+			t.Fatalf("Expected '%s' to contain '%s', got '%s'", name, expectedContents, contents)
+		}
+	}
+}
+
+func TestPullArtifactWithoutImageError(t *testing.T) {
+	pull := PullOptions{BundleFlags: BundleFlags{Bundle: "my-bundle"}, Artifact: true}
+	err := pull.Run()
+	if err == nil {
+		t.Fatalf("Expected validations to err, but did not")
+	}
+
+	if !strings.Contains(err.Error(), "Expected --artifact to be used only with image flag") {
+		t.Fatalf("Expected error to contain message about invalid flags, got: %s", err)
+	}
+}
+
+func TestPullExpectedDigest(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	ref, err := regname.ParseReference(bundleRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	desc, err := regremote.Head(ref)
+	if err != nil {
+		t.Fatalf("Getting bundle descriptor: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-expected-digest")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	existingFile := filepath.Join(outputDir, "existing.txt")
+
+	err = ioutil.WriteFile(existingFile, []byte("existing"), 0600)
+	if err != nil {
+		t.Fatalf("Writing existing file: %s", err)
+	}
+
+	otherDigest := "sha256:" + strings.Repeat("0", 64)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, ExpectedDigest: otherDigest}
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected pull to fail with mismatching digest")
+	}
+	if !strings.Contains(err.Error(), "to have digest '"+otherDigest+"', but was '"+desc.Digest.String()+"'") {
+		t.Fatalf("Expected error to contain message about digest mismatch, got: %s", err)
+	}
+
+	_, err = os.Stat(existingFile)
+	if err != nil {
+		t.Fatalf("Expected output directory to be left untouched: %s", err)
+	}
+
+	pull.ExpectedDigest = desc.Digest.String()
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected bundle to be extracted: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Getting bundle image: %s", err)
+	}
+
+	manifest, err := img.RawManifest()
+	if err != nil {
+		t.Fatalf("Getting bundle manifest: %s", err)
+	}
+
+	sum := sha512.Sum512(manifest)
+	pull.ExpectedDigest = "sha512:" + hex.EncodeToString(sum[:])
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull with sha512 digest to succeed: %s", err)
+	}
+}
+
+func TestPullKeepsExistingOutputOnFailure(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	missingRef := registryHost(server) + "/repo/app@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2"
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+missingRef+`
+`)
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-atomic")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+	existingFile := filepath.Join(outputDir, "existing.txt")
+
+	err = os.Mkdir(outputDir, 0700)
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(existingFile, []byte("existing"), 0600)
+	if err != nil {
+		t.Fatalf("Writing existing file: %s", err)
+	}
+
+	// Strict image check fails only after bundle was extracted
+	pull := PullOptions{ui: newStrictUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, CheckImages: true}
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected strict pull to fail due to missing image")
+	}
+
+	contents, err := ioutil.ReadFile(existingFile)
+	if err != nil || string(contents) != "existing" {
+		t.Fatalf("Expected existing output to survive failed pull: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config.yml"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output directory to not contain partially pulled files")
+	}
+
+	entries, err := ioutil.ReadDir(parentDir)
+	if err != nil {
+		t.Fatalf("Reading parent dir: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Expected temporary directories to be removed, found %d entries", len(entries))
+	}
+
+	pull.ui = ui.NewNoopUI()
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected bundle to be extracted: %s", err)
+	}
+
+	_, err = os.Stat(existingFile)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected previous output to be replaced")
+	}
+
+	entries, err = ioutil.ReadDir(parentDir)
+	if err != nil {
+		t.Fatalf("Reading parent dir: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Expected temporary directories to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestPullExcludeImgpkgDir(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	missingRef := registryHost(server) + "/repo/app@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2"
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+missingRef+`
+`)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-exclude-imgpkg-dir")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, ExcludeImgpkgDir: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected bundle contents to be extracted: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, BundleDir))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected '%s' to be absent from output directory", BundleDir)
+	}
+
+	// Referenced images are still checked based on bundle's lock
+	pull.CheckImages = true
+	pull.ui = newStrictUI()
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 were not found: "+missingRef) {
+		t.Fatalf("Expected strict pull to fail due to missing image, got: %v", err)
+	}
+}
+
+func TestPullWriteLock(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	files := map[string]string{
+		"config.yml":                    "key: value",
+		BundleDir + "/bundle.yml":       "bundle: metadata",
+		BundleDir + "/" + ImageLockFile: emptyImagesYaml,
+	}
+
+	bundleRef := registryHost(server) + "/repo/bundle:latest"
+	imageRef := registryHost(server) + "/repo/image:latest"
+
+	for ref, isBundle := range map[string]bool{bundleRef: true, imageRef: false} {
+		tag, err := regname.NewTag(ref)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		img := buildImage(t, files, func(cfg *regv1.ConfigFile) {
+			if isBundle {
+				cfg.Config.Labels = map[string]string{ctlimg.BundleConfigLabel: "true"}
+			}
+		})
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	cases := []struct {
+		Description      string
+		Bundle           bool
+		ExcludeImgpkgDir bool
+		WriteLock        string
+		ExpectedFiles    []string
+	}{
+		{"bundle", true, false, "", []string{BundleDir + "/bundle.yml", BundleDir + "/" + ImageLockFile, "config.yml"}},
+		{"bundle without lock", true, false, "false", []string{BundleDir + "/bundle.yml", "config.yml"}},
+		{"bundle without bundle dir", true, true, "", []string{"config.yml"}},
+		{"bundle without bundle dir with lock", true, true, "true", []string{BundleDir + "/" + ImageLockFile, "config.yml"}},
+		{"image", false, false, "", []string{BundleDir + "/bundle.yml", BundleDir + "/" + ImageLockFile, "config.yml"}},
+		{"image without lock", false, false, "false", []string{BundleDir + "/bundle.yml", "config.yml"}},
+	}
+
+	for _, tc := range cases {
+		outputDir, err := ioutil.TempDir("", "imgpkg-pull-write-lock")
+		if err != nil {
+			t.Fatalf("Creating output dir: %s", err)
+		}
+		defer os.RemoveAll(outputDir)
+
+		pull := PullOptions{ui: ui.NewNoopUI(), OutputPath: outputDir,
+			ExcludeImgpkgDir: tc.ExcludeImgpkgDir, WriteLock: tc.WriteLock}
+
+		if tc.Bundle {
+			pull.BundleFlags.Bundle = bundleRef
+		} else {
+			pull.ImageFlags.Image = imageRef
+		}
+
+		err = pull.Run()
+		if err != nil {
+			t.Fatalf("(%s) Expected pull to succeed: %s", tc.Description, err)
+		}
+
+		var extractedFiles []string
+
+		err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			relPath, err := filepath.Rel(outputDir, path)
+			extractedFiles = append(extractedFiles, filepath.ToSlash(relPath))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walking output dir: %s", err)
+		}
+
+		if strings.Join(extractedFiles, " ") != strings.Join(tc.ExpectedFiles, " ") {
+			t.Fatalf("(%s) Expected files '%s', but was '%s'", tc.Description, tc.ExpectedFiles, extractedFiles)
+		}
+	}
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: "unused", WriteLock: "maybe"}
+
+	err := pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --write-lock to be 'true' or 'false', got 'maybe'") {
+		t.Fatalf("Expected error about invalid value, got: %v", err)
+	}
+}
+
+func TestPullRecursiveExtractsNestedBundles(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	headDigest := func(ref string) string {
+		tag, err := regname.NewTag(ref)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+		desc, err := regremote.Head(tag)
+		if err != nil {
+			t.Fatalf("Getting descriptor: %s", err)
+		}
+		return desc.Digest.String()
+	}
+
+	appImg := buildImage(t, map[string]string{"app.txt": "app"}, nil)
+	appTag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+	err = regremote.Write(appTag, appImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	appDigest := headDigest(appTag.Name())
+
+	innerRef := writeBundle(t, server, "repo/inner", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+registryHost(server)+"/repo/app@"+appDigest+`
+`)
+	innerDigest := headDigest(innerRef)
+
+	outerRef := writeBundle(t, server, "repo/outer", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+registryHost(server)+"/repo/inner@"+innerDigest+`
+`)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-recursive")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: outerRef}, OutputPath: outputDir, Recursive: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	innerDir := filepath.Join(outputDir, BundleDir, "bundles", strings.Replace(innerDigest, ":", "-", 1))
+
+	for _, path := range []string{"config.yml", filepath.Join(BundleDir, ImageLockFile)} {
+		_, err = os.Stat(filepath.Join(innerDir, path))
+		if err != nil {
+			t.Fatalf("Expected nested bundle file '%s' to be extracted: %s", path, err)
+		}
+	}
+
+	// Referenced image that is not a bundle is not extracted
+	_, err = os.Stat(filepath.Join(innerDir, BundleDir, "bundles"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected image referenced by nested bundle to not be extracted")
+	}
+}
+
+func TestPullRecursiveWithImageError(t *testing.T) {
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: "repo/app"}, OutputPath: "/tmp/does-not-matter", Recursive: true}
+
+	err := pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --recursive to be used only with bundle flag") {
+		t.Fatalf("Expected recursive pull of image to fail, got: %v", err)
+	}
+}
+
+func TestPullLayersToDirWritesFilePerLayer(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	img := buildImage(t, map[string]string{"a.txt": "a"}, nil)
+
+	img, err := mutate.AppendLayers(img, buildLayer(t, map[string]string{"b.txt": "b"}))
+	if err != nil {
+		t.Fatalf("Appending layer: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	tag, err := regname.NewTag(imageRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	layersDir, err := ioutil.TempDir("", "imgpkg-pull-layers-to-dir")
+	if err != nil {
+		t.Fatalf("Creating layers dir: %s", err)
+	}
+	defer os.RemoveAll(layersDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: imageRef}, LayersToDir: layersDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(layersDir)
+	if err != nil {
+		t.Fatalf("Reading layers dir: %s", err)
+	}
+
+	if len(files) != len(layers) {
+		t.Fatalf("Expected one file per layer (%d), but found %d", len(layers), len(files))
+	}
+
+	for _, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			t.Fatalf("Getting diff ID: %s", err)
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(layersDir, ctlimg.LayerFileName(diffID)))
+		if err != nil {
+			t.Fatalf("Expected layer file to exist: %s", err)
+		}
+
+		hash, _, err := regv1.SHA256(bytes.NewReader(contents))
+		if err != nil {
+			t.Fatalf("Hashing layer file: %s", err)
+		}
+
+		if hash != diffID {
+			t.Fatalf("Expected layer file contents to match diff ID '%s', but was '%s'", diffID, hash)
+		}
+	}
+}
+
+func TestPullLayersToDirWithOutputError(t *testing.T) {
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: "repo/app"}, OutputPath: "/tmp/does-not-matter", LayersToDir: "/tmp/does-not-matter"}
+
+	err := pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected only one of --output (-o) or --layers-to-dir") {
+		t.Fatalf("Expected pull with both output and layers dir to fail, got: %v", err)
+	}
+}
+
+func TestPullLayerExtractsOnlyNamedLayer(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	img := buildImage(t, map[string]string{"a.txt": "a", "shared.txt": "first"}, nil)
+
+	img, err := mutate.AppendLayers(img, buildLayer(t, map[string]string{"b.txt": "b"}))
+	if err != nil {
+		t.Fatalf("Appending layer: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	tag, err := regname.NewTag(imageRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	secondDigest, err := layers[1].Digest()
+	if err != nil {
+		t.Fatalf("Getting layer digest: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-layer")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: imageRef}, OutputPath: outputDir, Layer: secondDigest.String()}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "b.txt"))
+	if err != nil || string(contents) != "b" {
+		t.Fatalf("Expected file of named layer to be extracted: %v", err)
+	}
+
+	for _, name := range []string{"a.txt", "shared.txt"} {
+		_, err = os.Stat(filepath.Join(outputDir, name))
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected file '%s' of other layer to not be extracted", name)
+		}
+	}
+
+	pull.Layer = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected image to have layer '"+pull.Layer+"'") {
+		t.Fatalf("Expected error about missing layer, got: %v", err)
+	}
+
+	// Output of previous pull is kept when layer is not found
+	_, err = os.Stat(filepath.Join(outputDir, "b.txt"))
+	if err != nil {
+		t.Fatalf("Expected existing output to be kept: %s", err)
+	}
+
+	pull.ImageFlags.Image = ""
+	pull.BundleFlags.Bundle = imageRef
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --layer to be used only with image flag") {
+		t.Fatalf("Expected error about image flag, got: %v", err)
+	}
+}
+
+func TestPullKeepOnErrorRetainsPartialOutput(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	missingRef := registryHost(server) + "/repo/app@sha256:36b74457bccb56fbf8b05f79c85569501b721d4db813b684391d63e02287c0b2"
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+missingRef+`
+`)
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-keep-on-error")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+
+	// Strict image check fails only after bundle was extracted
+	pull := PullOptions{ui: newStrictUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir,
+		CheckImages: true, KeepOnError: true}
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected strict pull to fail due to missing image")
+	}
+
+	_, err = os.Stat(outputDir)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output directory to not be created on failure")
+	}
+
+	entries, err := ioutil.ReadDir(parentDir)
+	if err != nil {
+		t.Fatalf("Reading parent dir: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Expected temporary directory to be kept, found %d entries", len(entries))
+	}
+
+	_, err = os.Stat(filepath.Join(parentDir, entries[0].Name(), "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected partially extracted files to be kept: %s", err)
+	}
+}
+
+func TestPullPostPullExecRunsWithOutputPathEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Post pull command test uses sh")
+	}
+
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-post-exec")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+	hookOutput := filepath.Join(parentDir, "hook.txt")
+
+	// Command fails unless extracted files are already in place
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir,
+		PostPullExec: `test -f "$IMGPKG_OUTPUT_PATH/config.yml" && printf '%s' "$IMGPKG_OUTPUT_PATH" > ` + hookOutput}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatalf("Expected post pull command to run: %s", err)
+	}
+
+	if string(contents) != outputDir {
+		t.Fatalf("Expected post pull command to receive output path '%s', but was '%s'", outputDir, contents)
+	}
+
+	pull.PostPullExec = "exit 3"
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Running post pull command 'exit 3': exit status 3") {
+		t.Fatalf("Expected pull to fail due to post pull command, but was: %v", err)
+	}
+}
+
+func TestPullImageNameFromImagesLock(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	var lockImages []string
+
+	for _, name := range []string{"frontend", "backend"} {
+		tagRef, err := regname.NewTag(registryHost(server) + "/repo/" + name + ":latest")
+		if err != nil {
+			t.Fatalf("Parsing reference: %s", err)
+		}
+
+		img := buildImage(t, map[string]string{"name.txt": name}, nil)
+
+		err = regremote.Write(tagRef, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		lockImages = append(lockImages, "  - name: "+name+"\n    image: "+tagRef.Context().Digest(digest.String()).Name()+"\n")
+	}
+
+	lockDir, err := ioutil.TempDir("", "imgpkg-pull-image-name")
+	if err != nil {
+		t.Fatalf("Creating lock dir: %s", err)
+	}
+	defer os.RemoveAll(lockDir)
+
+	lockPath := filepath.Join(lockDir, "images.yml")
+	lockYAML := "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n" + strings.Join(lockImages, "")
+
+	err = ioutil.WriteFile(lockPath, []byte(lockYAML), 0600)
+	if err != nil {
+		t.Fatalf("Writing lock file: %s", err)
+	}
+
+	outputDir := filepath.Join(lockDir, "out")
+
+	pull := PullOptions{ui: ui.NewNoopUI(), LockInputFlags: LockInputFlags{LockFilePath: lockPath}, ImageName: "backend", OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "name.txt"))
+	if err != nil {
+		t.Fatalf("Reading pulled file: %s", err)
+	}
+	if string(contents) != "backend" {
+		t.Fatalf("Expected image named backend to be pulled, got contents '%s'", contents)
+	}
+
+	pull.ImageName = "database"
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected pull to fail for unknown image name")
+	}
+	if !strings.Contains(err.Error(), "Expected to find image named 'database'") || !strings.Contains(err.Error(), "(available names: frontend, backend)") {
+		t.Fatalf("Expected error to list available names, got: %s", err)
+	}
+}
+
+func TestPullRequireRelocatedFailsOnExternalImages(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	writeImage := func(repo string, img regv1.Image) regname.Digest {
+		tag, err := regname.NewTag(registryHost(server) + "/" + repo + ":latest")
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		return tag.Context().Digest(digest.String())
+	}
+
+	relocatedImg := buildImage(t, map[string]string{"file.txt": "relocated"}, nil)
+	externalImg := buildImage(t, map[string]string{"file.txt": "external"}, nil)
+
+	// Relocated image is also present in bundle repo
+	relocatedRef := writeImage("other/app", relocatedImg)
+	writeImage("repo/relocated-bundle", relocatedImg)
+
+	externalRef := writeImage("other/app", externalImg)
+
+	relocatedBundleRef := writeBundle(t, server, "repo/relocated-bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+relocatedRef.Name()+`
+`)
+
+	leakedBundleRef := writeBundle(t, server, "repo/leaked-bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+externalRef.Name()+`
+`)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-require-relocated")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: relocatedBundleRef},
+		OutputPath: filepath.Join(outputDir, "relocated"), RequireRelocated: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull of relocated bundle to succeed: %s", err)
+	}
+
+	pull.BundleFlags.Bundle = leakedBundleRef
+	pull.OutputPath = filepath.Join(outputDir, "leaked")
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected pull of bundle with external image to fail")
+	}
+	if !strings.Contains(err.Error(), "Expected all referenced images to be relocated to bundle repo") ||
+		!strings.Contains(err.Error(), externalRef.Name()) {
+		t.Fatalf("Expected error to mention external image, got: %s", err)
+	}
+
+	pull.BundleFlags.Bundle = ""
+	pull.ImageFlags.Image = externalRef.Name()
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --require-relocated to be used only with bundle flag") {
+		t.Fatalf("Expected error about bundle flag, got: %v", err)
+	}
+}
+
+func TestPullLockUpdatePolicy(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	writeImage := func(repo string, img regv1.Image) regname.Digest {
+		tag, err := regname.NewTag(registryHost(server) + "/" + repo + ":latest")
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		return tag.Context().Digest(digest.String())
+	}
+
+	relocatedImg := buildImage(t, map[string]string{"file.txt": "relocated"}, nil)
+	pendingImg := buildImage(t, map[string]string{"file.txt": "pending"}, nil)
+
+	// Only one of images was relocated to bundle repo so far
+	relocatedRef := writeImage("other/app", relocatedImg)
+	bundleRepoRef := writeImage("repo/bundle", relocatedImg)
+	pendingRef := writeImage("other/app", pendingImg)
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+relocatedRef.Name()+`
+  - image: `+pendingRef.Name()+`
+`)
+
+	originalImages := []string{relocatedRef.Name(), pendingRef.Name()}
+
+	testCases := []struct {
+		policy         string
+		expectedImages []string
+	}{
+		{policy: "", expectedImages: originalImages},
+		{policy: "all", expectedImages: originalImages},
+		{policy: "partial", expectedImages: []string{bundleRepoRef.Name(), pendingRef.Name()}},
+		{policy: "none", expectedImages: originalImages},
+	}
+
+	for _, tc := range testCases {
+		t.Run("policy "+tc.policy, func(t *testing.T) {
+			outputDir, err := ioutil.TempDir("", "imgpkg-pull-lock-update-policy")
+			if err != nil {
+				t.Fatalf("Creating output dir: %s", err)
+			}
+			defer os.RemoveAll(outputDir)
+
+			pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef},
+				OutputPath: outputDir, LockUpdatePolicy: tc.policy}
+
+			err = pull.Run()
+			if err != nil {
+				t.Fatalf("Expected pull to succeed: %s", err)
+			}
+
+			lock, err := ReadBundleImageLockFile(outputDir, DefaultImageLockLocation)
+			if err != nil {
+				t.Fatalf("Reading image lock: %s", err)
+			}
+
+			var images []string
+			for _, img := range lock.Spec.Images {
+				images = append(images, img.Image)
+			}
+
+			if strings.Join(images, " ") != strings.Join(tc.expectedImages, " ") {
+				t.Fatalf("Expected lock images %v, but was %v", tc.expectedImages, images)
+			}
+		})
+	}
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: "out", LockUpdatePolicy: "some"}
+
+	err := pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --lock-update-policy to be one of all, partial, none, got 'some'") {
+		t.Fatalf("Expected unsupported policy error, got: %v", err)
+	}
+}
+
+func TestPullLockUpdatePolicyPartialFailsOnRegistryErrors(t *testing.T) {
+	var deniedPath string
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if deniedPath != "" && r.URL.Path == deniedPath {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	img := buildImage(t, map[string]string{"file.txt": "content"}, nil)
+
+	imgTag, err := regname.NewTag(registryHost(server) + "/other/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(imgTag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - image: `+imgTag.Context().Digest(digest.String()).Name()+`
+`)
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-lock-update-policy")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	// Only image missing in bundle repo (not found) keeps original location
+	deniedPath = "/v2/repo/bundle/manifests/" + digest.String()
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef},
+		OutputPath: outputDir, LockUpdatePolicy: "partial"}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Checking image '"+registryHost(server)+"/repo/bundle@"+digest.String()+"' in bundle repo") {
+		t.Fatalf("Expected pull to fail due to denied access, got: %v", err)
+	}
+}
+
+func TestPullByDigestReference(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	img := buildImage(t, map[string]string{"file.txt": "content"}, nil)
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	// Content store has no tags, only digest
+	digestRef, err := regname.NewDigest(registryHost(server) + "/store/app@" + digest.String())
+	if err != nil {
+		t.Fatalf("Building digest ref: %s", err)
+	}
+
+	err = regremote.Write(digestRef, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-digest")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: digestRef.Name()}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull by digest to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "file.txt"))
+	if err != nil || string(contents) != "content" {
+		t.Fatalf("Expected pulled file, got: '%s' (%v)", contents, err)
+	}
+
+	missingDigest := "sha256:" + strings.Repeat("0", 64)
+
+	testCases := []struct {
+		ref         string
+		expectedErr string
+	}{
+		{
+			ref:         registryHost(server) + "/store/app@" + missingDigest,
+			expectedErr: "Expected to find manifest with digest '" + missingDigest + "' in '" + registryHost(server) + "/store/app'",
+		},
+		{
+			ref:         registryHost(server) + "/store/app@sha256:abc",
+			expectedErr: "Expected digest reference '" + registryHost(server) + "/store/app@sha256:abc' to be in format host/repo@sha256:<hex>",
+		},
+	}
+
+	for _, tc := range testCases {
+		pull.ImageFlags.Image = tc.ref
+
+		err = pull.Run()
+		if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+			t.Fatalf("Expected error '%s', got: %v", tc.expectedErr, err)
+		}
+	}
+}
+
+func TestPullExpectedImagesFailsOnUnexpectedAndMissingImages(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	digestRef := func(repo, hex string) string {
+		return registryHost(server) + "/" + repo + "@sha256:" + strings.Repeat(hex, 64)
+	}
+
+	bundleRef := writeBundle(t, server, "repo/bundle", `apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+spec:
+  images:
+  - name: frontend
+    image: `+digestRef("src/frontend", "1")+`
+  - image: `+digestRef("src/backend", "2")+`
+`)
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-pull-expected-images")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeExpectedImages := func(images ...string) string {
+		path := filepath.Join(tmpDir, "expected.yml")
+		contents := "apiVersion: imgpkg.carvel.dev/v1alpha1\nkind: ImagesLock\nspec:\n  images:\n" + strings.Join(images, "")
+		err := ioutil.WriteFile(path, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing expected images: %s", err)
+		}
+		return path
+	}
+
+	outputDir := filepath.Join(tmpDir, "output")
+
+	// Images are matched by digest, hence relocated images match as well
+	// (referenced images do not exist, hence lock is not kept to avoid rewriting it)
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, ExcludeImgpkgDir: true,
+		ExpectedImages: writeExpectedImages(
+			"  - name: frontend\n    image: "+digestRef("relocated/frontend", "1")+"\n",
+			"  - image: "+digestRef("relocated/backend", "2")+"\n",
+		)}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	pull.ExpectedImages = writeExpectedImages("  - name: frontend\n    image: " + digestRef("src/frontend", "1") + "\n")
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "found 1 unexpected ("+digestRef("src/backend", "2")+") and 0 missing") {
+		t.Fatalf("Expected pull to fail due to unexpected image, but was: %v", err)
+	}
+
+	pull.ExpectedImages = writeExpectedImages(
+		"  - name: frontend\n    image: "+digestRef("src/frontend", "1")+"\n",
+		"  - image: "+digestRef("src/backend", "2")+"\n",
+		"  - name: worker\n    image: "+digestRef("src/worker", "3")+"\n",
+	)
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "found 0 unexpected () and 1 missing (worker ("+digestRef("src/worker", "3")+"))") {
+		t.Fatalf("Expected pull to fail due to missing image, but was: %v", err)
+	}
+
+	// Name has to match when expected image has one
+	pull.ExpectedImages = writeExpectedImages(
+		"  - name: backend\n    image: "+digestRef("src/frontend", "1")+"\n",
+		"  - image: "+digestRef("src/backend", "2")+"\n",
+	)
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "found 1 unexpected (frontend ("+digestRef("src/frontend", "1")+"))") {
+		t.Fatalf("Expected pull to fail due to name mismatch, but was: %v", err)
+	}
+}
+
+func TestPullTreeDigestOutputIsSameForSameTree(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-pull-tree-digest")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var digests []string
+
+	for _, name := range []string{"first", "second"} {
+		digestPath := filepath.Join(tmpDir, name+"-digest")
+
+		pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef},
+			OutputPath: filepath.Join(tmpDir, name), TreeDigestOutput: digestPath}
+
+		err = pull.Run()
+		if err != nil {
+			t.Fatalf("Expected pull to succeed: %s", err)
+		}
+
+		digest, err := ioutil.ReadFile(digestPath)
+		if err != nil {
+			t.Fatalf("Reading tree digest: %s", err)
+		}
+
+		digests = append(digests, string(digest))
+	}
+
+	if !strings.HasPrefix(digests[0], "sha256:") || digests[0] != digests[1] {
+		t.Fatalf("Expected pulls of same bundle to have same tree digest, but was '%s' and '%s'", digests[0], digests[1])
+	}
+
+	expectedDigest, err := ctlimg.DefaultDigestAlgorithm.TreeDigest(filepath.Join(tmpDir, "first"))
+	if err != nil {
+		t.Fatalf("Computing tree digest: %s", err)
+	}
+
+	if digests[0] != expectedDigest.String()+"\n" {
+		t.Fatalf("Expected written digest to be '%s', but was '%s'", expectedDigest, digests[0])
+	}
+}
+
+func TestPullExpectedFileCount(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, buildImage(t, map[string]string{"config/app.yml": "key: value", "README.md": "readme"}, nil))
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-expected-file-count")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: tag.String()}, OutputPath: outputDir, ExpectedFileCount: 3}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected to extract 3 file(s), but extracted 2") {
+		t.Fatalf("Expected pull to fail with mismatching file count, but was: %v", err)
+	}
+
+	_, err = os.Stat(outputDir)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output directory to not be created on failure")
+	}
+
+	pull.ExpectedFileCount = 2
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config", "app.yml"))
+	if err != nil {
+		t.Fatalf("Expected image to be extracted: %s", err)
+	}
+}
+
+func TestPullExpectedFileCountCountsFilesRemainingAfterAllLayers(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	// a.txt is overwritten and b.txt is removed by second layer
+	img, err := mutate.AppendLayers(empty.Image,
+		buildLayer(t, map[string]string{"a.txt": "a1", "b.txt": "b", "c.txt": "c"}),
+		buildLayer(t, map[string]string{"a.txt": "a2", ".wh.b.txt": ""}),
+	)
+	if err != nil {
+		t.Fatalf("Appending layers: %s", err)
+	}
+
+	tag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-expected-file-count-layers")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: tag.String()}, OutputPath: outputDir, ExpectedFileCount: 4}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected to extract 4 file(s), but extracted 2") {
+		t.Fatalf("Expected pull to fail with mismatching file count, but was: %v", err)
+	}
+
+	pull.ExpectedFileCount = 2
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+}
+
+func TestPullOfflineFailsWithoutReachingRegistry(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-offline")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir,
+		RegistryFlags: RegistryFlags{Offline: true}}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected no network access in offline mode") {
+		t.Fatalf("Expected pull to fail in offline mode, but was: %v", err)
+	}
+
+	_, err = os.Stat(outputDir)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output directory to not be created in offline mode")
+	}
+}
+
+func TestPullRekorURLRequiresTransparencyLogEntry(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	ref, err := regname.ParseReference(bundleRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	desc, err := regremote.Head(ref)
+	if err != nil {
+		t.Fatalf("Getting bundle descriptor: %s", err)
+	}
+
+	recordedDigests := map[string]bool{}
+
+	rekorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/index/retrieve" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var query struct{ Hash string }
+
+		err := json.NewDecoder(r.Body).Decode(&query)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		uuids := []string{}
+		if recordedDigests[query.Hash] {
+			uuids = append(uuids, "24296fb24b8ad77a"+strings.Repeat("0", 48))
+		}
+
+		json.NewEncoder(w).Encode(uuids)
+	}))
+	defer rekorServer.Close()
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-rekor")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	outputDir := filepath.Join(parentDir, "output")
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir, RekorURL: rekorServer.URL}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "to be recorded in Rekor transparency log") {
+		t.Fatalf("Expected pull to fail without transparency log entry, but was: %v", err)
+	}
+
+	_, err = os.Stat(outputDir)
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected output directory to not be created")
+	}
+
+	recordedDigests[desc.Digest.String()] = true
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config.yml"))
+	if err != nil {
+		t.Fatalf("Expected bundle to be extracted: %s", err)
+	}
+
+	pull.RekorURL = "rekor.sigstore.dev"
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --rekor-url to be http(s) URL") {
+		t.Fatalf("Expected pull to fail with invalid Rekor URL, but was: %v", err)
+	}
+}
+
+func TestPullRekorURLUsesRegistryCACerts(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	rekorServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]string{"24296fb24b8ad77a" + strings.Repeat("0", 48)})
+	}))
+	defer rekorServer.Close()
+
+	parentDir, err := ioutil.TempDir("", "imgpkg-pull-rekor-ca")
+	if err != nil {
+		t.Fatalf("Creating parent dir: %s", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	caCertPath := filepath.Join(parentDir, "ca.pem")
+
+	err = ioutil.WriteFile(caCertPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rekorServer.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatalf("Writing CA certificate: %s", err)
+	}
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: filepath.Join(parentDir, "output"),
+		RekorURL: rekorServer.URL, RegistryFlags: RegistryFlags{VerifyCerts: true}}
+
+	err = pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("Expected pull to fail verifying Rekor certificate, but was: %v", err)
+	}
+
+	pull.RegistryFlags.CACertPaths = []string{caCertPath}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed with Rekor CA certificate: %s", err)
+	}
+}
+
+func TestPullAttestationPolicyVerifiesSubjectAndPredicate(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-pull-attestation")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte("config"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	// Attestation about pushed image is attached by push
+	attestedRef := registryHost(server) + "/repo/app:attested"
+
+	push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: attestedRef}, FileFlags: FileFlags{Files: []string{dir}}, AttestProvenance: true}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	// Attestation about other image is attached to image
+	otherImg := buildImage(t, map[string]string{"other.yml": "other"}, nil)
+	img := buildImage(t, map[string]string{"config.yml": "config"}, nil)
+
+	mismatchedRef := registryHost(server) + "/repo/app:mismatched"
+
+	for ref, img := range map[string]regv1.Image{mismatchedRef: img, registryHost(server) + "/repo/app:other": otherImg} {
+		tag, err := regname.NewTag(ref)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	otherDigest, err := otherImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	attestationImg, err := ctlimg.NewProvenanceImage("other", regv1.Descriptor{Digest: otherDigest}, ctlimg.Provenance{ToolVersion: Version})
+	if err != nil {
+		t.Fatalf("Building attestation: %s", err)
+	}
+
+	attestationDigest, err := attestationImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	registry, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{})
+	if err != nil {
+		t.Fatalf("Creating registry: %s", err)
+	}
+
+	repo, err := regname.NewRepository(registryHost(server) + "/repo/app")
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	err = registry.WriteImage(repo.Digest(attestationDigest.String()), attestationImg)
+	if err != nil {
+		t.Fatalf("Writing attestation: %s", err)
+	}
+
+	err = registry.AddReferrer(repo.Digest(imgDigest.String()), attestationImg)
+	if err != nil {
+		t.Fatalf("Adding referrer: %s", err)
+	}
+
+	writePolicy := func(predicate string) string {
+		path := filepath.Join(dir, "policy.yml")
+
+		err := ioutil.WriteFile(path, []byte(`apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: AttestationPolicy
+predicateType: https://slsa.dev/provenance/v0.2
+predicate:
+`+predicate), 0600)
+		if err != nil {
+			t.Fatalf("Writing policy: %s", err)
+		}
+
+		return path
+	}
+
+	testCases := []struct {
+		name        string
+		image       string
+		predicate   string
+		expectedErr string
+	}{
+		{
+			name:      "matching subject",
+			image:     attestedRef,
+			predicate: "- path: builder.id\n  pattern: ^imgpkg@\n- path: buildType\n  value: https://carvel.dev/imgpkg/push@v1\n",
+		},
+		{
+			name:        "matching subject but unmet policy",
+			image:       attestedRef,
+			predicate:   "- path: builder.id\n  value: other-builder\n",
+			expectedErr: "Expected predicate field 'builder.id' to be 'other-builder'",
+		},
+		{
+			name:        "non-matching subject",
+			image:       mismatchedRef,
+			predicate:   "- path: builder.id\n  pattern: ^imgpkg@\n",
+			expectedErr: "Expected subject to have digest '" + imgDigest.String() + "'",
+		},
+		{
+			name:        "no attestations",
+			image:       registryHost(server) + "/repo/app:other",
+			predicate:   "- path: builder.id\n  pattern: ^imgpkg@\n",
+			expectedErr: "to have in-toto attestation, but found none",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputDir := filepath.Join(dir, "output")
+			defer os.RemoveAll(outputDir)
+
+			pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: tc.image}, OutputPath: outputDir, AttestationPolicy: writePolicy(tc.predicate)}
+
+			err := pull.Run()
+
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Expected pull to succeed: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("Expected pull to fail with '%s', but was: %v", tc.expectedErr, err)
+			}
+
+			_, err = os.Stat(outputDir)
+			if !os.IsNotExist(err) {
+				t.Fatalf("Expected output directory to not be created")
+			}
+		})
+	}
+}
+
+func TestPullToStdoutWritesSingleFile(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	images := map[string]map[string]string{
+		"single": {"config/app.yml": "key: value"},
+		"multi":  {"config/app.yml": "key: value", "README.md": "readme"},
+	}
+
+	for name, files := range images {
+		tag, err := regname.NewTag(registryHost(server) + "/repo/" + name + ":latest")
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, buildImage(t, files, nil))
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	var stdout bytes.Buffer
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: registryHost(server) + "/repo/single"},
+		ToStdout: true, stdout: &stdout}
+
+	err := pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	if stdout.String() != "key: value" {
+		t.Fatalf("Expected stdout to contain file contents, but was '%s'", stdout.String())
+	}
+
+	stdout.Reset()
+
+	pull.ImageFlags.Image = registryHost(server) + "/repo/multi"
+
+	err = pull.Run()
+	if err == nil {
+		t.Fatalf("Expected pull of image with multiple files to fail")
+	}
+
+	expectedErr := "Expected image to contain exactly one file, but found 2 (README.md, config/app.yml)"
+	if !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("Expected error to contain '%s', but was: %s", expectedErr, err)
+	}
+
+	if stdout.Len() != 0 {
+		t.Fatalf("Expected nothing to be written to stdout on failure, but was '%s'", stdout.String())
+	}
+}
+
+func TestPullToStdoutPrintsOnlyFileContents(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	// Multiple images found when pulling index without platform (prints a warning)
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "amd64")},
+		mutate.IndexAddendum{Add: buildPlatformImage(t, "linux", "arm64")},
+	)
+
+	idxTag, err := regname.NewTag(registryHost(server) + "/repo/multi-arch:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.WriteIndex(idxTag, idx)
+	if err != nil {
+		t.Fatalf("Writing index: %s", err)
+	}
+
+	// Lines are printed to non-TTY stdout only with --tty
+	stdout, stderr, err := runImgpkg(t, "pull", "-i", idxTag.Name(), "--to-stdout", "--tty")
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	if stdout != "linux/amd64" {
+		t.Fatalf("Expected stdout to contain only file contents, but was '%s'", stdout)
+	}
+
+	if !strings.Contains(stderr, "Found multiple images, extracting first") {
+		t.Fatalf("Expected warning to be printed to stderr, but was '%s'", stderr)
+	}
+}
+
+func TestPullToStdoutWithOutputError(t *testing.T) {
+	pull := PullOptions{ImageFlags: ImageFlags{Image: "my-image"}, ToStdout: true, OutputPath: "/tmp/output"}
+	err := pull.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --to-stdout to not be combined with --output (-o)") {
+		t.Fatalf("Expected validations to err, but was: %v", err)
+	}
+}
+
+func TestPullEstimateWithoutOutput(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	imgTag, err := regname.NewTag(registryHost(server) + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(imgTag, buildImage(t, map[string]string{"file.txt": "content"}, nil))
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	pull := PullOptions{ui: ui.NewWriterUI(&out, ioutil.Discard, nil), ImageFlags: ImageFlags{Image: imgTag.Name()}, Estimate: true}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected estimate without output to succeed: %s", err)
+	}
+
+	if !strings.Contains(out.String(), "Estimated extracted size: ") {
+		t.Fatalf("Expected estimate to be printed, but was: %s", out.String())
+	}
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
@@ -22,13 +24,33 @@ const BundleDir = ".imgpkg"
 const ImageLockFile = "images.yml"
 
 type PushOptions struct {
-	ui ui.UI
+	ui       ui.UI
+	resultUI ui.UI
 
 	ImageFlags      ImageFlags
 	BundleFlags     BundleFlags
 	LockOutputFlags LockOutputFlags
 	FileFlags       FileFlags
 	RegistryFlags   RegistryFlags
+	ForceUpload     bool
+	ValidateOnly    bool
+	Append          bool
+	ImagesFrom      string
+	Platforms       []string
+	OS              string
+	Arch            string
+	Subject         string
+	Quiet           bool
+	Silent          bool
+
+	CheckReproducible bool
+	AttestProvenance  bool
+
+	HistoryRecordArgs bool
+	HistoryComment    string
+
+	// historyCreatedBy describes command line (set by push command)
+	historyCreatedBy string
 }
 
 func NewPushOptions(ui ui.UI) *PushOptions {
@@ -39,26 +61,70 @@ func NewPushCmd(o *PushOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "push",
 		Short: "Push files as image",
-		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			o.historyCreatedBy = pushCreatedBy(cmd.Flags())
+			return o.Run()
+		},
 		Example: `
   # Push bundle dkalinin/app1-config with contents of config/ directory
   imgpkg push -b dkalinin/app1-config -f config/
 
   # Push image dkalinin/app1-config with contents from multiple locations
-  imgpkg push -i dkalinin/app1-config -f config/ -f additional-config.yml`,
+  imgpkg push -i dkalinin/app1-config -f config/ -f additional-config.yml
+
+  # Push index dkalinin/app1 with image per platform (one file per platform, in the same order)
+  imgpkg push -i dkalinin/app1 --platform linux/amd64 -f build/amd64/ --platform linux/arm64 -f build/arm64/
+
+  # Push image dkalinin/app1-chart with each file as its own titled layer
+  imgpkg push -i dkalinin/app1-chart --artifact-file chart.tgz --artifact-file values.yml=config/values.yml`,
 	}
 	o.ImageFlags.Set(cmd)
 	o.BundleFlags.Set(cmd)
 	o.LockOutputFlags.Set(cmd)
 	o.FileFlags.Set(cmd)
 	o.RegistryFlags.Set(cmd)
+	cmd.Flags().BoolVar(&o.ForceUpload, "force-upload", false, "Upload all layers even if they already exist in destination")
+	cmd.Flags().BoolVar(&o.ValidateOnly, "validate-only", false, "Package files and print resulting digest without uploading")
+	cmd.Flags().StringVar(&o.ImagesFrom, "images-from", "", "Push bundle without files, with ImagesLock generated from YAML list of image refs in given file")
+	cmd.Flags().BoolVar(&o.Append, "append", false, "Add files as a new layer on top of existing image instead of replacing it")
+	cmd.Flags().StringSliceVar(&o.Platforms, "platform", nil, "Push index with image per platform made from file at the same position (format: linux/amd64) (can be specified multiple times)")
+	cmd.Flags().StringVar(&o.OS, "os", "", "Set operating system recorded in image config (e.g. linux)")
+	cmd.Flags().StringVar(&o.Arch, "arch", "", "Set architecture recorded in image config (e.g. arm64)")
+	cmd.Flags().BoolVar(&o.CheckReproducible, "check-reproducible", false, "Package contents twice and warn if resulting digests differ (fail with --strict)")
+	cmd.Flags().BoolVarP(&o.Quiet, "quiet", "q", false, "Print only pushed digest")
+	cmd.Flags().BoolVar(&o.Silent, "silent", false, "Print nothing (exit code indicates result)")
+	cmd.Flags().StringVar(&o.Subject, "subject", "", "Set subject of pushed image and list it as referrer of subject (subject must be in the same repository)")
+	cmd.Flags().BoolVar(&o.HistoryRecordArgs, "history-record-args", false, "Record push flags (except registry flags) in history of added layers (image digest depends on them)")
+	cmd.Flags().StringVar(&o.HistoryComment, "history-comment", "", "Set comment recorded in history of added layers")
+	cmd.Flags().BoolVar(&o.AttestProvenance, "attest-provenance", false, "Push provenance attestation (inputs, timestamp, imgpkg version) listed as referrer of pushed image")
 	return cmd
 }
 
 func (o *PushOptions) Run() error {
+	if o.Quiet && o.Silent {
+		return fmt.Errorf("Expected only one of --quiet (-q) or --silent")
+	}
+
+	// Result is printed via original ui, everything else is discarded
+	// (warnings still fail push with --strict)
+	o.resultUI = o.ui
+	if o.Quiet || o.Silent {
+		o.ui = withWarnings(o.ui, ui.NewNoopUI())
+		defer func() { o.ui = o.resultUI }()
+	}
+
 	var inputRef string
 	var registry ctlimg.Registry
-	var err error
+
+	lockLocation, err := o.BundleFlags.ImageLockLocation()
+	if err != nil {
+		return err
+	}
+
+	sources, err := o.FileFlags.AsTarImageSources()
+	if err != nil {
+		return err
+	}
 
 	switch {
 	case o.isBundle() && o.isImage():
@@ -68,11 +134,46 @@ func (o *PushOptions) Run() error {
 		return fmt.Errorf("Expected either image or bundle")
 
 	case o.isBundle():
-		registry, err = ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+		if o.FileFlags.RawTarFile != "" {
+			return fmt.Errorf("Raw tar file is only supported with image, use files for bundle")
+		}
+		if o.FileFlags.TarPrefix != "" {
+			return fmt.Errorf("Tar prefix is only supported with image, since bundle directory must be at the root")
+		}
+		if o.FileFlags.RelativeTo != "" {
+			return fmt.Errorf("Relative to is only supported with image, since bundle directory must be at the root")
+		}
+		if len(o.FileFlags.ArtifactFiles) > 0 {
+			return fmt.Errorf("Artifact files are only supported with image, use files for bundle")
+		}
+		if o.Append {
+			return fmt.Errorf("Append is only supported with image")
+		}
+		if len(o.Platforms) > 0 {
+			return fmt.Errorf("Platforms are only supported with image")
+		}
+
+		registry, err = ctlimg.NewRegistry(o.registryOpts())
 		if err != nil {
-			return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+			return fmt.Errorf("Unable to create a registry with the options %v: %v", o.registryOpts(), err)
 		}
-		err = o.validateBundle(registry)
+
+		if o.ImagesFrom != "" {
+			if len(sources) > 0 {
+				return fmt.Errorf("Expected images from file to not be combined with files")
+			}
+
+			imagesBundlePath, err := o.writeImagesFromBundle(lockLocation, registry)
+			if err != nil {
+				return err
+			}
+
+			defer os.RemoveAll(imagesBundlePath)
+
+			sources = []ctlimg.TarImageSource{{Path: imagesBundlePath}}
+		}
+
+		err = o.validateBundle(sources, lockLocation, registry)
 		if err != nil {
 			return err
 		}
@@ -80,28 +181,30 @@ func (o *PushOptions) Run() error {
 		inputRef = o.BundleFlags.Bundle
 
 	case o.isImage():
+		if o.ImagesFrom != "" {
+			return fmt.Errorf("Images from file is only supported with bundle")
+		}
 		if o.LockOutputFlags.LockFilePath != "" {
 			return fmt.Errorf("Lock output is not compatible with image, use bundle for lock output")
 		}
 
-		bundleDirPaths, err := o.findBundleDirs()
+		bundleDirPaths, err := o.findBundleDirs(sources, lockLocation)
 		if err != nil {
 			return err
 		}
 
 		if len(bundleDirPaths) > 0 {
-			return fmt.Errorf("Images cannot be pushed with '%s' directories (found %d at '%s'), consider using a bundle", BundleDir, len(bundleDirPaths), strings.Join(bundleDirPaths, ","))
+			return fmt.Errorf("Images cannot be pushed with '%s' directories (found %d at '%s'), consider using a bundle", lockLocation.BundleDir, len(bundleDirPaths), strings.Join(bundleDirPaths, ","))
 		}
-		registry, err = ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+		registry, err = ctlimg.NewRegistry(o.registryOpts())
 		if err != nil {
-			return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+			return fmt.Errorf("Unable to create a registry with the options %v: %v", o.registryOpts(), err)
 		}
 		inputRef = o.ImageFlags.Image
 	}
 
-	err = o.checkRepeatedPaths()
-	if err != nil {
-		return err
+	if o.ValidateOnly && o.LockOutputFlags.LockFilePath != "" {
+		return fmt.Errorf("Lock output is not compatible with validate only, since nothing is pushed")
 	}
 
 	uploadRef, err := regname.NewTag(inputRef, regname.WeakValidation)
@@ -109,33 +212,138 @@ func (o *PushOptions) Run() error {
 		return fmt.Errorf("Parsing '%s': %s", inputRef, err)
 	}
 
-	var img *ctlimg.FileImage
-	tarImg := ctlimg.NewTarImage(o.FileFlags.Files, o.FileFlags.FileExcludeDefaults, InfoLog{o.ui})
-	if o.isBundle() {
-		img, err = tarImg.AsFileBundle()
-	} else {
-		img, err = tarImg.AsFileImage()
+	if len(o.Platforms) > 0 {
+		if o.OS != "" || o.Arch != "" {
+			return fmt.Errorf("Expected --os and --arch to not be combined with --platform")
+		}
+		if o.Subject != "" {
+			return fmt.Errorf("Expected --subject to not be combined with --platform")
+		}
+		if o.AttestProvenance {
+			return fmt.Errorf("Expected --attest-provenance to not be combined with --platform")
+		}
+		return o.pushPlatforms(uploadRef, sources, registry)
 	}
 
+	err = o.checkRepeatedPaths(sources)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(o.FileFlags.ArtifactFiles) > 0:
+		if len(sources) > 0 || o.FileFlags.RawTarFile != "" || o.FileFlags.TarPrefix != "" || o.FileFlags.LayerMediaType != "" || o.FileFlags.Mtime != "" {
+			return fmt.Errorf("Expected artifact files to not be combined with files, raw tar file, tar prefix, layer media type or mtime")
+		}
+	case o.FileFlags.RawTarFile != "":
+		if len(sources) > 0 {
+			return fmt.Errorf("Expected only one of files or raw tar file")
+		}
+		if o.FileFlags.NoCompressLayers || o.FileFlags.LayerMediaType != "" || o.FileFlags.Mtime != "" {
+			return fmt.Errorf("Expected --no-compress-layers, --layer-media-type and --mtime to not be combined with raw tar file")
+		}
+	}
+
+	tarOpts, err := o.FileFlags.AsTarImageOpts()
+	if err != nil {
+		return err
+	}
+
+	tarImg := ctlimg.NewTarImageFromSources(sources, o.FileFlags.FileExcludeDefaults, tarOpts, InfoLog{o.ui})
+
+	packageImg := func() (*ctlimg.FileImage, error) {
+		switch {
+		case len(o.FileFlags.ArtifactFiles) > 0:
+			return ctlimg.NewArtifactImage(o.FileFlags.AsArtifactFiles())
+		case o.FileFlags.RawTarFile != "":
+			return ctlimg.NewRawTarImage(o.FileFlags.RawTarFile).AsFileImage()
+		case o.isBundle():
+			return tarImg.AsFileBundle()
+		default:
+			return tarImg.AsFileImage()
+		}
+	}
+
+	img, err := packageImg()
 	if err != nil {
 		return err
 	}
 
 	defer img.Remove()
 
-	err = registry.WriteImage(uploadRef, img)
+	if o.CheckReproducible {
+		err = o.checkReproducible(img, packageImg)
+		if err != nil {
+			return err
+		}
+	}
+
+	var pushImg regv1.Image = img
+
+	if o.Append {
+		pushImg, err = o.appendToExisting(uploadRef, img, registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	addedLayers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	pushImg, err = o.withHistory(pushImg, len(addedLayers))
+	if err != nil {
+		return err
+	}
+
+	if o.OS != "" || o.Arch != "" {
+		pushImg, err = o.withConfigPlatform(pushImg)
+		if err != nil {
+			return err
+		}
+	}
+
+	var subjectRef regname.Digest
+
+	if o.Subject != "" {
+		pushImg, subjectRef, err = o.withSubject(uploadRef, pushImg, registry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.ValidateOnly {
+		return o.printValidated(uploadRef, pushImg)
+	}
+
+	err = registry.WriteImage(uploadRef, pushImg)
 	if err != nil {
 		return fmt.Errorf("Writing '%s': %s", uploadRef.Name(), err)
 	}
 
-	digest, err := img.Digest()
+	digest, err := pushImg.Digest()
 	if err != nil {
 		return err
 	}
 
 	imageURL := fmt.Sprintf("%s@%s", uploadRef.Context(), digest)
 
-	o.ui.BeginLinef("Pushed '%s'", imageURL)
+	o.printResult(digest, "Pushed '%s'", imageURL)
+
+	if o.Subject != "" {
+		err = registry.AddReferrer(subjectRef, pushImg)
+		if err != nil {
+			return fmt.Errorf("Listing '%s' as referrer of '%s': %s", imageURL, subjectRef.Name(), err)
+		}
+	}
+
+	if o.AttestProvenance {
+		err = o.attestProvenance(uploadRef, pushImg, sources, registry)
+		if err != nil {
+			return err
+		}
+	}
 
 	if o.LockOutputFlags.LockFilePath != "" {
 		bundleLock := BundleLock{
@@ -163,37 +371,187 @@ func (o *PushOptions) Run() error {
 	return nil
 }
 
-func (o *PushOptions) validateBundleDirs(bundleDirPaths []string) error {
+func (o *PushOptions) validateBundleDirs(sources []ctlimg.TarImageSource, bundleDirPaths []string, lockLocation ImageLockLocation) error {
 	if len(bundleDirPaths) != 1 {
-		return fmt.Errorf("Expected one '%s' dir, got %d: %s", BundleDir, len(bundleDirPaths), strings.Join(bundleDirPaths, ", "))
+		return fmt.Errorf("Expected one '%s' dir, got %d: %s", lockLocation.BundleDir, len(bundleDirPaths), strings.Join(bundleDirPaths, ", "))
 	}
 
 	path := bundleDirPaths[0]
 
-	// make sure it is a child of one input dir
-	for _, flagPath := range o.FileFlags.Files {
-		flagPath, err := filepath.Abs(flagPath)
+	// make sure it is a child of one input dir placed at image root
+	for _, source := range sources {
+		sourcePath, err := filepath.Abs(source.Path)
 		if err != nil {
 			return err
 		}
 
-		if filepath.Dir(path) == flagPath {
+		if filepath.Dir(path) == sourcePath && filepath.Clean("./"+source.Name) == "." {
 			return nil
 		}
 	}
 
-	return fmt.Errorf("Expected '%s' directory, to be a direct child of one of: %s; was %s", BundleDir, strings.Join(o.FileFlags.Files, ", "), path)
+	return fmt.Errorf("Expected '%s' directory, to be a direct child of one of: %s; was %s", lockLocation.BundleDir, strings.Join(sourcePaths(sources), ", "), path)
+}
+
+// appendToExisting adds layers of given image on top of layers of the image
+// currently found at ref. Existing layers stay in place in the destination
+// repository, hence are not uploaded again.
+func (o *PushOptions) appendToExisting(ref regname.Tag, img regv1.Image, registry ctlimg.Registry) (regv1.Image, error) {
+	if len(o.FileFlags.ArtifactFiles) > 0 {
+		return nil, fmt.Errorf("Expected artifact files to not be combined with append")
+	}
+
+	existingImg, err := registry.Image(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Fetching existing image '%s': %s", ref.Name(), err)
+	}
+
+	bundle, err := isBundle(existingImg)
+	if err != nil {
+		return nil, err
+	}
+	if bundle {
+		return nil, fmt.Errorf("Expected existing image '%s' to not be a bundle", ref.Name())
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("Getting image layers: %s", err)
+	}
+
+	appendedImg, err := mutate.AppendLayers(existingImg, layers...)
+	if err != nil {
+		return nil, fmt.Errorf("Appending layers to existing image: %s", err)
+	}
+
+	return appendedImg, nil
+}
+
+// withConfigPlatform sets os and architecture recorded in image config
+// (e.g. for artifacts later assembled into an index)
+func (o *PushOptions) withConfigPlatform(img regv1.Image) (regv1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("Getting image config: %s", err)
+	}
+
+	if o.OS != "" {
+		cfg.OS = o.OS
+	}
+	if o.Arch != "" {
+		cfg.Architecture = o.Arch
+	}
+
+	platformImg, err := mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Setting image config platform: %s", err)
+	}
+
+	return platformImg, nil
+}
+
+// writeImagesFromBundle creates bundle directory that only contains ImagesLock
+// with images listed in images from file (resolved to digests)
+func (o *PushOptions) writeImagesFromBundle(lockLocation ImageLockLocation, registry ctlimg.Registry) (string, error) {
+	refsBytes, err := ioutil.ReadFile(o.ImagesFrom)
+	if err != nil {
+		return "", fmt.Errorf("Reading images from file: %s", err)
+	}
+
+	var refs []string
+
+	err = yaml.Unmarshal(refsBytes, &refs)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshalling images from file (expected list of image refs): %s", err)
+	}
+
+	if len(refs) == 0 {
+		return "", fmt.Errorf("Expected images from file to list at least one image")
+	}
+
+	var images []ImageDesc
+
+	for _, ref := range refs {
+		parsedRef, err := regname.ParseReference(ref, regname.WeakValidation)
+		if err != nil {
+			return "", fmt.Errorf("Parsing image '%s': %s", ref, err)
+		}
+
+		desc, err := registry.Generic(parsedRef)
+		if err != nil {
+			return "", fmt.Errorf("Resolving image '%s': %s", ref, err)
+		}
+
+		images = append(images, ImageDesc{Image: parsedRef.Context().Digest(desc.Digest.String()).Name()})
+	}
+
+	imgLockBytes, err := yaml.Marshal(ImageLock{
+		ApiVersion: ImageLockAPIVersion,
+		Kind:       ImageLockKind,
+		Spec:       ImageSpec{Images: images},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Marshalling image lock file: %s", err)
+	}
+
+	bundlePath, err := ioutil.TempDir("", "imgpkg-push-images-from")
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Mkdir(filepath.Join(bundlePath, lockLocation.BundleDir), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(lockLocation.Path(bundlePath), append([]byte("---\n"), imgLockBytes...), 0600)
+	}
+	if err != nil {
+		_ = os.RemoveAll(bundlePath)
+		return "", fmt.Errorf("Writing image lock file: %s", err)
+	}
+
+	return bundlePath, nil
+}
+
+func (o *PushOptions) printValidated(uploadRef regname.Tag, img regv1.Image) error {
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	estimate, err := ctlimg.EstimateSize(img)
+	if err != nil {
+		return err
+	}
+
+	o.printResult(digest, "Validated '%s@%s' (not pushed)\n", uploadRef.Context(), digest)
+	o.ui.BeginLinef("Layers size: %d bytes\n", estimate.DownloadSize)
+
+	return nil
+}
+
+// printResult prints given line, or only digest with --quiet
+func (o *PushOptions) printResult(digest regv1.Hash, pattern string, args ...interface{}) {
+	o.ui.BeginLinef(pattern, args...)
+
+	if o.Quiet {
+		o.resultUI.PrintLinef("%s", digest)
+	}
+}
+
+func (o *PushOptions) registryOpts() ctlimg.RegistryOpts {
+	opts := o.RegistryFlags.AsRegistryOpts()
+	opts.ForceUpload = o.ForceUpload
+	return opts
 }
 
-func (o *PushOptions) findBundleDirs() ([]string, error) {
+func (o *PushOptions) findBundleDirs(sources []ctlimg.TarImageSource, lockLocation ImageLockLocation) ([]string, error) {
 	var bundlePaths []string
-	for _, flagPath := range o.FileFlags.Files {
+	for _, flagPath := range sourcePaths(sources) {
 		err := filepath.Walk(flagPath, func(currPath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
 
-			if filepath.Base(currPath) != BundleDir {
+			if filepath.Base(currPath) != lockLocation.BundleDir {
 				return nil
 			}
 
@@ -215,21 +573,21 @@ func (o *PushOptions) findBundleDirs() ([]string, error) {
 	return bundlePaths, nil
 }
 
-func (o *PushOptions) validateBundle(registry ctlimg.Registry) error {
-	bundlePaths, err := o.findBundleDirs()
+func (o *PushOptions) validateBundle(sources []ctlimg.TarImageSource, lockLocation ImageLockLocation, registry ctlimg.Registry) error {
+	bundlePaths, err := o.findBundleDirs(sources, lockLocation)
 	if err != nil {
 		return nil
 	}
 
-	err = o.validateBundleDirs(bundlePaths)
+	err = o.validateBundleDirs(sources, bundlePaths, lockLocation)
 	if err != nil {
 		return err
 	}
 
-	imagesBytes, err := ioutil.ReadFile(filepath.Join(bundlePaths[0], ImageLockFile))
+	imagesBytes, err := ioutil.ReadFile(filepath.Join(bundlePaths[0], lockLocation.ImageLockFile))
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = fmt.Errorf("Must have images.yml in '%s' directory", BundleDir)
+			err = fmt.Errorf("Must have %s in '%s' directory", lockLocation.ImageLockFile, lockLocation.BundleDir)
 		}
 		return err
 	}
@@ -250,9 +608,10 @@ func (o *PushOptions) validateBundle(registry ctlimg.Registry) error {
 	return nil
 }
 
-func (o *PushOptions) checkRepeatedPaths() error {
+func (o *PushOptions) checkRepeatedPaths(sources []ctlimg.TarImageSource) error {
 	imageRootPaths := make(map[string][]string)
-	for _, flagPath := range o.FileFlags.Files {
+	for _, source := range sources {
+		flagPath := source.Path
 		err := filepath.Walk(flagPath, func(currPath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -268,6 +627,11 @@ func (o *PushOptions) checkRepeatedPaths() error {
 					return nil
 				}
 				imageRootPath = filepath.Base(flagPath)
+				if len(source.Name) > 0 {
+					imageRootPath = filepath.Clean(source.Name)
+				}
+			} else {
+				imageRootPath = filepath.Join(source.Name, imageRootPath)
 			}
 			imageRootPaths[imageRootPath] = append(imageRootPaths[imageRootPath], currPath)
 			return nil
@@ -290,6 +654,14 @@ func (o *PushOptions) checkRepeatedPaths() error {
 	return nil
 }
 
+func sourcePaths(sources []ctlimg.TarImageSource) []string {
+	var paths []string
+	for _, source := range sources {
+		paths = append(paths, source.Path)
+	}
+	return paths
+}
+
 func (o *PushOptions) isBundle() bool {
 	return o.BundleFlags.Bundle != ""
 }
@@ -0,0 +1,48 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/spf13/pflag"
+)
+
+// withHistory sets history entry of each layer added by push
+// (layers of existing image keep their history with --append)
+func (o *PushOptions) withHistory(img regv1.Image, addedLayers int) (regv1.Image, error) {
+	var createdBy string
+	if o.HistoryRecordArgs {
+		createdBy = o.historyCreatedBy
+	}
+
+	return ctlimg.WithHistory(img, addedLayers, ctlimg.LayerHistory(createdBy, o.HistoryComment))
+}
+
+// pushCreatedBy describes push command with flags set by user
+// (e.g. 'imgpkg push --file=config/ --image=app'); registry flags
+// are omitted since they may contain credentials
+func pushCreatedBy(flags *pflag.FlagSet) string {
+	args := []string{"imgpkg", "push"}
+
+	flags.Visit(func(flag *pflag.Flag) {
+		if strings.HasPrefix(flag.Name, "registry-") || strings.HasPrefix(flag.Name, "history-") {
+			return
+		}
+
+		if sliceVal, ok := flag.Value.(pflag.SliceValue); ok {
+			for _, val := range sliceVal.GetSlice() {
+				args = append(args, fmt.Sprintf("--%s=%s", flag.Name, val))
+			}
+			return
+		}
+
+		args = append(args, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+	})
+
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+const (
+	PushManifestKind       string = "PushManifest"
+	PushManifestAPIVersion string = "imgpkg.carvel.dev/v1alpha1"
+)
+
+// PushManifest lists files to push (YAML or JSON)
+type PushManifest struct {
+	ApiVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Files      []PushManifestFile
+}
+
+type PushManifestFile struct {
+	// Path is relative to manifest file directory (unless absolute)
+	Path string
+	// Name within image (defaults to file name for files, and image root for directories)
+	Name string
+	// Excludes are relative to directory path
+	Excludes []string
+}
+
+func ReadPushManifestFile(path string) (PushManifest, error) {
+	var manifest PushManifest
+
+	err := readPathInto(path, &manifest)
+	if err != nil {
+		return PushManifest{}, fmt.Errorf("Reading push manifest: %s", err)
+	}
+
+	if manifest.ApiVersion != PushManifestAPIVersion || manifest.Kind != PushManifestKind {
+		return PushManifest{}, fmt.Errorf("Expected push manifest to have apiVersion '%s' and kind '%s', got '%s' and '%s'",
+			PushManifestAPIVersion, PushManifestKind, manifest.ApiVersion, manifest.Kind)
+	}
+
+	if len(manifest.Files) == 0 {
+		return PushManifest{}, fmt.Errorf("Expected push manifest to list at least one file")
+	}
+
+	for i, file := range manifest.Files {
+		if len(file.Path) == 0 {
+			return PushManifest{}, fmt.Errorf("Expected push manifest file %d to specify path", i)
+		}
+		if !filepath.IsAbs(file.Path) {
+			manifest.Files[i].Path = filepath.Join(filepath.Dir(path), file.Path)
+		}
+	}
+
+	return manifest, nil
+}
+
+func (m PushManifest) AsTarImageSources() []ctlimg.TarImageSource {
+	var sources []ctlimg.TarImageSource
+	for _, file := range m.Files {
+		sources = append(sources, ctlimg.TarImageSource{Path: file.Path, Name: file.Name, ExcludePaths: file.Excludes})
+	}
+	return sources
+}
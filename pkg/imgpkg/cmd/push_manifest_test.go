@@ -0,0 +1,135 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+)
+
+func TestPushBundleFromFileManifest(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	inputDir, err := ioutil.TempDir("", "imgpkg-push-manifest")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	inputFiles := map[string]string{
+		"config/app.yml":        "app: true",
+		"build/values.yml":      "env: prod",
+		"docs/README.md":        "readme",
+		"docs/drafts/draft.md":  "draft",
+		"docs/notes/private.md": "private",
+	}
+
+	for path, contents := range inputFiles {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(inputDir, path)), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(inputDir, path), []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	err = createBundleDir(filepath.Join(inputDir, "config"), "")
+	if err != nil {
+		t.Fatalf("Creating bundle dir: %s", err)
+	}
+
+	manifestPath := filepath.Join(inputDir, "manifest.yml")
+
+	err = ioutil.WriteFile(manifestPath, []byte(`
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: PushManifest
+files:
+- path: config
+- path: build/values.yml
+  name: values/prod.yml
+- path: docs
+  name: documentation
+  excludes: [drafts, notes/private.md]
+`), 0600)
+	if err != nil {
+		t.Fatalf("Writing manifest: %s", err)
+	}
+
+	bundleRef := registryHost(server) + "/repo/bundle:latest"
+
+	push := PushOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, FileFlags: FileFlags{FileManifest: manifestPath}}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-pull-manifest")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	expectedFiles := map[string]string{
+		"app.yml":                               "app: true",
+		"values/prod.yml":                       "env: prod",
+		"documentation/README.md":               "readme",
+		filepath.Join(BundleDir, ImageLockFile): emptyImagesYaml,
+	}
+
+	var pulledFiles []string
+
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		pulledFiles = append(pulledFiles, relPath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walking output dir: %s", err)
+	}
+
+	if len(pulledFiles) != len(expectedFiles) {
+		t.Fatalf("Expected files %v, got: %s", expectedFiles, strings.Join(pulledFiles, ", "))
+	}
+
+	for path, expectedContents := range expectedFiles {
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, path))
+		if err != nil {
+			t.Fatalf("Reading pulled file: %s", err)
+		}
+		if string(contents) != expectedContents {
+			t.Fatalf("Expected '%s' to contain '%s', got '%s'", path, expectedContents, contents)
+		}
+	}
+}
+
+func TestPushFileManifestWithFilesError(t *testing.T) {
+	push := PushOptions{ImageFlags: ImageFlags{Image: "foo"}, FileFlags: FileFlags{Files: []string{"foo"}, FileManifest: "manifest.yml"}}
+
+	err := push.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected only one of files or file manifest") {
+		t.Fatalf("Expected error about files and file manifest, got: %v", err)
+	}
+}
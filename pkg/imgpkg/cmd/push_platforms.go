@@ -0,0 +1,120 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// pushPlatforms pushes OCI index with one image per platform,
+// pairing each platform with file at the same position
+func (o *PushOptions) pushPlatforms(uploadRef regname.Tag, sources []ctlimg.TarImageSource, registry ctlimg.Registry) error {
+	switch {
+	case len(o.FileFlags.FileManifest) > 0 || o.FileFlags.RawTarFile != "" || len(o.FileFlags.ArtifactFiles) > 0:
+		return fmt.Errorf("Expected platforms to be used only with files")
+	case o.Append || o.ValidateOnly:
+		return fmt.Errorf("Expected platforms to not be combined with append or validate only")
+	case len(o.Platforms) != len(sources):
+		return fmt.Errorf("Expected one file per platform, got %d platform(s) and %d file(s)", len(o.Platforms), len(sources))
+	}
+
+	tarOpts, err := o.FileFlags.AsTarImageOpts()
+	if err != nil {
+		return err
+	}
+
+	var addenda []mutate.IndexAddendum
+	seen := map[string]bool{}
+
+	for i, val := range o.Platforms {
+		platform, err := parsePlatform(val)
+		if err != nil {
+			return err
+		}
+
+		if seen[val] {
+			return fmt.Errorf("Expected platforms to be unique, but '%s' is repeated", val)
+		}
+		seen[val] = true
+
+		source := sources[i]
+
+		img, err := ctlimg.NewTarImageFromSources([]ctlimg.TarImageSource{source},
+			o.FileFlags.FileExcludeDefaults, tarOpts, InfoLog{o.ui}).AsFileImage()
+		if err != nil {
+			return err
+		}
+
+		defer img.Remove()
+
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return fmt.Errorf("Getting image config: %s", err)
+		}
+
+		cfg.OS = platform.OS
+		cfg.Architecture = platform.Architecture
+
+		platformImg, err := mutate.ConfigFile(img, cfg)
+		if err != nil {
+			return fmt.Errorf("Setting platform of image for '%s': %s", source.Path, err)
+		}
+
+		// Image made from files has a single layer
+		platformImg, err = o.withHistory(platformImg, 1)
+		if err != nil {
+			return err
+		}
+
+		addenda = append(addenda, mutate.IndexAddendum{
+			Add:        platformImg,
+			Descriptor: regv1.Descriptor{Platform: &platform},
+		})
+	}
+
+	idx := mutate.AppendManifests(empty.Index, addenda...)
+
+	err = registry.WriteIndex(uploadRef, idx)
+	if err != nil {
+		return fmt.Errorf("Writing '%s': %s", uploadRef.Name(), err)
+	}
+
+	digest, err := idx.Digest()
+	if err != nil {
+		return err
+	}
+
+	o.printResult(digest, "Pushed '%s@%s' (%d platforms)", uploadRef.Context(), digest, len(addenda))
+
+	return nil
+}
+
+// parsePlatform parses platform in format os/arch[/variant] (e.g. linux/arm64)
+func parsePlatform(val string) (regv1.Platform, error) {
+	pieces := strings.Split(val, "/")
+
+	if len(pieces) < 2 || len(pieces) > 3 {
+		return regv1.Platform{}, fmt.Errorf("Expected platform '%s' to be in format os/arch[/variant] (e.g. linux/arm64)", val)
+	}
+
+	for _, piece := range pieces {
+		if len(piece) == 0 {
+			return regv1.Platform{}, fmt.Errorf("Expected platform '%s' to be in format os/arch[/variant] (e.g. linux/arm64)", val)
+		}
+	}
+
+	platform := regv1.Platform{OS: pieces[0], Architecture: pieces[1]}
+	if len(pieces) == 3 {
+		platform.Variant = pieces[2]
+	}
+
+	return platform, nil
+}
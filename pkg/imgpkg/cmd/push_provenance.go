@@ -0,0 +1,71 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// attestProvenance pushes provenance attestation of pushed image
+// and lists it as referrer of pushed image
+func (o *PushOptions) attestProvenance(uploadRef regname.Tag, pushedImg regv1.Image,
+	sources []ctlimg.TarImageSource, registry ctlimg.Registry) error {
+
+	mediaType, err := pushedImg.MediaType()
+	if err != nil {
+		return err
+	}
+
+	digest, err := pushedImg.Digest()
+	if err != nil {
+		return err
+	}
+
+	size, err := pushedImg.Size()
+	if err != nil {
+		return err
+	}
+
+	inputs := sourcePaths(sources)
+	if o.FileFlags.RawTarFile != "" {
+		inputs = append(inputs, o.FileFlags.RawTarFile)
+	}
+	for _, file := range o.FileFlags.AsArtifactFiles() {
+		inputs = append(inputs, file.Path)
+	}
+
+	subjectDesc := regv1.Descriptor{MediaType: mediaType, Digest: digest, Size: size}
+
+	provenanceImg, err := ctlimg.NewProvenanceImage(uploadRef.Context().Name(), subjectDesc,
+		ctlimg.Provenance{ToolVersion: Version, Inputs: inputs, FinishedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("Building provenance: %s", err)
+	}
+
+	provenanceDigest, err := provenanceImg.Digest()
+	if err != nil {
+		return err
+	}
+
+	provenanceRef := uploadRef.Context().Digest(provenanceDigest.String())
+
+	err = registry.WriteImage(provenanceRef, provenanceImg)
+	if err != nil {
+		return fmt.Errorf("Writing provenance '%s': %s", provenanceRef.Name(), err)
+	}
+
+	err = registry.AddReferrer(uploadRef.Context().Digest(digest.String()), provenanceImg)
+	if err != nil {
+		return fmt.Errorf("Listing provenance '%s' as referrer: %s", provenanceRef.Name(), err)
+	}
+
+	o.ui.BeginLinef("Attached provenance '%s'\n", provenanceRef.Name())
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// checkReproducible packages contents again and compares resulting digest
+// to surface non-determinism (e.g. files changing while being packaged)
+func (o *PushOptions) checkReproducible(img *ctlimg.FileImage, packageImg func() (*ctlimg.FileImage, error)) error {
+	if o.FileFlags.RawTarFile == "-" {
+		return fmt.Errorf("Expected --check-reproducible to not be used with raw tar file read from stdin")
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	o.ui.BeginLinef("Packaging contents again to check that digest is reproducible\n")
+
+	otherImg, err := packageImg()
+	if err != nil {
+		return err
+	}
+
+	defer otherImg.Remove()
+
+	otherDigest, err := otherImg.Digest()
+	if err != nil {
+		return err
+	}
+
+	if digest == otherDigest {
+		return nil
+	}
+
+	return warnf(o.ui, "Packaging contents twice resulted in different digests '%s' and '%s' "+
+		"(inputs may be changing while being packaged)", digest, otherDigest)
+}
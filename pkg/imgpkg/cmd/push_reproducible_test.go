@@ -0,0 +1,93 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !windows
+
+package cmd
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPushQuietStrictFailsOnNonReproducibleContents(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-quiet-reproducible")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Raw tar is read once per packaging, each time with different contents
+	pipePath := filepath.Join(dir, "contents.tar")
+
+	err = syscall.Mkfifo(pipePath, 0600)
+	if err != nil {
+		t.Fatalf("Creating fifo: %s", err)
+	}
+
+	writeErrs := make(chan error, 1)
+
+	go func() {
+		for _, contents := range []string{"step 1", "step 2"} {
+			err := writeTarFile(pipePath, "build.log", contents)
+			if err != nil {
+				writeErrs <- err
+				return
+			}
+			// Let reader see end of contents before fifo is opened again
+			// (otherwise both contents are read as one)
+			time.Sleep(500 * time.Millisecond)
+		}
+		writeErrs <- nil
+	}()
+
+	push := PushOptions{
+		ui:                newStrictUI(),
+		ImageFlags:        ImageFlags{Image: registryHost(server) + "/repo/app:latest"},
+		FileFlags:         FileFlags{RawTarFile: pipePath},
+		CheckReproducible: true,
+		Quiet:             true,
+	}
+
+	err = push.Run()
+	if err == nil || !strings.Contains(err.Error(), "Packaging contents twice resulted in different digests") {
+		t.Fatalf("Expected quiet strict push to fail on non-reproducible contents, but was: %v", err)
+	}
+
+	err = <-writeErrs
+	if err != nil {
+		t.Fatalf("Writing contents into fifo: %s", err)
+	}
+}
+
+func writeTarFile(path, name, contents string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+
+	err = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+
+	_, err = tarWriter.Write([]byte(contents))
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
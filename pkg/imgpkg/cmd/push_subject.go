@@ -0,0 +1,42 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+// withSubject sets subject of pushed image (OCI referrers API) so that
+// it can be discovered as referrer of subject (e.g. SBOM of an app image).
+// Referrers are scoped to repository, hence subject must be in destination repository
+func (o *PushOptions) withSubject(uploadRef regname.Tag, img regv1.Image, registry ctlimg.Registry) (regv1.Image, regname.Digest, error) {
+	subjectRef, err := parseImageRef(o.Subject)
+	if err != nil {
+		return nil, regname.Digest{}, fmt.Errorf("Parsing subject '%s': %s", o.Subject, err)
+	}
+
+	if subjectRef.Context().Name() != uploadRef.Context().Name() {
+		return nil, regname.Digest{}, fmt.Errorf("Expected subject '%s' to be in repository '%s'", o.Subject, uploadRef.Context().Name())
+	}
+
+	subjectDesc, err := registry.Generic(subjectRef)
+	if err != nil {
+		return nil, regname.Digest{}, fmt.Errorf("Fetching subject '%s': %s", o.Subject, err)
+	}
+
+	subjectImg, err := ctlimg.NewSubjectImage(img, regv1.Descriptor{
+		MediaType: subjectDesc.MediaType,
+		Size:      subjectDesc.Size,
+		Digest:    subjectDesc.Digest,
+	})
+	if err != nil {
+		return nil, regname.Digest{}, fmt.Errorf("Setting subject: %s", err)
+	}
+
+	return subjectImg, uploadRef.Context().Digest(subjectDesc.Digest.String()), nil
+}
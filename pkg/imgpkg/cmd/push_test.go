@@ -4,12 +4,28 @@
 package cmd
 
 import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"gopkg.in/yaml.v2"
 )
 
 const emptyImagesYaml = `apiVersion: imgpkg.carvel.dev/v1alpha1
@@ -190,7 +206,7 @@ func TestNoImageOrBundleError(t *testing.T) {
 }
 
 func TestImageAndBundleError(t *testing.T) {
-	push := PushOptions{ImageFlags: ImageFlags{"image@123456"}, BundleFlags: BundleFlags{"my-bundle"}}
+	push := PushOptions{ImageFlags: ImageFlags{"image@123456"}, BundleFlags: BundleFlags{Bundle: "my-bundle"}}
 	err := push.Run()
 	if err == nil {
 		t.Fatalf("Expected validations to err, but did not")
@@ -213,6 +229,240 @@ func TestImageAndBundleLockError(t *testing.T) {
 	}
 }
 
+func TestPushSkipsExistingLayers(t *testing.T) {
+	var uploads int32
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+			atomic.AddInt32(&uploads, 1)
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	pushDir, err := ioutil.TempDir("", "imgpkg-push-units-existing-layers")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(pushDir)
+
+	err = ioutil.WriteFile(filepath.Join(pushDir, "config.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	push := func(forceUpload bool) int32 {
+		atomic.StoreInt32(&uploads, 0)
+
+		push := PushOptions{
+			ui:          ui.NewNoopUI(),
+			ImageFlags:  ImageFlags{registryHost(server) + "/repo/app"},
+			FileFlags:   FileFlags{Files: []string{pushDir}},
+			ForceUpload: forceUpload,
+		}
+
+		err := push.Run()
+		if err != nil {
+			t.Fatalf("Expected push to succeed: %s", err)
+		}
+
+		return atomic.LoadInt32(&uploads)
+	}
+
+	// layer and config
+	if count := push(false); count != 2 {
+		t.Fatalf("Expected first push to upload 2 blobs, but uploaded %d", count)
+	}
+
+	if count := push(false); count != 0 {
+		t.Fatalf("Expected second push to upload no blobs, but uploaded %d", count)
+	}
+
+	if count := push(true); count != 2 {
+		t.Fatalf("Expected forced push to upload 2 blobs, but uploaded %d", count)
+	}
+}
+
+func TestPushAppendReusesExistingLayers(t *testing.T) {
+	var uploads int32
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+			atomic.AddInt32(&uploads, 1)
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	pushDir, err := ioutil.TempDir("", "imgpkg-push-units-append")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(pushDir)
+
+	existingFile := filepath.Join(pushDir, "config.yml")
+	newFile := filepath.Join(pushDir, "extra.yml")
+
+	err = ioutil.WriteFile(existingFile, []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	err = ioutil.WriteFile(newFile, []byte("extra: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{imageRef},
+		FileFlags:  FileFlags{Files: []string{existingFile}},
+	}
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Failed to parse ref: %s", err)
+	}
+
+	existingImg, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Failed to fetch image: %s", err)
+	}
+	existingLayers, err := existingImg.Layers()
+	if err != nil {
+		t.Fatalf("Failed to get layers: %s", err)
+	}
+
+	atomic.StoreInt32(&uploads, 0)
+
+	push = PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{imageRef},
+		FileFlags:  FileFlags{Files: []string{newFile}},
+		Append:     true,
+	}
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected append push to succeed: %s", err)
+	}
+
+	// new layer and config
+	if count := atomic.LoadInt32(&uploads); count != 2 {
+		t.Fatalf("Expected append push to upload 2 blobs, but uploaded %d", count)
+	}
+
+	appendedImg, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Failed to fetch image: %s", err)
+	}
+	appendedLayers, err := appendedImg.Layers()
+	if err != nil {
+		t.Fatalf("Failed to get layers: %s", err)
+	}
+
+	if len(appendedLayers) != len(existingLayers)+1 {
+		t.Fatalf("Expected %d layers, but was %d", len(existingLayers)+1, len(appendedLayers))
+	}
+
+	for i, layer := range existingLayers {
+		expectedDigest, err := layer.Digest()
+		if err != nil {
+			t.Fatalf("Failed to get layer digest: %s", err)
+		}
+		digest, err := appendedLayers[i].Digest()
+		if err != nil {
+			t.Fatalf("Failed to get layer digest: %s", err)
+		}
+		if digest != expectedDigest {
+			t.Fatalf("Expected layer %d to be '%s', but was '%s'", i, expectedDigest, digest)
+		}
+	}
+}
+
+func TestPushAppendWithBundleError(t *testing.T) {
+	push := PushOptions{
+		ui:          ui.NewNoopUI(),
+		BundleFlags: BundleFlags{Bundle: "localhost:5000/repo/bundle"},
+		FileFlags:   FileFlags{Files: []string{"does-not-matter"}},
+		Append:      true,
+	}
+
+	err := push.Run()
+	if err == nil || !strings.Contains(err.Error(), "Append is only supported with image") {
+		t.Fatalf("Expected append with bundle to fail, but was: %v", err)
+	}
+}
+
+func TestPushValidateOnlyDoesNotWrite(t *testing.T) {
+	var writes int32
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			atomic.AddInt32(&writes, 1)
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	pushDir, err := ioutil.TempDir("", "imgpkg-push-units-validate-only")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(pushDir)
+
+	err = ioutil.WriteFile(filepath.Join(pushDir, "config.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app"
+
+	var validateOut bytes.Buffer
+
+	push := PushOptions{
+		ui:           ui.NewWriterUI(&validateOut, ioutil.Discard, nil),
+		ImageFlags:   ImageFlags{imageRef},
+		FileFlags:    FileFlags{Files: []string{pushDir}},
+		ValidateOnly: true,
+	}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected validate only push to succeed: %s", err)
+	}
+
+	if count := atomic.LoadInt32(&writes); count != 0 {
+		t.Fatalf("Expected no registry writes, but got %d", count)
+	}
+
+	var pushOut bytes.Buffer
+
+	push.ui = ui.NewWriterUI(&pushOut, ioutil.Discard, nil)
+	push.ValidateOnly = false
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	digestRef := regexp.MustCompile(`'(.+@sha256:[a-f0-9]{64})'`)
+
+	validatedRef := digestRef.FindStringSubmatch(validateOut.String())
+	pushedRef := digestRef.FindStringSubmatch(pushOut.String())
+
+	if validatedRef == nil || pushedRef == nil || validatedRef[1] != pushedRef[1] {
+		t.Fatalf("Expected validated digest to match pushed digest, got: '%s' and '%s'", validateOut.String(), pushOut.String())
+	}
+}
+
 func Cleanup(dirs ...string) {
 	for _, dir := range dirs {
 		os.RemoveAll(dir)
@@ -264,3 +514,1061 @@ func createBundleDir(loc, imagesYaml string) error {
 
 	return ioutil.WriteFile(filepath.Join(bundleDir, ImageLockFile), []byte(imagesYaml), 0600)
 }
+
+func TestPushImagesFromCreatesBundleWithOnlyImageLock(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	var refs []string
+	var digests []string
+
+	for _, name := range []string{"app1", "app2"} {
+		img := buildImage(t, map[string]string{"name": name}, nil)
+
+		ref := registryHost(server) + "/repo/" + name + ":latest"
+
+		tag, err := regname.NewTag(ref)
+		if err != nil {
+			t.Fatalf("Building tag: %s", err)
+		}
+
+		err = regremote.Write(tag, img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		refs = append(refs, ref)
+		digests = append(digests, registryHost(server)+"/repo/"+name+"@"+digest.String())
+	}
+
+	refsDir, err := ioutil.TempDir("", "imgpkg-push-images-from")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(refsDir)
+
+	refsPath := filepath.Join(refsDir, "refs.yml")
+
+	err = ioutil.WriteFile(refsPath, []byte("- "+refs[0]+"\n- "+refs[1]+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	bundleRef := registryHost(server) + "/repo/bundle:latest"
+
+	push := PushOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef}, ImagesFrom: refsPath}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(bundleRef)
+	if err != nil {
+		t.Fatalf("Failed to parse ref: %s", err)
+	}
+
+	bundleImg, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Failed to fetch bundle: %s", err)
+	}
+
+	isBundle, err := isBundle(bundleImg)
+	if err != nil || !isBundle {
+		t.Fatalf("Expected pushed image to be a bundle: %v", err)
+	}
+
+	layers, err := bundleImg.Layers()
+	if err != nil || len(layers) != 1 {
+		t.Fatalf("Expected bundle to have one layer: %v", err)
+	}
+
+	layerStream, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("Failed to read layer: %s", err)
+	}
+	defer layerStream.Close()
+
+	var fileNames []string
+	var imgLock ImageLock
+
+	tarReader := tar.NewReader(layerStream)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read layer: %s", err)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		fileNames = append(fileNames, hdr.Name)
+
+		contents, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("Failed to read layer: %s", err)
+		}
+
+		err = yaml.Unmarshal(contents, &imgLock)
+		if err != nil {
+			t.Fatalf("Failed to unmarshal image lock: %s", err)
+		}
+	}
+
+	if strings.Join(fileNames, ",") != filepath.Join(BundleDir, ImageLockFile) {
+		t.Fatalf("Expected bundle to only contain image lock, but was: %v", fileNames)
+	}
+
+	if len(imgLock.Spec.Images) != 2 || imgLock.Spec.Images[0].Image != digests[0] || imgLock.Spec.Images[1].Image != digests[1] {
+		t.Fatalf("Expected image lock to reference images by digest, but was: %v", imgLock.Spec.Images)
+	}
+}
+
+func TestPushPlatformsCreatesIndexWithPlatformDescriptors(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	var files []string
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		dir, err := ioutil.TempDir("", "imgpkg-push-platforms-"+arch)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		err = ioutil.WriteFile(filepath.Join(dir, "arch.txt"), []byte(arch), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+
+		files = append(files, dir)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{Image: imageRef},
+		FileFlags:  FileFlags{Files: files},
+		Platforms:  []string{"linux/amd64", "linux/arm64/v8"},
+	}
+
+	err := push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	idx, err := regremote.Index(ref)
+	if err != nil {
+		t.Fatalf("Getting index: %s", err)
+	}
+
+	idxManifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatalf("Getting index manifest: %s", err)
+	}
+
+	mediaType, err := idx.MediaType()
+	if err != nil {
+		t.Fatalf("Getting index media type: %s", err)
+	}
+
+	if mediaType != types.OCIImageIndex {
+		t.Fatalf("Expected OCI index, but was '%s'", mediaType)
+	}
+
+	var platforms []string
+
+	for _, desc := range idxManifest.Manifests {
+		if desc.Platform == nil {
+			t.Fatalf("Expected descriptor '%s' to have platform", desc.Digest)
+		}
+		platforms = append(platforms, desc.Platform.OS+"/"+desc.Platform.Architecture+"/"+desc.Platform.Variant)
+	}
+
+	if strings.Join(platforms, ",") != "linux/amd64/,linux/arm64/v8" {
+		t.Fatalf("Expected platform descriptors, but was: %v", platforms)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-push-platforms-pull")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{Image: imageRef}, OutputPath: outputDir, Platform: "linux/arm64"}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "arch.txt"))
+	if err != nil {
+		t.Fatalf("Reading pulled file: %s", err)
+	}
+	if string(contents) != "arm64" {
+		t.Fatalf("Expected arm64 image to be pulled, but was '%s'", contents)
+	}
+}
+
+func TestPushPlatformsWithoutFilePerPlatformError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgpkg-push-platforms")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{Image: "localhost:5000/repo/app"},
+		FileFlags:  FileFlags{Files: []string{dir}},
+		Platforms:  []string{"linux/amd64", "linux/arm64"},
+	}
+
+	err = push.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected one file per platform, got 2 platform(s) and 1 file(s)") {
+		t.Fatalf("Expected push to fail due to missing file, but was: %v", err)
+	}
+}
+
+func TestPushOSAndArchSetConfigPlatform(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-os-arch")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "model.bin"), []byte("model"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/model:latest"
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{Image: imageRef},
+		FileFlags:  FileFlags{Files: []string{dir}},
+		OS:         "linux",
+		Arch:       "arm64",
+	}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Getting image: %s", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("Getting config: %s", err)
+	}
+
+	if cfg.OS != "linux" || cfg.Architecture != "arm64" {
+		t.Fatalf("Expected config to report linux/arm64, but was '%s/%s'", cfg.OS, cfg.Architecture)
+	}
+
+	push.Platforms = []string{"linux/amd64"}
+
+	err = push.Run()
+	if err == nil || !strings.Contains(err.Error(), "Expected --os and --arch to not be combined with --platform") {
+		t.Fatalf("Expected push to fail when combined with platforms, but was: %v", err)
+	}
+}
+
+func TestPushRelativeToControlsEntryNames(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-push-relative-to")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	projectDir := filepath.Join(tmpDir, "project")
+
+	for path, contents := range map[string]string{"src/main.go": "main", "docs/readme.md": "readme", "VERSION": "1.0"} {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(projectDir, path)), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(projectDir, path), []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	files := []string{filepath.Join(projectDir, "src"), filepath.Join(projectDir, "docs", "readme.md"), filepath.Join(projectDir, "VERSION")}
+
+	testCases := []struct {
+		relativeTo      string
+		expectedEntries string
+	}{
+		{relativeTo: "", expectedEntries: ".,main.go,readme.md,VERSION"},
+		{relativeTo: projectDir, expectedEntries: "src,src/main.go,docs/readme.md,VERSION"},
+		{relativeTo: tmpDir, expectedEntries: "project/src,project/src/main.go,project/docs/readme.md,project/VERSION"},
+	}
+
+	for _, tc := range testCases {
+		imageRef := registryHost(server) + "/repo/app:latest"
+
+		push := PushOptions{
+			ui:         ui.NewNoopUI(),
+			ImageFlags: ImageFlags{Image: imageRef},
+			FileFlags:  FileFlags{Files: files, RelativeTo: tc.relativeTo},
+		}
+
+		err = push.Run()
+		if err != nil {
+			t.Fatalf("Expected push to succeed: %s", err)
+		}
+
+		entries := pushedEntryNames(t, imageRef)
+
+		if strings.Join(entries, ",") != tc.expectedEntries {
+			t.Fatalf("Expected entries relative to '%s' to be '%s', but were: %v", tc.relativeTo, tc.expectedEntries, entries)
+		}
+	}
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{Image: registryHost(server) + "/repo/app:latest"},
+		FileFlags:  FileFlags{Files: files, RelativeTo: filepath.Join(projectDir, "src")},
+	}
+
+	err = push.Run()
+	if err == nil || !strings.Contains(err.Error(), "to be within relative to directory") {
+		t.Fatalf("Expected push to fail for file outside of relative to directory, but was: %v", err)
+	}
+}
+
+func pushedEntryNames(t *testing.T, imageRef string) []string {
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Getting image: %s", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil || len(layers) != 1 {
+		t.Fatalf("Expected image to have one layer: %v", err)
+	}
+
+	layerStream, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("Reading layer: %s", err)
+	}
+	defer layerStream.Close()
+
+	var names []string
+
+	tarReader := tar.NewReader(layerStream)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Reading layer: %s", err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	return names
+}
+
+func TestPushSubjectListsImageAsReferrer(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	subjectImg := buildImage(t, map[string]string{"app": "binary"}, nil)
+
+	subjectTag, err := regname.NewTag(registryHost(server) + "/repo/app:v1")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(subjectTag, subjectImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	subjectDigest, err := subjectImg.Digest()
+	if err != nil {
+		t.Fatalf("Getting digest: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-subject")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var referrerDigests []string
+
+	for _, name := range []string{"sbom", "attestation"} {
+		err = ioutil.WriteFile(filepath.Join(dir, "contents.json"), []byte(name), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+
+		push := PushOptions{
+			ui:         ui.NewNoopUI(),
+			ImageFlags: ImageFlags{Image: registryHost(server) + "/repo/app:" + name},
+			FileFlags:  FileFlags{Files: []string{dir}},
+			Subject:    subjectTag.Name(),
+		}
+
+		err = push.Run()
+		if err != nil {
+			t.Fatalf("Expected push to succeed: %s", err)
+		}
+
+		desc, err := regremote.Get(subjectTag.Context().Tag(name))
+		if err != nil {
+			t.Fatalf("Getting pushed manifest: %s", err)
+		}
+
+		var manifest struct {
+			MediaType types.MediaType
+			Subject   struct{ Digest string }
+		}
+
+		err = json.Unmarshal(desc.Manifest, &manifest)
+		if err != nil {
+			t.Fatalf("Parsing manifest: %s", err)
+		}
+
+		if manifest.MediaType != types.OCIManifestSchema1 || manifest.Subject.Digest != subjectDigest.String() {
+			t.Fatalf("Expected OCI manifest with subject '%s', got: %s", subjectDigest, desc.Manifest)
+		}
+
+		referrerDigests = append(referrerDigests, desc.Digest.String())
+	}
+
+	// Registry without referrers API; referrers are listed in sha256-<hex> tag
+	referrersDesc, err := regremote.Get(subjectTag.Context().Tag("sha256-" + subjectDigest.Hex))
+	if err != nil {
+		t.Fatalf("Getting referrers index: %s", err)
+	}
+
+	var referrers struct {
+		Manifests []struct {
+			Digest       string
+			ArtifactType types.MediaType
+		}
+	}
+
+	err = json.Unmarshal(referrersDesc.Manifest, &referrers)
+	if err != nil {
+		t.Fatalf("Parsing referrers index: %s", err)
+	}
+
+	if len(referrers.Manifests) != len(referrerDigests) {
+		t.Fatalf("Expected %d referrers, got: %s", len(referrerDigests), referrersDesc.Manifest)
+	}
+	for i, referrer := range referrers.Manifests {
+		if referrer.Digest != referrerDigests[i] || referrer.ArtifactType != types.OCIConfigJSON {
+			t.Fatalf("Expected referrer '%s' to be listed, got: %s", referrerDigests[i], referrersDesc.Manifest)
+		}
+	}
+
+	push := PushOptions{
+		ui:         ui.NewNoopUI(),
+		ImageFlags: ImageFlags{Image: registryHost(server) + "/other/app:sbom"},
+		FileFlags:  FileFlags{Files: []string{dir}},
+		Subject:    subjectTag.Name(),
+	}
+
+	err = push.Run()
+	if err == nil || !strings.Contains(err.Error(), "to be in repository '"+registryHost(server)+"/other/app'") {
+		t.Fatalf("Expected push to fail with subject in another repository, but was: %v", err)
+	}
+}
+
+func TestPushQuietPrintsOnlyDigest(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-quiet")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	var quietOut bytes.Buffer
+
+	push := PushOptions{
+		ui:         ui.NewWriterUI(&quietOut, ioutil.Discard, nil),
+		ImageFlags: ImageFlags{Image: imageRef},
+		FileFlags:  FileFlags{Files: []string{dir}},
+		Quiet:      true,
+	}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	desc, err := regremote.Get(ref)
+	if err != nil {
+		t.Fatalf("Getting pushed image: %s", err)
+	}
+
+	if quietOut.String() != desc.Digest.String()+"\n" {
+		t.Fatalf("Expected output to be exactly digest '%s', got: '%s'", desc.Digest, quietOut.String())
+	}
+
+	var silentOut bytes.Buffer
+
+	push.ui = ui.NewWriterUI(&silentOut, ioutil.Discard, nil)
+	push.Quiet = false
+	push.Silent = true
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	if silentOut.Len() != 0 {
+		t.Fatalf("Expected no output, got: '%s'", silentOut.String())
+	}
+
+	push.Quiet = true
+
+	err = push.Run()
+	if err == nil || err.Error() != "Expected only one of --quiet (-q) or --silent" {
+		t.Fatalf("Expected error about quiet and silent, got: %v", err)
+	}
+
+	cmd := NewImgpkgCmd(NewImgpkgOptions(ui.NewConfUI(ui.NewNoopLogger())))
+
+	pushCmd, _, err := cmd.Find([]string{"push"})
+	if err != nil {
+		t.Fatalf("Finding push command: %s", err)
+	}
+
+	if PrintsOnlyResult(pushCmd) {
+		t.Fatalf("Expected push without -q to print more than result")
+	}
+
+	err = pushCmd.Flags().Parse([]string{"-q"})
+	if err != nil {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	if !PrintsOnlyResult(pushCmd) {
+		t.Fatalf("Expected push with -q to print only result")
+	}
+}
+
+func TestPushCheckReproducibleDetectsChangingInputs(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-reproducible")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "build.log")
+
+	err = ioutil.WriteFile(filePath, []byte("step 1"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	push := PushOptions{
+		ui:                newStrictUI(),
+		ImageFlags:        ImageFlags{Image: registryHost(server) + "/repo/app:latest"},
+		FileFlags:         FileFlags{Files: []string{dir}},
+		CheckReproducible: true,
+	}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push of unchanging inputs to succeed: %s", err)
+	}
+
+	packageImg := func() (*ctlimg.FileImage, error) {
+		return ctlimg.NewTarImage([]string{dir}, nil, ctlimg.TarImageOpts{}, ioutil.Discard).AsFileImage()
+	}
+
+	img, err := packageImg()
+	if err != nil {
+		t.Fatalf("Packaging: %s", err)
+	}
+	defer img.Remove()
+
+	// File changes while contents are packaged
+	changingPackageImg := func() (*ctlimg.FileImage, error) {
+		err := ioutil.WriteFile(filePath, []byte("step 2"), 0600)
+		if err != nil {
+			return nil, err
+		}
+		return packageImg()
+	}
+
+	err = push.checkReproducible(img, changingPackageImg)
+	if err == nil || !strings.Contains(err.Error(), "Packaging contents twice resulted in different digests") {
+		t.Fatalf("Expected changing inputs to be detected, but was: %v", err)
+	}
+
+	push.ui = ui.NewNoopUI()
+
+	err = push.checkReproducible(img, changingPackageImg)
+	if err != nil {
+		t.Fatalf("Expected only warning without strict, but was: %s", err)
+	}
+}
+
+func TestPushAttestProvenanceListsAttestationAsReferrer(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imgpkg-push-provenance")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yml"), []byte("config"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	push := PushOptions{
+		ui:               ui.NewNoopUI(),
+		ImageFlags:       ImageFlags{Image: registryHost(server) + "/repo/app:v1"},
+		FileFlags:        FileFlags{Files: []string{dir}},
+		AttestProvenance: true,
+	}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	pushedTag, err := regname.NewTag(push.ImageFlags.Image)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	pushedDesc, err := regremote.Get(pushedTag)
+	if err != nil {
+		t.Fatalf("Getting pushed image: %s", err)
+	}
+
+	referrersDesc, err := regremote.Get(pushedTag.Context().Tag("sha256-" + pushedDesc.Digest.Hex))
+	if err != nil {
+		t.Fatalf("Getting referrers index: %s", err)
+	}
+
+	var referrers struct {
+		Manifests []struct {
+			Digest       string
+			ArtifactType types.MediaType
+		}
+	}
+
+	err = json.Unmarshal(referrersDesc.Manifest, &referrers)
+	if err != nil {
+		t.Fatalf("Parsing referrers index: %s", err)
+	}
+
+	if len(referrers.Manifests) != 1 || referrers.Manifests[0].ArtifactType != ctlimg.ProvenanceMediaType {
+		t.Fatalf("Expected provenance to be listed as referrer, got: %s", referrersDesc.Manifest)
+	}
+
+	attestationImg, err := regremote.Image(pushedTag.Context().Digest(referrers.Manifests[0].Digest))
+	if err != nil {
+		t.Fatalf("Getting attestation: %s", err)
+	}
+
+	manifest, err := attestationImg.Manifest()
+	if err != nil {
+		t.Fatalf("Getting attestation manifest: %s", err)
+	}
+
+	layers, err := attestationImg.Layers()
+	if err != nil || len(layers) != 1 {
+		t.Fatalf("Expected attestation to have one layer: %v", err)
+	}
+
+	// Statement is stored as is, hence compressed form is its contents
+	contents, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("Getting statement: %s", err)
+	}
+	defer contents.Close()
+
+	var statement struct {
+		Subject []struct {
+			Name   string
+			Digest map[string]string
+		}
+		Predicate struct {
+			Builder   struct{ ID string }
+			Materials []struct{ URI string }
+		}
+	}
+
+	err = json.NewDecoder(contents).Decode(&statement)
+	if err != nil {
+		t.Fatalf("Parsing statement: %s", err)
+	}
+
+	if len(statement.Subject) != 1 || statement.Subject[0].Digest["sha256"] != pushedDesc.Digest.Hex {
+		t.Fatalf("Expected statement to refer to pushed image '%s', got: %#v", pushedDesc.Digest, statement.Subject)
+	}
+	if statement.Predicate.Builder.ID != "imgpkg@"+Version {
+		t.Fatalf("Expected builder to include imgpkg version, got '%s'", statement.Predicate.Builder.ID)
+	}
+	if len(statement.Predicate.Materials) != 1 || statement.Predicate.Materials[0].URI != dir {
+		t.Fatalf("Expected materials to list pushed dir, got: %#v", statement.Predicate.Materials)
+	}
+
+	// Attestation manifest also refers to pushed image via subject field
+	rawManifest, err := attestationImg.RawManifest()
+	if err != nil {
+		t.Fatalf("Getting attestation manifest: %s", err)
+	}
+
+	var subjectManifest struct {
+		Subject struct{ Digest string }
+	}
+
+	err = json.Unmarshal(rawManifest, &subjectManifest)
+	if err != nil {
+		t.Fatalf("Parsing attestation manifest: %s", err)
+	}
+
+	if subjectManifest.Subject.Digest != pushedDesc.Digest.String() || manifest.Config.MediaType != ctlimg.ProvenanceMediaType {
+		t.Fatalf("Expected attestation manifest to refer to '%s', got: %s", pushedDesc.Digest, rawManifest)
+	}
+}
+
+func TestPushRecordsHistoryOfAddedLayers(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	pushDir, err := ioutil.TempDir("", "imgpkg-push-history")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(pushDir)
+
+	existingFile := filepath.Join(pushDir, "config.yml")
+	newFile := filepath.Join(pushDir, "extra.yml")
+
+	err = ioutil.WriteFile(existingFile, []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	err = ioutil.WriteFile(newFile, []byte("extra: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imageRef}, FileFlags: FileFlags{Files: []string{existingFile}}}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	push = PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imageRef}, FileFlags: FileFlags{Files: []string{newFile}},
+		Append: true, HistoryRecordArgs: true, HistoryComment: "nightly build", historyCreatedBy: "imgpkg push --append=true"}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected append push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Failed to parse ref: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Failed to fetch image: %s", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Failed to get layers: %s", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("Failed to get config: %s", err)
+	}
+
+	if len(cfg.History) != len(layers) || len(layers) != 2 {
+		t.Fatalf("Expected history entry per layer (2), but found %d entries for %d layers", len(cfg.History), len(layers))
+	}
+
+	expectedHistory := []struct{ CreatedBy, Comment string }{
+		{"imgpkg", ""},
+		{"imgpkg push --append=true", "nightly build"},
+	}
+
+	for i, expected := range expectedHistory {
+		entry := cfg.History[i]
+		if entry.Author != "imgpkg" || entry.CreatedBy != expected.CreatedBy || entry.Comment != expected.Comment || entry.EmptyLayer {
+			t.Fatalf("Expected history entry %d to be created by '%s' with comment '%s', but was: %#v", i, expected.CreatedBy, expected.Comment, entry)
+		}
+	}
+}
+
+func TestPushCreatedByOmitsRegistryFlags(t *testing.T) {
+	cmd := NewPushCmd(NewPushOptions(ui.NewNoopUI()))
+
+	err := cmd.ParseFlags([]string{"-i", "repo/app", "-f", "config/", "-f", "extra.yml",
+		"--registry-password", "secret", "--history-comment", "build", "--os", "linux"})
+	if err != nil {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	createdBy := pushCreatedBy(cmd.Flags())
+
+	expected := "imgpkg push --file=config/ --file=extra.yml --image=repo/app --os=linux"
+	if createdBy != expected {
+		t.Fatalf("Expected created by '%s', but was '%s'", expected, createdBy)
+	}
+}
+
+func TestPushNoCompressLayersRoundTripsUncompressedLayer(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-push-no-compress")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(tmpDir)
+
+	pushDir := filepath.Join(tmpDir, "push")
+	outputDir := filepath.Join(tmpDir, "output")
+
+	err = os.Mkdir(pushDir, 0700)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(pushDir, "archive.tgz"), []byte("already compressed"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	imageRef := registryHost(server) + "/repo/app:latest"
+
+	push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imageRef},
+		FileFlags: FileFlags{Files: []string{pushDir}, NoCompressLayers: true}}
+
+	err = push.Run()
+	if err != nil {
+		t.Fatalf("Expected push to succeed: %s", err)
+	}
+
+	ref, err := regname.ParseReference(imageRef)
+	if err != nil {
+		t.Fatalf("Failed to parse ref: %s", err)
+	}
+
+	img, err := regremote.Image(ref)
+	if err != nil {
+		t.Fatalf("Failed to fetch image: %s", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("Failed to get manifest: %s", err)
+	}
+
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("Failed to get config: %s", err)
+	}
+
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != types.DockerUncompressedLayer {
+		t.Fatalf("Expected single uncompressed layer, but was: %#v", manifest.Layers)
+	}
+
+	if manifest.Layers[0].Digest != cfg.RootFS.DiffIDs[0] {
+		t.Fatalf("Expected uncompressed layer digest to match its diff ID, but was '%s' and '%s'", manifest.Layers[0].Digest, cfg.RootFS.DiffIDs[0])
+	}
+
+	pull := PullOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imageRef}, OutputPath: outputDir}
+
+	err = pull.Run()
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "archive.tgz"))
+	if err != nil || string(contents) != "already compressed" {
+		t.Fatalf("Expected pulled file to match pushed file: %v", err)
+	}
+}
+
+func TestPushLayerMediaTypeIsSetOnPushedLayers(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	pushDir, err := ioutil.TempDir("", "imgpkg-push-layer-media-type")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+	defer Cleanup(pushDir)
+
+	err = ioutil.WriteFile(filepath.Join(pushDir, "config.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to setup test: %s", err)
+	}
+
+	// Manifest and config media types follow layer media type
+	cases := []struct {
+		FileFlags                 FileFlags
+		ExpectedMediaType         types.MediaType
+		ExpectedManifestMediaType types.MediaType
+		ExpectedConfigMediaType   types.MediaType
+	}{
+		{FileFlags{LayerMediaType: "oci"}, types.OCILayer, types.OCIManifestSchema1, types.OCIConfigJSON},
+		{FileFlags{LayerMediaType: string(types.DockerLayer)}, types.DockerLayer, types.DockerManifestSchema2, types.DockerConfigJSON},
+		{FileFlags{LayerMediaType: "oci-uncompressed", NoCompressLayers: true}, types.OCIUncompressedLayer, types.OCIManifestSchema1, types.OCIConfigJSON},
+	}
+
+	for _, tc := range cases {
+		imageRef := registryHost(server) + "/repo/app:latest"
+
+		fileFlags := tc.FileFlags
+		fileFlags.Files = []string{pushDir}
+
+		push := PushOptions{ui: ui.NewNoopUI(), ImageFlags: ImageFlags{imageRef}, FileFlags: fileFlags}
+
+		err = push.Run()
+		if err != nil {
+			t.Fatalf("Expected push to succeed: %s", err)
+		}
+
+		ref, err := regname.ParseReference(imageRef)
+		if err != nil {
+			t.Fatalf("Failed to parse ref: %s", err)
+		}
+
+		img, err := regremote.Image(ref)
+		if err != nil {
+			t.Fatalf("Failed to fetch image: %s", err)
+		}
+
+		manifest, err := img.Manifest()
+		if err != nil {
+			t.Fatalf("Failed to get manifest: %s", err)
+		}
+
+		if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != tc.ExpectedMediaType {
+			t.Fatalf("Expected single layer with media type '%s', but was: %#v", tc.ExpectedMediaType, manifest.Layers)
+		}
+
+		mediaType, err := img.MediaType()
+		if err != nil {
+			t.Fatalf("Failed to get media type: %s", err)
+		}
+
+		if mediaType != tc.ExpectedManifestMediaType || manifest.Config.MediaType != tc.ExpectedConfigMediaType {
+			t.Fatalf("Expected manifest media type '%s' and config media type '%s', but was '%s' and '%s'",
+				tc.ExpectedManifestMediaType, tc.ExpectedConfigMediaType, mediaType, manifest.Config.MediaType)
+		}
+	}
+
+	invalidFlags := []struct {
+		FileFlags     FileFlags
+		ExpectedError string
+	}{
+		{FileFlags{LayerMediaType: "zstd"}, "Expected --layer-media-type to be one of docker, oci, docker-uncompressed, oci-uncompressed"},
+		{FileFlags{LayerMediaType: "docker-uncompressed"}, "Expected --layer-media-type 'docker-uncompressed' to match layer compression"},
+		{FileFlags{LayerMediaType: "oci", NoCompressLayers: true}, "Expected --layer-media-type 'oci' to match layer compression"},
+	}
+
+	for _, tc := range invalidFlags {
+		_, err := tc.FileFlags.AsTarImageOpts()
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+			t.Fatalf("Expected error to contain '%s', but was: %v", tc.ExpectedError, err)
+		}
+	}
+}
+
+func TestPushMtimeFlag(t *testing.T) {
+	opts, err := (&FileFlags{Mtime: "2020-01-01T10:00:00+02:00"}).AsTarImageOpts()
+	if err != nil {
+		t.Fatalf("Expected valid mtime to be accepted: %s", err)
+	}
+	if !opts.Mtime.Equal(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected mtime to be parsed, but was %s", opts.Mtime)
+	}
+
+	invalidFlags := []struct {
+		FileFlags     FileFlags
+		ExpectedError string
+	}{
+		{FileFlags{Mtime: "2020-01-01"}, "Expected --mtime to be in RFC3339 format"},
+		{FileFlags{Mtime: "2020-01-01T00:00:00Z", PreserveMtime: true}, "Expected --mtime to not be combined with --preserve-mtime"},
+	}
+
+	for _, tc := range invalidFlags {
+		_, err := tc.FileFlags.AsTarImageOpts()
+		if err == nil || !strings.Contains(err.Error(), tc.ExpectedError) {
+			t.Fatalf("Expected error to contain '%s', but was: %v", tc.ExpectedError, err)
+		}
+	}
+}
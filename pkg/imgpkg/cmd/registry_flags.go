@@ -4,7 +4,9 @@
 package cmd
 
 import (
+	"net/http"
 	"os"
+	"time"
 
 	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
 	"github.com/spf13/cobra"
@@ -19,6 +21,27 @@ type RegistryFlags struct {
 	Password string
 	Token    string
 	Anon     bool
+
+	AnonFallback bool
+	Keychain     string
+	UserAgent    string
+
+	DockerConfigPath string
+
+	RetryStatusCodes []int
+
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+
+	Scopes []string
+
+	MaxBandwidth int64
+
+	Offline bool
+
+	// Transport is not exposed as a flag; it is set
+	// when embedding imgpkg (see RegistryOpts.Transport)
+	Transport http.RoundTripper
 }
 
 func (s *RegistryFlags) Set(cmd *cobra.Command) {
@@ -30,6 +53,16 @@ func (s *RegistryFlags) Set(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&s.Password, "registry-password", "", "Set password for auth ($IMGPKG_PASSWORD)")
 	cmd.Flags().StringVar(&s.Token, "registry-token", "", "Set token for auth ($IMGPKG_TOKEN)")
 	cmd.Flags().BoolVar(&s.Anon, "registry-anon", false, "Set anonymous auth ($IMGPKG_ANON)")
+	cmd.Flags().BoolVar(&s.AnonFallback, "registry-anon-fallback", false, "Retry read operations anonymously when credentials are rejected (e.g. public images)")
+	cmd.Flags().StringVar(&s.Keychain, "registry-keychain", "", "Set cloud provider keychain used for auth (ecr, gcr, acr) ($IMGPKG_REGISTRY_KEYCHAIN)")
+	cmd.Flags().StringVar(&s.DockerConfigPath, "registry-docker-config", "", "Set docker config file used for auth, including credential helpers (format: /tmp/config.json) ($IMGPKG_REGISTRY_DOCKER_CONFIG)")
+	cmd.Flags().StringVar(&s.UserAgent, "registry-user-agent", defaultUserAgent(), "Set User-Agent header sent to registries")
+	cmd.Flags().IntSliceVar(&s.RetryStatusCodes, "registry-retry-status-codes", []int{429, 503}, "Set response status codes for which requests are retried honoring Retry-After header (can be specified multiple times)")
+	cmd.Flags().IntVar(&s.MaxIdleConns, "registry-max-idle-conns", 100, "Set maximum number of idle (keep-alive) connections kept open to registries")
+	cmd.Flags().DurationVar(&s.IdleConnTimeout, "registry-idle-timeout", 90*time.Second, "Set duration after which idle connections to registries are closed")
+	cmd.Flags().StringSliceVar(&s.Scopes, "registry-scope", nil, "Request additional scope with registry tokens (format: repository:<repo>:pull,push) (can be specified multiple times)")
+	cmd.Flags().BoolVar(&s.Offline, "offline", false, "Fail immediately instead of accessing network, e.g. to make sure CI jobs do not reach registries ($IMGPKG_OFFLINE)")
+	cmd.Flags().Int64Var(&s.MaxBandwidth, "max-bandwidth", 0, "Limit combined download and upload rate in bytes per second (0 means no limit)")
 }
 
 func (s *RegistryFlags) AsRegistryOpts() ctlimg.RegistryOpts {
@@ -42,6 +75,25 @@ func (s *RegistryFlags) AsRegistryOpts() ctlimg.RegistryOpts {
 		Password: s.Password,
 		Token:    s.Token,
 		Anon:     s.Anon,
+
+		AnonFallback: s.AnonFallback,
+		Keychain:     s.Keychain,
+		UserAgent:    s.UserAgent,
+
+		DockerConfigPath: s.DockerConfigPath,
+
+		RetryStatusCodes: s.RetryStatusCodes,
+
+		MaxIdleConns:    s.MaxIdleConns,
+		IdleConnTimeout: s.IdleConnTimeout,
+
+		ExtraScopes: s.Scopes,
+
+		MaxBandwidth: s.MaxBandwidth,
+
+		Transport: s.Transport,
+
+		Offline: s.Offline,
 	}
 
 	if len(opts.Username) == 0 {
@@ -53,9 +105,25 @@ func (s *RegistryFlags) AsRegistryOpts() ctlimg.RegistryOpts {
 	if len(opts.Token) == 0 {
 		opts.Token = os.Getenv("IMGPKG_TOKEN")
 	}
+	if len(opts.UserAgent) == 0 {
+		opts.UserAgent = defaultUserAgent()
+	}
+	if len(opts.Keychain) == 0 {
+		opts.Keychain = os.Getenv("IMGPKG_REGISTRY_KEYCHAIN")
+	}
+	if len(opts.DockerConfigPath) == 0 {
+		opts.DockerConfigPath = os.Getenv("IMGPKG_REGISTRY_DOCKER_CONFIG")
+	}
 	if os.Getenv("IMGPKG_ANON") == "true" {
 		opts.Anon = true
 	}
+	if os.Getenv("IMGPKG_OFFLINE") == "true" {
+		opts.Offline = true
+	}
 
 	return opts
 }
+
+func defaultUserAgent() string {
+	return "imgpkg/" + Version
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestRegistryFlagsConnectionPooling(t *testing.T) {
+	flags := RegistryFlags{}
+	cmd := &cobra.Command{}
+	flags.Set(cmd)
+
+	opts := flags.AsRegistryOpts()
+	if opts.MaxIdleConns != 100 || opts.IdleConnTimeout != 90*time.Second {
+		t.Fatalf("Expected default pooling, got %d idle connections and %s timeout", opts.MaxIdleConns, opts.IdleConnTimeout)
+	}
+
+	err := cmd.Flags().Parse([]string{"--registry-max-idle-conns", "250", "--registry-idle-timeout", "2m"})
+	if err != nil {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	opts = flags.AsRegistryOpts()
+	if opts.MaxIdleConns != 250 || opts.IdleConnTimeout != 2*time.Minute {
+		t.Fatalf("Expected pooling from flags, got %d idle connections and %s timeout", opts.MaxIdleConns, opts.IdleConnTimeout)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	repoTemplateRepoVar = "{repo}"
+	repoTemplateNameVar = "{name}"
+)
+
+var repoTemplateVarRegexp = regexp.MustCompile(`\{[^}]*\}`)
+
+// RepoTemplate computes destination repository per image by replacing
+// {repo} with source repository path (without registry) and
+// {name} with image name (e.g. from ImagesLock)
+type RepoTemplate struct {
+	template string
+	names    *UnprocessedImageURLs
+}
+
+func NewRepoTemplate(template string) (*RepoTemplate, error) {
+	vars := repoTemplateVarRegexp.FindAllString(template, -1)
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("Expected repository template '%s' to contain %s or %s", template, repoTemplateRepoVar, repoTemplateNameVar)
+	}
+
+	for _, v := range vars {
+		if v != repoTemplateRepoVar && v != repoTemplateNameVar {
+			return nil, fmt.Errorf("Expected repository template '%s' to only contain %s or %s, but found %s",
+				template, repoTemplateRepoVar, repoTemplateNameVar, v)
+		}
+	}
+
+	return &RepoTemplate{template: template}, nil
+}
+
+// Repository returns destination repository of given source image
+func (t *RepoTemplate) Repository(ref regname.Reference) (regname.Repository, error) {
+	var name string
+	if t.names != nil {
+		name = t.names.Name(ref.Name())
+	}
+
+	if name == "" && strings.Contains(t.template, repoTemplateNameVar) {
+		return regname.Repository{}, fmt.Errorf("Expected image '%s' to have name (e.g. in ImagesLock) to be used in repository template '%s'",
+			ref.Name(), t.template)
+	}
+
+	repo := strings.NewReplacer(repoTemplateRepoVar, ref.Context().RepositoryStr(), repoTemplateNameVar, name).Replace(t.template)
+
+	importRepo, err := regname.NewRepository(repo)
+	if err != nil {
+		return regname.Repository{}, fmt.Errorf("Building repository from template '%s' for image '%s': %s", t.template, ref.Name(), err)
+	}
+
+	return importRepo, nil
+}
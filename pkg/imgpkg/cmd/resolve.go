@@ -0,0 +1,130 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type ResolveOptions struct {
+	ui ui.UI
+
+	BundleFlags     BundleFlags
+	RegistryFlags   RegistryFlags
+	LockOutputFlags LockOutputFlags
+}
+
+func NewResolveOptions(ui ui.UI) *ResolveOptions {
+	return &ResolveOptions{ui: ui}
+}
+
+func NewResolveCmd(o *ResolveOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resolve",
+		Short: "Write BundleLock pinning bundle tag to its digest without pulling contents",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+		Example: `
+  # Pin current digest of dkalinin/app1-bundle:v1.0.0 in bundle.lock.yml
+  imgpkg resolve -b dkalinin/app1-bundle:v1.0.0 --lock-output bundle.lock.yml`,
+	}
+	cmd.Flags().StringVarP(&o.BundleFlags.Bundle, "bundle", "b", "", "Set bundle tag (example: docker.io/dkalinin/test-content:v1.0.0)")
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().StringVar(&o.LockOutputFlags.LockFilePath, "lock-output", "", "Output BundleLock file path (replaced atomically)")
+	cmd.MarkFlagRequired("lock-output")
+	return cmd
+}
+
+func (o *ResolveOptions) Run() error {
+	if o.BundleFlags.Bundle == "" {
+		return fmt.Errorf("Expected bundle flag")
+	}
+
+	if o.LockOutputFlags.LockFilePath == "" {
+		return fmt.Errorf("Expected lock output flag")
+	}
+
+	tag, err := regname.NewTag(o.BundleFlags.Bundle, regname.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("Expected bundle '%s' to be a tag: %s", o.BundleFlags.Bundle, err)
+	}
+
+	registry, err := ctlimg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	if err != nil {
+		return fmt.Errorf("Unable to create a registry with the options %v: %v", o.RegistryFlags.AsRegistryOpts(), err)
+	}
+
+	img, err := registry.Image(tag)
+	if err != nil {
+		return fmt.Errorf("Fetching '%s': %s", tag.Name(), err)
+	}
+
+	bundle, err := isBundle(img)
+	if err != nil {
+		return err
+	}
+
+	if !bundle {
+		return fmt.Errorf("Expected '%s' to be a bundle", tag.Name())
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+
+	digestRef := fmt.Sprintf("%s@%s", tag.Context(), digest)
+
+	bundleLock := BundleLock{
+		ApiVersion: BundleLockAPIVersion,
+		Kind:       BundleLockKind,
+		Spec:       BundleSpec{Image: ImageLocation{DigestRef: digestRef, OriginalTag: tag.TagStr()}},
+	}
+
+	bundleLockBytes, err := yaml.Marshal(bundleLock)
+	if err != nil {
+		return fmt.Errorf("Marshalling bundle lock file: %s", err)
+	}
+
+	err = writeFileAtomically(o.LockOutputFlags.LockFilePath, append([]byte("---\n"), bundleLockBytes...))
+	if err != nil {
+		return fmt.Errorf("Writing bundle lock file: %s", err)
+	}
+
+	o.ui.BeginLinef("Resolved '%s' to '%s'\n", tag.Name(), digestRef)
+
+	return nil
+}
+
+// writeFileAtomically writes contents into temporary file next to path
+// and renames it, so that readers never observe partially written file
+func writeFileAtomically(path string, contents []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(contents)
+	if err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestResolveWritesBundleLockWithResolvedDigest(t *testing.T) {
+	server := newTestRegistryServer()
+	defer server.Close()
+
+	bundleRef := writeBundle(t, server, "repo/bundle", emptyImagesYaml)
+
+	tag, err := regname.NewTag(bundleRef)
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	desc, err := regremote.Get(tag)
+	if err != nil {
+		t.Fatalf("Fetching bundle: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-resolve")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	lockPath := filepath.Join(outputDir, "bundle.lock.yml")
+
+	// Existing lock is replaced
+	err = ioutil.WriteFile(lockPath, []byte("stale"), 0600)
+	if err != nil {
+		t.Fatalf("Writing stale lock: %s", err)
+	}
+
+	resolve := ResolveOptions{ui: ui.NewNoopUI(), BundleFlags: BundleFlags{Bundle: bundleRef},
+		LockOutputFlags: LockOutputFlags{LockFilePath: lockPath}}
+
+	err = resolve.Run()
+	if err != nil {
+		t.Fatalf("Expected resolve to succeed: %s", err)
+	}
+
+	bundleLock, err := ReadBundleLockFile(lockPath)
+	if err != nil {
+		t.Fatalf("Expected output to be parseable BundleLock: %s", err)
+	}
+
+	expectedDigestRef := tag.Context().Name() + "@" + desc.Digest.String()
+	if bundleLock.Spec.Image.DigestRef != expectedDigestRef {
+		t.Fatalf("Expected digest ref '%s', but was '%s'", expectedDigestRef, bundleLock.Spec.Image.DigestRef)
+	}
+
+	if bundleLock.Spec.Image.OriginalTag != "latest" {
+		t.Fatalf("Expected original tag 'latest', but was '%s'", bundleLock.Spec.Image.OriginalTag)
+	}
+
+	files, err := ioutil.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("Reading output dir: %s", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("Expected only lock file in output dir, but found %d files", len(files))
+	}
+
+	// Digest refs are not resolved again
+	resolve.BundleFlags.Bundle = expectedDigestRef
+
+	err = resolve.Run()
+	if err == nil || !strings.Contains(err.Error(), "to be a tag") {
+		t.Fatalf("Expected resolving digest ref to fail, but was: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+)
+
+const semverTagFilterPrefix = "semver:"
+
+// TagFilter matches tags either via regular expression
+// or, when prefixed with 'semver:', via semantic version range
+// (tags that are not semantic versions never match range)
+type TagFilter struct {
+	regexp      *regexp.Regexp
+	semverRange semver.Range
+}
+
+func NewTagFilter(filter string) (TagFilter, error) {
+	if strings.HasPrefix(filter, semverTagFilterPrefix) {
+		semverRange, err := semver.ParseRange(strings.TrimPrefix(filter, semverTagFilterPrefix))
+		if err != nil {
+			return TagFilter{}, fmt.Errorf("Parsing semver tag filter: %s", err)
+		}
+		return TagFilter{semverRange: semverRange}, nil
+	}
+
+	re, err := regexp.Compile(filter)
+	if err != nil {
+		return TagFilter{}, fmt.Errorf("Parsing regex tag filter: %s", err)
+	}
+
+	return TagFilter{regexp: re}, nil
+}
+
+func (f TagFilter) Matches(tag string) bool {
+	if f.semverRange != nil {
+		ver, err := semver.ParseTolerant(tag)
+		if err != nil {
+			return false
+		}
+		return f.semverRange(ver)
+	}
+
+	return f.regexp.MatchString(tag)
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestTagFilterMatches(t *testing.T) {
+	tags := []string{"0.9.0", "1.0.0", "v1.2.3", "1.3.0-rc.1", "2.0.0", "latest"}
+
+	cases := []struct {
+		filter   string
+		expected []string
+	}{
+		{`^v?1\.`, []string{"1.0.0", "v1.2.3", "1.3.0-rc.1"}},
+		{"latest", []string{"latest"}},
+		{"semver:>=1.0.0", []string{"1.0.0", "v1.2.3", "1.3.0-rc.1", "2.0.0"}},
+		{"semver:>=1.0.0 <2.0.0", []string{"1.0.0", "v1.2.3", "1.3.0-rc.1"}},
+	}
+
+	for _, c := range cases {
+		filter, err := NewTagFilter(c.filter)
+		if err != nil {
+			t.Fatalf("Parsing filter '%s': %s", c.filter, err)
+		}
+
+		var matched []string
+		for _, tag := range tags {
+			if filter.Matches(tag) {
+				matched = append(matched, tag)
+			}
+		}
+
+		if len(matched) != len(c.expected) {
+			t.Fatalf("Expected filter '%s' to match %v, got %v", c.filter, c.expected, matched)
+		}
+		for i := range matched {
+			if matched[i] != c.expected[i] {
+				t.Fatalf("Expected filter '%s' to match %v, got %v", c.filter, c.expected, matched)
+			}
+		}
+	}
+}
+
+func TestTagFilterInvalid(t *testing.T) {
+	for _, filter := range []string{"semver:>=abc", "(unclosed"} {
+		_, err := NewTagFilter(filter)
+		if err == nil {
+			t.Fatalf("Expected filter '%s' to be invalid", filter)
+		}
+	}
+}
@@ -70,6 +70,12 @@ func (o *TarImageSet) Import(path string,
 			bundleRef = (*imgOrIndex.Image).Ref()
 		}
 	}
+
+	// Images referenced by bundle are expected to be collocated with bundle
+	if bundleRef != "" && o.imageSet.repoTemplate != nil {
+		return nil, "", fmt.Errorf("Expected --to-repo-template to not be used with bundles")
+	}
+
 	processedImages, err := o.imageSet.Import(imgOrIndexes, importRepo, registry)
 	return processedImages, bundleRef, err
 }
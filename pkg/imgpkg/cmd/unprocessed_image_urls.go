@@ -5,6 +5,8 @@ package cmd
 
 import (
 	"sort"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
 )
 
 type UnprocessedImageURL struct {
@@ -14,10 +16,33 @@ type UnprocessedImageURL struct {
 
 type UnprocessedImageURLs struct {
 	urls map[UnprocessedImageURL]struct{}
+
+	// names and annotations keyed by normalized URL
+	// (e.g. of images in ImagesLock)
+	names       map[string]string
+	annotations map[string]map[string]string
 }
 
 func NewUnprocessedImageURLs() *UnprocessedImageURLs {
-	return &UnprocessedImageURLs{map[UnprocessedImageURL]struct{}{}}
+	return &UnprocessedImageURLs{map[UnprocessedImageURL]struct{}{}, map[string]string{}, map[string]map[string]string{}}
+}
+
+// SetName records name of image with given URL
+func (i *UnprocessedImageURLs) SetName(url, name string) {
+	i.names[normalizedImageURL(url)] = name
+}
+
+func (i *UnprocessedImageURLs) Name(url string) string {
+	return i.names[normalizedImageURL(url)]
+}
+
+// SetAnnotations records annotations of image with given URL
+func (i *UnprocessedImageURLs) SetAnnotations(url string, annotations map[string]string) {
+	i.annotations[normalizedImageURL(url)] = annotations
+}
+
+func (i *UnprocessedImageURLs) Annotations(url string) map[string]string {
+	return i.annotations[normalizedImageURL(url)]
 }
 
 func (i *UnprocessedImageURLs) Add(url UnprocessedImageURL) {
@@ -34,3 +59,11 @@ func (i *UnprocessedImageURLs) All() []UnprocessedImageURL {
 	})
 	return result
 }
+
+func normalizedImageURL(url string) string {
+	ref, err := regname.ParseReference(url)
+	if err != nil {
+		return url
+	}
+	return ref.Name()
+}
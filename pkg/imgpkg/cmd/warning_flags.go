@@ -0,0 +1,16 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type WarningFlags struct {
+	Strict bool
+}
+
+func (f *WarningFlags) Set(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&f.Strict, "strict", false, "Treat warnings (e.g. multiple images found, lock file update skipped, referenced images missing) as errors")
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+)
+
+// WarningsUI prints warnings as they occur, or collects them when output
+// is JSON so that automation finds them in 'warnings' table
+// instead of mixed with other lines. With strict enabled (--strict)
+// warnings are returned as errors instead
+type WarningsUI struct {
+	ui.UI
+
+	json     bool
+	strict   bool
+	warnings []string
+	lock     sync.Mutex
+}
+
+var _ ui.UI = &WarningsUI{}
+
+func NewWarningsUI(parent ui.UI) *WarningsUI {
+	return &WarningsUI{UI: parent}
+}
+
+func (u *WarningsUI) EnableJSON()   { u.json = true }
+func (u *WarningsUI) EnableStrict() { u.strict = true }
+
+// withWarnings returns replacement UI (e.g. printing to stderr or nothing)
+// that keeps handling warnings the way current UI does (--json, --strict)
+func withWarnings(current ui.UI, replacement ui.UI) ui.UI {
+	if warningsUI, ok := current.(*WarningsUI); ok {
+		return &WarningsUI{UI: replacement, json: warningsUI.json, strict: warningsUI.strict}
+	}
+	return replacement
+}
+
+func (u *WarningsUI) Warnf(pattern string, args ...interface{}) error {
+	if u.strict {
+		return fmt.Errorf("%s (warnings are treated as errors with --strict)", fmt.Sprintf(pattern, args...))
+	}
+
+	if !u.json {
+		u.UI.BeginLinef(pattern+"\n", args...)
+		return nil
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.warnings = append(u.warnings, fmt.Sprintf(pattern, args...))
+	return nil
+}
+
+// PrintWarnings prints collected warnings as a table (included in JSON output)
+func (u *WarningsUI) PrintWarnings() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if len(u.warnings) == 0 {
+		return
+	}
+
+	table := uitable.Table{
+		Title:   "Warnings",
+		Content: "warnings",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Warning"),
+		},
+	}
+
+	for _, warning := range u.warnings {
+		table.Rows = append(table.Rows, []uitable.Value{uitable.NewValueString(warning)})
+	}
+
+	u.UI.PrintTable(table)
+	u.warnings = nil
+}
+
+// warnf routes warning to WarningsUI when available, so that it's
+// collected for JSON output or returned as an error with --strict
+func warnf(u ui.UI, pattern string, args ...interface{}) error {
+	if warningsUI, ok := u.(*WarningsUI); ok {
+		return warningsUI.Warnf(pattern, args...)
+	}
+	u.BeginLinef(pattern+"\n", args...)
+	return nil
+}
+
+// warnfFunc returns warnf bound to given UI (e.g. for DirImageOpts.Warnf)
+func warnfFunc(u ui.UI) func(string, ...interface{}) error {
+	return func(pattern string, args ...interface{}) error {
+		return warnf(u, pattern, args...)
+	}
+}
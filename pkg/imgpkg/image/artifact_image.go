@@ -0,0 +1,158 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	ArtifactTitleAnnotation = "org.opencontainers.image.title"
+
+	// Files are stored as is (not as tar), hence generic binary media type
+	// so that they are not mistaken for filesystem layers
+	artifactFileMediaType types.MediaType = "application/octet-stream"
+)
+
+type ArtifactFile struct {
+	Title string
+	Path  string
+}
+
+// NewArtifactImage stores each file as a separate layer
+// annotated with its title (org.opencontainers.image.title);
+// resulting image is backed by original files, hence nothing to remove
+func NewArtifactImage(files []ArtifactFile) (*FileImage, error) {
+	var addenda []mutate.Addendum
+
+	for _, file := range files {
+		_, err := cleanArtifactTitle(file.Title)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("Expected artifact file '%s' to be a regular file", file.Path)
+		}
+
+		digest, err := DefaultDigestAlgorithm.DigestPath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		addenda = append(addenda, mutate.Addendum{
+			Layer: &RawFileLayer{
+				digest:    digest,
+				size:      info.Size(),
+				mediaType: artifactFileMediaType,
+				path:      file.Path,
+			},
+			Annotations: map[string]string{ArtifactTitleAnnotation: file.Title},
+			History:     LayerHistory("", ""),
+		})
+	}
+
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), addenda...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileImage{img, ""}, nil
+}
+
+// ArtifactDir writes each titled layer of an image as a file named by its title
+type ArtifactDir struct {
+	dirPath string
+	img     regv1.Image
+	logger  Logger
+}
+
+func NewArtifactDir(dirPath string, img regv1.Image, logger Logger) *ArtifactDir {
+	return &ArtifactDir{dirPath, img, logger}
+}
+
+func (d *ArtifactDir) Write() error {
+	manifest, err := d.img.Manifest()
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range manifest.Layers {
+		title, err := cleanArtifactTitle(desc.Annotations[ArtifactTitleAnnotation])
+		if err != nil {
+			return fmt.Errorf("Layer '%s': %s", desc.Digest, err)
+		}
+
+		d.logger.BeginLinef("Writing layer '%s' to '%s'\n", desc.Digest, title)
+
+		layer, err := d.img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+
+		err = d.writeFile(filepath.Join(d.dirPath, title), layer)
+		if err != nil {
+			return fmt.Errorf("Writing layer '%s': %s", desc.Digest, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *ArtifactDir) writeFile(path string, layer regv1.Layer) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Artifact layers are stored as is, hence compressed form is file contents
+	contents, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+
+	defer contents.Close()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, contents)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func cleanArtifactTitle(title string) (string, error) {
+	if len(title) == 0 {
+		return "", fmt.Errorf("Expected artifact title (%s annotation) to be non-empty", ArtifactTitleAnnotation)
+	}
+
+	cleanTitle := filepath.Clean(filepath.FromSlash(title))
+
+	if filepath.IsAbs(cleanTitle) || cleanTitle == "." || cleanTitle == ".." ||
+		strings.HasPrefix(cleanTitle, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Expected artifact title '%s' to be a relative path within output directory", title)
+	}
+
+	return cleanTitle, nil
+}
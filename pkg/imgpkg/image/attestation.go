@@ -0,0 +1,251 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	inTotoStatementTypeV01 = "https://in-toto.io/Statement/v0.1"
+	inTotoStatementTypeV1  = "https://in-toto.io/Statement/v1"
+)
+
+// InTotoStatement is an in-toto statement with arbitrary predicate
+type InTotoStatement struct {
+	Type          string                 `json:"_type"`
+	PredicateType string                 `json:"predicateType"`
+	Subject       []InTotoSubject        `json:"subject"`
+	Predicate     map[string]interface{} `json:"predicate"`
+}
+
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Attestation is an in-toto statement listed as referrer of an image
+// or pushed by cosign with 'sha256-<hex>.att' tag
+type Attestation struct {
+	Ref       regname.Digest
+	Statement InTotoStatement
+	// Envelope is set when statement is signed (e.g. by cosign);
+	// imgpkg provenance (--attest-provenance) is not signed
+	Envelope *DSSEEnvelope
+}
+
+// CheckType makes sure that statement is an in-toto statement
+// (other JSON documents may be listed as attestations as well)
+func (s InTotoStatement) CheckType() error {
+	if s.Type != inTotoStatementTypeV01 && s.Type != inTotoStatementTypeV1 {
+		return fmt.Errorf("Expected statement type to be '%s' or '%s', but was '%s'",
+			inTotoStatementTypeV01, inTotoStatementTypeV1, s.Type)
+	}
+	return nil
+}
+
+// HasSubject checks if statement is about image with given digest
+func (s InTotoStatement) HasSubject(digest regv1.Hash) bool {
+	for _, subject := range s.Subject {
+		if subject.Digest[digest.Algorithm] == digest.Hex {
+			return true
+		}
+	}
+	return false
+}
+
+// Attestations returns in-toto attestations listed in referrers tag of subject
+// (e.g. pushed with --attest-provenance) and attestations pushed by cosign
+// ('sha256-<hex>.att' tag); signatures of attestations are not verified here
+func (i Registry) Attestations(subject regname.Digest) ([]Attestation, error) {
+	attestations, err := i.referrerAttestations(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	cosignAttestations, err := i.cosignAttestations(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(attestations, cosignAttestations...), nil
+}
+
+func (i Registry) referrerAttestations(subject regname.Digest) ([]Attestation, error) {
+	tag, err := ReferrersTag(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := i.Index(tag)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Fetching referrers index '%s': %s", tag.Name(), err)
+	}
+
+	rawManifest, err := idx.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var index referrersIndexManifest
+
+	err = json.Unmarshal(rawManifest, &index)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing referrers index '%s': %s", tag.Name(), err)
+	}
+
+	var attestations []Attestation
+
+	for _, referrer := range index.Manifests {
+		if referrer.ArtifactType != ProvenanceMediaType {
+			continue
+		}
+
+		ref := subject.Context().Digest(referrer.Digest.String())
+
+		statement, err := i.attestationStatement(ref)
+		if err != nil {
+			return nil, fmt.Errorf("Reading attestation '%s': %s", ref.Name(), err)
+		}
+
+		attestations = append(attestations, Attestation{Ref: ref, Statement: statement})
+	}
+
+	return attestations, nil
+}
+
+// cosignAttestations returns statements of DSSE envelopes stored
+// as layers of image tagged 'sha256-<hex>.att' (cosign attest)
+func (i Registry) cosignAttestations(subject regname.Digest) ([]Attestation, error) {
+	digest, err := regv1.NewHash(subject.DigestStr())
+	if err != nil {
+		return nil, err
+	}
+
+	tag := subject.Context().Tag(digest.Algorithm + "-" + digest.Hex + ".att")
+
+	img, err := i.Image(tag)
+	if err != nil {
+		if isNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Fetching attestations '%s': %s", tag.Name(), err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	ref := subject.Context().Digest(imgDigest.String())
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations []Attestation
+
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if mediaType != DSSEEnvelopeMediaType {
+			continue
+		}
+
+		bs, err := readLayer(layer)
+		if err != nil {
+			return nil, fmt.Errorf("Reading attestation '%s': %s", ref.Name(), err)
+		}
+
+		var envelope DSSEEnvelope
+
+		err = json.Unmarshal(bs, &envelope)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing DSSE envelope of attestation '%s': %s", ref.Name(), err)
+		}
+
+		if envelope.PayloadType != inTotoPayloadType {
+			continue
+		}
+
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("Decoding DSSE payload of attestation '%s': %s", ref.Name(), err)
+		}
+
+		var statement InTotoStatement
+
+		err = json.Unmarshal(payload, &statement)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing in-toto statement of attestation '%s': %s", ref.Name(), err)
+		}
+
+		attestations = append(attestations, Attestation{Ref: ref, Statement: statement, Envelope: &envelope})
+	}
+
+	return attestations, nil
+}
+
+func (i Registry) attestationStatement(ref regname.Digest) (InTotoStatement, error) {
+	img, err := i.Image(ref)
+	if err != nil {
+		return InTotoStatement{}, err
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return InTotoStatement{}, err
+	}
+
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return InTotoStatement{}, err
+		}
+		if mediaType != ProvenanceMediaType {
+			continue
+		}
+
+		bs, err := readLayer(layer)
+		if err != nil {
+			return InTotoStatement{}, err
+		}
+
+		var statement InTotoStatement
+
+		err = json.Unmarshal(bs, &statement)
+		if err != nil {
+			return InTotoStatement{}, fmt.Errorf("Parsing in-toto statement: %s", err)
+		}
+
+		return statement, nil
+	}
+
+	return InTotoStatement{}, fmt.Errorf("Expected attestation to have layer with media type '%s'", ProvenanceMediaType)
+}
+
+// readLayer returns contents of layer stored as is (not compressed),
+// e.g. in-toto statement or DSSE envelope
+func readLayer(layer regv1.Layer) ([]byte, error) {
+	contents, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	defer contents.Close()
+
+	return ioutil.ReadAll(contents)
+}
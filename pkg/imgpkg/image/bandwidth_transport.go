@@ -0,0 +1,92 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reads are split into chunks so that waits are spread evenly
+const bandwidthMaxChunkSize = 32 * 1024
+
+// bandwidthTransport limits combined rate at which request bodies (uploads)
+// and response bodies (downloads) are transferred
+type bandwidthTransport struct {
+	http.RoundTripper
+	limiter *bandwidthLimiter
+}
+
+func newBandwidthTransport(tran http.RoundTripper, bytesPerSec int64) bandwidthTransport {
+	return bandwidthTransport{tran, &bandwidthLimiter{bytesPerSec: bytesPerSec}}
+}
+
+func (t bandwidthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = bandwidthReadCloser{req.Body, t.limiter}
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = bandwidthReadCloser{resp.Body, t.limiter}
+
+	return resp, nil
+}
+
+type bandwidthReadCloser struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+}
+
+func (r bandwidthReadCloser) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.chunkSize() {
+		p = p[:r.limiter.chunkSize()]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.limiter.Wait(n)
+
+	return n, err
+}
+
+// bandwidthLimiter schedules transfers one after another
+// so that each one takes time proportional to its size
+type bandwidthLimiter struct {
+	bytesPerSec int64
+
+	lock sync.Mutex
+	next time.Time
+}
+
+func (l *bandwidthLimiter) chunkSize() int {
+	if l.bytesPerSec < bandwidthMaxChunkSize {
+		return int(l.bytesPerSec)
+	}
+	return bandwidthMaxChunkSize
+}
+
+func (l *bandwidthLimiter) Wait(n int) {
+	if n <= 0 {
+		return
+	}
+
+	l.lock.Lock()
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSec))
+	delay := l.next.Sub(now)
+
+	l.lock.Unlock()
+
+	time.Sleep(delay)
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBandwidthTransportKeepsThroughputUnderCap(t *testing.T) {
+	const size = 64 * 1024
+	const maxBandwidth = 256 * 1024
+
+	var uploaded int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			uploaded, _ = io.Copy(ioutil.Discard, r.Body)
+			return
+		}
+		w.Write(bytes.Repeat([]byte("x"), size))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newBandwidthTransport(http.DefaultTransport, maxBandwidth)}
+
+	assertThroughput := func(desc string, transferred int64, elapsed time.Duration) {
+		if transferred != size {
+			t.Fatalf("Expected %s of %d bytes, but was %d", desc, size, transferred)
+		}
+
+		throughput := float64(transferred) / elapsed.Seconds()
+		if throughput > maxBandwidth {
+			t.Fatalf("Expected %s throughput to stay under %d bytes/sec, but was %.0f", desc, maxBandwidth, throughput)
+		}
+	}
+
+	start := time.Now()
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Downloading: %s", err)
+	}
+
+	downloaded, err := io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Reading download: %s", err)
+	}
+
+	assertThroughput("download", downloaded, time.Since(start))
+
+	start = time.Now()
+
+	resp, err = client.Post(server.URL, "application/octet-stream", bytes.NewReader(bytes.Repeat([]byte("x"), size)))
+	if err != nil {
+		t.Fatalf("Uploading: %s", err)
+	}
+	resp.Body.Close()
+
+	assertThroughput("upload", uploaded, time.Since(start))
+}
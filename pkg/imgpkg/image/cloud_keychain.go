@@ -0,0 +1,82 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+)
+
+var cloudKeychains = map[string]func() regauthn.Keychain{
+	"gcr": func() regauthn.Keychain { return google.Keychain },
+	"ecr": func() regauthn.Keychain {
+		return credHelperKeychain{"ecr-login", regexp.MustCompile(`^\d+\.dkr\.ecr(-fips)?\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)}
+	},
+	"acr": func() regauthn.Keychain {
+		return credHelperKeychain{"acr-env", regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(io|cn|de|us)$`)}
+	},
+}
+
+func cloudKeychain(name string) (regauthn.Keychain, error) {
+	keychainFunc, found := cloudKeychains[name]
+	if !found {
+		var names []string
+		for name := range cloudKeychains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown registry keychain '%s' (supported: %s)", name, strings.Join(names, ", "))
+	}
+	return keychainFunc(), nil
+}
+
+// credHelperKeychain uses docker credential helper binary
+// (e.g. docker-credential-ecr-login) to retrieve short lived credentials
+type credHelperKeychain struct {
+	helper     string
+	registries *regexp.Regexp
+}
+
+func (k credHelperKeychain) Resolve(res regauthn.Resource) (regauthn.Authenticator, error) {
+	if !k.registries.MatchString(res.RegistryStr()) {
+		return regauthn.Anonymous, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("docker-credential-"+k.helper, "get")
+	cmd.Stdin = strings.NewReader(res.RegistryStr())
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Getting credentials via 'docker-credential-%s': %s (stderr: %s)", k.helper, err, stderr.String())
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), &creds)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling credentials from 'docker-credential-%s': %s", k.helper, err)
+	}
+
+	// Same convention as docker CLI for helpers returning identity tokens
+	if creds.Username == "<token>" {
+		return regauthn.FromConfig(regauthn.AuthConfig{IdentityToken: creds.Secret}), nil
+	}
+
+	return &regauthn.Basic{Username: creds.Username, Password: creds.Secret}, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// DigestAlgorithm names hash function used to compute content digests
+type DigestAlgorithm string
+
+const (
+	SHA256DigestAlgorithm DigestAlgorithm = "sha256"
+	SHA512DigestAlgorithm DigestAlgorithm = "sha512"
+
+	DefaultDigestAlgorithm = SHA256DigestAlgorithm
+)
+
+func (a DigestAlgorithm) Hasher() (hash.Hash, error) {
+	switch a {
+	case SHA256DigestAlgorithm:
+		return sha256.New(), nil
+	case SHA512DigestAlgorithm:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported digest algorithm '%s' (supported: %s, %s)",
+			a, SHA256DigestAlgorithm, SHA512DigestAlgorithm)
+	}
+}
+
+func (a DigestAlgorithm) Digest(input io.Reader) (regv1.Hash, error) {
+	hasher, err := a.Hasher()
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	_, err = io.Copy(hasher, input)
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	return regv1.Hash{Algorithm: string(a), Hex: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+func (a DigestAlgorithm) DigestPath(path string) (regv1.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	defer file.Close()
+
+	return a.Digest(file)
+}
+
+// ParseDigest parses digest (e.g. sha512:<hex>) with any supported algorithm
+// (go-containerregistry's regv1.NewHash only accepts sha256)
+func ParseDigest(val string) (regv1.Hash, error) {
+	pieces := strings.SplitN(val, ":", 2)
+	if len(pieces) != 2 {
+		return regv1.Hash{}, fmt.Errorf("Expected digest '%s' to be in format <algorithm>:<hex>", val)
+	}
+
+	hasher, err := DigestAlgorithm(pieces[0]).Hasher()
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	if len(pieces[1]) != hasher.Size()*2 || len(strings.Trim(pieces[1], "0123456789abcdef")) > 0 {
+		return regv1.Hash{}, fmt.Errorf("Expected digest '%s' to have %d lowercase hex characters", val, hasher.Size()*2)
+	}
+
+	return regv1.Hash{Algorithm: pieces[0], Hex: pieces[1]}, nil
+}
+
+// ManifestDigest computes digest of image manifest with given algorithm
+// (image's Digest() is always sha256)
+func ManifestDigest(img regv1.Image, alg DigestAlgorithm) (regv1.Hash, error) {
+	if alg == SHA256DigestAlgorithm {
+		return img.Digest()
+	}
+
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	return alg.Digest(bytes.NewReader(manifest))
+}
+
+// TreeDigest computes digest over directory tree so that same tree always
+// results in same digest: each directory, file (with its contents digest) and
+// symlink (with its target) is listed by its relative path in sorted order.
+// Modes and modification times are not included
+func (a DigestAlgorithm) TreeDigest(dirPath string) (regv1.Hash, error) {
+	var entries []string
+
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.ToSlash(relPath)
+
+		switch {
+		case relPath == ".":
+			return nil
+
+		case info.IsDir():
+			entries = append(entries, fmt.Sprintf("%q dir", relPath))
+
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, fmt.Sprintf("%q symlink %q", relPath, filepath.ToSlash(target)))
+
+		case info.Mode().IsRegular():
+			digest, err := a.DigestPath(path)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, fmt.Sprintf("%q file %s", relPath, digest))
+
+		default:
+			return fmt.Errorf("Expected '%s' to be a directory, file or symlink", relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return regv1.Hash{}, err
+	}
+
+	// Walk order depends on OS specific path separator
+	sort.Strings(entries)
+
+	return a.Digest(strings.NewReader(strings.Join(entries, "\n")))
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestManifestDigestWithSHA512(t *testing.T) {
+	img, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatalf("Building image: %s", err)
+	}
+
+	manifest, err := img.RawManifest()
+	if err != nil {
+		t.Fatalf("Getting manifest: %s", err)
+	}
+
+	sum := sha512.Sum512(manifest)
+	expectedDigest := "sha512:" + hex.EncodeToString(sum[:])
+
+	parsedDigest, err := ctlimg.ParseDigest(expectedDigest)
+	if err != nil {
+		t.Fatalf("Expected sha512 digest to be parsed: %s", err)
+	}
+
+	digest, err := ctlimg.ManifestDigest(img, ctlimg.DigestAlgorithm(parsedDigest.Algorithm))
+	if err != nil {
+		t.Fatalf("Computing manifest digest: %s", err)
+	}
+
+	if digest != parsedDigest {
+		t.Fatalf("Expected manifest digest '%s', but was '%s'", expectedDigest, digest)
+	}
+
+	sha256Digest, err := ctlimg.ManifestDigest(img, ctlimg.DefaultDigestAlgorithm)
+	if err != nil {
+		t.Fatalf("Computing manifest digest: %s", err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	if sha256Digest != imgDigest {
+		t.Fatalf("Expected default digest to match image digest '%s', but was '%s'", imgDigest, sha256Digest)
+	}
+}
+
+func TestParseDigestErrors(t *testing.T) {
+	cases := map[string]string{
+		"sha256":                            "to be in format <algorithm>:<hex>",
+		"md5:" + strings.Repeat("0", 32):    "Unsupported digest algorithm 'md5'",
+		"sha512:" + strings.Repeat("0", 64): "to have 128 lowercase hex characters",
+		"sha256:" + strings.Repeat("Z", 64): "to have 64 lowercase hex characters",
+	}
+
+	for val, expectedErr := range cases {
+		_, err := ctlimg.ParseDigest(val)
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Fatalf("Expected digest '%s' to fail with '%s', but was: %v", val, expectedErr, err)
+		}
+	}
+}
+
+func TestTreeDigestIsSameForSameTree(t *testing.T) {
+	writeTree := func(files map[string]string) string {
+		dir, err := ioutil.TempDir("", "imgpkg-tree-digest")
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		for path, content := range files {
+			fullPath := filepath.Join(dir, filepath.FromSlash(path))
+
+			err := os.MkdirAll(filepath.Dir(fullPath), 0700)
+			if err != nil {
+				t.Fatalf("Creating dir: %s", err)
+			}
+
+			err = ioutil.WriteFile(fullPath, []byte(content), 0600)
+			if err != nil {
+				t.Fatalf("Writing file: %s", err)
+			}
+		}
+
+		return dir
+	}
+
+	treeDigest := func(dir string) string {
+		digest, err := ctlimg.DefaultDigestAlgorithm.TreeDigest(dir)
+		if err != nil {
+			t.Fatalf("Computing tree digest: %s", err)
+		}
+		return digest.String()
+	}
+
+	files := map[string]string{"config.yml": "key: value", "dir/a.yml": "a", "dir/sub/b.yml": "b"}
+
+	dir1 := writeTree(files)
+	defer os.RemoveAll(dir1)
+
+	dir2 := writeTree(files)
+	defer os.RemoveAll(dir2)
+
+	digest := treeDigest(dir1)
+
+	if !strings.HasPrefix(digest, "sha256:") || treeDigest(dir2) != digest {
+		t.Fatalf("Expected same tree to have same digest, but was '%s' and '%s'", digest, treeDigest(dir2))
+	}
+
+	// Modes and modification times are not included
+	err := os.Chmod(filepath.Join(dir2, "config.yml"), 0644)
+	if err != nil {
+		t.Fatalf("Changing mode: %s", err)
+	}
+
+	err = os.Chtimes(filepath.Join(dir2, "config.yml"), time.Now(), time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Changing mtime: %s", err)
+	}
+
+	if treeDigest(dir2) != digest {
+		t.Fatalf("Expected digest to not depend on mode or mtime")
+	}
+
+	changes := map[string]func(string) error{
+		"changed contents": func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "dir", "a.yml"), []byte("changed"), 0600)
+		},
+		"renamed file": func(dir string) error {
+			return os.Rename(filepath.Join(dir, "dir", "a.yml"), filepath.Join(dir, "dir", "c.yml"))
+		},
+		"added empty dir": func(dir string) error {
+			return os.Mkdir(filepath.Join(dir, "empty"), 0700)
+		},
+	}
+
+	for desc, change := range changes {
+		dir := writeTree(files)
+		defer os.RemoveAll(dir)
+
+		err := change(dir)
+		if err != nil {
+			t.Fatalf("Changing tree: %s", err)
+		}
+
+		if treeDigest(dir) == digest {
+			t.Fatalf("Expected digest to change after %s", desc)
+		}
+	}
+}
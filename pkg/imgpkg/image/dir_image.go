@@ -5,25 +5,108 @@ package image
 
 import (
 	"archive/tar"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/k14s/imgpkg/pkg/imgpkg/util"
+	"golang.org/x/sync/errgroup"
 )
 
+type DirImageOpts struct {
+	// Modes applied to extracted directories and files;
+	// mode found in tar header is used when not set
+	DirMode  os.FileMode
+	FileMode os.FileMode
+
+	// FileWritten is called for each extracted regular file, including
+	// ones later overwritten or removed by whiteouts of following layers
+	// (unlike logger, meant for programmatic consumption)
+	FileWritten func(ExtractedFile)
+
+	// Warnf is called for each warning instead of printing it via logger;
+	// returned error fails extraction (e.g. warnings treated as errors)
+	Warnf func(pattern string, args ...interface{}) error
+
+	// SkipUnchanged leaves existing files that have same contents
+	// as tar entries untouched (including their mode and mtime)
+	SkipUnchanged bool
+
+	// Concurrency bounds number of files written in parallel within a layer;
+	// only small regular files are written in parallel (0 or 1 writes serially)
+	Concurrency int
+
+	// NewerThan skips non-directory entries with mtime
+	// not after given time when set
+	NewerThan time.Time
+
+	// Owner is applied to extracted entries instead of
+	// ownership found in tar header; only applied when running as root
+	Owner *Owner
+
+	// RenameTemplate computes output path of each entry
+	// from its original name (whiteouts follow renamed paths)
+	RenameTemplate *RenameTemplate
+}
+
+// Owner identifies user and group owning extracted entries
+type Owner struct {
+	UID int
+	GID int
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// Files up to this size are buffered in memory to be written in parallel
+const parallelWriteMaxFileSize = 1024 * 1024
+
+type ExtractedFile struct {
+	// Path relative to extraction directory
+	Path string
+	// FullPath includes extraction directory (files written
+	// by multiple extractions into nested directories are distinct)
+	FullPath string
+	Size     int64
+}
+
 type DirImage struct {
 	dirPath     string
 	img         regv1.Image
 	shouldChown bool
+	opts        DirImageOpts
 	logger      Logger
+
+	// Synchronize parallel file writes
+	dirsLock        sync.Mutex
+	fileWrittenLock sync.Mutex
+
+	ownerWarnOnce sync.Once
+	ownerWarnErr  error
+
+	caseProbeOnce   sync.Once
+	caseInsensitive bool
+	caseProbeErr    error
+
+	// Entry names keyed by their lowercase form to detect entries
+	// (of any layer) overwriting each other on case-insensitive filesystems
+	casePaths map[string]string
 }
 
-func NewDirImage(dirPath string, img regv1.Image, logger Logger) *DirImage {
-	return &DirImage{dirPath, img, os.Getuid() == 0, logger}
+func NewDirImage(dirPath string, img regv1.Image, opts DirImageOpts, logger Logger) *DirImage {
+	return &DirImage{dirPath: dirPath, img: img, shouldChown: os.Getuid() == 0, opts: opts, logger: logger,
+		casePaths: map[string]string{}}
 }
 
 func (i *DirImage) AsDirectory() error {
@@ -40,14 +123,14 @@ func (i *DirImage) AsDirectory() error {
 
 		i.logger.BeginLinef("Extracting layer '%s' (%d/%d)\n", digest, idx+1, len(layers))
 
-		layerStream, err := imgLayer.Uncompressed()
+		layerStream, err := UncompressedContents(imgLayer)
 		if err != nil {
 			return err
 		}
 
 		defer layerStream.Close()
 
-		err = i.writeLayer(layerStream)
+		err = i.writeLayer(layerStream, digest, nil)
 		if err != nil {
 			return err
 		}
@@ -56,11 +139,155 @@ func (i *DirImage) AsDirectory() error {
 	return nil
 }
 
+// AsLayerDirectory extracts only layer with given digest (e.g. for debugging)
+// without merging it with other layers
+func (i *DirImage) AsLayerDirectory(layerDigest regv1.Hash) error {
+	layers, err := i.img.Layers()
+	if err != nil {
+		return err
+	}
+
+	var digests []string
+
+	for _, imgLayer := range layers {
+		digest, err := imgLayer.Digest()
+		if err != nil {
+			return err
+		}
+
+		if digest != layerDigest {
+			digests = append(digests, digest.String())
+			continue
+		}
+
+		i.logger.BeginLinef("Extracting layer '%s'\n", digest)
+
+		layerStream, err := UncompressedContents(imgLayer)
+		if err != nil {
+			return err
+		}
+
+		defer layerStream.Close()
+
+		return i.writeLayer(layerStream, digest, nil)
+	}
+
+	return fmt.Errorf("Expected image to have layer '%s' (layers: %s)", layerDigest, strings.Join(digests, ", "))
+}
+
+// AsMetadataDirectory extracts only given directory from the smallest layer
+// containing it, so that larger (data) layers are not fetched when possible
+func (i *DirImage) AsMetadataDirectory(metadataDir string) error {
+	layers, err := i.img.Layers()
+	if err != nil {
+		return err
+	}
+
+	layerSizes := map[regv1.Layer]int64{}
+
+	for _, layer := range layers {
+		size, err := layer.Size()
+		if err != nil {
+			return err
+		}
+		layerSizes[layer] = size
+	}
+
+	sort.SliceStable(layers, func(a, b int) bool { return layerSizes[layers[a]] < layerSizes[layers[b]] })
+
+	metadataDir = filepath.Clean(metadataDir)
+
+	for _, imgLayer := range layers {
+		digest, err := imgLayer.Digest()
+		if err != nil {
+			return err
+		}
+
+		i.logger.BeginLinef("Looking for '%s' in layer '%s'\n", metadataDir, digest)
+
+		found, err := i.writeMetadataLayer(imgLayer, func(name string) bool {
+			name = filepath.Clean(name)
+			return name == metadataDir || strings.HasPrefix(name, metadataDir+string(filepath.Separator))
+		})
+		if err != nil {
+			return err
+		}
+
+		if found {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Expected to find '%s' directory in one of image layers", metadataDir)
+}
+
+func (i *DirImage) writeMetadataLayer(imgLayer regv1.Layer, include func(string) bool) (bool, error) {
+	layerStream, err := UncompressedContents(imgLayer)
+	if err != nil {
+		return false, err
+	}
+
+	defer layerStream.Close()
+
+	digest, err := imgLayer.Digest()
+	if err != nil {
+		return false, err
+	}
+
+	var found bool
+
+	err = i.writeLayer(layerStream, digest, func(name string) bool {
+		if include(name) {
+			found = true
+			return true
+		}
+		return false
+	})
+
+	return found, err
+}
+
 // Taken from https://github.com/concourse/registry-image-resource/blob/b5481130ad61bc74e0a74f9b00b287b3a24bab88/cmd/in/unpack.go
 
-func (i *DirImage) writeLayer(stream io.Reader) error {
+func (i *DirImage) writeLayer(stream io.Reader, layerDigest regv1.Hash, include func(string) bool) error {
+	if i.opts.Owner != nil && !i.shouldChown {
+		i.ownerWarnOnce.Do(func() {
+			i.ownerWarnErr = i.warnf("Warning: Skipping changing ownership of extracted files to '%d:%d' since not running as root",
+				i.opts.Owner.UID, i.opts.Owner.GID)
+		})
+		if i.ownerWarnErr != nil {
+			return i.ownerWarnErr
+		}
+	}
+
+	var writes *parallelWrites
+	if i.opts.Concurrency > 1 {
+		writes = newParallelWrites(i.opts.Concurrency)
+	}
+
+	err := i.writeLayerEntries(stream, layerDigest, include, writes)
+
+	if writes != nil {
+		// Wait for started writes even if reading failed
+		writesErr := writes.Wait()
+		if err == nil {
+			err = writesErr
+		}
+	}
+
+	return err
+}
+
+func (i *DirImage) writeLayerEntries(stream io.Reader, layerDigest regv1.Hash, include func(string) bool, writes *parallelWrites) error {
 	tarReader := tar.NewReader(stream)
 
+	// Paths (and their parent directories) extracted from this layer,
+	// since whiteouts only apply to contents of previous layers
+	layerPaths := map[string]bool{}
+
+	// Entry types keyed by entry names to detect repeated entries
+	layerNames := map[string]byte{}
+
 	for {
 		hdr, err := tarReader.Next()
 		if err != nil {
@@ -70,23 +297,69 @@ func (i *DirImage) writeLayer(stream io.Reader) error {
 			return err
 		}
 
-		path := filepath.Join(i.dirPath, filepath.Clean(hdr.Name))
-		base := filepath.Base(path)
+		if include != nil && !include(hdr.Name) {
+			continue
+		}
 
-		const (
-			whiteoutPrefix = ".wh."
-		)
+		if i.opts.RenameTemplate != nil {
+			hdr.Name, err = i.renameEntry(hdr.Name, layerDigest)
+			if err != nil {
+				return err
+			}
+		}
 
-		if strings.HasPrefix(base, whiteoutPrefix) {
-			dir := filepath.Dir(path)
+		duplicate, err := i.checkDuplicateEntry(layerNames, hdr, layerDigest)
+		if err != nil {
+			return err
+		}
 
-			err := os.RemoveAll(filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		// Earlier entry may still be written in parallel
+		if duplicate && writes != nil {
+			err := writes.Wait()
 			if err != nil {
-				return nil
+				return err
 			}
+		}
+
+		path := filepath.Join(i.dirPath, filepath.Clean(hdr.Name))
+
+		if strings.HasPrefix(filepath.Base(path), whiteoutPrefix) {
+			err := applyWhiteout(osWhiteoutFS{}, filepath.Dir(path), filepath.Base(path), layerPaths)
+			if err != nil {
+				return fmt.Errorf("Applying whiteout '%s': %s", hdr.Name, err)
+			}
+			i.forgetCasePaths(filepath.Clean(hdr.Name), layerNames)
+			continue
+		}
+
+		if !i.opts.NewerThan.IsZero() && hdr.Typeflag != tar.TypeDir && !hdr.ModTime.After(i.opts.NewerThan) {
 			continue
 		}
 
+		err = i.checkCaseCollision(filepath.Clean(hdr.Name))
+		if err != nil {
+			return err
+		}
+
+		i.addLayerPath(layerPaths, path)
+
+		if i.opts.SkipUnchanged && hdr.FileInfo().Mode().IsRegular() {
+			unchanged, changedInput, err := i.compareExistingFile(path, hdr, tarReader)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				continue
+			}
+			if changedInput != nil {
+				err := i.extractChangedTarEntry(hdr, path, changedInput)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
 		if fi, err := os.Lstat(path); err == nil {
 			if fi.IsDir() && hdr.Name == "." {
 				continue
@@ -98,6 +371,18 @@ func (i *DirImage) writeLayer(stream io.Reader) error {
 			}
 		}
 
+		// Entry names within a layer are unique (repeated ones are awaited above), hence files can be written in any order
+		if writes != nil && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) && hdr.Size <= parallelWriteMaxFileSize {
+			contents, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+
+			hdr := hdr // copy
+			writes.Go(func() error { return i.extractTarEntry(hdr, bytes.NewReader(contents)) })
+			continue
+		}
+
 		err = i.extractTarEntry(hdr, tarReader)
 		if err != nil {
 			return err
@@ -107,31 +392,256 @@ func (i *DirImage) writeLayer(stream io.Reader) error {
 	return nil
 }
 
+// renameEntry applies rename template to entry name; output root is never renamed
+// and whiteouts are renamed according to entries they remove
+func (i *DirImage) renameEntry(name string, layerDigest regv1.Hash) (string, error) {
+	name = filepath.Clean(name)
+	if name == "." {
+		return name, nil
+	}
+
+	dir, base := filepath.Dir(name), filepath.Base(name)
+
+	switch {
+	case base == whiteoutOpaque:
+		if dir == "." {
+			return name, nil
+		}
+		renamedDir, err := i.opts.RenameTemplate.Rename(dir, layerDigest)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(renamedDir, base), nil
+
+	case strings.HasPrefix(base, whiteoutPrefix):
+		target := strings.TrimPrefix(base, whiteoutPrefix)
+		if target == "" || target == "." || target == ".." {
+			return name, nil // rejected when applied
+		}
+		renamed, err := i.opts.RenameTemplate.Rename(filepath.Join(dir, target), layerDigest)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(filepath.Dir(renamed), whiteoutPrefix+filepath.Base(renamed)), nil
+
+	default:
+		return i.opts.RenameTemplate.Rename(name, layerDigest)
+	}
+}
+
+func (i *DirImage) checkCaseCollision(name string) error {
+	key := strings.ToLower(name)
+
+	existingName, found := i.casePaths[key]
+	if !found {
+		i.casePaths[key] = name
+		return nil
+	}
+	if existingName == name {
+		return nil
+	}
+
+	caseInsensitive, err := i.isCaseInsensitive()
+	if err != nil {
+		return fmt.Errorf("Checking case sensitivity of '%s': %s", i.dirPath, err)
+	}
+
+	if caseInsensitive {
+		return fmt.Errorf("Expected tar entries '%s' and '%s' to not differ only by case "+
+			"(they collide on case-insensitive filesystems)", existingName, name)
+	}
+
+	return i.warnf("Warning: Tar entries '%s' and '%s' differ only by case "+
+		"(they collide on case-insensitive filesystems)", existingName, name)
+}
+
+// forgetCasePaths drops entries removed by whiteout (opaque whiteout
+// only removes entries of previous layers) so they do not collide
+// with entries extracted afterwards
+func (i *DirImage) forgetCasePaths(whiteoutName string, layerNames map[string]byte) {
+	dir, base := filepath.Dir(whiteoutName), filepath.Base(whiteoutName)
+	opaque := base == whiteoutOpaque
+
+	removedName := filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+	if opaque {
+		removedName = dir
+	}
+
+	for key, name := range i.casePaths {
+		removed := removedName == "." || strings.HasPrefix(name, removedName+string(filepath.Separator))
+		if opaque {
+			_, fromLayer := layerNames[name]
+			removed = removed && !fromLayer
+		} else {
+			removed = removed || name == removedName
+		}
+		if removed {
+			delete(i.casePaths, key)
+		}
+	}
+}
+
+// checkDuplicateEntry reports entries repeated within layer; repeated
+// directory entries are allowed since they do not overwrite contents
+func (i *DirImage) checkDuplicateEntry(layerNames map[string]byte, hdr *tar.Header, layerDigest regv1.Hash) (bool, error) {
+	name := filepath.Clean(hdr.Name)
+
+	existingType, found := layerNames[name]
+	layerNames[name] = hdr.Typeflag
+
+	if !found || (existingType == tar.TypeDir && hdr.Typeflag == tar.TypeDir) {
+		return false, nil
+	}
+
+	err := i.warnf("Warning: Tar entry '%s' is repeated within layer '%s' (later entry overwrites earlier one)", name, layerDigest)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// warnf passes warning to Warnf when set, otherwise prints it
+func (i *DirImage) warnf(pattern string, args ...interface{}) error {
+	if i.opts.Warnf != nil {
+		return i.opts.Warnf(pattern, args...)
+	}
+	i.logger.BeginLinef(pattern+"\n", args...)
+	return nil
+}
+
+// isCaseInsensitive checks (once) whether output directory resolves
+// names case-insensitively (e.g. default macOS and Windows filesystems)
+func (i *DirImage) isCaseInsensitive() (bool, error) {
+	i.caseProbeOnce.Do(func() {
+		i.caseProbeErr = i.mkdirAll(i.dirPath, i.parentDirMode())
+		if i.caseProbeErr != nil {
+			return
+		}
+
+		probeFile, err := ioutil.TempFile(i.dirPath, ".imgpkg-case-probe-")
+		if err != nil {
+			i.caseProbeErr = err
+			return
+		}
+
+		probeFile.Close()
+		defer os.Remove(probeFile.Name())
+
+		upperPath := filepath.Join(i.dirPath, strings.ToUpper(filepath.Base(probeFile.Name())))
+
+		_, err = os.Lstat(upperPath)
+		switch {
+		case err == nil:
+			i.caseInsensitive = true
+		case !os.IsNotExist(err):
+			i.caseProbeErr = err
+		}
+	})
+
+	return i.caseInsensitive, i.caseProbeErr
+}
+
+func (i *DirImage) addLayerPath(layerPaths map[string]bool, path string) {
+	rootPath := filepath.Clean(i.dirPath)
+
+	for path != rootPath && !layerPaths[path] {
+		layerPaths[path] = true
+
+		parentPath := filepath.Dir(path)
+		if parentPath == path {
+			break
+		}
+		path = parentPath
+	}
+}
+
+// compareExistingFile consumes tar entry contents if existing file
+// has the same size, hence returns a copy of contents to use instead
+func (i *DirImage) compareExistingFile(path string, hdr *tar.Header, input io.Reader) (bool, *os.File, error) {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != hdr.Size {
+		return false, nil, nil
+	}
+
+	existingDigest, err := DefaultDigestAlgorithm.DigestPath(path)
+	if err != nil {
+		return false, nil, err
+	}
+
+	contents, err := ioutil.TempFile("", "imgpkg-dir-image-entry")
+	if err != nil {
+		return false, nil, err
+	}
+
+	incomingDigest, err := DefaultDigestAlgorithm.Digest(io.TeeReader(input, contents))
+	if err == nil {
+		_, err = contents.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		contents.Close()
+		os.Remove(contents.Name())
+		return false, nil, err
+	}
+
+	if incomingDigest == existingDigest {
+		contents.Close()
+		os.Remove(contents.Name())
+		return true, nil, nil
+	}
+
+	return false, contents, nil
+}
+
+func (i *DirImage) extractChangedTarEntry(hdr *tar.Header, path string, contents *os.File) error {
+	defer os.Remove(contents.Name())
+	defer contents.Close()
+
+	err := os.Remove(path)
+	if err != nil {
+		return err
+	}
+
+	return i.extractTarEntry(hdr, contents)
+}
+
 // Taken from https://github.com/concourse/go-archive/blob/f26802964d15194bddb07bf116ea567c56af973f/tarfs/extract.go
 
 func (i *DirImage) extractTarEntry(header *tar.Header, input io.Reader) error {
 	path := filepath.Join(i.dirPath, header.Name)
 	mode := header.FileInfo().Mode()
 
-	err := os.MkdirAll(filepath.Dir(path), 0700)
+	err := i.mkdirAll(filepath.Dir(path), i.parentDirMode())
 	if err != nil {
 		return err
 	}
 
 	switch header.Typeflag {
 	case tar.TypeDir:
-		err := os.MkdirAll(path, mode)
+		if i.opts.DirMode != 0 {
+			mode = i.opts.DirMode
+		}
+
+		err := i.mkdirAll(path, mode)
 		if err != nil {
 			return err
 		}
 
-	case tar.TypeReg, tar.TypeRegA:
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		if i.opts.FileMode != 0 {
+			mode = i.opts.FileMode
+		}
+
 		file, err := os.Create(path)
 		if err != nil {
 			return err
 		}
 
-		_, err = io.Copy(file, input)
+		if isSparseEntry(header) {
+			err = writeSparseFile(file, input)
+		} else {
+			_, err = io.Copy(file, input)
+		}
 		if err != nil {
 			_ = file.Close()
 			return err
@@ -152,7 +662,12 @@ func (i *DirImage) extractTarEntry(header *tar.Header, input io.Reader) error {
 	}
 
 	if runtime.GOOS != "windows" && i.shouldChown {
-		err = os.Lchown(path, header.Uid, header.Gid)
+		uid, gid := header.Uid, header.Gid
+		if i.opts.Owner != nil {
+			uid, gid = i.opts.Owner.UID, i.opts.Owner.GID
+		}
+
+		err = os.Lchown(path, uid, gid)
 		if err != nil {
 			return err
 		}
@@ -165,7 +680,55 @@ func (i *DirImage) extractTarEntry(header *tar.Header, input io.Reader) error {
 	}
 
 	// must be done after everything
-	return lchtimes(header, path)
+	err = lchtimes(header, path)
+	if err != nil {
+		return err
+	}
+
+	if i.opts.FileWritten != nil && header.FileInfo().Mode().IsRegular() {
+		i.fileWrittenLock.Lock()
+		i.opts.FileWritten(ExtractedFile{Path: filepath.Clean(header.Name), FullPath: path, Size: header.Size})
+		i.fileWrittenLock.Unlock()
+	}
+
+	return nil
+}
+
+func (i *DirImage) mkdirAll(path string, mode os.FileMode) error {
+	i.dirsLock.Lock()
+	defer i.dirsLock.Unlock()
+
+	return os.MkdirAll(path, mode)
+}
+
+// parallelWrites runs writes concurrently (bounded by throttle)
+// and reports first encountered error
+type parallelWrites struct {
+	throttle util.Throttle
+	group    errgroup.Group
+}
+
+func newParallelWrites(concurrency int) *parallelWrites {
+	return &parallelWrites{throttle: util.NewThrottle(concurrency)}
+}
+
+func (w *parallelWrites) Go(writeFunc func() error) {
+	// Taken before starting goroutine to bound buffered contents in memory
+	w.throttle.Take()
+
+	w.group.Go(func() error {
+		defer w.throttle.Done()
+		return writeFunc()
+	})
+}
+
+func (w *parallelWrites) Wait() error { return w.group.Wait() }
+
+func (i *DirImage) parentDirMode() os.FileMode {
+	if i.opts.DirMode != 0 {
+		return i.opts.DirMode
+	}
+	return 0700
 }
 
 func lchmod(header *tar.Header, path string, mode os.FileMode) error {
@@ -0,0 +1,54 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !windows
+
+package image_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestDirImageAppliesConfiguredOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Changing ownership requires running as root")
+	}
+
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/file.yml", Content: "content"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-owner")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	opts := ctlimg.DirImageOpts{Owner: &ctlimg.Owner{UID: 1234, GID: 5678}}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	for _, path := range []string{"dir", filepath.Join("dir", "file.yml")} {
+		fi, err := os.Lstat(filepath.Join(outputDir, path))
+		if err != nil {
+			t.Fatalf("Expected '%s' to be extracted: %s", path, err)
+		}
+
+		stat := fi.Sys().(*syscall.Stat_t)
+		if stat.Uid != 1234 || stat.Gid != 5678 {
+			t.Fatalf("Expected '%s' to be owned by 1234:5678, but was %d:%d", path, stat.Uid, stat.Gid)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestDirImageParallelWritesMatchSerial(t *testing.T) {
+	img := buildTarEntriesImage(t, manySmallFilesEntries(20, 50, 2*1024*1024))
+	defer img.Remove()
+
+	var extracted []map[string]string
+
+	for _, concurrency := range []int{1, 8} {
+		outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-parallel")
+		if err != nil {
+			t.Fatalf("Creating output dir: %s", err)
+		}
+		defer os.RemoveAll(outputDir)
+
+		var writtenFiles int
+
+		opts := ctlimg.DirImageOpts{
+			Concurrency: concurrency,
+			FileWritten: func(ctlimg.ExtractedFile) { writtenFiles++ },
+		}
+
+		err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+		if err != nil {
+			t.Fatalf("Expected extraction with concurrency %d to succeed: %s", concurrency, err)
+		}
+
+		files := dirContents(t, outputDir)
+
+		if writtenFiles != len(files) {
+			t.Fatalf("Expected to be notified about %d written files, got %d", len(files), writtenFiles)
+		}
+
+		extracted = append(extracted, files)
+	}
+
+	serial, parallel := extracted[0], extracted[1]
+
+	if len(serial) != 20*50+1 || len(serial) != len(parallel) {
+		t.Fatalf("Expected same number of files, got %d (serial) and %d (parallel)", len(serial), len(parallel))
+	}
+
+	for path, contents := range serial {
+		if parallel[path] != contents {
+			t.Fatalf("Expected '%s' to have same contents and mode in serial and parallel extraction", path)
+		}
+	}
+}
+
+func BenchmarkDirImageAsDirectory(b *testing.B) {
+	img := buildTarEntriesImage(b, manySmallFilesEntries(20, 100, 0))
+	defer img.Remove()
+
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-bench")
+				if err != nil {
+					b.Fatalf("Creating output dir: %s", err)
+				}
+
+				opts := ctlimg.DirImageOpts{Concurrency: concurrency}
+
+				err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+				if err != nil {
+					b.Fatalf("Extracting: %s", err)
+				}
+
+				os.RemoveAll(outputDir)
+			}
+		})
+	}
+}
+
+// manySmallFilesEntries returns directories with files in them,
+// and optionally one large file (written serially)
+func manySmallFilesEntries(dirs, filesPerDir, largeFileSize int) []tarEntry {
+	var entries []tarEntry
+
+	for d := 0; d < dirs; d++ {
+		dirName := fmt.Sprintf("dir%d", d)
+		entries = append(entries, tarEntry{Name: dirName, Typeflag: tar.TypeDir})
+
+		for f := 0; f < filesPerDir; f++ {
+			entries = append(entries, tarEntry{
+				Name:    fmt.Sprintf("%s/file%d.yml", dirName, f),
+				Content: strings.Repeat(fmt.Sprintf("%d-%d\n", d, f), 100),
+			})
+		}
+	}
+
+	if largeFileSize > 0 {
+		entries = append(entries, tarEntry{Name: "large.bin", Content: strings.Repeat("x", largeFileSize)})
+	}
+
+	return entries
+}
+
+// dirContents returns file contents prefixed with mode by relative path
+func dirContents(t *testing.T, dir string) map[string]string {
+	result := map[string]string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		result[relPath] = info.Mode().String() + ":" + string(contents)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walking dir: %s", err)
+	}
+
+	return result
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !windows
+
+package image_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestDirImageReconstructsSparseFileHoles(t *testing.T) {
+	const realSize = 8 * 1024 * 1024
+
+	// Data fragments; everything else (including trailing 4MB) is a hole
+	fragments := []struct {
+		Offset  int64
+		Content string
+	}{
+		{0, "start"},
+		{2 * 1024 * 1024, "middle"},
+	}
+
+	// GNU PAX sparse format 1.0: sparse map precedes fragment data
+	var sparseMap bytes.Buffer
+	var data bytes.Buffer
+
+	fmt.Fprintf(&sparseMap, "%d\n", len(fragments))
+	for _, frag := range fragments {
+		fmt.Fprintf(&sparseMap, "%d\n%d\n", frag.Offset, len(frag.Content))
+		data.WriteString(frag.Content)
+	}
+
+	var tarContents bytes.Buffer
+
+	paxRecords := paxRecord("GNU.sparse.major", "1") + paxRecord("GNU.sparse.minor", "0") +
+		paxRecord("GNU.sparse.name", "sparse.bin") + paxRecord("GNU.sparse.realsize", fmt.Sprintf("%d", realSize))
+
+	writeTarBlocks(&tarContents, tarHeaderBlock("PaxHeaders.0/sparse.bin", 'x', len(paxRecords)), []byte(paxRecords))
+
+	physical := append(padTarBlock(sparseMap.Bytes()), data.Bytes()...)
+	writeTarBlocks(&tarContents, tarHeaderBlock("GNUSparseFile.0/sparse.bin", '0', len(physical)), physical)
+
+	tarContents.Write(make([]byte, 2*512))
+
+	tarFile, err := ioutil.TempFile("", "imgpkg-dir-image-sparse")
+	if err != nil {
+		t.Fatalf("Creating tar file: %s", err)
+	}
+	defer os.Remove(tarFile.Name())
+
+	_, err = tarFile.Write(tarContents.Bytes())
+	if err != nil {
+		t.Fatalf("Writing tar file: %s", err)
+	}
+	tarFile.Close()
+
+	img, err := ctlimg.NewFileImage(tarFile.Name(), false)
+	if err != nil {
+		t.Fatalf("Building file image: %s", err)
+	}
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-sparse")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	err = ctlimg.NewDirImage(outputDir, img, ctlimg.DirImageOpts{}, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	path := filepath.Join(outputDir, "sparse.bin")
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading extracted file: %s", err)
+	}
+
+	if len(contents) != realSize {
+		t.Fatalf("Expected extracted file to have size %d, but was %d", realSize, len(contents))
+	}
+
+	expected := make([]byte, realSize)
+	for _, frag := range fragments {
+		copy(expected[frag.Offset:], frag.Content)
+	}
+
+	if !bytes.Equal(contents, expected) {
+		t.Fatalf("Expected extracted file contents to match sparse entry")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stating extracted file: %s", err)
+	}
+
+	allocated := info.Sys().(*syscall.Stat_t).Blocks * 512
+	if allocated >= realSize/2 {
+		t.Fatalf("Expected holes to not be allocated, but %d bytes were allocated", allocated)
+	}
+}
+
+func paxRecord(key, val string) string {
+	// Record length includes its own decimal length
+	rec := fmt.Sprintf(" %s=%s\n", key, val)
+	size := len(rec)
+	for size != len(fmt.Sprintf("%d", size))+len(rec) {
+		size = len(fmt.Sprintf("%d", size)) + len(rec)
+	}
+	return fmt.Sprintf("%d%s", size, rec)
+}
+
+func tarHeaderBlock(name string, typeflag byte, size int) []byte {
+	block := make([]byte, 512)
+
+	copy(block[0:100], name)
+	copy(block[100:108], "0000644\x00")
+	copy(block[108:116], "0000000\x00")
+	copy(block[116:124], "0000000\x00")
+	copy(block[124:136], fmt.Sprintf("%011o\x00", size))
+	copy(block[136:148], fmt.Sprintf("%011o\x00", 0))
+	block[156] = typeflag
+	copy(block[257:265], "ustar\x0000")
+
+	// Checksum is computed with checksum field set to spaces
+	copy(block[148:156], "        ")
+	var sum int
+	for _, b := range block {
+		sum += int(b)
+	}
+	copy(block[148:156], fmt.Sprintf("%06o\x00 ", sum))
+
+	return block
+}
+
+func padTarBlock(contents []byte) []byte {
+	if rem := len(contents) % 512; rem != 0 {
+		contents = append(contents, make([]byte, 512-rem)...)
+	}
+	return contents
+}
+
+func writeTarBlocks(buf *bytes.Buffer, hdr []byte, contents []byte) {
+	buf.Write(hdr)
+	buf.Write(padTarBlock(append([]byte{}, contents...)))
+}
@@ -0,0 +1,506 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+type tarEntry struct {
+	Name     string
+	Content  string
+	Typeflag byte
+	ModTime  time.Time
+}
+
+func TestDirImageUsesConfiguredModes(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/file.yml", Content: "content"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-modes")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	opts := ctlimg.DirImageOpts{DirMode: 0750, FileMode: 0640}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	assertMode(t, filepath.Join(outputDir, "dir"), 0750)
+	assertMode(t, filepath.Join(outputDir, "dir", "file.yml"), 0640)
+}
+
+func TestDirImageReportsEachWrittenFile(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/file1.yml", Content: "content1"},
+		{Name: "dir/file2.yml", Content: "content-2"},
+		{Name: "file3.yml", Content: ""},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-callback")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	writtenFiles := map[string][]int64{}
+
+	opts := ctlimg.DirImageOpts{
+		FileWritten: func(file ctlimg.ExtractedFile) {
+			writtenFiles[file.Path] = append(writtenFiles[file.Path], file.Size)
+		},
+	}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	expectedFiles := map[string]int64{
+		filepath.Join("dir", "file1.yml"): 8,
+		filepath.Join("dir", "file2.yml"): 9,
+		"file3.yml":                       0,
+	}
+
+	if len(writtenFiles) != len(expectedFiles) {
+		t.Fatalf("Expected callback for %d files, got: %v", len(expectedFiles), writtenFiles)
+	}
+
+	for path, size := range expectedFiles {
+		sizes := writtenFiles[path]
+		if len(sizes) != 1 || sizes[0] != size {
+			t.Fatalf("Expected callback exactly once for '%s' with size %d, got: %v", path, size, sizes)
+		}
+	}
+}
+
+func TestDirImageSkipUnchangedPreservesUnchangedFiles(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/same.yml", Content: "same"},
+		{Name: "dir/changed.yml", Content: "new-content"},
+		{Name: "dir/added.yml", Content: "added"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-skip-unchanged")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	existingFiles := map[string]string{
+		"same.yml":    "same",
+		"changed.yml": "old-content", // same size as new contents
+		"extra.yml":   "extra",
+	}
+
+	err = os.Mkdir(filepath.Join(outputDir, "dir"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	oldTime := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, content := range existingFiles {
+		path := filepath.Join(outputDir, "dir", name)
+
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+
+		err = os.Chtimes(path, oldTime, oldTime)
+		if err != nil {
+			t.Fatalf("Setting file times: %s", err)
+		}
+	}
+
+	var writtenFiles []string
+
+	opts := ctlimg.DirImageOpts{
+		SkipUnchanged: true,
+		FileWritten: func(file ctlimg.ExtractedFile) {
+			writtenFiles = append(writtenFiles, file.Path)
+		},
+	}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	info, err := os.Stat(filepath.Join(outputDir, "dir", "same.yml"))
+	if err != nil {
+		t.Fatalf("Stating file: %s", err)
+	}
+
+	if !info.ModTime().Equal(oldTime) {
+		t.Fatalf("Expected unchanged file mtime to be preserved, but was %s", info.ModTime())
+	}
+
+	expectedContents := map[string]string{
+		"same.yml":    "same",
+		"changed.yml": "new-content",
+		"added.yml":   "added",
+		"extra.yml":   "extra",
+	}
+
+	for name, expectedContent := range expectedContents {
+		content, err := ioutil.ReadFile(filepath.Join(outputDir, "dir", name))
+		if err != nil {
+			t.Fatalf("Reading file: %s", err)
+		}
+		if string(content) != expectedContent {
+			t.Fatalf("Expected '%s' to contain '%s', but was '%s'", name, expectedContent, content)
+		}
+	}
+
+	expectedWritten := []string{filepath.Join("dir", "changed.yml"), filepath.Join("dir", "added.yml")}
+
+	if strings.Join(writtenFiles, ",") != strings.Join(expectedWritten, ",") {
+		t.Fatalf("Expected only changed files to be written, got: %v", writtenFiles)
+	}
+}
+
+func TestDirImageNewerThanSkipsOlderFiles(t *testing.T) {
+	threshold := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir, ModTime: threshold.Add(-time.Hour)},
+		{Name: "dir/old.yml", Content: "old", ModTime: threshold.Add(-time.Hour)},
+		{Name: "dir/same.yml", Content: "same", ModTime: threshold},
+		{Name: "dir/new.yml", Content: "new", ModTime: threshold.Add(time.Hour)},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-newer-than")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	opts := ctlimg.DirImageOpts{NewerThan: threshold}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "dir", "new.yml"))
+	if err != nil {
+		t.Fatalf("Expected newer file to be extracted: %s", err)
+	}
+	if string(contents) != "new" {
+		t.Fatalf("Expected newer file contents, but was '%s'", contents)
+	}
+
+	for _, name := range []string{"old.yml", "same.yml"} {
+		_, err = os.Stat(filepath.Join(outputDir, "dir", name))
+		if !os.IsNotExist(err) {
+			t.Fatalf("Expected file '%s' to not be extracted, but was: %v", name, err)
+		}
+	}
+}
+
+func buildTarEntriesImage(t testing.TB, entries []tarEntry) *ctlimg.FileImage {
+	tarFile, err := ioutil.TempFile("", "imgpkg-dir-image-test")
+	if err != nil {
+		t.Fatalf("Creating tar file: %s", err)
+	}
+
+	defer tarFile.Close()
+
+	tarWriter := tar.NewWriter(tarFile)
+
+	for _, entry := range entries {
+		hdr := &tar.Header{Name: entry.Name, Mode: 0600, Typeflag: entry.Typeflag, ModTime: entry.ModTime}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Mode = 0700
+		} else {
+			hdr.Size = int64(len(entry.Content))
+		}
+
+		err := tarWriter.WriteHeader(hdr)
+		if err != nil {
+			t.Fatalf("Writing tar header: %s", err)
+		}
+
+		_, err = tarWriter.Write([]byte(entry.Content))
+		if err != nil {
+			t.Fatalf("Writing tar content: %s", err)
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		t.Fatalf("Closing tar: %s", err)
+	}
+
+	img, err := ctlimg.NewFileImage(tarFile.Name(), false)
+	if err != nil {
+		t.Fatalf("Building file image: %s", err)
+	}
+
+	return img
+}
+
+func assertMode(t *testing.T, path string, expectedMode os.FileMode) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stating '%s': %s", path, err)
+	}
+
+	if info.Mode().Perm() != expectedMode {
+		t.Fatalf("Expected '%s' to have mode %o, but was %o", path, expectedMode, info.Mode().Perm())
+	}
+}
+
+type noopLogger struct{}
+
+func (noopLogger) BeginLinef(string, ...interface{}) {}
+
+func TestDirImageAppliesWhiteoutsFromLaterLayers(t *testing.T) {
+	lowerImg := buildTarEntriesImage(t, []tarEntry{
+		{Name: "removed.yml", Content: "removed"},
+		{Name: "kept.yml", Content: "kept"},
+		{Name: "removed-dir", Typeflag: tar.TypeDir},
+		{Name: "removed-dir/file.yml", Content: "file"},
+		{Name: "opaque-dir", Typeflag: tar.TypeDir},
+		{Name: "opaque-dir/old.yml", Content: "old"},
+	})
+	defer lowerImg.Remove()
+
+	upperImg := buildTarEntriesImage(t, []tarEntry{
+		{Name: ".wh.removed.yml"},
+		{Name: ".wh.removed-dir"},
+		{Name: "opaque-dir", Typeflag: tar.TypeDir},
+		{Name: "opaque-dir/new.yml", Content: "new"},
+		{Name: "opaque-dir/.wh..wh..opq"},
+	})
+	defer upperImg.Remove()
+
+	upperLayers, err := upperImg.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	img, err := mutate.AppendLayers(lowerImg, upperLayers...)
+	if err != nil {
+		t.Fatalf("Appending layers: %s", err)
+	}
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-whiteouts")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	err = ctlimg.NewDirImage(outputDir, img, ctlimg.DirImageOpts{}, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	var paths []string
+
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walking output dir: %s", err)
+	}
+
+	expectedPaths := ". kept.yml opaque-dir opaque-dir/new.yml"
+	if strings.Join(paths, " ") != expectedPaths {
+		t.Fatalf("Expected output to contain '%s', but was '%s'", expectedPaths, strings.Join(paths, " "))
+	}
+}
+
+func TestDirImageFailsOnEntriesDifferingOnlyByCase(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "README", Content: "upper"},
+		{Name: "docs", Typeflag: tar.TypeDir},
+		{Name: "readme", Content: "lower"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-case")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	err = ctlimg.NewDirImage(outputDir, img, strictDirImageOpts(), noopLogger{}).AsDirectory()
+	if err == nil {
+		t.Fatalf("Expected extraction to fail")
+	}
+
+	// Warning on case-sensitive filesystems, error on case-insensitive ones
+	if !strings.Contains(err.Error(), "'README' and 'readme'") || !strings.Contains(err.Error(), "differ only by case") {
+		t.Fatalf("Expected error to name entries differing by case, but was: %s", err)
+	}
+}
+
+func TestDirImageChecksCaseCollisionsAcrossLayers(t *testing.T) {
+	lowerImg := buildTarEntriesImage(t, []tarEntry{
+		{Name: "README", Content: "upper"},
+		{Name: "removed.yml", Content: "removed"},
+		{Name: "opaque-dir", Typeflag: tar.TypeDir},
+		{Name: "opaque-dir/old.yml", Content: "old"},
+	})
+	defer lowerImg.Remove()
+
+	testCases := []struct {
+		name        string
+		entries     []tarEntry
+		expectedErr string
+	}{
+		{
+			name:        "collision with entry of previous layer",
+			entries:     []tarEntry{{Name: "readme", Content: "lower"}},
+			expectedErr: "'README' and 'readme'",
+		},
+		{
+			name:    "entry removed by whiteout",
+			entries: []tarEntry{{Name: ".wh.removed.yml"}, {Name: "REMOVED.yml", Content: "new"}},
+		},
+		{
+			name: "entry removed by opaque whiteout",
+			entries: []tarEntry{
+				{Name: "opaque-dir", Typeflag: tar.TypeDir},
+				{Name: "opaque-dir/.wh..wh..opq"},
+				{Name: "opaque-dir/OLD.yml", Content: "new"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upperImg := buildTarEntriesImage(t, tc.entries)
+			defer upperImg.Remove()
+
+			upperLayers, err := upperImg.Layers()
+			if err != nil {
+				t.Fatalf("Getting layers: %s", err)
+			}
+
+			img, err := mutate.AppendLayers(lowerImg, upperLayers...)
+			if err != nil {
+				t.Fatalf("Appending layers: %s", err)
+			}
+
+			outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-case-layers")
+			if err != nil {
+				t.Fatalf("Creating output dir: %s", err)
+			}
+			defer os.RemoveAll(outputDir)
+
+			err = ctlimg.NewDirImage(outputDir, img, strictDirImageOpts(), noopLogger{}).AsDirectory()
+
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("Expected extraction to succeed: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("Expected extraction to fail with '%s', but was: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// strictDirImageOpts treats warnings as errors (e.g. with --strict)
+func strictDirImageOpts() ctlimg.DirImageOpts {
+	return ctlimg.DirImageOpts{Warnf: func(pattern string, args ...interface{}) error {
+		return fmt.Errorf(pattern, args...)
+	}}
+}
+
+func TestDirImageReportsDuplicateEntries(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/app.yml", Content: "first"},
+		{Name: "dir", Typeflag: tar.TypeDir},
+		{Name: "dir/app.yml", Content: "second"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-duplicates")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	logger := &recordingLogger{}
+
+	err = ctlimg.NewDirImage(outputDir, img, ctlimg.DirImageOpts{Concurrency: 2}, logger).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "dir", "app.yml"))
+	if err != nil || string(contents) != "second" {
+		t.Fatalf("Expected later entry to be extracted, but was '%s' (%v)", contents, err)
+	}
+
+	output := strings.Join(logger.Lines, "")
+	if strings.Count(output, "Warning: Tar entry") != 1 || !strings.Contains(output, "Warning: Tar entry 'dir/app.yml' is repeated within layer") {
+		t.Fatalf("Expected single warning about repeated file entry, but was: %s", output)
+	}
+
+	// Warnings are treated as errors e.g. with --strict
+	opts := ctlimg.DirImageOpts{Warnf: func(pattern string, args ...interface{}) error {
+		return fmt.Errorf(pattern, args...)
+	}}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err == nil {
+		t.Fatalf("Expected extraction to fail")
+	}
+
+	expectedErr := "Warning: Tar entry 'dir/app.yml' is repeated within layer 'sha256:"
+	if !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("Expected error to contain '%s', but was: %s", expectedErr, err)
+	}
+}
+
+type recordingLogger struct {
+	Lines []string
+}
+
+func (l *recordingLogger) BeginLinef(msg string, args ...interface{}) {
+	l.Lines = append(l.Lines, fmt.Sprintf(msg, args...))
+}
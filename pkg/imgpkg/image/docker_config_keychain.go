@@ -0,0 +1,61 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// dockerConfigKeychain resolves credentials from given docker config file
+// (auths, credHelpers, credsStore) similar to regauthn.DefaultKeychain,
+// which only reads config.json from $DOCKER_CONFIG directory
+type dockerConfigKeychain struct {
+	path string
+}
+
+func (k dockerConfigKeychain) Resolve(res regauthn.Resource) (regauthn.Authenticator, error) {
+	file, err := os.Open(k.path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading docker config '%s': %s", k.path, err)
+	}
+
+	defer file.Close()
+
+	cf := configfile.New(k.path)
+
+	err = cf.LoadFromReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("Reading docker config '%s': %s", k.path, err)
+	}
+
+	// Docker Hub credentials are stored under legacy key
+	key := res.RegistryStr()
+	if key == regname.DefaultRegistry {
+		key = regauthn.DefaultAuthKey
+	}
+
+	// Invokes credential helper (docker-credential-<helper> on PATH) if configured
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, fmt.Errorf("Getting credentials for '%s' from docker config '%s': %s", key, k.path, err)
+	}
+
+	if cfg == (types.AuthConfig{}) {
+		return regauthn.Anonymous, nil
+	}
+
+	return regauthn.FromConfig(regauthn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// DSSEEnvelopeMediaType is used by cosign for layers of attestations
+	// pushed with 'sha256-<hex>.att' tag (one envelope per layer)
+	DSSEEnvelopeMediaType types.MediaType = "application/vnd.dsse.envelope.v1+json"
+
+	inTotoPayloadType = "application/vnd.in-toto+json"
+)
+
+// DSSEEnvelope is signed in-toto statement
+// (https://github.com/secure-systems-lab/dsse/blob/master/envelope.md)
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Verify checks that one of envelope signatures was made with given key
+// (ECDSA and RSA PKCS#1 v1.5 signatures over SHA-256 or Ed25519 signatures)
+func (e DSSEEnvelope) Verify(key crypto.PublicKey) error {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return fmt.Errorf("Decoding payload: %s", err)
+	}
+
+	message := dssePAE(e.PayloadType, payload)
+	digest := sha256.Sum256(message)
+
+	for _, sig := range e.Signatures {
+		sigBytes, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if verifySignature(key, message, digest[:], sigBytes) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Expected envelope to be signed with given key, but none of %d signature(s) was", len(e.Signatures))
+}
+
+// dssePAE is pre-authentication encoding of payload which is what gets signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+func verifySignature(key crypto.PublicKey, message, digest, sig []byte) bool {
+	switch typedKey := key.(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSig struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(sig, &ecdsaSig)
+		if err != nil || len(rest) > 0 {
+			return false
+		}
+		return ecdsa.Verify(typedKey, digest, ecdsaSig.R, ecdsaSig.S)
+
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(typedKey, crypto.SHA256, digest, sig) == nil
+
+	case ed25519.PublicKey:
+		return ed25519.Verify(typedKey, message, sig)
+
+	default:
+		return false
+	}
+}
+
+// ParsePublicKey parses PEM encoded PKIX public key (e.g. cosign.pub)
+func ParsePublicKey(bs []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("Expected PEM encoded public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing public key: %s", err)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const excludeNegationPrefix = "!"
+
+// excludeMatcher evaluates exclude paths in order with last match winning;
+// '!' prefixed paths re-include previously excluded paths (similar to gitignore),
+// including files within excluded directories. Path matches itself and its contents.
+type excludeMatcher struct {
+	patterns []excludePattern
+}
+
+type excludePattern struct {
+	path    string
+	negated bool
+}
+
+func newExcludeMatcher(pathLists ...[]string) excludeMatcher {
+	var patterns []excludePattern
+
+	for _, paths := range pathLists {
+		for _, path := range paths {
+			negated := strings.HasPrefix(path, excludeNegationPrefix)
+			if negated {
+				path = strings.TrimPrefix(path, excludeNegationPrefix)
+			}
+			patterns = append(patterns, excludePattern{path: filepath.Clean(path), negated: negated})
+		}
+	}
+
+	return excludeMatcher{patterns}
+}
+
+func (m excludeMatcher) Excluded(relPath string) bool {
+	excluded := false
+
+	for _, pattern := range m.patterns {
+		if pattern.matches(relPath) {
+			excluded = !pattern.negated
+		}
+	}
+
+	return excluded
+}
+
+// HasReincludesWithin indicates that excluded directory
+// still needs to be walked to find re-included paths
+func (m excludeMatcher) HasReincludesWithin(dirRelPath string) bool {
+	for _, pattern := range m.patterns {
+		if pattern.negated && strings.HasPrefix(pattern.path, dirRelPath+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p excludePattern) matches(relPath string) bool {
+	return relPath == p.path || strings.HasPrefix(relPath, p.path+string(filepath.Separator))
+}
@@ -4,12 +4,8 @@
 package image
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
-	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
@@ -26,24 +22,39 @@ type FileImage struct {
 }
 
 func NewFileImage(path string, bundle bool) (*FileImage, error) {
-	sha256, err := sha256Path(path)
+	return newFileImage(path, bundle, types.DockerLayer)
+}
+
+// newFileImage stores tar as is instead of compressing it when
+// layer media type is uncompressed (e.g. when files are already compressed)
+func newFileImage(path string, bundle bool, layerMediaType types.MediaType) (*FileImage, error) {
+	diffID, err := DefaultDigestAlgorithm.DigestPath(path)
 	if err != nil {
 		return nil, err
 	}
 
-	layer, err := partial.UncompressedToLayer(&UncompressedFileLayer{
-		diffID:    v1.Hash{Algorithm: "sha256", Hex: sha256},
-		mediaType: types.DockerLayer,
-		path:      path,
-	})
+	var layer v1.Layer
+
+	if IsUncompressedLayer(layerMediaType) {
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		layer = &RawFileLayer{digest: diffID, size: fileInfo.Size(), mediaType: layerMediaType, path: path}
+	} else {
+		layer, err = partial.UncompressedToLayer(&UncompressedFileLayer{
+			diffID:    diffID,
+			mediaType: layerMediaType,
+			path:      path,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	add := mutate.Addendum{
-		Layer: layer,
-		History: v1.History{
-			Author:    "imgpkg",
-			CreatedBy: "imgpkg",
-			Created:   v1.Time{time.Time{}}, // static
-		},
+		Layer:   layer,
+		History: LayerHistory("", ""),
 	}
 
 	img, err := mutate.Append(empty.Image, add)
@@ -69,27 +80,20 @@ func NewFileImage(path string, bundle bool) (*FileImage, error) {
 		}
 	}
 
+	// OCI layers are not expected within Docker manifest
+	if layerMediaType == types.OCILayer || layerMediaType == types.OCIUncompressedLayer {
+		img, err = NewOCIImage(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &FileImage{img, path}, nil
 }
 
 func (i *FileImage) Remove() error {
-	return os.Remove(i.path)
-}
-
-func sha256Path(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
+	if len(i.path) == 0 {
+		return nil
 	}
-
-	defer file.Close()
-
-	hash := sha256.New()
-
-	_, err = io.Copy(hash, file)
-	if err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	return os.Remove(i.path)
 }
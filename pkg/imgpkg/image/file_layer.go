@@ -32,3 +32,25 @@ func (ul *UncompressedFileLayer) Uncompressed() (io.ReadCloser, error) {
 func (ul *UncompressedFileLayer) MediaType() (regtypes.MediaType, error) {
 	return ul.mediaType, nil
 }
+
+// RawFileLayer stores file contents as is (without tar or compression),
+// as commonly done for OCI artifacts
+type RawFileLayer struct {
+	digest    regv1.Hash
+	size      int64
+	mediaType regtypes.MediaType
+	path      string
+}
+
+var _ regv1.Layer = (*RawFileLayer)(nil)
+
+func (l *RawFileLayer) Digest() (regv1.Hash, error) { return l.digest, nil }
+func (l *RawFileLayer) DiffID() (regv1.Hash, error) { return l.digest, nil }
+func (l *RawFileLayer) Size() (int64, error)        { return l.size, nil }
+
+func (l *RawFileLayer) Compressed() (io.ReadCloser, error)   { return os.Open(l.path) }
+func (l *RawFileLayer) Uncompressed() (io.ReadCloser, error) { return os.Open(l.path) }
+
+func (l *RawFileLayer) MediaType() (regtypes.MediaType, error) {
+	return l.mediaType, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CheckFreeSpace errors if filesystem holding given path (which may not exist yet)
+// has less than required bytes available; check is skipped on unsupported platforms
+func CheckFreeSpace(path string, required int64) error {
+	existingPath, err := nearestExistingPath(path)
+	if err != nil {
+		return err
+	}
+
+	available, supported, err := availableDiskSpace(existingPath)
+	if err != nil {
+		return fmt.Errorf("Checking free space at '%s': %s", existingPath, err)
+	}
+
+	if supported && available < required {
+		return fmt.Errorf("Expected at least %d bytes of free space at '%s' for extraction, but only %d bytes are available",
+			required, existingPath, available)
+	}
+
+	return nil
+}
+
+func nearestExistingPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parentPath := filepath.Dir(path)
+		if parentPath == path {
+			return "", fmt.Errorf("Expected to find existing parent directory of '%s'", path)
+		}
+		path = parentPath
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !linux,!darwin
+
+package image
+
+func availableDiskSpace(path string) (int64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,21 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build linux darwin
+
+package image
+
+import (
+	"syscall"
+)
+
+func availableDiskSpace(path string) (int64, bool, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), true, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build linux darwin
+
+package image_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgpkg-free-space")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Output directory does not need to exist yet
+	outputPath := filepath.Join(dir, "not-yet", "output")
+
+	err = ctlimg.CheckFreeSpace(outputPath, 1)
+	if err != nil {
+		t.Fatalf("Expected small size to fit: %s", err)
+	}
+
+	err = ctlimg.CheckFreeSpace(outputPath, 1<<62)
+	if err == nil {
+		t.Fatalf("Expected huge size to not fit")
+	}
+
+	if !strings.Contains(err.Error(), "free space at '"+dir+"'") {
+		t.Fatalf("Expected error to mention existing parent directory, got: %s", err)
+	}
+}
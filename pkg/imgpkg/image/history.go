@@ -0,0 +1,64 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"time"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// LayerHistory returns history entry describing layer added by imgpkg;
+// creation time is static so that digest does not depend on it
+func LayerHistory(createdBy, comment string) regv1.History {
+	if len(createdBy) == 0 {
+		createdBy = "imgpkg"
+	}
+	return regv1.History{
+		Author:    "imgpkg",
+		CreatedBy: createdBy,
+		Created:   regv1.Time{Time: time.Time{}}, // static
+		Comment:   comment,
+	}
+}
+
+// WithHistory sets history entry of each of last numLayers layers of image
+// (e.g. layers added on top of existing image), keeping history of other layers
+func WithHistory(img regv1.Image, numLayers int, history regv1.History) (regv1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("Getting image config: %s", err)
+	}
+
+	// Empty layer entries (e.g. ENV instructions) do not correspond to layers
+	var layerEntries []int
+	for idx, entry := range cfg.History {
+		if !entry.EmptyLayer {
+			layerEntries = append(layerEntries, idx)
+		}
+	}
+
+	// Images built without history have no entries to update
+	for len(layerEntries) < len(cfg.RootFS.DiffIDs) {
+		cfg.History = append(cfg.History, regv1.History{})
+		layerEntries = append(layerEntries, len(cfg.History)-1)
+	}
+
+	if numLayers > len(layerEntries) {
+		return nil, fmt.Errorf("Expected image to have at least %d layers, but found %d", numLayers, len(layerEntries))
+	}
+
+	for _, idx := range layerEntries[len(layerEntries)-numLayers:] {
+		cfg.History[idx] = history
+	}
+
+	historyImg, err := mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Setting image history: %s", err)
+	}
+
+	return historyImg, nil
+}
@@ -0,0 +1,445 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	regremtran "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	regtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Same as go-containerregistry uses for uploading layers of an image
+	blobUploadConcurrency = 4
+	// Interrupted blob upload is resumed this many times
+	// before whole upload is retried from the beginning
+	blobUploadResumes = 3
+)
+
+// imageUploader writes images and indexes via registry API. Blobs that
+// already exist are skipped and blobs within same registry are mounted,
+// unless force is set (e.g. --force-upload). Interrupted blob uploads
+// are resumed from the offset registry reports for upload session.
+type imageUploader struct {
+	repo  regname.Repository
+	auth  regauthn.Authenticator
+	tran  http.RoundTripper
+	force bool
+}
+
+type pendingBlob struct {
+	regv1.Layer
+	digest regv1.Hash
+}
+
+// uploadedManifest is satisfied by both images and indexes
+type uploadedManifest interface {
+	RawManifest() ([]byte, error)
+	MediaType() (regtypes.MediaType, error)
+}
+
+func (i Registry) newImageUploader(repo regname.Repository) (imageUploader, error) {
+	auth, err := i.keychain.Resolve(repo.Registry)
+	if err != nil {
+		return imageUploader{}, fmt.Errorf("Resolving credentials: %s", err)
+	}
+
+	return imageUploader{repo: repo, auth: auth, tran: i.tran, force: i.forceUpload}, nil
+}
+
+// WriteIndex writes images and indexes within index (skipping ones that
+// already exist in repository) and then index itself with given tag or digest
+func (u imageUploader) WriteIndex(identifier string, idx regv1.ImageIndex) error {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	client, err := u.client([]string{u.repo.Scope(regremtran.PushScope)})
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range manifest.Manifests {
+		exists, err := u.exists(client, "/manifests/"+desc.Digest.String())
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		switch desc.MediaType {
+		case regtypes.OCIImageIndex, regtypes.DockerManifestList:
+			childIdx, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			err = u.WriteIndex(desc.Digest.String(), childIdx)
+			if err != nil {
+				return err
+			}
+
+		case regtypes.OCIManifestSchema1, regtypes.DockerManifestSchema2:
+			img, err := idx.Image(desc.Digest)
+			if err != nil {
+				return err
+			}
+			err = u.WriteImage(desc.Digest.String(), img)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("Expected index entry '%s' to be an image or index, but media type was '%s'", desc.Digest, desc.MediaType)
+		}
+	}
+
+	return u.putManifest(client, identifier, idx)
+}
+
+// WriteImage uploads layers and config blob of image in parallel
+// and then writes its manifest with given tag or digest
+func (u imageUploader) WriteImage(identifier string, img regv1.Image) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+
+	config, err := partial.ConfigLayer(img)
+	if err != nil {
+		return err
+	}
+
+	var blobs []pendingBlob
+	seen := map[regv1.Hash]bool{}
+
+	scopes := []string{u.repo.Scope(regremtran.PushScope)}
+	seenScopes := map[string]bool{}
+
+	for _, layer := range append(layers, config) {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return err
+		}
+		if !mediaType.IsDistributable() {
+			continue
+		}
+
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+
+		blobs = append(blobs, pendingBlob{layer, digest})
+
+		if fromRepo, ok := u.mountRepo(layer); ok {
+			scope := fromRepo.Scope(regremtran.PullScope)
+			if !seenScopes[scope] {
+				seenScopes[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	client, err := u.client(scopes)
+	if err != nil {
+		return err
+	}
+
+	var uploads errgroup.Group
+	throttle := make(chan struct{}, blobUploadConcurrency)
+
+	for _, blob := range blobs {
+		blob := blob // copy
+
+		uploads.Go(func() error {
+			throttle <- struct{}{}
+			defer func() { <-throttle }()
+
+			return u.upload(client, blob)
+		})
+	}
+
+	err = uploads.Wait()
+	if err != nil {
+		return err
+	}
+
+	return u.putManifest(client, identifier, img)
+}
+
+func (u imageUploader) putManifest(client *http.Client, identifier string, manifest uploadedManifest) error {
+	rawManifest, err := manifest.RawManifest()
+	if err != nil {
+		return err
+	}
+
+	mediaType, err := manifest.MediaType()
+	if err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", string(mediaType))
+
+	_, err = u.do(client, http.MethodPut, u.url("/manifests/"+identifier, nil), bytes.NewReader(rawManifest),
+		headers, http.StatusOK, http.StatusCreated, http.StatusAccepted)
+	return err
+}
+
+func (u imageUploader) client(scopes []string) (*http.Client, error) {
+	tran, err := regremtran.New(u.repo.Registry, u.auth, u.tran, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: tran}, nil
+}
+
+// mountRepo returns repository within same registry blob can be mounted from
+func (u imageUploader) mountRepo(layer regv1.Layer) (regname.Repository, bool) {
+	if u.force {
+		return regname.Repository{}, false
+	}
+
+	mountable, ok := layer.(*regremote.MountableLayer)
+	if !ok {
+		return regname.Repository{}, false
+	}
+
+	fromRepo := mountable.Reference.Context()
+	if fromRepo.RegistryStr() != u.repo.RegistryStr() || fromRepo.RepositoryStr() == u.repo.RepositoryStr() {
+		return regname.Repository{}, false
+	}
+
+	return fromRepo, true
+}
+
+func (u imageUploader) upload(client *http.Client, blob pendingBlob) error {
+	if !u.force {
+		exists, err := u.exists(client, "/blobs/"+blob.digest.String())
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	location, mounted, err := u.initiate(client, blob)
+	if err != nil || mounted {
+		return err
+	}
+
+	location, err = u.send(client, location, blob)
+	if err != nil {
+		return err
+	}
+
+	return u.commit(client, location, blob.digest)
+}
+
+// exists checks whether blob or manifest (e.g. '/blobs/sha256:...') is in repository
+func (u imageUploader) exists(client *http.Client, path string) (bool, error) {
+	resp, err := u.do(client, http.MethodHead, u.url(path, nil), nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// initiate starts upload session or mounts blob from another repository
+func (u imageUploader) initiate(client *http.Client, blob pendingBlob) (string, bool, error) {
+	query := url.Values{}
+	if fromRepo, ok := u.mountRepo(blob.Layer); ok {
+		query.Set("mount", blob.digest.String())
+		query.Set("from", fromRepo.RepositoryStr())
+	}
+
+	resp, err := u.do(client, http.MethodPost, u.url("/blobs/uploads/", query), nil, nil, http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return "", false, err
+	}
+
+	if resp.StatusCode == http.StatusCreated {
+		return "", true, nil
+	}
+
+	location, err := nextLocation(resp)
+	return location, false, err
+}
+
+// send uploads blob contents; if upload is interrupted (e.g. dropped connection),
+// it continues from the offset registry has received so far
+func (u imageUploader) send(client *http.Client, location string, blob pendingBlob) (string, error) {
+	var offset int64
+	var resumed bool
+
+	for attempt := 0; ; attempt++ {
+		nextLocation, err := u.patch(client, location, blob, offset, resumed)
+		if err == nil {
+			return nextLocation, nil
+		}
+		if attempt == blobUploadResumes {
+			return "", err
+		}
+
+		var statusErr error
+
+		location, offset, statusErr = u.status(client, location)
+		if statusErr != nil {
+			// Registry may not support querying upload status, in which
+			// case whole upload is retried by the caller
+			return "", err
+		}
+
+		resumed = true
+	}
+}
+
+func (u imageUploader) patch(client *http.Client, location string, blob pendingBlob, offset int64, resumed bool) (string, error) {
+	contents, err := blob.Compressed()
+	if err != nil {
+		return "", err
+	}
+
+	defer contents.Close()
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/octet-stream")
+
+	// Continuing upload session requires range of contents being sent
+	if resumed {
+		size, err := blob.Size()
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.CopyN(ioutil.Discard, contents, offset)
+		if err != nil {
+			return "", fmt.Errorf("Skipping %d uploaded bytes: %s", offset, err)
+		}
+
+		headers.Set("Content-Range", fmt.Sprintf("%d-%d", offset, size-1))
+	}
+
+	resp, err := u.do(client, http.MethodPatch, location, contents, headers, http.StatusNoContent, http.StatusAccepted, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+
+	return nextLocation(resp)
+}
+
+// status returns location and offset to continue upload session from
+func (u imageUploader) status(client *http.Client, location string) (string, int64, error) {
+	resp, err := u.do(client, http.MethodGet, location, nil, nil, http.StatusNoContent)
+	if err != nil {
+		return "", 0, err
+	}
+
+	nextLocation, err := nextLocation(resp)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Range is inclusive (e.g. '0-0' when first byte was received)
+	// and not reported when nothing was received yet
+	uploadedRange := resp.Header.Get("Range")
+	if len(uploadedRange) == 0 {
+		return nextLocation, 0, nil
+	}
+
+	var start, end int64
+
+	_, err = fmt.Sscanf(uploadedRange, "%d-%d", &start, &end)
+	if err != nil {
+		return "", 0, fmt.Errorf("Parsing upload status range: %s", err)
+	}
+
+	return nextLocation, end + 1, nil
+}
+
+func (u imageUploader) commit(client *http.Client, location string, digest regv1.Hash) error {
+	commitURL, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+
+	query := commitURL.Query()
+	query.Set("digest", digest.String())
+	commitURL.RawQuery = query.Encode()
+
+	_, err = u.do(client, http.MethodPut, commitURL.String(), nil, nil, http.StatusCreated)
+	return err
+}
+
+func (u imageUploader) url(path string, query url.Values) string {
+	repoURL := url.URL{
+		Scheme:   u.repo.Registry.Scheme(),
+		Host:     u.repo.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s%s", u.repo.RepositoryStr(), path),
+		RawQuery: query.Encode(),
+	}
+	return repoURL.String()
+}
+
+func (u imageUploader) do(client *http.Client, method, location string, body io.Reader,
+	headers http.Header, expectedCodes ...int) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, location, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range headers {
+		req.Header.Set(name, headers.Get(name))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	err = regremtran.CheckError(resp, expectedCodes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// nextLocation resolves Location header (possibly just a path) against request URL
+func nextLocation(resp *http.Response) (string, error) {
+	location := resp.Header.Get("Location")
+	if len(location) == 0 {
+		return "", fmt.Errorf("Expected upload response to include Location header")
+	}
+
+	locationURL, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Request.URL.ResolveReference(locationURL).String(), nil
+}
@@ -28,14 +28,38 @@ func NewImages(ref regname.Reference, metadata ImagesMetadata) Images {
 	return Images{ref: ref, metadata: errImagesMetadata{metadata}}
 }
 
+// PlatformImage is an image with platform recorded
+// in its index descriptor (nil when image is not within index)
+type PlatformImage struct {
+	regv1.Image
+	Platform *regv1.Platform
+}
+
 func (tds Images) Images() ([]regv1.Image, error) {
-	desc, err := tds.metadata.Generic(tds.ref)
+	platformImgs, err := tds.PlatformImages()
 	if err != nil {
 		return nil, err
 	}
 
 	var result []regv1.Image
 
+	for _, img := range platformImgs {
+		result = append(result, img.Image)
+	}
+
+	return result, nil
+}
+
+// PlatformImages returns images together with platforms recorded in index
+// (image config does not include e.g. variant)
+func (tds Images) PlatformImages() ([]PlatformImage, error) {
+	desc, err := tds.metadata.Generic(tds.ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []PlatformImage
+
 	if tds.isImageIndex(desc) {
 		imgs, err := tds.buildImageIndex(tds.ref, desc)
 		if err != nil {
@@ -47,13 +71,13 @@ func (tds Images) Images() ([]regv1.Image, error) {
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, img)
+		result = append(result, PlatformImage{Image: img})
 	}
 
 	return result, nil
 }
 
-func (tds Images) buildImageIndex(ref regname.Reference, desc regv1.Descriptor) ([]regv1.Image, error) {
+func (tds Images) buildImageIndex(ref regname.Reference, desc regv1.Descriptor) ([]PlatformImage, error) {
 	imgIndex, err := tds.metadata.Index(ref)
 	if err != nil {
 		return nil, err
@@ -64,7 +88,7 @@ func (tds Images) buildImageIndex(ref regname.Reference, desc regv1.Descriptor)
 		return nil, err
 	}
 
-	var result []regv1.Image
+	var result []PlatformImage
 
 	for _, manDesc := range imgIndexManifest.Manifests {
 		if tds.isImageIndex(manDesc) {
@@ -78,7 +102,7 @@ func (tds Images) buildImageIndex(ref regname.Reference, desc regv1.Descriptor)
 			if err != nil {
 				return nil, err
 			}
-			result = append(result, img)
+			result = append(result, PlatformImage{Image: img, Platform: manDesc.Platform})
 		}
 	}
 
@@ -127,7 +151,12 @@ func (m errImagesMetadata) Image(ref regname.Reference) (regv1.Image, error) {
 func (m errImagesMetadata) betterErr(ref regname.Reference, err error) error {
 	if err != nil {
 		if strings.Contains(err.Error(), string(regtran.ManifestUnknownErrorCode)) {
-			err = fmt.Errorf("Encountered an error most likely because this image is in Docker Registry v1 format; only v2 or OCI image format is supported (underlying error: %s)", err)
+			if digestRef, ok := ref.(regname.Digest); ok {
+				// Missing digest is much more likely than v1 format
+				err = fmt.Errorf("Expected to find manifest with digest '%s' in '%s' (underlying error: %s)", digestRef.DigestStr(), digestRef.Context().Name(), err)
+			} else {
+				err = fmt.Errorf("Encountered an error most likely because this image is in Docker Registry v1 format; only v2 or OCI image format is supported (underlying error: %s)", err)
+			}
 		}
 		err = fmt.Errorf("Working with %s: %s", ref.Name(), err)
 	}
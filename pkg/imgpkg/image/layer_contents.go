@@ -0,0 +1,36 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"io"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	regtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// IsUncompressedLayer returns whether layer blob is stored as plain tar
+func IsUncompressedLayer(mediaType regtypes.MediaType) bool {
+	switch mediaType {
+	case regtypes.DockerUncompressedLayer, regtypes.OCIUncompressedLayer, regtypes.OCIUncompressedRestrictedLayer:
+		return true
+	default:
+		return false
+	}
+}
+
+// UncompressedContents returns tar stream of layer. Remote layers always
+// gunzip their blobs, hence uncompressed layers are read as is
+func UncompressedContents(layer regv1.Layer) (io.ReadCloser, error) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	if IsUncompressedLayer(mediaType) {
+		return layer.Compressed()
+	}
+
+	return layer.Uncompressed()
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"io"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerTar streams uncompressed contents of single layer image as tar
+// (e.g. into a pipe) without buffering it on disk
+type LayerTar struct {
+	img regv1.Image
+}
+
+func NewLayerTar(img regv1.Image) *LayerTar {
+	return &LayerTar{img}
+}
+
+func (t *LayerTar) Write(writer io.Writer) error {
+	layers, err := t.img.Layers()
+	if err != nil {
+		return err
+	}
+
+	if len(layers) != 1 {
+		return fmt.Errorf("Expected image to have exactly one layer to write as tar, but found %d", len(layers))
+	}
+
+	contents, err := UncompressedContents(layers[0])
+	if err != nil {
+		return err
+	}
+
+	defer contents.Close()
+
+	_, err = io.Copy(writer, contents)
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayersDir writes each uncompressed image layer as a separate tar file
+// named by its diff ID (e.g. sha256-<hex>.tar) instead of merging layers
+type LayersDir struct {
+	dirPath string
+	img     regv1.Image
+	logger  Logger
+}
+
+func NewLayersDir(dirPath string, img regv1.Image, logger Logger) *LayersDir {
+	return &LayersDir{dirPath, img, logger}
+}
+
+func (d *LayersDir) Write() error {
+	layers, err := d.img.Layers()
+	if err != nil {
+		return err
+	}
+
+	for idx, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return err
+		}
+
+		fileName := LayerFileName(diffID)
+
+		d.logger.BeginLinef("Writing layer '%s' (%d/%d) to '%s'\n", diffID, idx+1, len(layers), fileName)
+
+		err = d.writeFile(filepath.Join(d.dirPath, fileName), layer)
+		if err != nil {
+			return fmt.Errorf("Writing layer '%s': %s", diffID, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *LayersDir) writeFile(path string, layer regv1.Layer) error {
+	contents, err := UncompressedContents(layer)
+	if err != nil {
+		return err
+	}
+
+	defer contents.Close()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, contents)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// LayerFileName avoids ':' in file names since it's not allowed on some filesystems
+func LayerFileName(diffID regv1.Hash) string {
+	return diffID.Algorithm + "-" + diffID.Hex + ".tar"
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is read only filesystem with image contents; names are
+// slash separated paths relative to image root ("." is root directory)
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	// ReadDir returns directory entries sorted by name
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// memFS is in-memory FS keyed by paths relative to its root
+type memFS struct {
+	files map[string]*memFile
+}
+
+var _ FS = memFS{}
+var _ whiteoutFS = memFS{}
+
+func newMemFS() memFS {
+	return memFS{files: map[string]*memFile{".": {name: ".", mode: os.ModeDir | 0755}}}
+}
+
+func (m memFS) Stat(name string) (os.FileInfo, error) {
+	return m.file("stat", name)
+}
+
+func (m memFS) ReadFile(name string) ([]byte, error) {
+	file, err := m.file("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if file.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return append([]byte{}, file.data...), nil
+}
+
+func (m memFS) ReadDir(name string) ([]os.FileInfo, error) {
+	file, err := m.file("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return m.children(name), nil
+}
+
+func (m memFS) file(op, name string) (*memFile, error) {
+	file, found := m.files[path.Clean(name)]
+	if !found {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return file, nil
+}
+
+func (m memFS) children(dir string) []os.FileInfo {
+	var entries []os.FileInfo
+	for filePath, file := range m.files {
+		if filePath != "." && path.Dir(filePath) == dir {
+			entries = append(entries, file)
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Name() < entries[b].Name() })
+	return entries
+}
+
+// mkdirAll adds directory and its missing parents
+func (m memFS) mkdirAll(dir string, mode os.FileMode, modTime time.Time) {
+	for ; dir != "."; dir = path.Dir(dir) {
+		if existing, found := m.files[dir]; found && existing.IsDir() {
+			return
+		}
+		m.files[dir] = &memFile{name: path.Base(dir), mode: os.ModeDir | mode, modTime: modTime}
+	}
+}
+
+func (m memFS) ReadDirNames(dir string) ([]string, error) {
+	var names []string
+	for _, entry := range m.children(dir) {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+func (m memFS) RemoveAll(name string) error {
+	m.removeAll(name)
+	return nil
+}
+
+// removeAll removes file or directory with all of its contents
+func (m memFS) removeAll(name string) {
+	for filePath := range m.files {
+		if filePath != "." && (filePath == name || strings.HasPrefix(filePath, name+"/")) {
+			delete(m.files, filePath)
+		}
+	}
+}
+
+func (m memFS) Join(elem ...string) string { return path.Join(elem...) }
+
+type memFile struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+var _ os.FileInfo = &memFile{}
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() os.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() interface{}   { return nil }
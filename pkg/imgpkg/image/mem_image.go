@@ -0,0 +1,141 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// MemImage merges image layers into read only in-memory filesystem
+// (following same whiteout semantics as DirImage) instead of writing to disk
+type MemImage struct {
+	img regv1.Image
+}
+
+func NewMemImage(img regv1.Image) *MemImage {
+	return &MemImage{img}
+}
+
+// PullAsFS pulls image or bundle (first image of an index)
+// and returns its contents without writing them to disk
+func PullAsFS(ref regname.Reference, metadata ImagesMetadata) (FS, error) {
+	imgs, err := NewImages(ref, metadata).Images()
+	if err != nil {
+		return nil, fmt.Errorf("Collecting images: %s", err)
+	}
+
+	if len(imgs) == 0 {
+		return nil, fmt.Errorf("Expected to find at least one image, but found none")
+	}
+
+	return NewMemImage(imgs[0]).AsFS()
+}
+
+func (i *MemImage) AsFS() (FS, error) {
+	layers, err := i.img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	memFS := newMemFS()
+
+	for _, imgLayer := range layers {
+		layerStream, err := UncompressedContents(imgLayer)
+		if err != nil {
+			return nil, err
+		}
+
+		err = i.addLayer(memFS, layerStream)
+		layerStream.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return memFS, nil
+}
+
+func (i *MemImage) addLayer(memFS memFS, stream io.Reader) error {
+	tarReader := tar.NewReader(stream)
+
+	// Paths added by this layer are not affected by its opaque whiteouts
+	layerPaths := map[string]bool{}
+
+	for {
+		hdr, err := tarReader.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("Expected tar entry '%s' to be within image root", hdr.Name)
+		}
+
+		dir, base := path.Dir(name), path.Base(name)
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			err := applyWhiteout(memFS, dir, base, layerPaths)
+			if err != nil {
+				return fmt.Errorf("Applying whiteout '%s': %s", hdr.Name, err)
+			}
+			continue
+		}
+
+		if name == "." {
+			continue
+		}
+
+		for p := name; p != "."; p = path.Dir(p) {
+			layerPaths[p] = true
+		}
+
+		memFS.mkdirAll(dir, 0755, hdr.ModTime)
+
+		mode := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if existing, found := memFS.files[name]; found && !existing.IsDir() {
+				memFS.removeAll(name)
+			}
+			memFS.mkdirAll(name, mode, hdr.ModTime)
+
+		case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+			data, err := ioutil.ReadAll(tarReader)
+			if err != nil {
+				return err
+			}
+			memFS.removeAll(name)
+			memFS.files[name] = &memFile{name: base, mode: mode, modTime: hdr.ModTime, data: data}
+
+		case tar.TypeSymlink:
+			// Symlinks are not followed; contents are link target
+			memFS.removeAll(name)
+			memFS.files[name] = &memFile{name: base, mode: os.ModeSymlink | mode, modTime: hdr.ModTime, data: []byte(hdr.Linkname)}
+
+		case tar.TypeLink:
+			target, found := memFS.files[path.Clean(strings.TrimPrefix(hdr.Linkname, "/"))]
+			if !found || target.IsDir() {
+				return fmt.Errorf("Expected hard link '%s' to point to existing file '%s'", hdr.Name, hdr.Linkname)
+			}
+			memFS.removeAll(name)
+			memFS.files[name] = &memFile{name: base, mode: target.mode, modTime: target.modTime, data: target.data}
+		}
+	}
+
+	return nil
+}
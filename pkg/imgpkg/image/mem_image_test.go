@@ -0,0 +1,118 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestPullAsFSReadsMergedLayersFromMemory(t *testing.T) {
+	lowerImg := buildTarEntriesImage(t, []tarEntry{
+		{Name: ".imgpkg", Typeflag: tar.TypeDir},
+		{Name: ".imgpkg/images.yml", Content: "images"},
+		{Name: "config", Typeflag: tar.TypeDir},
+		{Name: "config/removed.yml", Content: "removed"},
+		{Name: "config/app.yml", Content: "old"},
+	})
+	defer lowerImg.Remove()
+
+	upperImg := buildTarEntriesImage(t, []tarEntry{
+		{Name: "config/.wh.removed.yml"},
+		{Name: "config/app.yml", Content: "new"},
+		{Name: "nested/dir/file.yml", Content: "nested"},
+	})
+	defer upperImg.Remove()
+
+	upperLayers, err := upperImg.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	img, err := mutate.AppendLayers(lowerImg, upperLayers...)
+	if err != nil {
+		t.Fatalf("Appending layers: %s", err)
+	}
+
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://") + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(ref, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	fsys, err := ctlimg.PullAsFS(ref, reg)
+	if err != nil {
+		t.Fatalf("Expected pull to succeed: %s", err)
+	}
+
+	expectedFiles := map[string]string{
+		".imgpkg/images.yml":  "images",
+		"config/app.yml":      "new",
+		"nested/dir/file.yml": "nested",
+	}
+
+	for path, expectedContents := range expectedFiles {
+		contents, err := fsys.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Reading '%s': %s", path, err)
+		}
+		if string(contents) != expectedContents {
+			t.Fatalf("Expected '%s' to contain '%s', got '%s'", path, expectedContents, contents)
+		}
+	}
+
+	allPaths := []string{"."}
+
+	err = walkFS(fsys, ".", &allPaths)
+	if err != nil {
+		t.Fatalf("Walking filesystem: %s", err)
+	}
+
+	expectedPaths := ". .imgpkg .imgpkg/images.yml config config/app.yml nested nested/dir nested/dir/file.yml"
+	if strings.Join(allPaths, " ") != expectedPaths {
+		t.Fatalf("Expected filesystem to contain '%s', but was '%s'", expectedPaths, strings.Join(allPaths, " "))
+	}
+}
+
+func walkFS(fsys ctlimg.FS, dir string, paths *[]string) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dir, entry.Name())
+		*paths = append(*paths, entryPath)
+
+		if entry.IsDir() {
+			err := walkFS(fsys, entryPath, paths)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// offlineTransport refuses every request (see RegistryOpts.Offline);
+// registry operations check offline mode upfront, however images returned
+// by them fetch blobs lazily, hence requests are refused here as well
+type offlineTransport struct{}
+
+var _ http.RoundTripper = offlineTransport{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("Expected no network access in offline mode, but request to '%s' was attempted", req.URL.Host)
+}
+
+func offlineErr() error {
+	return fmt.Errorf("Expected no network access in offline mode, but operation requires registry access")
+}
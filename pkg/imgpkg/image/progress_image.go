@@ -0,0 +1,156 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// LayerProgress describes how many bytes of layer were transferred
+// (e.g. read from source and written to destination registry)
+type LayerProgress struct {
+	Digest      regv1.Hash
+	Transferred int64
+	Total       int64
+}
+
+// Progress is reported at most this often per layer (and once done)
+const layerProgressInterval = 1 * time.Second
+
+// NewProgressImage returns image whose layers report progress
+// as their contents are read (e.g. while being uploaded)
+func NewProgressImage(img regv1.Image, reportFunc func(LayerProgress)) regv1.Image {
+	return progressImage{img, reportFunc}
+}
+
+// NewProgressIndex returns index whose images report progress of their layers
+func NewProgressIndex(idx regv1.ImageIndex, reportFunc func(LayerProgress)) regv1.ImageIndex {
+	return progressIndex{idx, reportFunc}
+}
+
+type progressImage struct {
+	regv1.Image
+	reportFunc func(LayerProgress)
+}
+
+func (i progressImage) Layers() ([]regv1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var progressLayers []regv1.Layer
+	for _, layer := range layers {
+		progressLayers = append(progressLayers, i.wrapLayer(layer))
+	}
+
+	return progressLayers, nil
+}
+
+func (i progressImage) LayerByDigest(digest regv1.Hash) (regv1.Layer, error) {
+	layer, err := i.Image.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	return i.wrapLayer(layer), nil
+}
+
+func (i progressImage) wrapLayer(layer regv1.Layer) regv1.Layer {
+	// Keep layers mountable so that blobs within same registry are still mounted
+	if mountable, ok := layer.(*regremote.MountableLayer); ok {
+		return &regremote.MountableLayer{Layer: progressLayer{mountable.Layer, i.reportFunc}, Reference: mountable.Reference}
+	}
+	return progressLayer{layer, i.reportFunc}
+}
+
+type progressIndex struct {
+	imageIndex
+	reportFunc func(LayerProgress)
+}
+
+// imageIndex avoids field name colliding with ImageIndex method
+type imageIndex = regv1.ImageIndex
+
+func (i progressIndex) Image(digest regv1.Hash) (regv1.Image, error) {
+	img, err := i.imageIndex.Image(digest)
+	if err != nil {
+		return nil, err
+	}
+	return NewProgressImage(img, i.reportFunc), nil
+}
+
+func (i progressIndex) ImageIndex(digest regv1.Hash) (regv1.ImageIndex, error) {
+	idx, err := i.imageIndex.ImageIndex(digest)
+	if err != nil {
+		return nil, err
+	}
+	return NewProgressIndex(idx, i.reportFunc), nil
+}
+
+type progressLayer struct {
+	regv1.Layer
+	reportFunc func(LayerProgress)
+}
+
+func (l progressLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := l.Layer.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+
+	return &progressReadCloser{
+		ReadCloser: stream,
+		progress:   LayerProgress{Digest: digest, Total: size},
+		reportFunc: l.reportFunc,
+	}, nil
+}
+
+type progressReadCloser struct {
+	io.ReadCloser
+	progress   LayerProgress
+	reportFunc func(LayerProgress)
+
+	lock         sync.Mutex
+	lastReported time.Time
+	done         bool
+}
+
+func (r *progressReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.progress.Transferred += int64(n)
+
+	if r.done {
+		return n, err
+	}
+
+	switch {
+	case err == io.EOF || r.progress.Transferred == r.progress.Total:
+		r.done = true
+		r.reportFunc(r.progress)
+	case time.Since(r.lastReported) >= layerProgressInterval:
+		r.lastReported = time.Now()
+		r.reportFunc(r.progress)
+	}
+
+	return n, err
+}
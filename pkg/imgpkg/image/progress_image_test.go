@@ -0,0 +1,89 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestProgressImageReportsTransferredLayerBytes(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	img, err := random.Image(64*1024, 3)
+	if err != nil {
+		t.Fatalf("Building image: %s", err)
+	}
+
+	var progressLock sync.Mutex
+	progress := map[regv1.Hash]ctlimg.LayerProgress{}
+
+	progressImg := ctlimg.NewProgressImage(img, func(p ctlimg.LayerProgress) {
+		progressLock.Lock()
+		defer progressLock.Unlock()
+		progress[p.Digest] = p
+	})
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://") + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = reg.WriteImage(ref, progressImg)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	if len(progress) != len(layers) {
+		t.Fatalf("Expected progress for each of %d layers, got %d", len(layers), len(progress))
+	}
+
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+
+		size, err := layer.Size()
+		if err != nil {
+			t.Fatalf("Getting size: %s", err)
+		}
+
+		p := progress[digest]
+		if p.Total != size || p.Transferred != size {
+			t.Fatalf("Expected layer '%s' to report %d/%d bytes, got %d/%d", digest, size, size, p.Transferred, p.Total)
+		}
+	}
+
+	// Existing blobs are not transferred again
+	progress = map[regv1.Hash]ctlimg.LayerProgress{}
+
+	err = reg.WriteImage(ref, progressImg)
+	if err != nil {
+		t.Fatalf("Writing image again: %s", err)
+	}
+
+	if len(progress) != 0 {
+		t.Fatalf("Expected no progress for existing layers, got %d", len(progress))
+	}
+}
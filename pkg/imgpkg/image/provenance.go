@@ -0,0 +1,123 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"time"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// ProvenanceMediaType is used for statement layer and as artifact type of attestation
+	ProvenanceMediaType types.MediaType = "application/vnd.in-toto+json"
+
+	provenancePredicateType = "https://slsa.dev/provenance/v0.2"
+	provenanceBuildType     = "https://carvel.dev/imgpkg/push@v1"
+)
+
+type Provenance struct {
+	ToolVersion string
+	// Inputs are paths of pushed files and directories
+	Inputs     []string
+	FinishedAt time.Time
+}
+
+// provenanceStatement is a minimal in-toto statement with SLSA provenance predicate
+type provenanceStatement struct {
+	Type          string              `json:"_type"`
+	PredicateType string              `json:"predicateType"`
+	Subject       []provenanceSubject `json:"subject"`
+	Predicate     provenancePredicate `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type provenancePredicate struct {
+	Builder   provenanceBuilder    `json:"builder"`
+	BuildType string               `json:"buildType"`
+	Metadata  provenanceMetadata   `json:"metadata"`
+	Materials []provenanceMaterial `json:"materials"`
+}
+
+type provenanceBuilder struct {
+	ID string `json:"id"`
+}
+
+type provenanceMetadata struct {
+	BuildFinishedOn string `json:"buildFinishedOn"`
+}
+
+type provenanceMaterial struct {
+	URI string `json:"uri"`
+}
+
+// NewProvenanceImage returns attestation artifact describing how subject was pushed;
+// it refers to subject so that it can be discovered as its referrer
+func NewProvenanceImage(subjectName string, subject regv1.Descriptor, prov Provenance) (regv1.Image, error) {
+	statement := provenanceStatement{
+		Type:          inTotoStatementTypeV01,
+		PredicateType: provenancePredicateType,
+		Subject: []provenanceSubject{{
+			Name:   subjectName,
+			Digest: map[string]string{subject.Digest.Algorithm: subject.Digest.Hex},
+		}},
+		Predicate: provenancePredicate{
+			Builder:   provenanceBuilder{ID: "imgpkg@" + prov.ToolVersion},
+			BuildType: provenanceBuildType,
+			Metadata:  provenanceMetadata{BuildFinishedOn: prov.FinishedAt.UTC().Format(time.RFC3339)},
+			Materials: []provenanceMaterial{},
+		},
+	}
+
+	for _, input := range prov.Inputs {
+		statement.Predicate.Materials = append(statement.Predicate.Materials, provenanceMaterial{URI: input})
+	}
+
+	contents, err := json.Marshal(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, _, err := regv1.SHA256(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer: &provenanceLayer{contents, digest},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newSubjectImage(img, subject, ProvenanceMediaType)
+}
+
+// provenanceLayer stores statement as is (not as tar)
+type provenanceLayer struct {
+	contents []byte
+	digest   regv1.Hash
+}
+
+var _ regv1.Layer = &provenanceLayer{}
+
+func (l *provenanceLayer) Digest() (regv1.Hash, error)         { return l.digest, nil }
+func (l *provenanceLayer) DiffID() (regv1.Hash, error)         { return l.digest, nil }
+func (l *provenanceLayer) Size() (int64, error)                { return int64(len(l.contents)), nil }
+func (l *provenanceLayer) Compressed() (io.ReadCloser, error)  { return l.Uncompressed() }
+func (l *provenanceLayer) MediaType() (types.MediaType, error) { return ProvenanceMediaType, nil }
+func (l *provenanceLayer) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.contents)), nil
+}
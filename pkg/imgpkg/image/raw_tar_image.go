@@ -0,0 +1,113 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// RawTarImage uses provided tar (optionally gzip compressed) as image's only layer.
+// Compressed input is decompressed so that resulting layer is compressed
+// the same way as other imgpkg layers (i.e. same input contents produce same digest).
+type RawTarImage struct {
+	path string
+}
+
+func NewRawTarImage(path string) *RawTarImage {
+	return &RawTarImage{path}
+}
+
+func (i *RawTarImage) AsFileImage() (*FileImage, error) {
+	tmpFile, err := ioutil.TempFile("", "imgpkg-raw-tar-image")
+	if err != nil {
+		return nil, err
+	}
+
+	defer tmpFile.Close()
+
+	err = i.copyUncompressed(tmpFile)
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return nil, err
+	}
+
+	fileImg, err := NewFileImage(tmpFile.Name(), false)
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return nil, err
+	}
+
+	return fileImg, nil
+}
+
+func (i *RawTarImage) copyUncompressed(dst *os.File) error {
+	var src io.Reader = os.Stdin
+
+	if i.path != "-" {
+		file, err := os.Open(i.path)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		src = file
+	}
+
+	bufSrc := bufio.NewReader(src)
+
+	magic, err := bufSrc.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("Reading raw tar: %s", err)
+	}
+
+	src = bufSrc
+
+	if len(magic) == len(gzipMagic) && magic[0] == gzipMagic[0] && magic[1] == gzipMagic[1] {
+		gzipReader, err := gzip.NewReader(bufSrc)
+		if err != nil {
+			return fmt.Errorf("Decompressing raw tar: %s", err)
+		}
+
+		defer gzipReader.Close()
+
+		src = gzipReader
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("Copying raw tar: %s", err)
+	}
+
+	return i.validateTar(dst.Name())
+}
+
+func (i *RawTarImage) validateTar(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	tarReader := tar.NewReader(file)
+
+	for {
+		_, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Expected raw tar '%s' to be a tar file (optionally gzip compressed): %s", i.path, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestRawTarImagePlainAndGzippedProduceSameImage(t *testing.T) {
+	var tarBuf bytes.Buffer
+
+	tarWriter := tar.NewWriter(&tarBuf)
+	err := tarWriter.WriteHeader(&tar.Header{Name: "config.yml", Mode: 0600, Size: 7, Typeflag: tar.TypeReg})
+	if err != nil {
+		t.Fatalf("Writing tar header: %s", err)
+	}
+
+	_, err = tarWriter.Write([]byte("content"))
+	if err != nil {
+		t.Fatalf("Writing tar content: %s", err)
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		t.Fatalf("Closing tar: %s", err)
+	}
+
+	var gzipBuf bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&gzipBuf)
+
+	_, err = gzipWriter.Write(tarBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Writing gzip content: %s", err)
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		t.Fatalf("Closing gzip: %s", err)
+	}
+
+	inputDir, err := ioutil.TempDir("", "imgpkg-raw-tar-input")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	tarPath := filepath.Join(inputDir, "input.tar")
+	tgzPath := filepath.Join(inputDir, "input.tgz")
+
+	err = ioutil.WriteFile(tarPath, tarBuf.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("Writing tar file: %s", err)
+	}
+
+	err = ioutil.WriteFile(tgzPath, gzipBuf.Bytes(), 0600)
+	if err != nil {
+		t.Fatalf("Writing gzip file: %s", err)
+	}
+
+	var digests []string
+
+	for _, path := range []string{tarPath, tgzPath} {
+		img, err := ctlimg.NewRawTarImage(path).AsFileImage()
+		if err != nil {
+			t.Fatalf("Expected raw tar '%s' to be used: %s", path, err)
+		}
+
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Getting digest: %s", err)
+		}
+		digests = append(digests, digest.String())
+
+		outputDir := filepath.Join(inputDir, "output-"+filepath.Base(path))
+
+		err = ctlimg.NewDirImage(outputDir, img, ctlimg.DirImageOpts{}, noopLogger{}).AsDirectory()
+		img.Remove()
+		if err != nil {
+			t.Fatalf("Extracting image: %s", err)
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, "config.yml"))
+		if err != nil || string(contents) != "content" {
+			t.Fatalf("Expected extracted file to match tar contents, got: '%s' (err: %v)", contents, err)
+		}
+	}
+
+	if digests[0] != digests[1] {
+		t.Fatalf("Expected plain and gzipped tar to produce same digest, got: %v", digests)
+	}
+
+	// input files must not be removed together with temp image
+	for _, path := range []string{tarPath, tgzPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("Expected input '%s' to be kept: %s", path, err)
+		}
+	}
+}
+
+func TestRawTarImageNotTar(t *testing.T) {
+	inputFile, err := ioutil.TempFile("", "imgpkg-raw-tar-input")
+	if err != nil {
+		t.Fatalf("Creating input file: %s", err)
+	}
+	defer os.Remove(inputFile.Name())
+
+	_, err = inputFile.Write(bytes.Repeat([]byte("not a tar"), 100))
+	if err != nil {
+		t.Fatalf("Writing input file: %s", err)
+	}
+
+	err = inputFile.Close()
+	if err != nil {
+		t.Fatalf("Closing input file: %s", err)
+	}
+
+	_, err = ctlimg.NewRawTarImage(inputFile.Name()).AsFileImage()
+	if err == nil {
+		t.Fatalf("Expected non tar input to err")
+	}
+
+	if !strings.Contains(err.Error(), "to be a tar file") {
+		t.Fatalf("Expected error about tar format, got: %s", err)
+	}
+}
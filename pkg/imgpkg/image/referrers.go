@@ -0,0 +1,248 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	regremtran "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// subjectManifest adds subject field (OCI referrers API)
+// which is not part of regv1.Manifest
+type subjectManifest struct {
+	regv1.Manifest
+	Subject *regv1.Descriptor `json:"subject,omitempty"`
+}
+
+// ociImage is an image with OCI manifest (optionally) referring to its subject
+type ociImage struct {
+	regv1.Image
+	rawManifest []byte
+}
+
+var _ regv1.Image = &ociImage{}
+
+// NewSubjectImage returns image with manifest that has subject field set.
+// Manifest is converted to OCI media types since Docker manifests do not support subject
+func NewSubjectImage(img regv1.Image, subject regv1.Descriptor) (regv1.Image, error) {
+	return newOCIImage(img, &subject, "")
+}
+
+// NewOCIImage returns image with manifest and config converted to OCI media types
+// (e.g. so that OCI layers are not mixed with Docker manifest)
+func NewOCIImage(img regv1.Image) (regv1.Image, error) {
+	return newOCIImage(img, nil, "")
+}
+
+// newSubjectImage additionally overrides config media type when set
+// since it is used as artifact type of referrers (e.g. attestations)
+func newSubjectImage(img regv1.Image, subject regv1.Descriptor, configMediaType types.MediaType) (regv1.Image, error) {
+	return newOCIImage(img, &subject, configMediaType)
+}
+
+func newOCIImage(img regv1.Image, subject *regv1.Descriptor, configMediaType types.MediaType) (regv1.Image, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	ociManifest := *manifest
+	ociManifest.MediaType = types.OCIManifestSchema1
+	ociManifest.Config.MediaType = ociMediaType(manifest.Config.MediaType)
+
+	if configMediaType != "" {
+		ociManifest.Config.MediaType = configMediaType
+	}
+	ociManifest.Layers = nil
+
+	for _, layer := range manifest.Layers {
+		layer.MediaType = ociMediaType(layer.MediaType)
+		ociManifest.Layers = append(ociManifest.Layers, layer)
+	}
+
+	rawManifest, err := json.Marshal(subjectManifest{ociManifest, subject})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ociImage{img, rawManifest}, nil
+}
+
+func (i *ociImage) MediaType() (types.MediaType, error) { return types.OCIManifestSchema1, nil }
+func (i *ociImage) RawManifest() ([]byte, error)        { return i.rawManifest, nil }
+func (i *ociImage) Size() (int64, error)                { return int64(len(i.rawManifest)), nil }
+
+func (i *ociImage) Digest() (regv1.Hash, error) {
+	digest, _, err := regv1.SHA256(bytes.NewReader(i.rawManifest))
+	return digest, err
+}
+
+func (i *ociImage) Manifest() (*regv1.Manifest, error) {
+	var manifest regv1.Manifest
+	err := json.Unmarshal(i.rawManifest, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func ociMediaType(mediaType types.MediaType) types.MediaType {
+	switch mediaType {
+	case types.DockerConfigJSON:
+		return types.OCIConfigJSON
+	case types.DockerLayer:
+		return types.OCILayer
+	case types.DockerUncompressedLayer:
+		return types.OCIUncompressedLayer
+	default:
+		return mediaType
+	}
+}
+
+// referrerDescriptor adds artifactType field
+// which is not part of regv1.Descriptor
+type referrerDescriptor struct {
+	regv1.Descriptor
+	ArtifactType types.MediaType `json:"artifactType,omitempty"`
+}
+
+type referrersIndexManifest struct {
+	SchemaVersion int64                `json:"schemaVersion"`
+	MediaType     types.MediaType      `json:"mediaType"`
+	Manifests     []referrerDescriptor `json:"manifests"`
+}
+
+// referrersIndex is written as is; referrers it lists already exist in repository
+type referrersIndex struct {
+	rawManifest []byte
+}
+
+var _ regv1.ImageIndex = referrersIndex{}
+
+func (i referrersIndex) MediaType() (types.MediaType, error) { return types.OCIImageIndex, nil }
+func (i referrersIndex) RawManifest() ([]byte, error)        { return i.rawManifest, nil }
+func (i referrersIndex) Size() (int64, error)                { return int64(len(i.rawManifest)), nil }
+
+func (i referrersIndex) Digest() (regv1.Hash, error) {
+	digest, _, err := regv1.SHA256(bytes.NewReader(i.rawManifest))
+	return digest, err
+}
+
+func (i referrersIndex) IndexManifest() (*regv1.IndexManifest, error) {
+	var manifest regv1.IndexManifest
+	err := json.Unmarshal(i.rawManifest, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (i referrersIndex) Image(digest regv1.Hash) (regv1.Image, error) {
+	return nil, fmt.Errorf("Expected referrer '%s' to already exist in repository", digest)
+}
+
+func (i referrersIndex) ImageIndex(digest regv1.Hash) (regv1.ImageIndex, error) {
+	return nil, fmt.Errorf("Expected referrer '%s' to already exist in repository", digest)
+}
+
+// ReferrersTag returns tag used by OCI referrers tag schema for given subject (e.g. sha256-<hex>)
+func ReferrersTag(subject regname.Digest) (regname.Tag, error) {
+	digest, err := regv1.NewHash(subject.DigestStr())
+	if err != nil {
+		return regname.Tag{}, err
+	}
+	return subject.Context().Tag(digest.Algorithm + "-" + digest.Hex), nil
+}
+
+// AddReferrer lists already pushed referrer in referrers tag of its subject
+// (OCI referrers tag schema used with registries without referrers API)
+func (i Registry) AddReferrer(subject regname.Digest, referrer regv1.Image) error {
+	tag, err := ReferrersTag(subject)
+	if err != nil {
+		return err
+	}
+
+	index := referrersIndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex}
+
+	existingIdx, err := i.Index(tag)
+	switch {
+	case err == nil:
+		existingManifest, err := existingIdx.RawManifest()
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(existingManifest, &index)
+		if err != nil {
+			return fmt.Errorf("Parsing referrers index '%s': %s", tag.Name(), err)
+		}
+	case !isNotFoundErr(err):
+		return fmt.Errorf("Fetching referrers index '%s': %s", tag.Name(), err)
+	}
+
+	desc, err := referrerDesc(referrer)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range index.Manifests {
+		if existing.Digest == desc.Digest {
+			return nil
+		}
+	}
+
+	index.Manifests = append(index.Manifests, desc)
+
+	rawManifest, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return i.WriteIndex(tag, referrersIndex{rawManifest})
+}
+
+func referrerDesc(referrer regv1.Image) (referrerDescriptor, error) {
+	mediaType, err := referrer.MediaType()
+	if err != nil {
+		return referrerDescriptor{}, err
+	}
+
+	digest, err := referrer.Digest()
+	if err != nil {
+		return referrerDescriptor{}, err
+	}
+
+	size, err := referrer.Size()
+	if err != nil {
+		return referrerDescriptor{}, err
+	}
+
+	manifest, err := referrer.Manifest()
+	if err != nil {
+		return referrerDescriptor{}, err
+	}
+
+	return referrerDescriptor{
+		Descriptor: regv1.Descriptor{
+			MediaType:   mediaType,
+			Size:        size,
+			Digest:      digest,
+			Annotations: manifest.Annotations,
+		},
+		// Image manifests without artifactType are typed by their config
+		ArtifactType: manifest.Config.MediaType,
+	}, nil
+}
+
+func isNotFoundErr(err error) bool {
+	var tranErr *regremtran.Error
+	return errors.As(err, &tranErr) && tranErr.StatusCode == http.StatusNotFound
+}
@@ -4,8 +4,10 @@
 package image
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -28,30 +30,134 @@ type RegistryOpts struct {
 	Password string
 	Token    string
 	Anon     bool
+
+	// AnonFallback retries read operations anonymously
+	// when configured credentials are rejected
+	AnonFallback bool
+
+	// ForceUpload uploads blobs even if they already exist in destination
+	ForceUpload bool
+
+	// Keychain selects cloud provider keychain (e.g. ecr)
+	// used when no credentials are configured explicitly
+	Keychain string
+
+	// DockerConfigPath is docker config file (e.g. /tmp/config.json) used
+	// instead of $DOCKER_CONFIG/config.json for credentials, including
+	// credential helpers (credHelpers, credsStore)
+	DockerConfigPath string
+
+	UserAgent string
+
+	// RetryStatusCodes lists response status codes for which
+	// requests are retried honoring Retry-After header (defaults to 429, 503)
+	RetryStatusCodes []int
+
+	// MaxIdleConns bounds idle (keep-alive) connections kept open,
+	// including to a single registry host (defaults to 100)
+	MaxIdleConns int
+	// IdleConnTimeout closes idle connections after duration (defaults to 90s)
+	IdleConnTimeout time.Duration
+
+	// ExtraScopes are requested in addition to computed scopes when obtaining
+	// tokens (format: repository:<repo>:pull,push), e.g. for cross repository mounts
+	ExtraScopes []string
+
+	// MaxConcurrentUploads bounds number of upload requests
+	// in flight across all images (0 means no limit)
+	MaxConcurrentUploads int
+
+	// MaxBandwidth bounds combined upload and download rate
+	// in bytes per second (0 means no limit)
+	MaxBandwidth int64
+
+	// Transport replaces HTTP transport built from options above
+	// (CA certs, cert verification, idle connections) when set,
+	// e.g. to go through a proxy with custom auth flow or to record requests;
+	// retries, User-Agent and other request handling still apply on top of it
+	Transport http.RoundTripper
+
+	// Offline makes every operation fail immediately instead of
+	// reaching registries (credentials are not resolved either)
+	Offline bool
 }
 
 type Registry struct {
-	opts    []regremote.Option
-	refOpts []regname.Option
+	opts     []regremote.Option
+	anonOpts []regremote.Option
+	refOpts  []regname.Option
+
+	// refreshAuth retries operations rejected due to expired
+	// short lived credentials (keychain is resolved again per operation)
+	refreshAuth bool
+
+	// keychain and tran are used for writing images via registry API
+	// (forceUpload skips existence checks and mounts)
+	keychain    regauthn.Keychain
+	tran        http.RoundTripper
+	forceUpload bool
+
+	offline bool
 }
 
 func NewRegistry(opts RegistryOpts) (Registry, error) {
-	httpTran, err := newHTTPTransport(opts)
+	httpTran, err := NewBaseTransport(opts)
 	if err != nil {
 		return Registry{}, err
 	}
 
+	// Credential helpers and cloud keychains may reach network themselves
+	var keychain regauthn.Keychain = regauthn.NewMultiKeychain()
+	if !opts.Offline {
+		keychain, err = registryKeychain(opts)
+		if err != nil {
+			return Registry{}, err
+		}
+	}
+
+	// Custom transports must not set Authorization header themselves:
+	// go-containerregistry only sets it for requests to registry host,
+	// so it is not forwarded on redirects (e.g. to blob storage)
+	var baseTran http.RoundTripper = httpTran
+	if opts.MaxBandwidth > 0 {
+		baseTran = newBandwidthTransport(baseTran, opts.MaxBandwidth)
+	}
+	baseTran = newRetryAfterTransport(baseTran, opts.RetryStatusCodes)
+	if len(opts.UserAgent) > 0 {
+		baseTran = userAgentTransport{baseTran, opts.UserAgent}
+	}
+	if len(opts.ExtraScopes) > 0 {
+		baseTran = scopesTransport{baseTran, opts.ExtraScopes}
+	}
+	if opts.MaxConcurrentUploads > 0 {
+		baseTran = newUploadThrottleTransport(baseTran, opts.MaxConcurrentUploads)
+	}
+
 	var refOpts []regname.Option
 	if opts.Insecure {
 		refOpts = append(refOpts, regname.Insecure)
 	}
 
+	var anonOpts []regremote.Option
+	if opts.AnonFallback {
+		anonOpts = []regremote.Option{
+			regremote.WithTransport(baseTran),
+			regremote.WithAuth(regauthn.Anonymous),
+		}
+	}
+
 	return Registry{
 		opts: []regremote.Option{
-			regremote.WithTransport(httpTran),
-			regremote.WithAuthFromKeychain(registryKeychain(opts)),
+			regremote.WithTransport(baseTran),
+			regremote.WithAuthFromKeychain(keychain),
 		},
-		refOpts: refOpts,
+		anonOpts:    anonOpts,
+		refOpts:     refOpts,
+		refreshAuth: len(opts.Keychain) > 0,
+		keychain:    keychain,
+		tran:        baseTran,
+		forceUpload: opts.ForceUpload,
+		offline:     opts.Offline,
 	}, nil
 }
 
@@ -60,7 +166,13 @@ func (i Registry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
 	if err != nil {
 		return regv1.Descriptor{}, err
 	}
-	desc, err := regremote.Get(overriddenRef, i.opts...)
+
+	var desc *regremote.Descriptor
+	err = i.withAnonFallback(func(opts []regremote.Option) error {
+		var getErr error
+		desc, getErr = regremote.Get(overriddenRef, opts...)
+		return getErr
+	})
 	if err != nil {
 		return regv1.Descriptor{}, err
 	}
@@ -74,7 +186,13 @@ func (i Registry) Image(ref regname.Reference) (regv1.Image, error) {
 		return nil, err
 	}
 
-	return regremote.Image(overriddenRef, i.opts...)
+	var img regv1.Image
+	err = i.withAnonFallback(func(opts []regremote.Option) error {
+		var imgErr error
+		img, imgErr = regremote.Image(overriddenRef, opts...)
+		return imgErr
+	})
+	return img, err
 }
 
 func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
@@ -84,7 +202,11 @@ func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
 	}
 
 	err = i.retry(func() error {
-		return regremote.Write(overriddenRef, img, i.opts...)
+		uploader, err := i.newImageUploader(overriddenRef.Context())
+		if err != nil {
+			return err
+		}
+		return uploader.WriteImage(overriddenRef.Identifier(), img)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image: %s", err)
@@ -98,7 +220,14 @@ func (i Registry) Index(ref regname.Reference) (regv1.ImageIndex, error) {
 	if err != nil {
 		return nil, err
 	}
-	return regremote.Index(overriddenRef, i.opts...)
+
+	var idx regv1.ImageIndex
+	err = i.withAnonFallback(func(opts []regremote.Option) error {
+		var idxErr error
+		idx, idxErr = regremote.Index(overriddenRef, opts...)
+		return idxErr
+	})
+	return idx, err
 }
 
 func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error {
@@ -108,7 +237,11 @@ func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error
 	}
 
 	err = i.retry(func() error {
-		return regremote.WriteIndex(overriddenRef, idx, i.opts...)
+		uploader, err := i.newImageUploader(overriddenRef.Context())
+		if err != nil {
+			return err
+		}
+		return uploader.WriteIndex(overriddenRef.Identifier(), idx)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image index: %s", err)
@@ -122,11 +255,87 @@ func (i Registry) ListTags(repo regname.Repository) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return regremote.List(overriddenRepo, i.opts...)
+
+	var tags []string
+	err = i.withAnonFallback(func(opts []regremote.Option) error {
+		var listErr error
+		tags, listErr = regremote.List(overriddenRepo, opts...)
+		return listErr
+	})
+	return tags, err
 }
 
-func registryKeychain(opts RegistryOpts) regauthn.Keychain {
-	return customRegistryKeychain{opts}
+// DeleteTag removes tag from repository (registry needs to support deleting
+// manifests by tag; manifest itself is left to registry garbage collection)
+func (i Registry) DeleteTag(tag regname.Tag) error {
+	if i.offline {
+		return offlineErr()
+	}
+
+	overriddenRef, err := regname.ParseReference(tag.String(), i.refOpts...)
+	if err != nil {
+		return err
+	}
+
+	return i.withAuthRefresh(func() error {
+		return regremote.Delete(overriddenRef, i.opts...)
+	})
+}
+
+// ListRepositories returns names of all repositories within registry
+// (relies on catalog API which is not supported by all registries)
+func (i Registry) ListRepositories(reg regname.Registry) ([]string, error) {
+	overriddenReg, err := regname.NewRegistry(reg.Name(), i.refOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []string
+	err = i.withAnonFallback(func(opts []regremote.Option) error {
+		var listErr error
+		repos, listErr = regremote.Catalog(context.Background(), overriddenReg, opts...)
+		return listErr
+	})
+	if err != nil {
+		var tranErr *regremtran.Error
+		if errors.As(err, &tranErr) && (tranErr.StatusCode == http.StatusNotFound || tranErr.StatusCode == http.StatusMethodNotAllowed) {
+			return nil, fmt.Errorf("Registry '%s' does not support listing repositories (catalog API): %s", reg.Name(), err)
+		}
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func registryKeychain(opts RegistryOpts) (regauthn.Keychain, error) {
+	keychain := customRegistryKeychain{opts: opts, dockerKeychain: regauthn.DefaultKeychain}
+
+	if len(opts.DockerConfigPath) > 0 {
+		keychain.dockerKeychain = dockerConfigKeychain{opts.DockerConfigPath}
+	}
+
+	if len(opts.Keychain) > 0 {
+		cloudKeychain, err := cloudKeychain(opts.Keychain)
+		if err != nil {
+			return nil, err
+		}
+		keychain.cloudKeychain = cloudKeychain
+	}
+
+	return keychain, nil
+}
+
+// NewBaseTransport returns transport configured by opts (CA certificates,
+// certificate verification, proxy, custom or offline transport) without
+// registry specific behavior, e.g. for reaching other services like Rekor
+func NewBaseTransport(opts RegistryOpts) (http.RoundTripper, error) {
+	if opts.Offline {
+		return offlineTransport{}, nil
+	}
+	if opts.Transport != nil {
+		return opts.Transport, nil
+	}
+	return newHTTPTransport(opts)
 }
 
 func newHTTPTransport(opts RegistryOpts) (*http.Transport, error) {
@@ -145,6 +354,18 @@ func newHTTPTransport(opts RegistryOpts) (*http.Transport, error) {
 		}
 	}
 
+	// Most operations talk to one registry host, so allow it to use
+	// all idle connections (default of 2 per host causes connection churn)
+	maxIdleConns := 100
+	if opts.MaxIdleConns > 0 {
+		maxIdleConns = opts.MaxIdleConns
+	}
+
+	idleConnTimeout := 90 * time.Second
+	if opts.IdleConnTimeout > 0 {
+		idleConnTimeout = opts.IdleConnTimeout
+	}
+
 	// Copied from https://github.com/golang/go/blob/release-branch.go1.12/src/net/http/transport.go#L42-L53
 	// We want to use the DefaultTransport but change its TLSClientConfig. There
 	// isn't a clean way to do this yet: https://github.com/golang/go/issues/26013
@@ -155,8 +376,9 @@ func newHTTPTransport(opts RegistryOpts) (*http.Transport, error) {
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		IdleConnTimeout:       idleConnTimeout,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ResponseHeaderTimeout: 10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
@@ -169,10 +391,14 @@ func newHTTPTransport(opts RegistryOpts) (*http.Transport, error) {
 }
 
 func (i Registry) retry(doFunc func() error) error {
+	if i.offline {
+		return offlineErr()
+	}
+
 	var lastErr error
 
-	for i := 0; i < 5; i++ {
-		lastErr = doFunc()
+	for attempt := 0; attempt < 5; attempt++ {
+		lastErr = i.withAuthRefresh(doFunc)
 		if lastErr == nil {
 			return nil
 		}
@@ -190,8 +416,58 @@ func (i Registry) retry(doFunc func() error) error {
 	return fmt.Errorf("Retried 5 times: %s", lastErr)
 }
 
+// withAnonFallback is only meant for read operations since
+// anonymous writes are not expected to succeed
+func (i Registry) withAnonFallback(doFunc func([]regremote.Option) error) error {
+	if i.offline {
+		return offlineErr()
+	}
+
+	err := i.withAuthRefresh(func() error { return doFunc(i.opts) })
+	if err == nil || len(i.anonOpts) == 0 || !isAuthErr(err) {
+		return err
+	}
+
+	anonErr := doFunc(i.anonOpts)
+	if anonErr != nil {
+		// Prefer original error as it's more relevant to configured credentials
+		return err
+	}
+
+	return nil
+}
+
+func (i Registry) withAuthRefresh(doFunc func() error) error {
+	err := doFunc()
+	if err == nil || !i.refreshAuth || !isAuthErr(err) {
+		return err
+	}
+	return doFunc()
+}
+
+func isAuthErr(err error) bool {
+	var tranErr *regremtran.Error
+	if !errors.As(err, &tranErr) {
+		return false
+	}
+
+	if tranErr.StatusCode == http.StatusUnauthorized || tranErr.StatusCode == http.StatusForbidden {
+		return true
+	}
+
+	for _, diag := range tranErr.Errors {
+		if diag.Code == regremtran.UnauthorizedErrorCode || diag.Code == regremtran.DeniedErrorCode {
+			return true
+		}
+	}
+
+	return false
+}
+
 type customRegistryKeychain struct {
-	opts RegistryOpts
+	opts           RegistryOpts
+	cloudKeychain  regauthn.Keychain
+	dockerKeychain regauthn.Keychain
 }
 
 func (k customRegistryKeychain) Resolve(res regauthn.Resource) (regauthn.Authenticator, error) {
@@ -202,7 +478,14 @@ func (k customRegistryKeychain) Resolve(res regauthn.Resource) (regauthn.Authent
 		return &regauthn.Bearer{Token: k.opts.Token}, nil
 	case k.opts.Anon:
 		return regauthn.Anonymous, nil
+	case k.cloudKeychain != nil:
+		auth, err := k.cloudKeychain.Resolve(res)
+		if err != nil || auth != regauthn.Anonymous {
+			return auth, err
+		}
+		// Registry is not handled by cloud keychain
+		return k.dockerKeychain.Resolve(res)
 	default:
-		return regauthn.DefaultKeychain.Resolve(res)
+		return k.dockerKeychain.Resolve(res)
 	}
 }
@@ -0,0 +1,181 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// expiringKeychain hands out expired token first, and fresh one afterwards
+type expiringKeychain struct {
+	resolved *int
+}
+
+func (k expiringKeychain) Resolve(regauthn.Resource) (regauthn.Authenticator, error) {
+	*k.resolved++
+	if *k.resolved == 1 {
+		return &regauthn.Basic{Username: "AWS", Password: "expired"}, nil
+	}
+	return &regauthn.Basic{Username: "AWS", Password: "fresh"}, nil
+}
+
+func TestRegistryKeychainRefreshesRejectedCredentials(t *testing.T) {
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if r.URL.Path == "/v2/" || !ok || user != "AWS" || pass != "fresh" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var resolved int
+	cloudKeychains["mock"] = func() regauthn.Keychain { return expiringKeychain{&resolved} }
+	defer delete(cloudKeychains, "mock")
+
+	reg, err := NewRegistry(RegistryOpts{Keychain: "mock"})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://") + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = reg.WriteImage(ref, img)
+	if err != nil {
+		t.Fatalf("Expected write to succeed after refreshing credentials: %s", err)
+	}
+
+	_, err = reg.Generic(ref)
+	if err != nil {
+		t.Fatalf("Expected read to succeed: %s", err)
+	}
+
+	if resolved < 2 {
+		t.Fatalf("Expected keychain to be resolved again after rejection, resolved %d times", resolved)
+	}
+}
+
+func TestRegistryUnknownKeychain(t *testing.T) {
+	_, err := NewRegistry(RegistryOpts{Keychain: "unknown"})
+	if err == nil || !strings.Contains(err.Error(), "Unknown registry keychain 'unknown' (supported: acr, ecr, gcr)") {
+		t.Fatalf("Expected unknown keychain error, got: %v", err)
+	}
+}
+
+func TestRegistryDockerConfigUsesCredentialHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake credential helper is a shell script")
+	}
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "helper-user" || pass != "helper-secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tmpDir, err := ioutil.TempDir("", "imgpkg-docker-config")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Helper records requested server and returns static credentials
+	helper := `#!/bin/sh
+cat > "` + filepath.Join(tmpDir, "requested") + `"
+echo '{"ServerURL":"","Username":"helper-user","Secret":"helper-secret"}'
+`
+
+	err = ioutil.WriteFile(filepath.Join(tmpDir, "docker-credential-fake"), []byte(helper), 0700)
+	if err != nil {
+		t.Fatalf("Writing helper: %s", err)
+	}
+
+	configPath := filepath.Join(tmpDir, "custom-config.json")
+
+	err = ioutil.WriteFile(configPath, []byte(`{"credHelpers": {"`+host+`": "fake"}}`), 0600)
+	if err != nil {
+		t.Fatalf("Writing docker config: %s", err)
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", tmpDir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	reg, err := NewRegistry(RegistryOpts{DockerConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	ref, err := regname.NewTag(host + "/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = reg.WriteImage(ref, img)
+	if err != nil {
+		t.Fatalf("Expected write with helper credentials to succeed: %s", err)
+	}
+
+	requested, err := ioutil.ReadFile(filepath.Join(tmpDir, "requested"))
+	if err != nil {
+		t.Fatalf("Expected credential helper to be invoked: %s", err)
+	}
+
+	if strings.TrimSpace(string(requested)) != host {
+		t.Fatalf("Expected credential helper to be asked for '%s', got '%s'", host, requested)
+	}
+}
+
+func TestRegistryDockerConfigMissingFile(t *testing.T) {
+	reg, err := NewRegistry(RegistryOpts{DockerConfigPath: "/non-existent/config.json"})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	ref, err := regname.NewTag("127.0.0.1:1/repo/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	_, err = reg.Generic(ref)
+	if err == nil || !strings.Contains(err.Error(), "Reading docker config '/non-existent/config.json'") {
+		t.Fatalf("Expected error reading docker config, got: %v", err)
+	}
+}
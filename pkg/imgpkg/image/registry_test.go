@@ -0,0 +1,355 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestRegistryAnonFallbackWithMixedRegistries(t *testing.T) {
+	privateServer := newAuthRegistryServer(func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "user" && pass == "pass"
+	})
+	defer privateServer.Close()
+
+	// Public registry rejects credentials it does not know about
+	publicServer := newAuthRegistryServer(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == ""
+	})
+	defer publicServer.Close()
+
+	privateRef := writeRandomImage(t, privateServer, "private/app", regremote.WithAuth(&regauthn.Basic{Username: "user", Password: "pass"}))
+	publicRef := writeRandomImage(t, publicServer, "public/app", regremote.WithAuth(regauthn.Anonymous))
+
+	opts := ctlimg.RegistryOpts{VerifyCerts: true, Username: "user", Password: "pass"}
+
+	reg, err := ctlimg.NewRegistry(opts)
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	_, err = reg.Generic(publicRef)
+	if err == nil {
+		t.Fatalf("Expected public image to be rejected without anon fallback")
+	}
+
+	opts.AnonFallback = true
+
+	reg, err = ctlimg.NewRegistry(opts)
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	for _, ref := range []regname.Reference{privateRef, publicRef} {
+		_, err = reg.Generic(ref)
+		if err != nil {
+			t.Fatalf("Expected to find '%s': %s", ref.Name(), err)
+		}
+
+		img, err := reg.Image(ref)
+		if err != nil {
+			t.Fatalf("Expected to fetch '%s': %s", ref.Name(), err)
+		}
+
+		layers, err := img.Layers()
+		if err != nil {
+			t.Fatalf("Getting layers: %s", err)
+		}
+
+		_, err = layers[0].Compressed()
+		if err != nil {
+			t.Fatalf("Expected to fetch layer of '%s': %s", ref.Name(), err)
+		}
+	}
+}
+
+func TestRegistryUserAgent(t *testing.T) {
+	var userAgents []string
+
+	regHandler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ref := writeRandomImage(t, server, "repo/app")
+	userAgents = nil
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{VerifyCerts: true, UserAgent: "imgpkg/1.2.3"})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	_, err = reg.Generic(ref)
+	if err != nil {
+		t.Fatalf("Expected to find '%s': %s", ref.Name(), err)
+	}
+
+	if len(userAgents) == 0 {
+		t.Fatalf("Expected registry to receive requests")
+	}
+
+	for _, userAgent := range userAgents {
+		if userAgent != "imgpkg/1.2.3" {
+			t.Fatalf("Expected User-Agent to be 'imgpkg/1.2.3', got: %v", userAgents)
+		}
+	}
+}
+
+func TestRegistryDoesNotForwardAuthOnBlobRedirect(t *testing.T) {
+	regHandler := registry.New()
+
+	var blobAuthHeaders []string
+
+	// Blob storage is served from a different host (sharing registry storage)
+	blobServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blobAuthHeaders = append(blobAuthHeaders, r.Header.Get("Authorization"))
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer blobServer.Close()
+
+	regServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if r.URL.Path == "/v2/" || !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			http.Redirect(w, r, blobServer.URL+r.URL.Path, http.StatusTemporaryRedirect)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer regServer.Close()
+
+	ref := writeRandomImage(t, regServer, "repo/app", regremote.WithAuth(&regauthn.Basic{Username: "user", Password: "pass"}))
+
+	// Custom transports (e.g. user agent) must not reintroduce auth headers
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{VerifyCerts: true, Username: "user", Password: "pass", UserAgent: "imgpkg/test"})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	img, err := reg.Image(ref)
+	if err != nil {
+		t.Fatalf("Expected to fetch '%s': %s", ref.Name(), err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	_, err = layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("Expected to fetch redirected layer: %s", err)
+	}
+
+	if len(blobAuthHeaders) == 0 {
+		t.Fatalf("Expected blob to be fetched from redirected host")
+	}
+
+	for _, header := range blobAuthHeaders {
+		if header != "" {
+			t.Fatalf("Expected Authorization header to not be forwarded to redirected host, got: %s", header)
+		}
+	}
+}
+
+func TestRegistryRequestsExtraScopes(t *testing.T) {
+	var requestedScopes []string
+	var scopesLock sync.Mutex
+
+	regHandler := registry.New()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			scopesLock.Lock()
+			requestedScopes = append(requestedScopes, r.URL.Query()["scope"]...)
+			scopesLock.Unlock()
+
+			w.Write([]byte(`{"token": "test-token"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{VerifyCerts: true, ExtraScopes: []string{"repository:src/app:pull"}})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://") + "/dst/app:latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = reg.WriteImage(ref, img)
+	if err != nil {
+		t.Fatalf("Expected write to succeed: %s", err)
+	}
+
+	scopesLock.Lock()
+	defer scopesLock.Unlock()
+
+	if len(requestedScopes) < 2 || requestedScopes[0] != "repository:dst/app:push,pull" {
+		t.Fatalf("Expected computed push scope to be requested first, got: %v", requestedScopes)
+	}
+
+	var found bool
+	for _, scope := range requestedScopes {
+		if scope == "repository:src/app:pull" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected extra scope to be requested, got: %v", requestedScopes)
+	}
+}
+
+type recordingTransport struct {
+	http.RoundTripper
+
+	lock     sync.Mutex
+	requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path)
+	t.lock.Unlock()
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestRegistryUsesConfiguredTransport(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	ref := writeRandomImage(t, server, "repo/app")
+
+	tran := &recordingTransport{RoundTripper: http.DefaultTransport}
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{VerifyCerts: true, UserAgent: "imgpkg/1.2.3", Transport: tran})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	_, err = reg.Generic(ref)
+	if err != nil {
+		t.Fatalf("Expected to find '%s': %s", ref.Name(), err)
+	}
+
+	expectedReq := "GET /v2/repo/app/manifests/latest"
+	requests := strings.Join(tran.requests, ", ")
+
+	if !strings.Contains(requests, expectedReq) {
+		t.Fatalf("Expected transport to record '%s', but recorded: %s", expectedReq, requests)
+	}
+}
+
+func TestRegistryOfflineFailsFastWithoutRequests(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	ref := writeRandomImage(t, server, "repo/app")
+
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	tran := &recordingTransport{RoundTripper: http.DefaultTransport}
+
+	reg, err := ctlimg.NewRegistry(ctlimg.RegistryOpts{Transport: tran, Offline: true})
+	if err != nil {
+		t.Fatalf("Building registry: %s", err)
+	}
+
+	start := time.Now()
+
+	_, err = reg.Generic(ref)
+	if err == nil || !strings.Contains(err.Error(), "Expected no network access in offline mode") {
+		t.Fatalf("Expected read to fail in offline mode, but was: %v", err)
+	}
+
+	// Writes are otherwise retried with delay
+	err = reg.WriteImage(ref, img)
+	if err == nil || !strings.Contains(err.Error(), "Expected no network access in offline mode") {
+		t.Fatalf("Expected write to fail in offline mode, but was: %v", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Expected offline operations to fail fast, but took %s", time.Since(start))
+	}
+
+	if len(tran.requests) > 0 {
+		t.Fatalf("Expected no requests in offline mode, but recorded: %s", strings.Join(tran.requests, ", "))
+	}
+}
+
+func newAuthRegistryServer(authorized func(*http.Request) bool) *httptest.Server {
+	regHandler := registry.New()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ping always issues a challenge so that clients present credentials
+		if r.URL.Path == "/v2/" || !authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+}
+
+func writeRandomImage(t *testing.T, server *httptest.Server, repo string, opts ...regremote.Option) regname.Reference {
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tag, err := regname.NewTag(host + "/" + repo + ":latest")
+	if err != nil {
+		t.Fatalf("Building tag: %s", err)
+	}
+
+	err = regremote.Write(tag, img, opts...)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	return tag
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHTTPTransportConnectionPooling(t *testing.T) {
+	tran, err := newHTTPTransport(RegistryOpts{MaxIdleConns: 20, IdleConnTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Building transport: %s", err)
+	}
+
+	if tran.MaxIdleConns != 20 || tran.MaxIdleConnsPerHost != 20 {
+		t.Fatalf("Expected 20 idle connections (per host), got %d (%d)", tran.MaxIdleConns, tran.MaxIdleConnsPerHost)
+	}
+	if tran.IdleConnTimeout != 5*time.Second {
+		t.Fatalf("Expected idle timeout 5s, got %s", tran.IdleConnTimeout)
+	}
+
+	tran, err = newHTTPTransport(RegistryOpts{})
+	if err != nil {
+		t.Fatalf("Building transport: %s", err)
+	}
+
+	if tran.MaxIdleConns != 100 || tran.IdleConnTimeout != 90*time.Second {
+		t.Fatalf("Expected default pooling, got %d idle connections and %s timeout", tran.MaxIdleConns, tran.IdleConnTimeout)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RekorIndex searches Rekor transparency log index
+// (https://github.com/sigstore/rekor) for entries by artifact digest
+type RekorIndex struct {
+	url    string
+	client *http.Client
+}
+
+func NewRekorIndex(url string, httpTran http.RoundTripper) RekorIndex {
+	return RekorIndex{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Transport: httpTran, Timeout: 30 * time.Second},
+	}
+}
+
+type rekorIndexQuery struct {
+	Hash string `json:"hash"`
+}
+
+// EntryUUIDs returns UUIDs of log entries recorded for given digest
+func (i RekorIndex) EntryUUIDs(digest regv1.Hash) ([]string, error) {
+	query, err := json.Marshal(rekorIndexQuery{Hash: digest.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := i.client.Post(i.url+"/api/v1/index/retrieve", "application/json", bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("Searching Rekor index: %s", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Reading Rekor index response: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Searching Rekor index: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var uuids []string
+
+	err = json.Unmarshal(body, &uuids)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing Rekor index response: %s", err)
+	}
+
+	return uuids, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RenameTemplate computes output path of extracted entries
+// (e.g. '{{.LayerDigest.Hex}}/{{.Name}}' or '{{trimSuffix .Name ".yml"}}.yaml')
+type RenameTemplate struct {
+	tpl *template.Template
+}
+
+// RenameInput is available to rename template
+type RenameInput struct {
+	// Name is original (cleaned) entry path, e.g. config/app.yml
+	Name string
+	Dir  string
+	Base string
+	Ext  string
+
+	LayerDigest regv1.Hash
+}
+
+var renameTemplateFuncs = template.FuncMap{
+	"trimPrefix": strings.TrimPrefix,
+	"trimSuffix": strings.TrimSuffix,
+	"replace":    func(s, old, new string) string { return strings.Replace(s, old, new, -1) },
+}
+
+func NewRenameTemplate(val string) (*RenameTemplate, error) {
+	tpl, err := template.New("rename").Funcs(renameTemplateFuncs).Option("missingkey=error").Parse(val)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing rename template: %s", err)
+	}
+
+	renameTpl := &RenameTemplate{tpl}
+
+	// Catch references to unknown fields before extraction starts
+	_, err = renameTpl.Rename("config/app.yml", regv1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)})
+	if err != nil {
+		return nil, err
+	}
+
+	return renameTpl, nil
+}
+
+// Rename returns renamed entry path making sure it stays within output directory
+func (t *RenameTemplate) Rename(name string, layerDigest regv1.Hash) (string, error) {
+	name = filepath.Clean(name)
+
+	input := RenameInput{
+		Name:        filepath.ToSlash(name),
+		Dir:         filepath.ToSlash(filepath.Dir(name)),
+		Base:        filepath.Base(name),
+		Ext:         filepath.Ext(name),
+		LayerDigest: layerDigest,
+	}
+
+	var buf bytes.Buffer
+
+	err := t.tpl.Execute(&buf, input)
+	if err != nil {
+		return "", fmt.Errorf("Executing rename template for entry '%s': %s", name, err)
+	}
+
+	renamed := filepath.Clean(filepath.FromSlash(buf.String()))
+
+	if buf.Len() == 0 || renamed == "." || filepath.IsAbs(renamed) ||
+		renamed == ".." || strings.HasPrefix(renamed, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Expected rename template to produce path within output directory for entry '%s', but was '%s'", name, buf.String())
+	}
+
+	return renamed, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestDirImageRenamesEntriesViaTemplate(t *testing.T) {
+	img := buildTarEntriesImage(t, []tarEntry{
+		{Name: "config", Typeflag: tar.TypeDir},
+		{Name: "config/app.yml", Content: "app"},
+		{Name: "README.md", Content: "readme"},
+	})
+	defer img.Remove()
+
+	outputDir, err := ioutil.TempDir("", "imgpkg-dir-image-rename")
+	if err != nil {
+		t.Fatalf("Creating output dir: %s", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	renameTpl, err := ctlimg.NewRenameTemplate(`{{if eq .Ext ".yml"}}{{trimSuffix .Name .Ext}}.yaml{{else}}{{.Name}}{{end}}`)
+	if err != nil {
+		t.Fatalf("Expected template to be valid: %s", err)
+	}
+
+	var writtenFiles []string
+
+	opts := ctlimg.DirImageOpts{
+		RenameTemplate: renameTpl,
+		FileWritten:    func(file ctlimg.ExtractedFile) { writtenFiles = append(writtenFiles, filepath.ToSlash(file.Path)) },
+	}
+
+	err = ctlimg.NewDirImage(outputDir, img, opts, noopLogger{}).AsDirectory()
+	if err != nil {
+		t.Fatalf("Expected extraction to succeed: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "config", "app.yaml"))
+	if err != nil || string(contents) != "app" {
+		t.Fatalf("Expected renamed file to be extracted: %v", err)
+	}
+
+	_, err = os.Stat(filepath.Join(outputDir, "config", "app.yml"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("Expected original name to not be extracted")
+	}
+
+	if strings.Join(writtenFiles, " ") != "config/app.yaml README.md" {
+		t.Fatalf("Expected renamed paths to be reported, but was: %v", writtenFiles)
+	}
+}
+
+func TestRenameTemplateKeepsPathsWithinOutputDir(t *testing.T) {
+	layerDigest := regv1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+
+	renameTpl, err := ctlimg.NewRenameTemplate(`{{if eq .Base "secret.yml"}}../{{.Base}}{{else}}{{.LayerDigest.Hex}}/{{.Name}}{{end}}`)
+	if err != nil {
+		t.Fatalf("Expected template to be valid: %s", err)
+	}
+
+	renamed, err := renameTpl.Rename("config/app.yml", layerDigest)
+	if err != nil {
+		t.Fatalf("Expected rename to succeed: %s", err)
+	}
+
+	if renamed != filepath.Join(layerDigest.Hex, "config", "app.yml") {
+		t.Fatalf("Expected renamed path to be prefixed with layer digest, but was '%s'", renamed)
+	}
+
+	_, err = renameTpl.Rename("config/secret.yml", layerDigest)
+	if err == nil || !strings.Contains(err.Error(), "Expected rename template to produce path within output directory for entry") {
+		t.Fatalf("Expected rename escaping output directory to fail, but was: %v", err)
+	}
+
+	for _, val := range []string{"/{{.Name}}", "{{.Dir}}/../../{{.Base}}", "", "{{.Unknown}}", "{{"} {
+		_, err := ctlimg.NewRenameTemplate(val)
+		if err == nil {
+			t.Fatalf("Expected template '%s' to be rejected", val)
+		}
+	}
+}
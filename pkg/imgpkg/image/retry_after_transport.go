@@ -0,0 +1,128 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	retryAfterMaxAttempts = 5
+	// Longer delays requested by registry are shortened to this one
+	retryAfterMaxDelay = 1 * time.Minute
+)
+
+var defaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+
+// retryAfterTransport retries requests that received one of configured
+// status codes with Retry-After header after waiting requested time.
+// Responses without Retry-After are returned as is (and are subject
+// to operation level retries).
+type retryAfterTransport struct {
+	http.RoundTripper
+	statusCodes map[int]struct{}
+	sleep       func(context.Context, time.Duration) error
+}
+
+func newRetryAfterTransport(tran http.RoundTripper, statusCodes []int) retryAfterTransport {
+	if len(statusCodes) == 0 {
+		statusCodes = defaultRetryStatusCodes
+	}
+
+	codes := map[int]struct{}{}
+	for _, code := range statusCodes {
+		codes[code] = struct{}{}
+	}
+
+	return retryAfterTransport{tran, codes, sleepContext}
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.RoundTripper.RoundTrip(req)
+		if err != nil || attempt == retryAfterMaxAttempts {
+			return resp, err
+		}
+
+		if _, found := t.statusCodes[resp.StatusCode]; !found {
+			return resp, nil
+		}
+
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+
+		// Request body was already consumed, hence it needs to be recreated
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		if delay > retryAfterMaxDelay {
+			delay = retryAfterMaxDelay
+		}
+
+		// Waiting stops as soon as request is canceled
+		err = t.sleep(req.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// parseRetryAfter supports both delay in seconds and HTTP-date formats
+func parseRetryAfter(val string, now time.Time) (time.Duration, bool) {
+	if len(val) == 0 {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(val); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	date, err := http.ParseTime(val)
+	if err != nil {
+		return 0, false
+	}
+
+	delay := date.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay, true
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRetryAfterTransportHonorsRetryAfter(t *testing.T) {
+	var failures int
+	regHandler := registry.New()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/manifests/") && failures < 2 {
+			failures++
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		regHandler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ref, err := regname.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/repo/img:latest")
+	if err != nil {
+		t.Fatalf("Parsing reference: %s", err)
+	}
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("Building image: %s", err)
+	}
+
+	err = regremote.Write(ref, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	var delays []time.Duration
+
+	tran := newRetryAfterTransport(http.DefaultTransport, nil)
+	tran.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	_, err = regremote.Get(ref, regremote.WithTransport(tran))
+	if err != nil {
+		t.Fatalf("Expected request to succeed after retries: %s", err)
+	}
+
+	if len(delays) != 2 || delays[0] != 7*time.Second || delays[1] != 7*time.Second {
+		t.Fatalf("Expected to wait as requested by Retry-After twice, got: %v", delays)
+	}
+}
+
+func TestRetryAfterTransportOnlyRetriesConfiguredCodes(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	for _, codes := range [][]int{nil, {http.StatusBadGateway}} {
+		requests = 0
+
+		tran := newRetryAfterTransport(http.DefaultTransport, codes)
+		tran.sleep = func(context.Context, time.Duration) error { return nil }
+
+		resp, err := (&http.Client{Transport: tran}).Get(server.URL)
+		if err != nil {
+			t.Fatalf("Making request: %s", err)
+		}
+		resp.Body.Close()
+
+		expectedRequests := 1
+		if codes != nil {
+			expectedRequests = retryAfterMaxAttempts
+		}
+
+		if requests != expectedRequests {
+			t.Fatalf("Expected %d requests with retry codes %v, got %d", expectedRequests, codes, requests)
+		}
+	}
+}
+
+func TestRetryAfterTransportCapsDelayAndStopsOnCancel(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+
+	tran := newRetryAfterTransport(http.DefaultTransport, nil)
+	tran.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return sleepContext(ctx, d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("Building request: %s", err)
+	}
+
+	started := time.Now()
+
+	_, err = tran.RoundTrip(req.WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected request to fail once canceled, but was: %v", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Fatalf("Expected waiting to stop on cancel, but took %s", elapsed)
+	}
+
+	if requests != 1 || len(delays) != 1 || delays[0] != retryAfterMaxDelay {
+		t.Fatalf("Expected single wait capped at %s, got %d request(s) and delays %v", retryAfterMaxDelay, requests, delays)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		val      string
+		expected time.Duration
+		ok       bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-30 * time.Second).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, c := range cases {
+		delay, ok := parseRetryAfter(c.val, now)
+		if ok != c.ok || delay != c.expected {
+			t.Fatalf("Expected Retry-After '%s' to be %v (%t), got %v (%t)", c.val, c.expected, c.ok, delay, ok)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// scopesTransport adds scopes to token requests made by bearer auth
+// (computed scopes only include repository that is operated on, which
+// is not enough for some registries to allow cross repository blob mounts)
+type scopesTransport struct {
+	http.RoundTripper
+	scopes []string
+}
+
+func (t scopesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	// https://docs.docker.com/registry/spec/auth/token/
+	case req.Method == http.MethodGet && isTokenRequestParams(req.URL.Query()):
+		query := req.URL.Query()
+		query["scope"] = t.mergeScopes(query["scope"])
+
+		req = req.Clone(req.Context())
+		req.URL.RawQuery = query.Encode()
+
+	// https://docs.docker.com/registry/spec/auth/oauth/
+	case req.Method == http.MethodPost && req.Body != nil &&
+		req.Header.Get("Content-Type") == "application/x-www-form-urlencoded":
+
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err == nil && isTokenRequestParams(form) {
+			form.Set("scope", strings.Join(t.mergeScopes(strings.Fields(form.Get("scope"))), " "))
+			body = []byte(form.Encode())
+		}
+
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// mergeScopes keeps requested scopes first since
+// some registries only look at the first scope
+func (t scopesTransport) mergeScopes(scopes []string) []string {
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		seen[scope] = true
+	}
+
+	result := append([]string{}, scopes...)
+	for _, scope := range t.scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func isTokenRequestParams(params url.Values) bool {
+	_, hasScope := params["scope"]
+	_, hasService := params["service"]
+	return hasScope && hasService
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// SingleFile streams contents of the only file found in image
+// (e.g. a config file) without extracting it to disk
+type SingleFile struct {
+	img      regv1.Image
+	artifact bool
+}
+
+// NewSingleFile returns SingleFile for image with tar layers,
+// or, when artifact is set, for image with a single artifact layer
+func NewSingleFile(img regv1.Image, artifact bool) *SingleFile {
+	return &SingleFile{img, artifact}
+}
+
+func (f *SingleFile) Write(writer io.Writer) error {
+	layers, err := f.img.Layers()
+	if err != nil {
+		return err
+	}
+
+	if f.artifact {
+		if len(layers) != 1 {
+			return fmt.Errorf("Expected artifact image to contain exactly one file, but found %d", len(layers))
+		}
+
+		contents, err := layers[0].Compressed()
+		if err != nil {
+			return err
+		}
+
+		defer contents.Close()
+
+		_, err = io.Copy(writer, contents)
+		return err
+	}
+
+	// Layers are read twice so that nothing is written
+	// unless image contains exactly one file
+	name, layerIdx, err := f.findFile(layers)
+	if err != nil {
+		return err
+	}
+
+	return readLayerEntries(layers[layerIdx], func(hdr *tar.Header, reader io.Reader) (bool, error) {
+		if path.Clean(hdr.Name) != name || !hdr.FileInfo().Mode().IsRegular() {
+			return false, nil
+		}
+		_, err := io.Copy(writer, reader)
+		return true, err
+	})
+}
+
+// findFile returns name of the only regular file in merged layers
+// (taking whiteouts into account) and index of layer that last wrote it
+func (f *SingleFile) findFile(layers []regv1.Layer) (string, int, error) {
+	files := map[string]int{}
+
+	for idx, layer := range layers {
+		err := readLayerEntries(layer, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+			name := path.Clean(hdr.Name)
+			base := path.Base(name)
+
+			switch {
+			case base == whiteoutOpaque:
+				deleteFiles(files, path.Dir(name), false)
+			case strings.HasPrefix(base, whiteoutPrefix):
+				deleteFiles(files, path.Join(path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)), true)
+			case hdr.FileInfo().Mode().IsRegular():
+				files[name] = idx
+			}
+			return false, nil
+		})
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) != 1 {
+		return "", 0, fmt.Errorf("Expected image to contain exactly one file, but found %d (%s)", len(names), strings.Join(names, ", "))
+	}
+
+	return names[0], files[names[0]], nil
+}
+
+// deleteFiles removes files within given path (including path itself when inclusive)
+func deleteFiles(files map[string]int, deletedPath string, inclusive bool) {
+	for name := range files {
+		if (inclusive && name == deletedPath) || deletedPath == "." || strings.HasPrefix(name, deletedPath+"/") {
+			delete(files, name)
+		}
+	}
+}
+
+// readLayerEntries calls entryFunc for each tar entry of layer until it returns true
+func readLayerEntries(layer regv1.Layer, entryFunc func(*tar.Header, io.Reader) (bool, error)) error {
+	contents, err := UncompressedContents(layer)
+	if err != nil {
+		return err
+	}
+
+	defer contents.Close()
+
+	tarReader := tar.NewReader(contents)
+
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		done, err := entryFunc(hdr, tarReader)
+		if err != nil || done {
+			return err
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Uncompressed layer sizes are not recorded in the manifest,
+// hence extracted size of compressed layers is approximated using typical gzip ratio
+const estimatedCompressionRatio = 3
+
+type SizeEstimate struct {
+	DownloadSize  int64
+	ExtractedSize int64
+}
+
+// EstimateSize only relies on image manifest (no layer blobs are fetched)
+func EstimateSize(img regv1.Image) (SizeEstimate, error) {
+	manifest, err := img.Manifest()
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+
+	var estimate SizeEstimate
+
+	for _, layer := range manifest.Layers {
+		estimate.DownloadSize += layer.Size
+
+		if IsUncompressedLayer(layer.MediaType) {
+			estimate.ExtractedSize += layer.Size
+		} else {
+			estimate.ExtractedSize += layer.Size * estimatedCompressionRatio
+		}
+	}
+
+	return estimate, nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestEstimateSizeMatchesManifestLayers(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		t.Fatalf("Getting manifest: %s", err)
+	}
+
+	var expectedSize int64
+	for _, layer := range manifest.Layers {
+		expectedSize += layer.Size
+	}
+
+	estimate, err := ctlimg.EstimateSize(img)
+	if err != nil {
+		t.Fatalf("Expected estimate to succeed: %s", err)
+	}
+
+	if estimate.DownloadSize != expectedSize {
+		t.Fatalf("Expected download size to be %d, but was %d", expectedSize, estimate.DownloadSize)
+	}
+
+	if estimate.ExtractedSize < estimate.DownloadSize {
+		t.Fatalf("Expected extracted size (%d) to be at least download size (%d)", estimate.ExtractedSize, estimate.DownloadSize)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"strings"
+)
+
+// sparseBlockSize is granularity at which holes are detected
+// (matches most common filesystem block size)
+const sparseBlockSize = 4096
+
+// isSparseEntry returns true for entries carrying GNU sparse metadata
+// (either old GNU format or PAX GNU.sparse.* records)
+func isSparseEntry(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSparseFile seeks over zero-filled blocks instead of writing them
+// so that filesystem does not allocate space for holes. Tar reader
+// fills holes of sparse entries with zeros when reading.
+func writeSparseFile(file *os.File, input io.Reader) error {
+	buf := make([]byte, sparseBlockSize)
+
+	var size int64
+
+	for {
+		n, err := io.ReadFull(input, buf)
+		if n > 0 {
+			if isZeroBlock(buf[:n]) {
+				_, err := file.Seek(int64(n), io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+			} else {
+				_, err := file.Write(buf[:n])
+				if err != nil {
+					return err
+				}
+			}
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailing hole is never written, hence extend file to its full size
+	return file.Truncate(size)
+}
+
+func isZeroBlock(block []byte) bool {
+	for _, b := range block {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
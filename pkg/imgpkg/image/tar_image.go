@@ -5,22 +5,96 @@ package image
 
 import (
 	"archive/tar"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	regtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/text/unicode/norm"
 )
 
+type TarImageOpts struct {
+	// MaxFileSize (in bytes) skips larger files when set
+	MaxFileSize int64
+
+	// Prefix is a relative directory path under which all entries are nested
+	Prefix string
+
+	// PreserveMtime records modification time of files instead of
+	// static zero time (makes image digest depend on file mtimes)
+	PreserveMtime bool
+
+	// Mtime is static modification time recorded for entries instead
+	// of zero time (e.g. for extractors rejecting zero time)
+	Mtime time.Time
+
+	// CopyBufferSize (in bytes) is size of buffer used to copy file
+	// contents into tar (defaults to DefaultTarCopyBufferSize)
+	CopyBufferSize int
+
+	// NormalizeUnicode converts entry names to Unicode NFC form
+	// since some filesystems (e.g. on macOS) return decomposed names
+	NormalizeUnicode bool
+
+	// SkipEmptyDirs omits directories that do not contain any
+	// included files (e.g. all of their files are excluded)
+	SkipEmptyDirs bool
+
+	// NoCompression stores layer as plain tar (e.g. for already compressed files)
+	NoCompression bool
+
+	// LayerMediaType overrides media type of layer (e.g. for registries
+	// rejecting OCI media types); expected to match compression of layer
+	LayerMediaType regtypes.MediaType
+
+	// Format forces tar header format (e.g. tar.FormatUSTAR for older extractors);
+	// by default USTAR is used when entry fits, PAX otherwise
+	Format tar.Format
+
+	// ReadAhead bounds number of files read in parallel ahead of being
+	// written into tar; only files not larger than copy buffer are
+	// read ahead (0 or 1 reads serially). Entry order is not affected
+	ReadAhead int
+}
+
+// DefaultTarCopyBufferSize is larger than io.Copy's 32KB buffer
+// to reduce number of writes when packaging large files
+const DefaultTarCopyBufferSize = 1024 * 1024
+
+// TarImageSource describes file or directory added to image
+type TarImageSource struct {
+	Path string
+
+	// Name is a relative path within image for the file or directory
+	// (defaults to file name for files, and image root for directories)
+	Name string
+
+	// ExcludePaths are relative to directory path
+	ExcludePaths []string
+}
+
 type TarImage struct {
-	files        []string
+	sources      []TarImageSource
 	excludePaths []string
+	opts         TarImageOpts
 	infoLog      io.Writer
 }
 
-func NewTarImage(files []string, excludePaths []string, infoLog io.Writer) *TarImage {
-	return &TarImage{files, excludePaths, infoLog}
+func NewTarImage(files []string, excludePaths []string, opts TarImageOpts, infoLog io.Writer) *TarImage {
+	var sources []TarImageSource
+	for _, file := range files {
+		sources = append(sources, TarImageSource{Path: file})
+	}
+	return NewTarImageFromSources(sources, excludePaths, opts, infoLog)
+}
+
+func NewTarImageFromSources(sources []TarImageSource, excludePaths []string, opts TarImageOpts, infoLog io.Writer) *TarImage {
+	return &TarImage{sources, excludePaths, opts, infoLog}
 }
 
 func (i *TarImage) AsFileBundle() (*FileImage, error) {
@@ -31,7 +105,33 @@ func (i *TarImage) AsFileImage() (*FileImage, error) {
 	return i.asFileImage(false)
 }
 
+// AsTarFile writes uncompressed tar (same as contents of image layer) into given path
+func (i *TarImage) AsTarFile(path string) error {
+	err := i.cleanPrefix()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = i.createTarball(file, i.sources)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
 func (i *TarImage) asFileImage(bundle bool) (*FileImage, error) {
+	err := i.cleanPrefix()
+	if err != nil {
+		return nil, err
+	}
+
 	tmpFile, err := ioutil.TempFile("", "imgpkg-tar-image")
 	if err != nil {
 		return nil, err
@@ -39,13 +139,13 @@ func (i *TarImage) asFileImage(bundle bool) (*FileImage, error) {
 
 	defer tmpFile.Close()
 
-	err = i.createTarball(tmpFile, i.files)
+	err = i.createTarball(tmpFile, i.sources)
 	if err != nil {
 		_ = os.Remove(tmpFile.Name())
 		return nil, err
 	}
 
-	fileImg, err := NewFileImage(tmpFile.Name(), bundle)
+	fileImg, err := newFileImage(tmpFile.Name(), bundle, i.layerMediaType())
 	if err != nil {
 		_ = os.Remove(tmpFile.Name())
 		return nil, err
@@ -54,17 +154,86 @@ func (i *TarImage) asFileImage(bundle bool) (*FileImage, error) {
 	return fileImg, nil
 }
 
-func (i *TarImage) createTarball(file *os.File, filePaths []string) error {
+func (i *TarImage) layerMediaType() regtypes.MediaType {
+	switch {
+	case len(i.opts.LayerMediaType) > 0:
+		return i.opts.LayerMediaType
+	case i.opts.NoCompression:
+		return regtypes.DockerUncompressedLayer
+	default:
+		return regtypes.DockerLayer
+	}
+}
+
+func (i *TarImage) cleanPrefix() error {
+	if len(i.opts.Prefix) > 0 {
+		prefix, err := cleanTarPrefix(i.opts.Prefix)
+		if err != nil {
+			return err
+		}
+		i.opts.Prefix = prefix
+	}
+	return nil
+}
+
+func (i *TarImage) createTarball(file *os.File, sources []TarImageSource) error {
 	tarWriter := tar.NewWriter(file)
 	defer tarWriter.Close()
 
-	for _, path := range filePaths {
+	if i.opts.ReadAhead > 1 {
+		entries := newReadAheadTarEntries(i, tarWriter, i.opts.ReadAhead)
+
+		err := i.addSources(sources, entries)
+
+		// Wait for queued entries to be written even if walk failed
+		writeErr := entries.Close()
+		if err == nil {
+			err = writeErr
+		}
+		return err
+	}
+
+	return i.addSources(sources, serialTarEntries{i, tarWriter})
+}
+
+// tarEntries receives entries in order in which they are written into tar
+type tarEntries interface {
+	AddDir(relPath string, info os.FileInfo) error
+	AddFile(fullPath, relPath string, info os.FileInfo) error
+}
+
+type serialTarEntries struct {
+	image     *TarImage
+	tarWriter *tar.Writer
+}
+
+func (e serialTarEntries) AddDir(relPath string, info os.FileInfo) error {
+	return e.image.addDirToTar(relPath, info, e.tarWriter)
+}
+
+func (e serialTarEntries) AddFile(fullPath, relPath string, info os.FileInfo) error {
+	return e.image.addFileToTar(fullPath, relPath, info, e.tarWriter)
+}
+
+func (i *TarImage) addSources(sources []TarImageSource, entries tarEntries) error {
+	for _, source := range sources {
+		path := source.Path
+
 		info, err := os.Stat(path)
 		if err != nil {
 			return err
 		}
 
+		name, err := cleanSourceName(source.Name)
+		if err != nil {
+			return err
+		}
+
+		excludes := newExcludeMatcher(i.excludePaths, source.ExcludePaths)
+
 		if info.IsDir() {
+			dirs := &pendingDirs{}
+
 			// Walk is deterministic according to https://golang.org/pkg/path/filepath/#Walk
 			err := filepath.Walk(path, func(walkedPath string, info os.FileInfo, err error) error {
 				if err != nil {
@@ -74,22 +243,38 @@ func (i *TarImage) createTarball(file *os.File, filePaths []string) error {
 				if err != nil {
 					return err
 				}
-				if info.IsDir() {
-					if i.isExcluded(relPath) {
+				if excludes.Excluded(relPath) {
+					if info.IsDir() && !excludes.HasReincludesWithin(relPath) {
 						return filepath.SkipDir
 					}
-					return i.addDirToTar(relPath, info, tarWriter)
+					return nil
 				}
-				if (info.Mode() & os.ModeType) != 0 {
-					return fmt.Errorf("Expected file '%s' to be a regular file", walkedPath)
+				if info.IsDir() {
+					if i.opts.SkipEmptyDirs {
+						dirs.Add(filepath.Join(name, relPath), info)
+						return nil
+					}
+					return entries.AddDir(filepath.Join(name, relPath), info)
+				}
+				if i.opts.SkipEmptyDirs && !i.exceedsMaxFileSize(info) {
+					err := dirs.WriteAncestors(filepath.Join(name, relPath), entries.AddDir)
+					if err != nil {
+						return err
+					}
 				}
-				return i.addFileToTar(walkedPath, relPath, info, tarWriter)
+				return entries.AddFile(walkedPath, filepath.Join(name, relPath), info)
 			})
 			if err != nil {
 				return fmt.Errorf("Adding file '%s' to tar: %s", path, err)
 			}
 		} else {
-			err := i.addFileToTar(path, filepath.Base(path), info, tarWriter)
+			if len(name) == 0 {
+				name = filepath.Base(path)
+			}
+			if excludes.Excluded(name) {
+				continue
+			}
+			err := entries.AddFile(path, name, info)
 			if err != nil {
 				return err
 			}
@@ -100,59 +285,220 @@ func (i *TarImage) createTarball(file *os.File, filePaths []string) error {
 }
 
 func (i *TarImage) addDirToTar(relPath string, info os.FileInfo, tarWriter *tar.Writer) error {
-	if i.isExcluded(relPath) {
-		panic("Unreachable") // directories excluded above
-	}
-
 	i.infoLog.Write([]byte(fmt.Sprintf("dir: %s\n", relPath)))
 
 	header := &tar.Header{
-		Name:     relPath,
+		Name:     i.entryName(relPath),
 		Size:     info.Size(),
-		Mode:     0700,        // static
-		ModTime:  time.Time{}, // static
+		Mode:     0700,         // static
+		ModTime:  i.opts.Mtime, // static
 		Typeflag: tar.TypeDir,
 	}
 
-	return tarWriter.WriteHeader(header)
+	return i.writeHeader(header, tarWriter)
 }
 
 func (i *TarImage) addFileToTar(fullPath, relPath string, info os.FileInfo, tarWriter *tar.Writer) error {
-	if i.isExcluded(relPath) {
+	return i.addFileContentsToTar(fullPath, relPath, info, nil, tarWriter)
+}
+
+// addFileContentsToTar writes file either from read ahead contents
+// (when given) or by reading it from disk
+func (i *TarImage) addFileContentsToTar(fullPath, relPath string, info os.FileInfo,
+	readAhead <-chan readAheadContents, tarWriter *tar.Writer) error {
+
+	if (info.Mode() & os.ModeType) != 0 {
+		return nonRegularFileErr(fullPath, info.Mode())
+	}
+
+	if i.exceedsMaxFileSize(info) {
+		i.infoLog.Write([]byte(fmt.Sprintf("skipping file: %s (size %d bytes exceeds max file size %d bytes)\n",
+			relPath, info.Size(), i.opts.MaxFileSize)))
 		return nil
 	}
 
 	i.infoLog.Write([]byte(fmt.Sprintf("file: %s\n", relPath)))
 
-	file, err := os.Open(fullPath)
-	if err != nil {
-		return err
-	}
+	var contents io.Reader
+
+	if readAhead != nil {
+		result := <-readAhead
+		if result.Err != nil {
+			return result.Err
+		}
+		contents = bytes.NewReader(result.Data)
+	} else {
+		file, err := os.Open(fullPath)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
 
-	defer file.Close()
+		contents = onlyReader{file}
+	}
 
 	header := &tar.Header{
-		Name:     relPath,
+		Name:     i.entryName(relPath),
 		Size:     info.Size(),
-		Mode:     0600,        // static
-		ModTime:  time.Time{}, // static
+		Mode:     0600,         // static
+		ModTime:  i.opts.Mtime, // static
 		Typeflag: tar.TypeReg,
 	}
 
-	err = tarWriter.WriteHeader(header)
+	if i.opts.PreserveMtime {
+		header.ModTime = info.ModTime()
+	}
+
+	err := i.writeHeader(header, tarWriter)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(tarWriter, file)
+	_, err = io.CopyBuffer(tarWriter, contents, i.copyBuffer(info.Size()))
 	return err
 }
 
-func (i *TarImage) isExcluded(relPath string) bool {
-	for _, path := range i.excludePaths {
-		if path == relPath {
-			return true
+func (i *TarImage) exceedsMaxFileSize(info os.FileInfo) bool {
+	return i.opts.MaxFileSize > 0 && info.Size() > i.opts.MaxFileSize
+}
+
+func (i *TarImage) writeHeader(header *tar.Header, tarWriter *tar.Writer) error {
+	if i.opts.Format == tar.FormatUnknown {
+		return tarWriter.WriteHeader(header)
+	}
+
+	header.Format = i.opts.Format
+
+	err := tarWriter.WriteHeader(header)
+	if err != nil {
+		return fmt.Errorf("Expected entry '%s' to fit %s tar format: %s", header.Name, i.opts.Format, err)
+	}
+
+	return nil
+}
+
+func (i *TarImage) entryName(relPath string) string {
+	return tarEntryName(filepath.Join(i.opts.Prefix, relPath), filepath.Separator, i.opts.NormalizeUnicode)
+}
+
+// tarEntryName converts path to tar entry name which always uses forward slashes
+// (backslashes are only replaced when they are path separators, e.g. on Windows)
+func tarEntryName(path string, separator rune, normalizeUnicode bool) string {
+	if separator != '/' {
+		path = strings.Replace(path, string(separator), "/", -1)
+	}
+	if normalizeUnicode {
+		path = norm.NFC.String(path)
+	}
+	return path
+}
+
+// copyBuffer returns buffer no larger than file itself
+// so that small files do not allocate full buffer
+func (i *TarImage) copyBuffer(fileSize int64) []byte {
+	size := i.copyBufferSize()
+	if fileSize < int64(size) {
+		size = int(fileSize)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return make([]byte, size)
+}
+
+func (i *TarImage) copyBufferSize() int {
+	if i.opts.CopyBufferSize <= 0 {
+		return DefaultTarCopyBufferSize
+	}
+	return i.opts.CopyBufferSize
+}
+
+// onlyReader hides file's WriteTo so that io.CopyBuffer uses given buffer
+type onlyReader struct {
+	io.Reader
+}
+
+func cleanTarPrefix(prefix string) (string, error) {
+	cleanPrefix := filepath.Clean(prefix)
+
+	if filepath.IsAbs(cleanPrefix) || cleanPrefix == "." {
+		return "", fmt.Errorf("Expected tar prefix '%s' to be a relative directory path", prefix)
+	}
+
+	for _, part := range strings.Split(filepath.ToSlash(cleanPrefix), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("Expected tar prefix '%s' to not contain '..'", prefix)
+		}
+	}
+
+	return cleanPrefix, nil
+}
+
+func cleanSourceName(name string) (string, error) {
+	if len(name) == 0 {
+		return "", nil
+	}
+
+	cleanName := filepath.Clean(name)
+	if cleanName == "." {
+		return "", nil
+	}
+
+	if filepath.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Expected name '%s' to be a relative path within image", name)
+	}
+
+	return cleanName, nil
+}
+
+func nonRegularFileErr(path string, mode os.FileMode) error {
+	var fileType string
+
+	switch {
+	case mode&os.ModeSymlink != 0:
+		fileType = "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		fileType = "named pipe (fifo)"
+	case mode&os.ModeSocket != 0:
+		fileType = "socket"
+	case mode&os.ModeCharDevice != 0:
+		fileType = "character device"
+	case mode&os.ModeDevice != 0:
+		fileType = "block device"
+	default:
+		fileType = fmt.Sprintf("non-regular file (mode %s)", mode)
+	}
+
+	return fmt.Errorf("Expected file '%s' to be a regular file, but was a %s", path, fileType)
+}
+
+// pendingDirs holds directories visited by walk whose entries
+// are written only once a file within them is written
+type pendingDirs struct {
+	dirs []pendingDir
+}
+
+type pendingDir struct {
+	path string
+	info os.FileInfo
+}
+
+func (d *pendingDirs) Add(path string, info os.FileInfo) {
+	d.dirs = append(d.dirs, pendingDir{path, info})
+}
+
+// WriteAncestors writes pending ancestors of file path in walk order;
+// other pending directories were fully walked without files, hence are dropped
+func (d *pendingDirs) WriteAncestors(filePath string, writeFunc func(string, os.FileInfo) error) error {
+	for _, dir := range d.dirs {
+		if dir.path == "." || strings.HasPrefix(filePath, dir.path+string(filepath.Separator)) {
+			err := writeFunc(dir.path, dir.info)
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return false
+	d.dirs = nil
+	return nil
 }
@@ -0,0 +1,100 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarImageCopiesFileContentsWithAnyBufferSize(t *testing.T) {
+	path, info := writeTarCopyFile(t, 100*1024+7)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading file: %s", err)
+	}
+
+	for _, bufSize := range []int{0, 1, 4096, 10 * 1024 * 1024} {
+		var out bytes.Buffer
+
+		img := &TarImage{opts: TarImageOpts{CopyBufferSize: bufSize}, infoLog: ioutil.Discard}
+		tarWriter := tar.NewWriter(&out)
+
+		err := img.addFileToTar(path, "file.bin", info, tarWriter)
+		if err != nil {
+			t.Fatalf("Adding file with buffer size %d: %s", bufSize, err)
+		}
+
+		tarWriter.Close()
+
+		tarReader := tar.NewReader(&out)
+		if _, err := tarReader.Next(); err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		contents, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("Reading tar entry: %s", err)
+		}
+
+		if !bytes.Equal(contents, expected) {
+			t.Fatalf("Expected file contents to be copied intact with buffer size %d", bufSize)
+		}
+	}
+}
+
+func BenchmarkTarImageAddLargeFile(b *testing.B) {
+	const fileSize = 64 * 1024 * 1024
+
+	path, info := writeTarCopyFile(b, fileSize)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, bufSize := range []int{32 * 1024, DefaultTarCopyBufferSize, 4 * 1024 * 1024} {
+		b.Run(fmt.Sprintf("buffer-%dKB", bufSize/1024), func(b *testing.B) {
+			b.SetBytes(fileSize)
+
+			img := &TarImage{opts: TarImageOpts{CopyBufferSize: bufSize}, infoLog: ioutil.Discard}
+
+			for n := 0; n < b.N; n++ {
+				err := img.addFileToTar(path, "large.bin", info, tar.NewWriter(ioutil.Discard))
+				if err != nil {
+					b.Fatalf("Adding file: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func writeTarCopyFile(t testing.TB, size int) (string, os.FileInfo) {
+	dir, err := ioutil.TempDir("", "imgpkg-tar-image-copy")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+
+	contents := make([]byte, size)
+	for i := range contents {
+		contents[i] = byte(i % 251)
+	}
+
+	path := filepath.Join(dir, "file.bin")
+
+	err = ioutil.WriteFile(path, contents, 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat file: %s", err)
+	}
+
+	return path, info
+}
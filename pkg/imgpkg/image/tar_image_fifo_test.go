@@ -0,0 +1,53 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// +build !windows
+
+package image_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestTarImageFifoError(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-fifo")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	err = ioutil.WriteFile(filepath.Join(inputDir, "config.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	fifoPath := filepath.Join(inputDir, "pipe")
+
+	err = syscall.Mkfifo(fifoPath, 0600)
+	if err != nil {
+		t.Fatalf("Creating fifo: %s", err)
+	}
+
+	_, err = ctlimg.NewTarImage([]string{inputDir}, nil, ctlimg.TarImageOpts{}, ioutil.Discard).AsFileImage()
+	if err == nil {
+		t.Fatalf("Expected fifo to be rejected")
+	}
+
+	expectedMsg := "Expected file '" + fifoPath + "' to be a regular file, but was a named pipe (fifo)"
+	if !strings.Contains(err.Error(), expectedMsg) {
+		t.Fatalf("Expected error to contain '%s', got: %s", expectedMsg, err)
+	}
+
+	img, err := ctlimg.NewTarImage([]string{inputDir}, []string{"pipe"}, ctlimg.TarImageOpts{}, ioutil.Discard).AsFileImage()
+	if err != nil {
+		t.Fatalf("Expected excluded fifo to be skipped: %s", err)
+	}
+	img.Remove()
+}
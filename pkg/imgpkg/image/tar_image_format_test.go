@@ -0,0 +1,88 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTarImageUsesConfiguredFormat(t *testing.T) {
+	longName := strings.Repeat("long-dir-name/", 20) + "file.yml"
+
+	cases := []struct {
+		Format         tar.Format
+		Name           string
+		ExpectedFormat tar.Format
+		ExpectedErr    string
+	}{
+		{tar.FormatUSTAR, "file.yml", tar.FormatUSTAR, ""},
+		{tar.FormatUSTAR, longName, tar.FormatUnknown, "Expected entry 'long-dir-name/long-dir-name/"},
+		{tar.FormatGNU, "file.yml", tar.FormatGNU, ""},
+		{tar.FormatGNU, longName, tar.FormatGNU, ""},
+		// PAX extended headers are only written when needed (USTAR header is valid PAX)
+		{tar.FormatPAX, "file.yml", tar.FormatUSTAR, ""},
+		{tar.FormatPAX, longName, tar.FormatPAX, ""},
+	}
+
+	for _, tc := range cases {
+		dir, err := ioutil.TempDir("", "imgpkg-tar-image-format")
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+		defer os.RemoveAll(dir)
+
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dir, tc.Name)), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, tc.Name), []byte("content"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+
+		tarFile, err := ioutil.TempFile("", "imgpkg-tar-image-format")
+		if err != nil {
+			t.Fatalf("Creating tar file: %s", err)
+		}
+		defer os.Remove(tarFile.Name())
+		defer tarFile.Close()
+
+		img := &TarImage{opts: TarImageOpts{Format: tc.Format}, infoLog: ioutil.Discard}
+
+		err = img.createTarball(tarFile, []TarImageSource{{Path: filepath.Join(dir, tc.Name), Name: tc.Name}})
+		if len(tc.ExpectedErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.ExpectedErr) {
+				t.Fatalf("Expected %s format with name '%s' to fail with '%s', but was: %v", tc.Format, tc.Name, tc.ExpectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Creating %s tarball: %s", tc.Format, err)
+		}
+
+		_, err = tarFile.Seek(0, io.SeekStart)
+		if err != nil {
+			t.Fatalf("Seeking tar file: %s", err)
+		}
+
+		hdr, err := tar.NewReader(tarFile).Next()
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		if hdr.Name != tc.Name {
+			t.Fatalf("Expected entry '%s', but was '%s'", tc.Name, hdr.Name)
+		}
+		if hdr.Format&tc.ExpectedFormat == 0 {
+			t.Fatalf("Expected entry '%s' to use %s format, but was %s", tc.Name, tc.ExpectedFormat, hdr.Format)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	composedName   = "caf\u00e9.yml"  // e with acute accent as single code point
+	decomposedName = "cafe\u0301.yml" // e followed by combining acute accent
+)
+
+func TestTarEntryNameUsesForwardSlashes(t *testing.T) {
+	cases := []struct {
+		Path      string
+		Separator rune
+		Expected  string
+	}{
+		{`app\config\file.yml`, '\\', "app/config/file.yml"},
+		{`app\file.yml`, '\\', "app/file.yml"},
+		{"app/config/file.yml", '/', "app/config/file.yml"},
+		// Backslash is a valid file name character when it is not a separator
+		{`app/back\slash.yml`, '/', `app/back\slash.yml`},
+	}
+
+	for _, tc := range cases {
+		name := tarEntryName(tc.Path, tc.Separator, false)
+		if name != tc.Expected {
+			t.Fatalf("Expected '%s' to become '%s', but was '%s'", tc.Path, tc.Expected, name)
+		}
+	}
+}
+
+func TestTarEntryNameNormalizesUnicodeWhenEnabled(t *testing.T) {
+	if name := tarEntryName(`dir\`+decomposedName, '\\', true); name != "dir/"+composedName {
+		t.Fatalf("Expected decomposed name to be composed, but was '%q'", name)
+	}
+	if name := tarEntryName("dir/"+composedName, '/', true); name != "dir/"+composedName {
+		t.Fatalf("Expected composed name to stay the same, but was '%q'", name)
+	}
+	if name := tarEntryName("dir/"+decomposedName, '/', false); name != "dir/"+decomposedName {
+		t.Fatalf("Expected name to not be normalized by default, but was '%q'", name)
+	}
+}
+
+func TestTarImageNormalizesUnicodeFileNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgpkg-tar-image-unicode")
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "config"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "config", decomposedName), []byte("content"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	for _, normalize := range []bool{false, true} {
+		tarFile, err := ioutil.TempFile("", "imgpkg-tar-image-unicode")
+		if err != nil {
+			t.Fatalf("Creating tar file: %s", err)
+		}
+		defer os.Remove(tarFile.Name())
+
+		img := &TarImage{opts: TarImageOpts{Prefix: "app", NormalizeUnicode: normalize}, infoLog: ioutil.Discard}
+
+		err = img.createTarball(tarFile, []TarImageSource{{Path: dir}})
+		if err != nil {
+			t.Fatalf("Creating tarball: %s", err)
+		}
+
+		_, err = tarFile.Seek(0, io.SeekStart)
+		if err != nil {
+			t.Fatalf("Seeking tar file: %s", err)
+		}
+
+		var names []string
+		tarReader := tar.NewReader(tarFile)
+
+		for {
+			hdr, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Reading tar: %s", err)
+			}
+			names = append(names, hdr.Name)
+		}
+
+		tarFile.Close()
+
+		expectedName := decomposedName
+		if normalize {
+			expectedName = composedName
+		}
+
+		expectedNames := strings.Join([]string{"app", "app/config", "app/config/" + expectedName}, " ")
+		if strings.Join(names, " ") != expectedNames {
+			t.Fatalf("Expected entries '%q' (normalize: %t), but was '%q'", expectedNames, normalize, strings.Join(names, " "))
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctlimg "github.com/k14s/imgpkg/pkg/imgpkg/image"
+)
+
+func TestTarImageSkipsFilesOverMaxSize(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-max-size")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	files := map[string]string{
+		"small.yml": "key: value",
+		"large.bin": strings.Repeat("x", 1024),
+	}
+
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(inputDir, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	var infoLog bytes.Buffer
+
+	img, err := ctlimg.NewTarImage([]string{inputDir}, nil, ctlimg.TarImageOpts{MaxFileSize: 100}, &infoLog).AsFileImage()
+	if err != nil {
+		t.Fatalf("Expected packaging to succeed: %s", err)
+	}
+	defer img.Remove()
+
+	entries := tarEntryNames(t, img)
+
+	if strings.Join(entries, ",") != ".,small.yml" {
+		t.Fatalf("Expected large file to be skipped, got entries: %v", entries)
+	}
+
+	expectedLog := "skipping file: large.bin (size 1024 bytes exceeds max file size 100 bytes)"
+	if !strings.Contains(infoLog.String(), expectedLog) {
+		t.Fatalf("Expected log to contain '%s', got: %s", expectedLog, infoLog.String())
+	}
+}
+
+func TestTarImagePrefixesEntries(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-prefix")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	err = os.Mkdir(filepath.Join(inputDir, "config"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(inputDir, "config", "app.yml"), []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	img, err := ctlimg.NewTarImage([]string{inputDir}, nil, ctlimg.TarImageOpts{Prefix: "./app//nested/"}, ioutil.Discard).AsFileImage()
+	if err != nil {
+		t.Fatalf("Expected packaging to succeed: %s", err)
+	}
+	defer img.Remove()
+
+	entries := tarEntryNames(t, img)
+	expectedEntries := []string{"app/nested", "app/nested/config", "app/nested/config/app.yml"}
+
+	if strings.Join(entries, ",") != strings.Join(expectedEntries, ",") {
+		t.Fatalf("Expected entries to carry prefix, got: %v", entries)
+	}
+
+	for _, prefix := range []string{"..", "app/../..", "/app", "."} {
+		_, err := ctlimg.NewTarImage([]string{inputDir}, nil, ctlimg.TarImageOpts{Prefix: prefix}, ioutil.Discard).AsFileImage()
+		if err == nil {
+			t.Fatalf("Expected prefix '%s' to be rejected", prefix)
+		}
+	}
+}
+
+func TestTarImagePreservesMtimeWhenRequested(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-mtime")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	filePath := filepath.Join(inputDir, "app.yml")
+	mtime := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	err = ioutil.WriteFile(filePath, []byte("key: value"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	err = os.Chtimes(filePath, mtime, mtime)
+	if err != nil {
+		t.Fatalf("Setting file mtime: %s", err)
+	}
+
+	for _, preserve := range []bool{false, true} {
+		img, err := ctlimg.NewTarImage([]string{filePath}, nil, ctlimg.TarImageOpts{PreserveMtime: preserve}, ioutil.Discard).AsFileImage()
+		if err != nil {
+			t.Fatalf("Expected packaging to succeed: %s", err)
+		}
+		defer img.Remove()
+
+		layers, err := img.Layers()
+		if err != nil {
+			t.Fatalf("Getting layers: %s", err)
+		}
+
+		stream, err := layers[0].Uncompressed()
+		if err != nil {
+			t.Fatalf("Getting layer contents: %s", err)
+		}
+		defer stream.Close()
+
+		hdr, err := tar.NewReader(stream).Next()
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		if hdr.ModTime.Equal(mtime) != preserve {
+			t.Fatalf("Expected mtime to be preserved only when requested (preserve %t), but was %s", preserve, hdr.ModTime)
+		}
+	}
+}
+
+func TestTarImageRecordsConfiguredMtimeForAllEntries(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-static-mtime")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	err = os.Mkdir(filepath.Join(inputDir, "config"), 0700)
+	if err != nil {
+		t.Fatalf("Creating dir: %s", err)
+	}
+
+	for _, name := range []string{"README.md", "config/app.yml"} {
+		err := ioutil.WriteFile(filepath.Join(inputDir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	img, err := ctlimg.NewTarImage([]string{inputDir}, nil, ctlimg.TarImageOpts{Mtime: mtime}, ioutil.Discard).AsFileImage()
+	if err != nil {
+		t.Fatalf("Expected packaging to succeed: %s", err)
+	}
+	defer img.Remove()
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	stream, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("Getting layer contents: %s", err)
+	}
+	defer stream.Close()
+
+	tarReader := tar.NewReader(stream)
+	entries := 0
+
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+
+		entries++
+
+		if !hdr.ModTime.Equal(mtime) {
+			t.Fatalf("Expected entry '%s' to have mtime %s, but was %s", hdr.Name, mtime, hdr.ModTime)
+		}
+	}
+
+	if entries != 4 {
+		t.Fatalf("Expected 4 entries, but was %d", entries)
+	}
+}
+
+func TestTarImageExcludesWithReincludesInOrder(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-excludes")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	for _, dir := range []string{"logs", filepath.Join("logs", "nested")} {
+		err := os.Mkdir(filepath.Join(inputDir, dir), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+	}
+
+	for _, name := range []string{"app.yml", "logs/keep.log", "logs/other.log", "logs/nested/keep.log"} {
+		err := ioutil.WriteFile(filepath.Join(inputDir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	cases := []struct {
+		Excludes        []string
+		ExpectedEntries []string
+	}{
+		{
+			Excludes:        []string{"logs", "!logs/keep.log"},
+			ExpectedEntries: []string{".", "app.yml", "logs/keep.log"},
+		},
+		{
+			Excludes:        []string{"logs", "!logs/nested", "logs/nested/keep.log", "!logs/keep.log"},
+			ExpectedEntries: []string{".", "app.yml", "logs/keep.log", "logs/nested"},
+		},
+		{
+			// Later exclude wins over earlier re-include
+			Excludes:        []string{"!logs/keep.log", "logs"},
+			ExpectedEntries: []string{".", "app.yml"},
+		},
+	}
+
+	for _, tc := range cases {
+		sources := []ctlimg.TarImageSource{{Path: inputDir, ExcludePaths: tc.Excludes}}
+
+		img, err := ctlimg.NewTarImageFromSources(sources, nil, ctlimg.TarImageOpts{}, ioutil.Discard).AsFileImage()
+		if err != nil {
+			t.Fatalf("Expected packaging to succeed: %s", err)
+		}
+		defer img.Remove()
+
+		entries := tarEntryNames(t, img)
+
+		if strings.Join(entries, ",") != strings.Join(tc.ExpectedEntries, ",") {
+			t.Fatalf("Expected entries %v with excludes %v, but was: %v", tc.ExpectedEntries, tc.Excludes, entries)
+		}
+	}
+}
+
+func TestTarImageSkipsEmptyDirsWhenRequested(t *testing.T) {
+	inputDir, err := ioutil.TempDir("", "imgpkg-tar-image-empty-dirs")
+	if err != nil {
+		t.Fatalf("Creating input dir: %s", err)
+	}
+	defer os.RemoveAll(inputDir)
+
+	for _, dir := range []string{"config", "empty", filepath.Join("empty", "nested"), "logs"} {
+		err := os.Mkdir(filepath.Join(inputDir, dir), 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+	}
+
+	for _, name := range []string{"config/app.yml", "logs/debug.log"} {
+		err := ioutil.WriteFile(filepath.Join(inputDir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	cases := []struct {
+		SkipEmptyDirs   bool
+		ExpectedEntries []string
+	}{
+		{false, []string{".", "config", "config/app.yml", "empty", "empty/nested", "logs"}},
+		// logs/ becomes empty after excluding its only file
+		{true, []string{".", "config", "config/app.yml"}},
+	}
+
+	for _, tc := range cases {
+		sources := []ctlimg.TarImageSource{{Path: inputDir, ExcludePaths: []string{"logs/debug.log"}}}
+
+		img, err := ctlimg.NewTarImageFromSources(sources, nil, ctlimg.TarImageOpts{SkipEmptyDirs: tc.SkipEmptyDirs}, ioutil.Discard).AsFileImage()
+		if err != nil {
+			t.Fatalf("Expected packaging to succeed: %s", err)
+		}
+		defer img.Remove()
+
+		entries := tarEntryNames(t, img)
+
+		if strings.Join(entries, ",") != strings.Join(tc.ExpectedEntries, ",") {
+			t.Fatalf("Expected entries %v (skip empty dirs: %t), but was: %v", tc.ExpectedEntries, tc.SkipEmptyDirs, entries)
+		}
+	}
+}
+
+func tarEntryNames(t *testing.T, img *ctlimg.FileImage) []string {
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	stream, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatalf("Getting layer contents: %s", err)
+	}
+	defer stream.Close()
+
+	var names []string
+
+	tarReader := tar.NewReader(stream)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Reading tar: %s", err)
+		}
+		names = append(names, hdr.Name)
+	}
+
+	return names
+}
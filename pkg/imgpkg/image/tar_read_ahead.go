@@ -0,0 +1,120 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+
+	"github.com/k14s/imgpkg/pkg/imgpkg/util"
+)
+
+// readAheadTarEntries overlaps reading of small files with writing
+// of preceding entries; entries are still written in walk order
+// by a single goroutine since tar writing is serial
+type readAheadTarEntries struct {
+	image     *TarImage
+	tarWriter *tar.Writer
+	throttle  util.Throttle
+
+	// entries is bounded to limit contents held in memory
+	entries chan readAheadEntry
+	written chan struct{}
+	failed  chan struct{}
+	err     error
+}
+
+type readAheadEntry struct {
+	dir       bool
+	fullPath  string
+	relPath   string
+	info      os.FileInfo
+	readAhead <-chan readAheadContents
+}
+
+type readAheadContents struct {
+	Data []byte
+	Err  error
+}
+
+func newReadAheadTarEntries(image *TarImage, tarWriter *tar.Writer, readAhead int) *readAheadTarEntries {
+	e := &readAheadTarEntries{
+		image:     image,
+		tarWriter: tarWriter,
+		throttle:  util.NewThrottle(readAhead),
+		entries:   make(chan readAheadEntry, readAhead),
+		written:   make(chan struct{}),
+		failed:    make(chan struct{}),
+	}
+	go e.write()
+	return e
+}
+
+func (e *readAheadTarEntries) AddDir(relPath string, info os.FileInfo) error {
+	return e.enqueue(readAheadEntry{dir: true, relPath: relPath, info: info})
+}
+
+func (e *readAheadTarEntries) AddFile(fullPath, relPath string, info os.FileInfo) error {
+	entry := readAheadEntry{fullPath: fullPath, relPath: relPath, info: info}
+
+	if e.readsAhead(info) {
+		readAhead := make(chan readAheadContents, 1)
+		entry.readAhead = readAhead
+
+		go func() {
+			e.throttle.Take()
+			defer e.throttle.Done()
+
+			data, err := ioutil.ReadFile(fullPath)
+			readAhead <- readAheadContents{Data: data, Err: err}
+		}()
+	}
+
+	return e.enqueue(entry)
+}
+
+// Close waits for all queued entries to be written
+func (e *readAheadTarEntries) Close() error {
+	close(e.entries)
+	<-e.written
+	return e.err
+}
+
+// readsAhead skips files that would not be written or
+// that would hold too much memory while queued
+func (e *readAheadTarEntries) readsAhead(info os.FileInfo) bool {
+	return (info.Mode()&os.ModeType) == 0 && !e.image.exceedsMaxFileSize(info) &&
+		info.Size() <= int64(e.image.copyBufferSize())
+}
+
+func (e *readAheadTarEntries) enqueue(entry readAheadEntry) error {
+	select {
+	case e.entries <- entry:
+		return nil
+	case <-e.failed:
+		return e.err
+	}
+}
+
+func (e *readAheadTarEntries) write() {
+	defer close(e.written)
+
+	for entry := range e.entries {
+		if e.err != nil {
+			continue // drain remaining entries after failure
+		}
+
+		var err error
+		if entry.dir {
+			err = e.image.addDirToTar(entry.relPath, entry.info, e.tarWriter)
+		} else {
+			err = e.image.addFileContentsToTar(entry.fullPath, entry.relPath, entry.info, entry.readAhead, e.tarWriter)
+		}
+		if err != nil {
+			e.err = err
+			close(e.failed)
+		}
+	}
+}
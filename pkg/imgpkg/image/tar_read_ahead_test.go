@@ -0,0 +1,125 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarImageReadAheadKeepsSerialOutput(t *testing.T) {
+	dir := writeManyFilesTree(t, 10, 30)
+	defer os.RemoveAll(dir)
+
+	// Files larger than copy buffer are not read ahead
+	err := ioutil.WriteFile(filepath.Join(dir, "dir-0", "large.bin"), bytes.Repeat([]byte("l"), 64*1024), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	var tarballs [][]byte
+
+	for _, readAhead := range []int{0, 4, 64} {
+		opts := TarImageOpts{ReadAhead: readAhead, CopyBufferSize: 32 * 1024}
+		tarballs = append(tarballs, createTestTarball(t, dir, opts))
+	}
+
+	for i, tarball := range tarballs[1:] {
+		if !bytes.Equal(tarballs[0], tarball) {
+			t.Fatalf("Expected tarball with read ahead (case %d) to match serially written tarball", i+1)
+		}
+	}
+}
+
+func TestTarImageReadAheadReportsWriteErrors(t *testing.T) {
+	dir := writeManyFilesTree(t, 2, 10)
+	defer os.RemoveAll(dir)
+
+	img := &TarImage{
+		sources: []TarImageSource{{Path: dir}},
+		opts:    TarImageOpts{ReadAhead: 4},
+		infoLog: ioutil.Discard,
+	}
+
+	file, err := ioutil.TempFile("", "imgpkg-tar-read-ahead")
+	if err != nil {
+		t.Fatalf("Creating temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	// Writing into closed file fails for the first entry
+	file.Close()
+
+	err = img.createTarball(file, img.sources)
+	if err == nil {
+		t.Fatalf("Expected writing into closed file to fail")
+	}
+}
+
+func BenchmarkTarImageManyFiles(b *testing.B) {
+	dir := writeManyFilesTree(b, 20, 250)
+	defer os.RemoveAll(dir)
+
+	for _, readAhead := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("read-ahead-%d", readAhead), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				createTestTarball(b, dir, TarImageOpts{ReadAhead: readAhead})
+			}
+		})
+	}
+}
+
+func writeManyFilesTree(t testing.TB, dirs, filesPerDir int) string {
+	root, err := ioutil.TempDir("", "imgpkg-tar-many-files")
+	if err != nil {
+		t.Fatalf("Creating temp dir: %s", err)
+	}
+
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir-%d", d))
+
+		err := os.Mkdir(dir, 0700)
+		if err != nil {
+			t.Fatalf("Creating dir: %s", err)
+		}
+
+		for f := 0; f < filesPerDir; f++ {
+			contents := bytes.Repeat([]byte(fmt.Sprintf("%d-%d ", d, f)), 100+f)
+
+			err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%d", f)), contents, 0600)
+			if err != nil {
+				t.Fatalf("Writing file: %s", err)
+			}
+		}
+	}
+
+	return root
+}
+
+func createTestTarball(t testing.TB, dir string, opts TarImageOpts) []byte {
+	file, err := ioutil.TempFile("", "imgpkg-tar-read-ahead")
+	if err != nil {
+		t.Fatalf("Creating temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	img := &TarImage{sources: []TarImageSource{{Path: dir}}, opts: opts, infoLog: ioutil.Discard}
+
+	err = img.createTarball(file, img.sources)
+	if err != nil {
+		t.Fatalf("Creating tarball: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatalf("Reading tarball: %s", err)
+	}
+
+	return contents
+}
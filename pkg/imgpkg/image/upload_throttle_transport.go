@@ -0,0 +1,31 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"net/http"
+
+	"github.com/k14s/imgpkg/pkg/imgpkg/util"
+)
+
+// uploadThrottleTransport bounds number of upload (write) requests in flight,
+// since go-containerregistry uploads all layers of an image in parallel
+type uploadThrottleTransport struct {
+	http.RoundTripper
+	throttle util.Throttle
+}
+
+func newUploadThrottleTransport(tran http.RoundTripper, max int) uploadThrottleTransport {
+	return uploadThrottleTransport{tran, util.NewThrottle(max)}
+}
+
+func (t uploadThrottleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		t.throttle.Take()
+		defer t.throttle.Done()
+	}
+
+	return t.RoundTripper.RoundTrip(req)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// whiteoutFS is filesystem into which layers are merged (e.g. output directory)
+type whiteoutFS interface {
+	// ReadDirNames returns no names for missing directory
+	ReadDirNames(dir string) ([]string, error)
+	RemoveAll(path string) error
+	Join(elem ...string) string
+}
+
+// applyWhiteout removes file or directory from previous layers following
+// overlayfs semantics (https://github.com/opencontainers/image-spec/blob/master/layer.md#whiteouts):
+// '.wh.<name>' removes sibling <name>, '.wh..wh..opq' removes all siblings
+// except for paths added by current layer
+func applyWhiteout(fsys whiteoutFS, dir, base string, layerPaths map[string]bool) error {
+	if base == whiteoutOpaque {
+		names, err := fsys.ReadDirNames(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			entryPath := fsys.Join(dir, name)
+			if layerPaths[entryPath] {
+				continue
+			}
+
+			err := fsys.RemoveAll(entryPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	name := strings.TrimPrefix(base, whiteoutPrefix)
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("Expected whiteout to name a file or directory")
+	}
+
+	return fsys.RemoveAll(fsys.Join(dir, name))
+}
+
+type osWhiteoutFS struct{}
+
+var _ whiteoutFS = osWhiteoutFS{}
+
+func (osWhiteoutFS) ReadDirNames(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+func (osWhiteoutFS) RemoveAll(path string) error { return os.RemoveAll(path) }
+func (osWhiteoutFS) Join(elem ...string) string  { return filepath.Join(elem...) }